@@ -0,0 +1,113 @@
+package cachesaver
+
+import (
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+// SaveOptions configures the cache written by [Convert].
+type SaveOptions struct {
+	// Format is the output format: "v1", "v2" or "v3".
+	Format string
+	// Threads bounds the threads sorting the KD-trees of v2 and v3 caches.
+	Threads int
+	// MaxMemory bounds the memory used to build v2 and v3 caches when
+	// positive, points are spilled to TempDir, see [savev2.SaveExternal].
+	MaxMemory int64
+	TempDir   string
+}
+
+// ConvertOptions configures [Convert].
+type ConvertOptions struct {
+	SaveOptions
+	// LegacyMetadata is written for legacy caches, which have no metadata.
+	LegacyMetadata cachemodel.Metadata
+}
+
+// Convert streams the points and zones of a cache of any format read from r
+// into a cache of opts.Format written to w.  The v3 format needs w to be an
+// [io.WriteSeeker].
+func Convert(r io.Reader, w io.Writer, opts ConvertOptions, log *slog.Logger) error {
+	pointsIter, zonesIter, metadata, err := LoadSeq(r, log)
+	if err != nil {
+		return err
+	}
+	meta := opts.LegacyMetadata
+	if metadata != nil {
+		meta = *metadata
+	}
+
+	// the savers take plain sequences, a read error stops them and is
+	// returned instead of their result
+	var loadErr error
+	points := func(yield func(cachemodel.Point) bool) {
+		for p, err := range pointsIter {
+			if err != nil {
+				loadErr = fmt.Errorf("error reading point: %w", err)
+				return
+			}
+			if !yield(p) {
+				return
+			}
+		}
+	}
+	zones := func(yield func(cachemodel.Zone) bool) {
+		if loadErr != nil {
+			return
+		}
+		for z, err := range zonesIter {
+			if err != nil {
+				loadErr = fmt.Errorf("error reading zone: %w", err)
+				return
+			}
+			if !yield(z) {
+				return
+			}
+		}
+	}
+
+	err = save(points, zones, meta, w, opts.SaveOptions)
+	if loadErr != nil {
+		return loadErr
+	}
+	return err
+}
+
+// save writes a cache of opts.Format, the v3 format needs w to be an
+// [io.WriteSeeker].
+func save(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, w io.Writer, opts SaveOptions) error {
+	threads := max(opts.Threads, 1)
+	external := savev2.ExternalOptions{
+		MaxMemory: opts.MaxMemory,
+		TempDir:   opts.TempDir,
+		Threads:   threads,
+	}
+	switch opts.Format {
+	case "v1":
+		return SaveV1(points, zones, meta, w)
+	case "v2":
+		if opts.MaxMemory > 0 {
+			return SaveV2External(points, zones, meta, w, external)
+		}
+		return SaveV2(points, zones, meta, w, kdbush.WithThreads(threads))
+	case "v3":
+		ws, ok := w.(io.WriteSeeker)
+		if !ok {
+			return fmt.Errorf("v3 format needs a seekable writer, got %T", w)
+		}
+		saveOpts := savev3.Options{Build: []kdbush.BuildOption{kdbush.WithThreads(threads)}}
+		if opts.MaxMemory > 0 {
+			saveOpts.External = &external
+		}
+		return SaveV3(points, zones, meta, ws, saveOpts)
+	default:
+		return fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+}
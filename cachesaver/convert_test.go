@@ -0,0 +1,151 @@
+package cachesaver
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"github.com/royalcat/rgeocache/geomodel"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+var discardLog = slog.New(slog.DiscardHandler)
+
+func testCache() ([]cachemodel.Point, []cachemodel.Zone, cachemodel.Metadata) {
+	var points []cachemodel.Point
+	for i := range 300 {
+		points = append(points, cachemodel.Point{X: 55 + float64(i)*0.001, Y: 37 + float64(i)*0.002, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Street " + strconv.Itoa(i%4)),
+			HouseNumber: unique.Make(strconv.Itoa(i)),
+			City:        unique.Make("City"),
+			Region:      unique.Make("Region"),
+			Weight:      uint8(i % 10),
+		}})
+	}
+	zones := []cachemodel.Zone{{
+		Type:    cachemodel.ZoneRegion,
+		Name:    unique.Make("Region"),
+		Bounds:  orb.Bound{Min: orb.Point{30, 50}, Max: orb.Point{40, 60}},
+		Polygon: orb.MultiPolygon{{{{30, 50}, {40, 50}, {40, 60}, {30, 50}}}},
+	}}
+	meta := cachemodel.Metadata{Version: 7, Locale: "ru", DateCreated: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)}
+	return points, zones, meta
+}
+
+func checkConverted(t *testing.T, b []byte, wantZones int, wantMeta cachemodel.Metadata) {
+	t.Helper()
+	want, _, _ := testCache()
+	points, zones, meta, err := LoadFromReaderWithMetadata(bytes.NewReader(b), discardLog)
+	if err != nil {
+		t.Fatalf("loading converted cache: %v", err)
+	}
+	if len(points) != len(want) {
+		t.Fatalf("%d points, want %d", len(points), len(want))
+	}
+	for i, p := range points {
+		// v2 and v3 store fixed-point coordinates
+		if math.Abs(p.X-want[i].X) > 1e-6 || math.Abs(p.Y-want[i].Y) > 1e-6 ||
+			p.Data.Street != want[i].Data.Street || p.Data.HouseNumber != want[i].Data.HouseNumber || p.Data.Weight != want[i].Data.Weight {
+			t.Fatalf("point %d = %+v, want %+v", i, p, want[i])
+		}
+	}
+	if len(zones) != wantZones {
+		t.Errorf("%d zones, want %d", len(zones), wantZones)
+	}
+	if meta == nil || meta.Locale != wantMeta.Locale || !meta.DateCreated.Equal(wantMeta.DateCreated) {
+		t.Errorf("metadata = %+v, want %+v", meta, wantMeta)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	points, zones, meta := testCache()
+
+	var v1 bytes.Buffer
+	if err := SaveV1(slices.Values(points), slices.Values(zones), meta, &v1); err != nil {
+		t.Fatal(err)
+	}
+
+	// every output format from v1, then back to v1 from each of them
+	for _, format := range []string{"v1", "v2", "v3"} {
+		t.Run(format, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), format+".rgc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := Convert(bytes.NewReader(v1.Bytes()), f, ConvertOptions{SaveOptions: SaveOptions{Format: format}}, discardLog); err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			converted, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkConverted(t, converted, len(zones), meta)
+
+			var back bytes.Buffer
+			if err := Convert(bytes.NewReader(converted), &back, ConvertOptions{SaveOptions: SaveOptions{Format: "v1"}}, discardLog); err != nil {
+				t.Fatalf("Convert back: %v", err)
+			}
+			checkConverted(t, back.Bytes(), len(zones), meta)
+		})
+	}
+}
+
+func TestConvertLegacy(t *testing.T) {
+	points, _, _ := testCache()
+	legacy := make([]kdbush.Point[geomodel.Info], len(points))
+	for i, p := range points {
+		legacy[i] = kdbush.Point[geomodel.Info]{X: p.X, Y: p.Y, Data: geomodel.Info{
+			Street:      p.Data.Street.Value(),
+			HouseNumber: p.Data.HouseNumber.Value(),
+			City:        p.Data.City.Value(),
+			Region:      p.Data.Region.Value(),
+			Weight:      p.Data.Weight,
+		}}
+	}
+	var gobCache bytes.Buffer
+	if err := gob.NewEncoder(&gobCache).Encode(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	legacyMeta := cachemodel.Metadata{DateCreated: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var v2 bytes.Buffer
+	err := Convert(&gobCache, &v2, ConvertOptions{
+		SaveOptions:    SaveOptions{Format: "v2", MaxMemory: 4 << 10, TempDir: t.TempDir()},
+		LegacyMetadata: legacyMeta,
+	}, discardLog)
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	checkConverted(t, v2.Bytes(), 0, legacyMeta)
+}
+
+func TestConvertErrors(t *testing.T) {
+	points, zones, meta := testCache()
+	var v2 bytes.Buffer
+	if err := SaveV2(slices.Values(points), slices.Values(zones), meta, &v2); err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := v2.Bytes()[:v2.Len()-10]
+	if err := Convert(bytes.NewReader(truncated), &bytes.Buffer{}, ConvertOptions{SaveOptions: SaveOptions{Format: "v1"}}, discardLog); err == nil {
+		t.Error("Convert of a truncated cache succeeded")
+	}
+	if err := Convert(bytes.NewReader(v2.Bytes()), &bytes.Buffer{}, ConvertOptions{SaveOptions: SaveOptions{Format: "v3"}}, discardLog); err == nil {
+		t.Error("Convert to v3 without a seekable writer succeeded")
+	}
+	if err := Convert(bytes.NewReader(v2.Bytes()), &bytes.Buffer{}, ConvertOptions{SaveOptions: SaveOptions{Format: "v9"}}, discardLog); err == nil {
+		t.Error("Convert to an unknown format succeeded")
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
 	"log/slog"
 	"runtime"
 
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	savev1 "github.com/royalcat/rgeocache/cachesaver/save/v1"
 	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
 	"github.com/royalcat/rgeocache/kdbush"
 )
 
@@ -34,13 +36,49 @@ func readCompatabilityLevel(reader io.Reader) (uint32, error) {
 }
 
 func LoadFromReader(reader io.Reader, log *slog.Logger) ([]kdbush.Point[cachemodel.Info], []cachemodel.Zone, error) {
+	points, zones, _, err := LoadFromReaderWithMetadata(reader, log)
+	return points, zones, err
+}
+
+// LoadFromReaderWithMetadata is [LoadFromReader] also returning the cache metadata,
+// metadata is nil for legacy caches.
+func LoadFromReaderWithMetadata(reader io.Reader, log *slog.Logger) ([]kdbush.Point[cachemodel.Info], []cachemodel.Zone, *cachemodel.Metadata, error) {
 	defer func() {
 		runtime.GC()
 	}()
 
+	pointsIter, zonesIter, metadata, err := LoadSeq(reader, log)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	points := make([]kdbush.Point[cachemodel.Info], 0, 128)
+	for point, err := range pointsIter {
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error reading point: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	zones := make([]cachemodel.Zone, 0, 128)
+	for zone, err := range zonesIter {
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error reading zone: %w", err)
+		}
+		zones = append(zones, zone)
+	}
+
+	return points, zones, metadata, nil
+}
+
+// LoadSeq reads a cache of any format like [LoadFromReaderWithMetadata] but
+// streams the points and zones, zones have to be read after the points.
+// Legacy caches are decoded as a whole, they have no zones and their
+// metadata is nil.
+func LoadSeq(reader io.Reader, log *slog.Logger) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel.Zone, error], *cachemodel.Metadata, error) {
 	magic, err := readMagicBytes(reader)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// If the magic bytes are not equal to the expected value, we assume it's a legacy format
@@ -48,41 +86,45 @@ func LoadFromReader(reader io.Reader, log *slog.Logger) ([]kdbush.Point[cachemod
 		log.Info("Magic bytes not detected, trying legacy format")
 		points, err := legacyLoader(io.MultiReader(bytes.NewReader(magic), reader))
 		if err != nil {
-			return nil, nil, fmt.Errorf("error loading legacy cache: %s", err.Error())
+			return nil, nil, nil, fmt.Errorf("error loading legacy cache: %s", err.Error())
+		}
+		pointsIter := func(yield func(cachemodel.Point, error) bool) {
+			for _, p := range points {
+				if !yield(p, nil) {
+					return
+				}
+			}
 		}
-		return points, []cachemodel.Zone{}, nil
+		zonesIter := func(yield func(cachemodel.Zone, error) bool) {}
+		return pointsIter, zonesIter, nil, nil
 	}
 
 	compatibilityLevel, err := readCompatabilityLevel(reader)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
+	var load func(io.Reader) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel.Zone, error], *cachemodel.Metadata, error)
 	switch compatibilityLevel {
 	case savev1.COMPATIBILITY_LEVEL:
-		log.Info("Loading v1 cache format")
-		points, zones, metadata, err := loadV1Cache(reader)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error loading v1 cache: %s", err.Error())
-		}
-		if metadata != nil {
-			log.Info("Loaded cache metadata", "version", metadata.Version, "locale", metadata.Locale, "date_created", metadata.DateCreated)
-		}
-		return points, zones, nil
+		load = savev1.Load
 	case savev2.COMPATIBILITY_LEVEL:
-		log.Info("Loading v2 cache format")
-		points, zones, metadata, err := loadV2Cache(reader)
-		if err != nil {
-			return nil, nil, fmt.Errorf("error loading v2 cache: %s", err.Error())
-		}
-		if metadata != nil {
-			log.Info("Loaded cache metadata", "version", metadata.Version, "locale", metadata.Locale, "date_created", metadata.DateCreated)
-		}
-		return points, zones, nil
+		load = savev2.Load
+	case savev3.COMPATIBILITY_LEVEL:
+		load = savev3.Load
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported compatibility level: %d", compatibilityLevel)
 	}
 
-	return nil, nil, fmt.Errorf("unsupported compatibility level: %d", compatibilityLevel)
-
+	log.Info(fmt.Sprintf("Loading v%d cache format", compatibilityLevel))
+	pointsIter, zonesIter, metadata, err := load(reader)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error loading v%d cache: %w", compatibilityLevel, err)
+	}
+	if metadata != nil {
+		log.Info("Loaded cache metadata", "version", metadata.Version, "locale", metadata.Locale, "date_created", metadata.DateCreated)
+	}
+	return pointsIter, zonesIter, metadata, nil
 }
 
 func PrintCacheSizeAnalysis(r io.Reader) error {
@@ -105,6 +147,9 @@ func PrintCacheSizeAnalysis(r io.Reader) error {
 	case savev2.COMPATIBILITY_LEVEL:
 		slog.Info("Loading v2 cache format")
 		return savev2.PrintCacheAnalysis(r)
+	case savev3.COMPATIBILITY_LEVEL:
+		slog.Info("Loading v3 cache format")
+		return savev3.PrintCacheAnalysis(r)
 	default:
 		return fmt.Errorf("Cache version %d not supported", compatibilityLevel)
 	}
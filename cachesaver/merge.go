@@ -0,0 +1,217 @@
+package cachesaver
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+)
+
+// MergeInput is a cache read by [Merge].
+type MergeInput struct {
+	// Name is recorded in the sources of the merged metadata, usually the
+	// file name.
+	Name   string
+	Reader io.Reader
+	// LegacyMetadata stands for the metadata of a legacy cache, which has
+	// none.
+	LegacyMetadata cachemodel.Metadata
+}
+
+// MergeOptions configures [Merge].  There is no memory bound, the inputs
+// are decoded into memory anyway.
+type MergeOptions struct {
+	// Format is the output format: "v1", "v2" or "v3".
+	Format string
+	// Threads bounds the threads sorting the KD-trees of v2 and v3 caches.
+	Threads int
+	// DedupRadius is the distance in degrees under which points of different
+	// caches with the same name, street and house number are duplicates.
+	// Default: 0.0001, about 10 m.
+	DedupRadius float64
+}
+
+const defaultDedupRadius = 0.0001
+
+// Merge loads the caches read from inputs and writes the union of their
+// points and zones to w as a cache of opts.Format.
+//
+// Caches of neighbouring areas are usually cut with some overlap, so a point
+// near the bounds of another cache is dropped when a point of an earlier
+// input with the same address is within opts.DedupRadius.  The earlier point
+// is kept and takes the footprint of the dropped one if it has none.  Zones
+// of the same type and name from different caches are merged into one when
+// their bounds intersect, keeping every distinct polygon.
+//
+// The merged metadata takes the locale of the first input and the highest
+// version, and lists every input with its creation date as a source.
+//
+// Every input is decoded into memory before the merged cache is written, so
+// merging needs about the memory of loading all inputs at once.
+func Merge(inputs []MergeInput, w io.Writer, opts MergeOptions, log *slog.Logger) error {
+	if len(inputs) < 2 {
+		return fmt.Errorf("merge needs at least two caches, got %d", len(inputs))
+	}
+	radius := opts.DedupRadius
+	if radius <= 0 {
+		radius = defaultDedupRadius
+	}
+
+	pointSets := make([][]cachemodel.Point, len(inputs))
+	zoneSets := make([][]cachemodel.Zone, len(inputs))
+	meta := cachemodel.Metadata{DateCreated: time.Now().UTC()}
+	for i, in := range inputs {
+		points, zones, metadata, err := LoadFromReaderWithMetadata(in.Reader, log)
+		if err != nil {
+			return fmt.Errorf("error loading %s: %w", in.Name, err)
+		}
+		m := in.LegacyMetadata
+		if metadata != nil {
+			m = *metadata
+		}
+		if i == 0 {
+			meta.Locale = m.Locale
+		} else if m.Locale != meta.Locale {
+			log.Warn("Merging caches of different locales", "cache", in.Name, "locale", m.Locale, "merged_locale", meta.Locale)
+		}
+		meta.Version = max(meta.Version, m.Version)
+		meta.Sources = append(meta.Sources, cachemodel.Source{Name: in.Name, DateCreated: m.DateCreated})
+
+		pointSets[i], zoneSets[i] = points, zones
+		log.Info("Loaded cache to merge", "cache", in.Name, "points", len(points), "zones", len(zones))
+	}
+
+	points, duplicates := mergePoints(pointSets, radius)
+	zones, mergedZones := mergeZones(zoneSets)
+	log.Info("Merged caches", "points", len(points), "duplicate_points", duplicates, "zones", len(zones), "merged_zones", mergedZones)
+
+	return save(slices.Values(points), slices.Values(zones), meta, w, SaveOptions{Format: opts.Format, Threads: opts.Threads})
+}
+
+// mergePoints concatenates the point sets, dropping the points that duplicate
+// a point of an earlier set, and returns the number of dropped points.  Only
+// points within the bounds of another set, padded by radius, can be
+// duplicates, so only those are put in a grid of radius sized cells.
+func mergePoints(sets [][]cachemodel.Point, radius float64) ([]cachemodel.Point, int) {
+	bounds := make([]orb.Bound, len(sets))
+	for i, set := range sets {
+		if len(set) == 0 {
+			continue
+		}
+		b := orb.Bound{Min: orb.Point{set[0].X, set[0].Y}, Max: orb.Point{set[0].X, set[0].Y}}
+		for _, p := range set[1:] {
+			b = b.Extend(orb.Point{p.X, p.Y})
+		}
+		bounds[i] = b.Pad(radius)
+	}
+	nearOther := func(set int, p cachemodel.Point) bool {
+		for j, b := range bounds {
+			if j != set && len(sets[j]) > 0 && b.Contains(orb.Point{p.X, p.Y}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	type cell struct{ x, y int64 }
+	cellOf := func(p cachemodel.Point) cell {
+		return cell{int64(math.Floor(p.X / radius)), int64(math.Floor(p.Y / radius))}
+	}
+	// footprints are not comparable and follow the address, so they are left out of equality
+	sameAddress := func(a, b cachemodel.Info) bool {
+		return a.Name == b.Name && a.Street == b.Street && a.HouseNumber == b.HouseNumber
+	}
+
+	// indices of the merged points near another set
+	grid := map[cell][]int{}
+	duplicate := func(p cachemodel.Point, merged []cachemodel.Point) (int, bool) {
+		c := cellOf(p)
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for _, k := range grid[cell{c.x + dx, c.y + dy}] {
+					q := merged[k]
+					if sameAddress(p.Data, q.Data) && math.Hypot(p.X-q.X, p.Y-q.Y) <= radius {
+						return k, true
+					}
+				}
+			}
+		}
+		return 0, false
+	}
+
+	var merged []cachemodel.Point
+	duplicates := 0
+	for i, set := range sets {
+		var border []int
+		for _, p := range set {
+			if !nearOther(i, p) {
+				merged = append(merged, p)
+				continue
+			}
+			if k, ok := duplicate(p, merged); ok {
+				if merged[k].Data.Footprint == nil {
+					merged[k].Data.Footprint = p.Data.Footprint
+				}
+				duplicates++
+				continue
+			}
+			border = append(border, len(merged))
+			merged = append(merged, p)
+		}
+		// points of the same set are never compared, their duplicates were
+		// removed when the cache was generated
+		for _, k := range border {
+			c := cellOf(merged[k])
+			grid[c] = append(grid[c], k)
+		}
+	}
+	return merged, duplicates
+}
+
+// mergeZones concatenates the zone sets, merging a zone into a zone of the
+// same type and name from an earlier set when their bounds intersect, and
+// returns the number of merged zones.
+func mergeZones(sets [][]cachemodel.Zone) ([]cachemodel.Zone, int) {
+	type zoneKey struct {
+		typ  cachemodel.ZoneType
+		name unique.Handle[string]
+	}
+	index := map[zoneKey][]int{}
+	var merged []cachemodel.Zone
+	// the last set merged into each zone, zones of one set are never merged
+	var lastSet []int
+	count := 0
+	for i, set := range sets {
+		for _, z := range set {
+			key := zoneKey{z.Type, z.Name}
+			k := slices.IndexFunc(index[key], func(k int) bool {
+				return lastSet[k] != i && merged[k].Bounds.Intersects(z.Bounds)
+			})
+			if k < 0 {
+				// the polygons are appended to when merging, don't share the input's array
+				z.Polygon = slices.Clip(z.Polygon)
+				index[key] = append(index[key], len(merged))
+				merged = append(merged, z)
+				lastSet = append(lastSet, i)
+				continue
+			}
+
+			m := &merged[index[key][k]]
+			m.Bounds = m.Bounds.Union(z.Bounds)
+			for _, poly := range z.Polygon {
+				if !slices.ContainsFunc(m.Polygon, func(q orb.Polygon) bool { return orb.Equal(q, poly) }) {
+					m.Polygon = append(m.Polygon, poly)
+				}
+			}
+			lastSet[index[key][k]] = i
+			count++
+		}
+	}
+	return merged, count
+}
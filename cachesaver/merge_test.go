@@ -0,0 +1,127 @@
+package cachesaver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+)
+
+func TestMerge(t *testing.T) {
+	points, _, meta := testCache()
+	square := func(x, y float64) orb.Polygon {
+		return orb.Polygon{{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y}}}
+	}
+	country := cachemodel.Zone{
+		Type:    cachemodel.ZoneCountry,
+		Name:    unique.Make("Country"),
+		Bounds:  orb.Bound{Min: orb.Point{50, 30}, Max: orb.Point{60, 40}},
+		Polygon: orb.MultiPolygon{{{{50, 30}, {60, 30}, {60, 40}, {50, 30}}}},
+	}
+
+	// a covers points 0-199, b covers 150-299 with the overlap slightly moved
+	a := slices.Clone(points[:200])
+	b := slices.Clone(points[150:])
+	for i := range 50 {
+		b[i].X += 0.000001
+	}
+	b[20].Data.Footprint = orb.Ring{{b[20].X, b[20].Y}, {b[20].X + 0.0001, b[20].Y}, {b[20].X, b[20].Y + 0.0001}, {b[20].X, b[20].Y}}
+	other := points[160]
+	other.Data.HouseNumber = unique.Make("160a")
+	far := points[10]
+	far.X += 0.01
+	b = append(b, other, far)
+
+	zonesA := []cachemodel.Zone{country, {Type: cachemodel.ZoneRegion, Name: unique.Make("Region"),
+		Bounds: orb.Bound{Min: orb.Point{54, 36}, Max: orb.Point{55, 37}}, Polygon: orb.MultiPolygon{square(54, 36)}}}
+	zonesB := []cachemodel.Zone{country, {Type: cachemodel.ZoneRegion, Name: unique.Make("Region"),
+		Bounds: orb.Bound{Min: orb.Point{55, 37}, Max: orb.Point{56, 38}}, Polygon: orb.MultiPolygon{square(55, 37)}}}
+
+	metaB := meta
+	metaB.DateCreated = meta.DateCreated.Add(24 * time.Hour)
+	metaB.Version = 9
+	var cacheA, cacheB bytes.Buffer
+	if err := SaveV1(slices.Values(a), slices.Values(zonesA), meta, &cacheA); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveV2(slices.Values(b), slices.Values(zonesB), metaB, &cacheB); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"v1", "v2", "v3"} {
+		t.Run(format, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), format+".rgc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			err = Merge([]MergeInput{
+				{Name: "a.rgc", Reader: bytes.NewReader(cacheA.Bytes())},
+				{Name: "b.rgc", Reader: bytes.NewReader(cacheB.Bytes())},
+			}, f, MergeOptions{Format: format}, discardLog)
+			if err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+			merged, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotPoints, gotZones, gotMeta, err := LoadFromReaderWithMetadata(bytes.NewReader(merged), discardLog)
+			if err != nil {
+				t.Fatalf("loading merged cache: %v", err)
+			}
+			// 300 addresses, the other house number and the point too far from its duplicate
+			if len(gotPoints) != 302 {
+				t.Errorf("%d points, want 302", len(gotPoints))
+			}
+			if format != "v1" {
+				i := slices.IndexFunc(gotPoints, func(p cachemodel.Point) bool { return p.Data.HouseNumber.Value() == "170" })
+				if i < 0 || gotPoints[i].Data.Footprint == nil {
+					t.Error("kept point didn't take the footprint of its duplicate")
+				}
+			}
+
+			if len(gotZones) != 2 {
+				t.Fatalf("%d zones, want 2", len(gotZones))
+			}
+			for _, z := range gotZones {
+				want := 1
+				if z.Type == cachemodel.ZoneRegion {
+					want = 2
+				}
+				if len(z.Polygon) != want {
+					t.Errorf("zone %s has %d polygons, want %d", z.Name.Value(), len(z.Polygon), want)
+				}
+			}
+
+			if gotMeta == nil || gotMeta.Version != 9 || gotMeta.Locale != meta.Locale {
+				t.Fatalf("metadata = %+v", gotMeta)
+			}
+			wantSources := []cachemodel.Source{{Name: "a.rgc", DateCreated: meta.DateCreated}, {Name: "b.rgc", DateCreated: metaB.DateCreated}}
+			if !slices.EqualFunc(gotMeta.Sources, wantSources, func(a, b cachemodel.Source) bool {
+				return a.Name == b.Name && a.DateCreated.Equal(b.DateCreated)
+			}) {
+				t.Errorf("sources = %+v, want %+v", gotMeta.Sources, wantSources)
+			}
+		})
+	}
+}
+
+func TestMergeZonesApart(t *testing.T) {
+	// regions of the same name far apart are different regions
+	zone := func(x float64) cachemodel.Zone {
+		return cachemodel.Zone{Type: cachemodel.ZoneRegion, Name: unique.Make("Limburg"),
+			Bounds: orb.Bound{Min: orb.Point{x, 0}, Max: orb.Point{x + 1, 1}}}
+	}
+	zones, merged := mergeZones([][]cachemodel.Zone{{zone(0)}, {zone(5), zone(0.5)}})
+	if len(zones) != 2 || merged != 1 {
+		t.Errorf("%d zones and %d merged, want 2 and 1", len(zones), merged)
+	}
+}
@@ -1,6 +1,7 @@
 package cachemodel
 
 import (
+	"fmt"
 	"time"
 	"unique"
 
@@ -12,6 +13,15 @@ type Metadata struct {
 	Version     uint32
 	Locale      string
 	DateCreated time.Time
+	// Sources are the caches merged into this one, empty for a generated
+	// cache.
+	Sources []Source
+}
+
+// Source is a cache merged into another one.
+type Source struct {
+	Name        string
+	DateCreated time.Time
 }
 
 type Point = kdbush.Point[Info]
@@ -23,6 +33,10 @@ type Info struct {
 	City        unique.Handle[string]
 	Region      unique.Handle[string]
 	Weight      uint8
+
+	// Footprint is an optional simplified building outline used for
+	// point-in-building matching. Only the v2 and v3 formats store it.
+	Footprint orb.Ring
 }
 
 type ZoneType uint8
@@ -38,3 +52,16 @@ type Zone struct {
 	Bounds  orb.Bound
 	Polygon orb.MultiPolygon
 }
+
+// CheckRings returns an error for the first ring of the zone polygon that is
+// not closed, point-in-polygon tests need closed rings.
+func (z Zone) CheckRings() error {
+	for pi, polygon := range z.Polygon {
+		for ri, ring := range polygon {
+			if len(ring) < 4 || !ring.Closed() {
+				return fmt.Errorf("zone %q: ring %d of polygon %d is not a closed ring (%d points)", z.Name.Value(), ri, pi, len(ring))
+			}
+		}
+	}
+	return nil
+}
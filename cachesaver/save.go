@@ -8,6 +8,8 @@ import (
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	savev1 "github.com/royalcat/rgeocache/cachesaver/save/v1"
 	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
+	"github.com/royalcat/rgeocache/kdbush"
 )
 
 func SaveV1(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, w io.Writer) error {
@@ -28,8 +30,9 @@ func SaveV1(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone],
 	return nil
 }
 
-// SaveV2 writes a v2 cache file with the mmap-compatible KDBH spatial index.
-func SaveV2(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, w io.Writer) error {
+// SaveV2 writes a v2 cache file with the mmap-compatible KDBH spatial index,
+// opts are passed to the KD-tree builds.
+func SaveV2(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, w io.Writer, opts ...kdbush.BuildOption) error {
 	_, err := w.Write(MAGIC_BYTES)
 	if err != nil {
 		return err
@@ -40,5 +43,28 @@ func SaveV2(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone],
 		return err
 	}
 
-	return savev2.Save(w, points, zones, meta)
+	return savev2.Save(w, points, zones, meta, opts...)
+}
+
+// SaveV2External writes the same file as [SaveV2] with memory use bounded by opts,
+// see [savev2.SaveExternal].
+func SaveV2External(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, w io.Writer, opts savev2.ExternalOptions) error {
+	_, err := w.Write(MAGIC_BYTES)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(w, binary.LittleEndian, savev2.COMPATIBILITY_LEVEL)
+	if err != nil {
+		return err
+	}
+
+	return savev2.SaveExternal(w, points, zones, meta, opts)
+}
+
+// SaveV3 writes a v3 cache file, a container of aligned and checksummed
+// sections, see [savev3.Save].  w has to seek, the table of contents is
+// written last.
+func SaveV3(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, w io.WriteSeeker, opts savev3.Options) error {
+	return savev3.Save(w, points, zones, meta, opts)
 }
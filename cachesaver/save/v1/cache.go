@@ -2,7 +2,6 @@ package savev1
 
 import (
 	"iter"
-	"time"
 
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	saveproto "github.com/royalcat/rgeocache/cachesaver/save/v1/proto"
@@ -11,10 +10,7 @@ import (
 const COMPATIBILITY_LEVEL uint32 = 1
 
 type cache struct {
-	// Metadata
-	Version     uint32
-	DateCreated string
-	Locale      string
+	Metadata *saveproto.CacheMetadata
 
 	// Values deduplication
 	StreetsNames []string
@@ -68,9 +64,7 @@ func cacheFromPoints(inputPoints iter.Seq[cachemodel.Point], inputZones iter.Seq
 	}
 
 	return cache{
-		Version:     metadata.Version,
-		Locale:      metadata.Locale,
-		DateCreated: metadata.DateCreated.Format(time.RFC3339),
+		Metadata: MetadataProto(metadata),
 
 		StreetsNames: streetsNames.Slice(),
 		CitiesNames:  citiesNames.Slice(),
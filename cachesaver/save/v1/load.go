@@ -6,7 +6,6 @@ import (
 	"io"
 	"iter"
 	"sync/atomic"
-	"time"
 	"unique"
 
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
@@ -168,15 +167,9 @@ func Load(r io.Reader) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel
 		}
 	}
 
-	dateCreated, err := time.Parse(time.RFC3339, metadata.DateCreated)
+	meta, err := ParseMetadata(&metadata)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to parse date created: %w", err)
-	}
-
-	meta := cachemodel.Metadata{
-		Version:     metadata.Version,
-		Locale:      metadata.Locale,
-		DateCreated: dateCreated,
+		return nil, nil, nil, err
 	}
 
 	return pointsIter, zonesIter, &meta, nil
@@ -0,0 +1,47 @@
+package savev1
+
+import (
+	"fmt"
+	"time"
+
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	saveproto "github.com/royalcat/rgeocache/cachesaver/save/v1/proto"
+)
+
+// MetadataProto converts metadata to the CacheMetadata message, which the v2
+// and v3 formats share with v1.
+func MetadataProto(meta cachemodel.Metadata) *saveproto.CacheMetadata {
+	m := &saveproto.CacheMetadata{
+		Version:     meta.Version,
+		DateCreated: meta.DateCreated.Format(time.RFC3339),
+		Locale:      meta.Locale,
+	}
+	for _, src := range meta.Sources {
+		m.Sources = append(m.Sources, &saveproto.CacheSource{
+			Name:        src.Name,
+			DateCreated: src.DateCreated.Format(time.RFC3339),
+		})
+	}
+	return m
+}
+
+// ParseMetadata converts a CacheMetadata message back to metadata.
+func ParseMetadata(m *saveproto.CacheMetadata) (cachemodel.Metadata, error) {
+	dateCreated, err := time.Parse(time.RFC3339, m.DateCreated)
+	if err != nil {
+		return cachemodel.Metadata{}, fmt.Errorf("failed to parse date created: %w", err)
+	}
+	meta := cachemodel.Metadata{
+		Version:     m.Version,
+		Locale:      m.Locale,
+		DateCreated: dateCreated,
+	}
+	for _, src := range m.Sources {
+		srcCreated, err := time.Parse(time.RFC3339, src.DateCreated)
+		if err != nil {
+			return cachemodel.Metadata{}, fmt.Errorf("failed to parse date created of source %q: %w", src.Name, err)
+		}
+		meta.Sources = append(meta.Sources, cachemodel.Source{Name: src.Name, DateCreated: srcCreated})
+	}
+	return meta, nil
+}
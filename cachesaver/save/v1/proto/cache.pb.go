@@ -139,10 +139,12 @@ func (x *CacheHeader) GetZonesBlobSizes() []uint32 {
 }
 
 type CacheMetadata struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Version       uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
-	DateCreated   string                 `protobuf:"bytes,2,opt,name=date_created,json=dateCreated,proto3" json:"date_created,omitempty"`
-	Locale        string                 `protobuf:"bytes,3,opt,name=locale,proto3" json:"locale,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Version     uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	DateCreated string                 `protobuf:"bytes,2,opt,name=date_created,json=dateCreated,proto3" json:"date_created,omitempty"`
+	Locale      string                 `protobuf:"bytes,3,opt,name=locale,proto3" json:"locale,omitempty"`
+	// caches merged into this one, empty for a generated cache
+	Sources       []*CacheSource `protobuf:"bytes,4,rep,name=sources,proto3" json:"sources,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -198,6 +200,65 @@ func (x *CacheMetadata) GetLocale() string {
 	return ""
 }
 
+func (x *CacheMetadata) GetSources() []*CacheSource {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+type CacheSource struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	DateCreated   string                 `protobuf:"bytes,2,opt,name=date_created,json=dateCreated,proto3" json:"date_created,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CacheSource) Reset() {
+	*x = CacheSource{}
+	mi := &file_cache_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CacheSource) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CacheSource) ProtoMessage() {}
+
+func (x *CacheSource) ProtoReflect() protoreflect.Message {
+	mi := &file_cache_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CacheSource.ProtoReflect.Descriptor instead.
+func (*CacheSource) Descriptor() ([]byte, []int) {
+	return file_cache_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CacheSource) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *CacheSource) GetDateCreated() string {
+	if x != nil {
+		return x.DateCreated
+	}
+	return ""
+}
+
 type StringsCache struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Streets       []string               `protobuf:"bytes,2,rep,name=streets,proto3" json:"streets,omitempty"`
@@ -209,7 +270,7 @@ type StringsCache struct {
 
 func (x *StringsCache) Reset() {
 	*x = StringsCache{}
-	mi := &file_cache_proto_msgTypes[2]
+	mi := &file_cache_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -221,7 +282,7 @@ func (x *StringsCache) String() string {
 func (*StringsCache) ProtoMessage() {}
 
 func (x *StringsCache) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[2]
+	mi := &file_cache_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -234,7 +295,7 @@ func (x *StringsCache) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StringsCache.ProtoReflect.Descriptor instead.
 func (*StringsCache) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{2}
+	return file_cache_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *StringsCache) GetStreets() []string {
@@ -267,7 +328,7 @@ type PointsBlob struct {
 
 func (x *PointsBlob) Reset() {
 	*x = PointsBlob{}
-	mi := &file_cache_proto_msgTypes[3]
+	mi := &file_cache_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -279,7 +340,7 @@ func (x *PointsBlob) String() string {
 func (*PointsBlob) ProtoMessage() {}
 
 func (x *PointsBlob) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[3]
+	mi := &file_cache_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -292,7 +353,7 @@ func (x *PointsBlob) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PointsBlob.ProtoReflect.Descriptor instead.
 func (*PointsBlob) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{3}
+	return file_cache_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *PointsBlob) GetPoints() []*Point {
@@ -318,7 +379,7 @@ type Point struct {
 
 func (x *Point) Reset() {
 	*x = Point{}
-	mi := &file_cache_proto_msgTypes[4]
+	mi := &file_cache_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -330,7 +391,7 @@ func (x *Point) String() string {
 func (*Point) ProtoMessage() {}
 
 func (x *Point) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[4]
+	mi := &file_cache_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -343,7 +404,7 @@ func (x *Point) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Point.ProtoReflect.Descriptor instead.
 func (*Point) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{4}
+	return file_cache_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *Point) GetLatitude() float64 {
@@ -412,7 +473,7 @@ type ZonesBlob struct {
 
 func (x *ZonesBlob) Reset() {
 	*x = ZonesBlob{}
-	mi := &file_cache_proto_msgTypes[5]
+	mi := &file_cache_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -424,7 +485,7 @@ func (x *ZonesBlob) String() string {
 func (*ZonesBlob) ProtoMessage() {}
 
 func (x *ZonesBlob) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[5]
+	mi := &file_cache_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -437,7 +498,7 @@ func (x *ZonesBlob) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ZonesBlob.ProtoReflect.Descriptor instead.
 func (*ZonesBlob) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{5}
+	return file_cache_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *ZonesBlob) GetType() ZoneType {
@@ -465,7 +526,7 @@ type Zone struct {
 
 func (x *Zone) Reset() {
 	*x = Zone{}
-	mi := &file_cache_proto_msgTypes[6]
+	mi := &file_cache_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -477,7 +538,7 @@ func (x *Zone) String() string {
 func (*Zone) ProtoMessage() {}
 
 func (x *Zone) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[6]
+	mi := &file_cache_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -490,7 +551,7 @@ func (x *Zone) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Zone.ProtoReflect.Descriptor instead.
 func (*Zone) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{6}
+	return file_cache_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *Zone) GetName() uint32 {
@@ -524,7 +585,7 @@ type Bounds struct {
 
 func (x *Bounds) Reset() {
 	*x = Bounds{}
-	mi := &file_cache_proto_msgTypes[7]
+	mi := &file_cache_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -536,7 +597,7 @@ func (x *Bounds) String() string {
 func (*Bounds) ProtoMessage() {}
 
 func (x *Bounds) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[7]
+	mi := &file_cache_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -549,7 +610,7 @@ func (x *Bounds) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Bounds.ProtoReflect.Descriptor instead.
 func (*Bounds) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{7}
+	return file_cache_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *Bounds) GetMax() *LatLon {
@@ -576,7 +637,7 @@ type MultiPolygon struct {
 
 func (x *MultiPolygon) Reset() {
 	*x = MultiPolygon{}
-	mi := &file_cache_proto_msgTypes[8]
+	mi := &file_cache_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -588,7 +649,7 @@ func (x *MultiPolygon) String() string {
 func (*MultiPolygon) ProtoMessage() {}
 
 func (x *MultiPolygon) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[8]
+	mi := &file_cache_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -601,7 +662,7 @@ func (x *MultiPolygon) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use MultiPolygon.ProtoReflect.Descriptor instead.
 func (*MultiPolygon) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{8}
+	return file_cache_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *MultiPolygon) GetPolygons() []*Polygon {
@@ -621,7 +682,7 @@ type Polygon struct {
 
 func (x *Polygon) Reset() {
 	*x = Polygon{}
-	mi := &file_cache_proto_msgTypes[9]
+	mi := &file_cache_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -633,7 +694,7 @@ func (x *Polygon) String() string {
 func (*Polygon) ProtoMessage() {}
 
 func (x *Polygon) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[9]
+	mi := &file_cache_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -646,7 +707,7 @@ func (x *Polygon) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Polygon.ProtoReflect.Descriptor instead.
 func (*Polygon) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{9}
+	return file_cache_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *Polygon) GetRings() []*Ring {
@@ -665,7 +726,7 @@ type Ring struct {
 
 func (x *Ring) Reset() {
 	*x = Ring{}
-	mi := &file_cache_proto_msgTypes[10]
+	mi := &file_cache_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -677,7 +738,7 @@ func (x *Ring) String() string {
 func (*Ring) ProtoMessage() {}
 
 func (x *Ring) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[10]
+	mi := &file_cache_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -690,7 +751,7 @@ func (x *Ring) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Ring.ProtoReflect.Descriptor instead.
 func (*Ring) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{10}
+	return file_cache_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *Ring) GetPoints() []*LatLon {
@@ -710,7 +771,7 @@ type LatLon struct {
 
 func (x *LatLon) Reset() {
 	*x = LatLon{}
-	mi := &file_cache_proto_msgTypes[11]
+	mi := &file_cache_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -722,7 +783,7 @@ func (x *LatLon) String() string {
 func (*LatLon) ProtoMessage() {}
 
 func (x *LatLon) ProtoReflect() protoreflect.Message {
-	mi := &file_cache_proto_msgTypes[11]
+	mi := &file_cache_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -735,7 +796,7 @@ func (x *LatLon) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use LatLon.ProtoReflect.Descriptor instead.
 func (*LatLon) Descriptor() ([]byte, []int) {
-	return file_cache_proto_rawDescGZIP(), []int{11}
+	return file_cache_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *LatLon) GetLat() float32 {
@@ -761,11 +822,15 @@ const file_cache_proto_rawDesc = "" +
 	"\rmetadata_size\x18\x01 \x01(\rR\fmetadataSize\x12,\n" +
 	"\x12strings_cache_size\x18\x02 \x01(\rR\x10stringsCacheSize\x12*\n" +
 	"\x11points_blob_sizes\x18\x03 \x03(\rR\x0fpointsBlobSizes\x12(\n" +
-	"\x10zones_blob_sizes\x18\x04 \x03(\rR\x0ezonesBlobSizes\"d\n" +
+	"\x10zones_blob_sizes\x18\x04 \x03(\rR\x0ezonesBlobSizes\"\x9f\x01\n" +
 	"\rCacheMetadata\x12\x18\n" +
 	"\aversion\x18\x01 \x01(\rR\aversion\x12!\n" +
 	"\fdate_created\x18\x02 \x01(\tR\vdateCreated\x12\x16\n" +
-	"\x06locale\x18\x03 \x01(\tR\x06locale\"`\n" +
+	"\x06locale\x18\x03 \x01(\tR\x06locale\x129\n" +
+	"\asources\x18\x04 \x03(\v2\x1f.cachesaver.save.v1.CacheSourceR\asources\"D\n" +
+	"\vCacheSource\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12!\n" +
+	"\fdate_created\x18\x02 \x01(\tR\vdateCreated\"`\n" +
 	"\fStringsCache\x12\x18\n" +
 	"\astreets\x18\x02 \x03(\tR\astreets\x12\x16\n" +
 	"\x06cities\x18\x03 \x03(\tR\x06cities\x12\x18\n" +
@@ -819,38 +884,40 @@ func file_cache_proto_rawDescGZIP() []byte {
 }
 
 var file_cache_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_cache_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_cache_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_cache_proto_goTypes = []any{
 	(ZoneType)(0),         // 0: cachesaver.save.v1.ZoneType
 	(*CacheHeader)(nil),   // 1: cachesaver.save.v1.CacheHeader
 	(*CacheMetadata)(nil), // 2: cachesaver.save.v1.CacheMetadata
-	(*StringsCache)(nil),  // 3: cachesaver.save.v1.StringsCache
-	(*PointsBlob)(nil),    // 4: cachesaver.save.v1.PointsBlob
-	(*Point)(nil),         // 5: cachesaver.save.v1.Point
-	(*ZonesBlob)(nil),     // 6: cachesaver.save.v1.ZonesBlob
-	(*Zone)(nil),          // 7: cachesaver.save.v1.Zone
-	(*Bounds)(nil),        // 8: cachesaver.save.v1.Bounds
-	(*MultiPolygon)(nil),  // 9: cachesaver.save.v1.MultiPolygon
-	(*Polygon)(nil),       // 10: cachesaver.save.v1.Polygon
-	(*Ring)(nil),          // 11: cachesaver.save.v1.Ring
-	(*LatLon)(nil),        // 12: cachesaver.save.v1.LatLon
+	(*CacheSource)(nil),   // 3: cachesaver.save.v1.CacheSource
+	(*StringsCache)(nil),  // 4: cachesaver.save.v1.StringsCache
+	(*PointsBlob)(nil),    // 5: cachesaver.save.v1.PointsBlob
+	(*Point)(nil),         // 6: cachesaver.save.v1.Point
+	(*ZonesBlob)(nil),     // 7: cachesaver.save.v1.ZonesBlob
+	(*Zone)(nil),          // 8: cachesaver.save.v1.Zone
+	(*Bounds)(nil),        // 9: cachesaver.save.v1.Bounds
+	(*MultiPolygon)(nil),  // 10: cachesaver.save.v1.MultiPolygon
+	(*Polygon)(nil),       // 11: cachesaver.save.v1.Polygon
+	(*Ring)(nil),          // 12: cachesaver.save.v1.Ring
+	(*LatLon)(nil),        // 13: cachesaver.save.v1.LatLon
 }
 var file_cache_proto_depIdxs = []int32{
-	5,  // 0: cachesaver.save.v1.PointsBlob.points:type_name -> cachesaver.save.v1.Point
-	0,  // 1: cachesaver.save.v1.ZonesBlob.type:type_name -> cachesaver.save.v1.ZoneType
-	7,  // 2: cachesaver.save.v1.ZonesBlob.zones:type_name -> cachesaver.save.v1.Zone
-	8,  // 3: cachesaver.save.v1.Zone.bounds:type_name -> cachesaver.save.v1.Bounds
-	9,  // 4: cachesaver.save.v1.Zone.multi_polygon:type_name -> cachesaver.save.v1.MultiPolygon
-	12, // 5: cachesaver.save.v1.Bounds.max:type_name -> cachesaver.save.v1.LatLon
-	12, // 6: cachesaver.save.v1.Bounds.min:type_name -> cachesaver.save.v1.LatLon
-	10, // 7: cachesaver.save.v1.MultiPolygon.polygons:type_name -> cachesaver.save.v1.Polygon
-	11, // 8: cachesaver.save.v1.Polygon.rings:type_name -> cachesaver.save.v1.Ring
-	12, // 9: cachesaver.save.v1.Ring.points:type_name -> cachesaver.save.v1.LatLon
-	10, // [10:10] is the sub-list for method output_type
-	10, // [10:10] is the sub-list for method input_type
-	10, // [10:10] is the sub-list for extension type_name
-	10, // [10:10] is the sub-list for extension extendee
-	0,  // [0:10] is the sub-list for field type_name
+	3,  // 0: cachesaver.save.v1.CacheMetadata.sources:type_name -> cachesaver.save.v1.CacheSource
+	6,  // 1: cachesaver.save.v1.PointsBlob.points:type_name -> cachesaver.save.v1.Point
+	0,  // 2: cachesaver.save.v1.ZonesBlob.type:type_name -> cachesaver.save.v1.ZoneType
+	8,  // 3: cachesaver.save.v1.ZonesBlob.zones:type_name -> cachesaver.save.v1.Zone
+	9,  // 4: cachesaver.save.v1.Zone.bounds:type_name -> cachesaver.save.v1.Bounds
+	10, // 5: cachesaver.save.v1.Zone.multi_polygon:type_name -> cachesaver.save.v1.MultiPolygon
+	13, // 6: cachesaver.save.v1.Bounds.max:type_name -> cachesaver.save.v1.LatLon
+	13, // 7: cachesaver.save.v1.Bounds.min:type_name -> cachesaver.save.v1.LatLon
+	11, // 8: cachesaver.save.v1.MultiPolygon.polygons:type_name -> cachesaver.save.v1.Polygon
+	12, // 9: cachesaver.save.v1.Polygon.rings:type_name -> cachesaver.save.v1.Ring
+	13, // 10: cachesaver.save.v1.Ring.points:type_name -> cachesaver.save.v1.LatLon
+	11, // [11:11] is the sub-list for method output_type
+	11, // [11:11] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_cache_proto_init() }
@@ -864,7 +931,7 @@ func file_cache_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_cache_proto_rawDesc), len(file_cache_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   12,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -24,12 +24,7 @@ func Save(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemo
 		return err
 	}
 
-	protoMetadata := &saveproto.CacheMetadata{
-		Version:     cache.Version,
-		DateCreated: cache.DateCreated,
-		Locale:      cache.Locale,
-	}
-	metadataBytes, err := proto.Marshal(protoMetadata)
+	metadataBytes, err := proto.Marshal(cache.Metadata)
 	if err != nil {
 		return err
 	}
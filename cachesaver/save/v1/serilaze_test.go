@@ -3,6 +3,7 @@ package savev1
 import (
 	"bytes"
 	"iter"
+	"slices"
 	"strconv"
 	"testing"
 	"time"
@@ -133,7 +134,14 @@ func TestSaveLoad(t *testing.T) {
 }
 
 func pointsEqual(a, b cachemodel.Point) bool {
-	return a == b
+	return a.X == b.X && a.Y == b.Y &&
+		a.Data.Name == b.Data.Name &&
+		a.Data.Street == b.Data.Street &&
+		a.Data.HouseNumber == b.Data.HouseNumber &&
+		a.Data.City == b.Data.City &&
+		a.Data.Region == b.Data.Region &&
+		a.Data.Weight == b.Data.Weight &&
+		slices.Equal(a.Data.Footprint, b.Data.Footprint)
 }
 
 func slicesIter[T any](slice []T) iter.Seq[T] {
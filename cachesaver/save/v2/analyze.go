@@ -7,6 +7,7 @@ import (
 
 	"github.com/dustin/go-humanize"
 	savev2proto "github.com/royalcat/rgeocache/cachesaver/save/v2/proto"
+	"github.com/royalcat/rgeocache/kdbush"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -16,6 +17,9 @@ func printCacheSizeAnalysisFromHeader(header *savev2proto.V2Header) {
 	fmt.Printf("Strings index size: %s\n", humanize.Bytes(uint64(header.StringsIndexSize)))
 	fmt.Printf("Strings data size: %s\n", humanize.Bytes(uint64(header.StringsDataSize)))
 	fmt.Printf("Zones size: %s\n", humanize.Bytes(uint64(header.ZonesSize)))
+	if header.FootprintsSize > 0 {
+		fmt.Printf("Footprints size: %s\n", humanize.Bytes(header.FootprintsSize))
+	}
 }
 
 // PrintCacheAnalysis reads a v2 cache from r and prints a human-readable size
@@ -42,8 +46,8 @@ func PrintCacheAnalysis(r io.Reader) error {
 
 	printCacheSizeAnalysisFromHeader(&header)
 
-	// 2. Skip metadata + string index + string data + zones to reach the KDBH block.
-	skipSize := int64(header.MetadataSize) + int64(header.StringsIndexSize) + int64(header.StringsDataSize) + int64(header.ZonesSize)
+	// 2. Skip metadata + string index + string data + zones + footprints to reach the KDBH block.
+	skipSize := int64(header.MetadataSize) + int64(header.StringsIndexSize) + int64(header.StringsDataSize) + int64(header.ZonesSize) + int64(header.FootprintsSize)
 	if _, err := io.CopyN(io.Discard, r, skipSize); err != nil {
 		return fmt.Errorf("v2 analyze: failed to skip to KDBH: %w", err)
 	}
@@ -53,17 +57,15 @@ func PrintCacheAnalysis(r io.Reader) error {
 	if _, err := io.ReadFull(r, kdbhHeader[:]); err != nil {
 		return fmt.Errorf("v2 analyze: failed to read KDBH header: %w", err)
 	}
-	var diskMagic [4]byte
-	copy(diskMagic[:], kdbhHeader[0:4])
-	if string(diskMagic[:]) != "KDBH" {
-		return fmt.Errorf("v2 analyze: invalid KDBH magic %q", diskMagic[:])
+	treeHeader, err := kdbush.ParseDiskHeader(kdbhHeader[:])
+	if err != nil {
+		return fmt.Errorf("v2 analyze: %w", err)
 	}
-	nodeSize := binary.LittleEndian.Uint64(kdbhHeader[8:16])
-	numPoints := binary.LittleEndian.Uint64(kdbhHeader[16:24])
+	nodeSize := uint64(treeHeader.NodeSize)
+	numPoints := uint64(treeHeader.NumPoints)
 
-	// 4. Skip tree indices (N*8) + tree coordinates (N*16) to reach the offset table.
-	treeSize := int64(numPoints*8 + numPoints*16)
-	if _, err := io.CopyN(io.Discard, r, treeSize); err != nil {
+	// 4. Skip tree indices and coordinates to reach the offset table.
+	if _, err := io.CopyN(io.Discard, r, treeHeader.TreeSize()); err != nil {
 		return fmt.Errorf("v2 analyze: failed to skip KDBH tree: %w", err)
 	}
 
@@ -80,12 +82,12 @@ func PrintCacheAnalysis(r io.Reader) error {
 	totalBlobSize := offsetTable[numPoints] // last cumulative offset = total blob data size
 
 	// 6. Compute and print KDBH breakdown.
-	indicesSize := numPoints * 8
-	coordsSize := numPoints * 16
+	indicesSize := numPoints * uint64(treeHeader.IdxSize)
+	coordsSize := numPoints * 2 * uint64(treeHeader.CoordSize)
 	offsetsSize := offsetCount * 8
 	kdbhTotal := uint64(32+indicesSize+coordsSize+offsetsSize) + uint64(totalBlobSize)
 
-	fmt.Printf("Points count: %d (node size: %d)\n", numPoints, nodeSize)
+	fmt.Printf("Points count: %d (node size: %d, KDBH version %d)\n", numPoints, nodeSize, treeHeader.Version)
 	fmt.Printf("  Tree indices: %s\n", humanize.Bytes(indicesSize))
 	fmt.Printf("  Tree coords:  %s\n", humanize.Bytes(coordsSize))
 	fmt.Printf("  Data offsets: %s\n", humanize.Bytes(offsetsSize))
@@ -98,6 +100,7 @@ func PrintCacheAnalysis(r io.Reader) error {
 		uint64(header.StringsIndexSize) +
 		uint64(header.StringsDataSize) +
 		uint64(header.ZonesSize) +
+		header.FootprintsSize +
 		kdbhTotal
 	fmt.Printf("Total uncompressed size: %s\n", humanize.Bytes(totalSize))
 
@@ -0,0 +1,127 @@
+package savev2
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+// Compile-time interface checks.
+var (
+	_ encoding.BinaryMarshaler   = V2Footprint{}
+	_ encoding.BinaryUnmarshaler = (*V2Footprint)(nil)
+)
+
+// MaxFootprintExtent is the largest distance in degrees between a building
+// centroid and any vertex of its footprint. Larger footprints are not stored,
+// such buildings are matched by the nearest centroid only.
+//
+// The footprints section is queried with this radius, so it bounds the number
+// of footprints tested for every lookup.
+const MaxFootprintExtent = 0.005
+
+// footprintCoordScale converts degrees to int32 fixed-point (1e-7°, ~1 cm).
+const footprintCoordScale = 1e7
+
+// V2Footprint is the on-disk representation of a simplified building outline.
+// Footprints are stored in their own KDBH block keyed by the building centroid,
+// PointIdx refers to the original index of the address point in the main KDBH block.
+//
+// Layout: uint32 PointIdx, uint32 vertex count, then int32 (lon, lat) pairs
+// in fixed-point 1e-7 degrees.
+type V2Footprint struct {
+	PointIdx uint32
+	Ring     orb.Ring
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler (value receiver).
+func (f V2Footprint) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 8+len(f.Ring)*8)
+	binary.LittleEndian.PutUint32(buf[0:4], f.PointIdx)
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(f.Ring)))
+	for i, p := range f.Ring {
+		binary.LittleEndian.PutUint32(buf[8+i*8:], uint32(toFixedPoint(p[0])))
+		binary.LittleEndian.PutUint32(buf[12+i*8:], uint32(toFixedPoint(p[1])))
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler (pointer receiver).
+func (f *V2Footprint) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		*f = V2Footprint{}
+		return nil
+	}
+	if len(data) < 8 {
+		return fmt.Errorf("savev2: invalid V2Footprint size: got %d, want at least 8", len(data))
+	}
+	f.PointIdx = binary.LittleEndian.Uint32(data[0:4])
+	n := int(binary.LittleEndian.Uint32(data[4:8]))
+	if len(data) < 8+n*8 {
+		return fmt.Errorf("savev2: invalid V2Footprint size: got %d, want %d", len(data), 8+n*8)
+	}
+	f.Ring = make(orb.Ring, n)
+	for i := range n {
+		f.Ring[i] = orb.Point{
+			fromFixedPoint(int32(binary.LittleEndian.Uint32(data[8+i*8:]))),
+			fromFixedPoint(int32(binary.LittleEndian.Uint32(data[12+i*8:]))),
+		}
+	}
+	return nil
+}
+
+func toFixedPoint(v float64) int32 {
+	return int32(math.Round(v * footprintCoordScale))
+}
+
+func fromFixedPoint(v int32) float64 {
+	return float64(v) / footprintCoordScale
+}
+
+// FootprintExtent returns the distance in degrees from center to the farthest vertex of ring.
+func FootprintExtent(center orb.Point, ring orb.Ring) float64 {
+	var extent float64
+	for _, p := range ring {
+		dx := p[0] - center[0]
+		dy := p[1] - center[1]
+		extent = max(extent, math.Sqrt(dx*dx+dy*dy))
+	}
+	return extent
+}
+
+// parseFootprintsBlock decodes a footprints KDBH block held in memory
+// and returns the footprint rings keyed by the address point index.
+func parseFootprintsBlock(data []byte) (map[uint32]orb.Ring, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	header, err := kdbush.ParseDiskHeader(data)
+	if err != nil {
+		return nil, fmt.Errorf("savev2: invalid footprints block header: %w", err)
+	}
+	numPoints := header.NumPoints
+	offsetsStart := kdbush.DiskHeaderSize + int(header.TreeSize())
+	blobsStart := offsetsStart + int(header.DataOffsetsSize())
+	if len(data) < blobsStart {
+		return nil, fmt.Errorf("savev2: footprints block truncated: %d bytes for %d footprints", len(data), numPoints)
+	}
+
+	out := make(map[uint32]orb.Ring, numPoints)
+	for i := range numPoints {
+		start := blobsStart + int(binary.LittleEndian.Uint64(data[offsetsStart+i*8:]))
+		end := blobsStart + int(binary.LittleEndian.Uint64(data[offsetsStart+(i+1)*8:]))
+		if start > end || end > len(data) {
+			return nil, fmt.Errorf("savev2: footprint[%d] blob out of bounds", i)
+		}
+		var fp V2Footprint
+		if err := fp.UnmarshalBinary(data[start:end]); err != nil {
+			return nil, err
+		}
+		out[fp.PointIdx] = fp.Ring
+	}
+	return out, nil
+}
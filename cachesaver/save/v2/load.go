@@ -6,14 +6,14 @@ import (
 	"fmt"
 	"io"
 	"iter"
-	"time"
 	"unique"
 
+	"github.com/paulmach/orb"
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev1 "github.com/royalcat/rgeocache/cachesaver/save/v1"
 	savev1proto "github.com/royalcat/rgeocache/cachesaver/save/v1/proto"
 	savev2proto "github.com/royalcat/rgeocache/cachesaver/save/v2/proto"
 	"github.com/royalcat/rgeocache/kdbush"
-	"golang.org/x/exp/mmap"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -67,20 +67,49 @@ func Load(r io.Reader) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel
 		return nil, nil, nil, fmt.Errorf("v2 load: failed to parse zones: %w", err)
 	}
 
+	// Read building footprints, they are attached to the points by index
+	footprintsBytes := make([]byte, header.FootprintsSize)
+	if _, err := io.ReadFull(r, footprintsBytes); err != nil {
+		return nil, nil, nil, fmt.Errorf("v2 load: failed to read footprints: %w", err)
+	}
+	footprints, err := parseFootprintsBlock(footprintsBytes)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("v2 load: failed to parse footprints: %w", err)
+	}
+	footprintsBytes = nil
+
 	// Read KDBH header
 	var kdbhHeader [32]byte
 	if _, err := io.ReadFull(r, kdbhHeader[:]); err != nil {
 		return nil, nil, nil, fmt.Errorf("v2 load: failed to read KDBH header: %w", err)
 	}
-	numPoints := int64(binary.LittleEndian.Uint64(kdbhHeader[16:24]))
+	treeHeader, err := kdbush.ParseDiskHeader(kdbhHeader[:])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("v2 load: %w", err)
+	}
+	numPoints := int64(treeHeader.NumPoints)
 
 	// Points iterator: reads V2PointData blobs and resolves strings from the in-memory index.
 	pointsIter := func(yield func(cachemodel.Point, error) bool) {
-		skipSize := numPoints*8 + numPoints*16
-		if _, err := io.CopyN(io.Discard, r, skipSize); err != nil {
-			yield(cachemodel.Point{}, fmt.Errorf("v2 load: failed to skip tree: %w", err))
+		// The tree section holds the coordinates, it's read into memory
+		// behind its header and opened to resolve them by original index.
+		tree := make([]byte, kdbush.DiskHeaderSize+treeHeader.TreeSize())
+		copy(tree, kdbhHeader[:])
+		if _, err := io.ReadFull(r, tree[kdbush.DiskHeaderSize:]); err != nil {
+			yield(cachemodel.Point{}, fmt.Errorf("v2 load: failed to read tree: %w", err))
+			return
+		}
+		treeBush, err := kdbush.OpenDiskReaderAt[V2PointData, *V2PointData](kdbush.Bytes(tree), 0)
+		if err != nil {
+			yield(cachemodel.Point{}, fmt.Errorf("v2 load: %w", err))
 			return
 		}
+		coords, err := treeBush.Coords()
+		if err != nil {
+			yield(cachemodel.Point{}, fmt.Errorf("v2 load: failed to read coordinates: %w", err))
+			return
+		}
+		tree = nil
 
 		offsetTable := make([]int64, numPoints+1)
 		for i := range offsetTable {
@@ -107,6 +136,8 @@ func Load(r io.Reader) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel
 				}
 			}
 			point := resolvePointFromIndex(stringsIndex, stringsData, data)
+			point.X, point.Y = coords[2*i], coords[2*i+1]
+			point.Data.Footprint = footprints[uint32(i)]
 			if !yield(point, nil) {
 				return
 			}
@@ -121,128 +152,254 @@ func Load(r io.Reader) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel
 		}
 	}
 
-	dateCreated, err := time.Parse(time.RFC3339, metadata.DateCreated)
+	meta, err := savev1.ParseMetadata(&metadata)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("v2 load: failed to parse date: %w", err)
-	}
-
-	meta := &cachemodel.Metadata{
-		Version:     metadata.Version,
-		Locale:      metadata.Locale,
-		DateCreated: dateCreated,
+		return nil, nil, nil, fmt.Errorf("v2 load: %w", err)
 	}
 
-	return pointsIter, zonesIter, meta, nil
+	return pointsIter, zonesIter, &meta, nil
 }
 
 // ---------------------------------------------------------------------------
 // Low-memory mmap path
 // ---------------------------------------------------------------------------
 
-// LoadMmapResult holds the results of loading a v2 cache via mmap.
+// LoadMmapResult holds the results of loading a v2 cache via mmap or another
+// [io.ReaderAt].
 type LoadMmapResult struct {
 	DiskBush          *kdbush.DiskKDBush[V2PointData, *V2PointData]
-	StringsIndex      []uint32 // offset index: id → byte offset into string data
-	StringsDataOffset int64    // byte offset of the string data block within the mmap'd file
+	StringsIndex      []uint32    // offset index: id → byte offset into string data
+	StringsData       io.ReaderAt // reader of the string data block
+	StringsDataOffset int64       // byte offset of the string data block within StringsData
 	Zones             []cachemodel.Zone
 	Metadata          *cachemodel.Metadata
-	mmapReader        *mmap.ReaderAt
+	closer            io.Closer
+	stringsDataSize   int64
+
+	// Footprints is the building footprints index, nil when the cache has none.
+	Footprints *kdbush.DiskKDBush[V2Footprint, *V2Footprint]
+	// FootprintsMaxExtent is the search radius needed to find every footprint containing a point.
+	FootprintsMaxExtent float64
 }
 
-// Close releases resources held by the result.
+// Close releases resources held by the result, closing the reader if it is
+// an [io.Closer].
 func (r *LoadMmapResult) Close() error {
-	return r.mmapReader.Close()
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// LoadMmap opens a v2 cache from a memory-mapped file or any other
+// [io.ReaderAt].  Only the string index and zones are read into memory, the
+// KD-trees and string data are read on demand.  A memory map or
+// [kdbush.Bytes] is the fast path, see [kdbush.OpenDiskReaderAt].
+func LoadMmap(reader io.ReaderAt) (*LoadMmapResult, error) {
+	sections, err := readSections(reader, -1)
+	if err != nil {
+		return nil, fmt.Errorf("v2 mmap: %w", err)
+	}
+
+	closer, _ := reader.(io.Closer)
+	result, err := OpenSections(sections, closer)
+	if err != nil {
+		return nil, fmt.Errorf("v2 mmap: %w", err)
+	}
+	return result, nil
 }
 
-// LoadMmap opens a v2 cache from a memory-mapped file.
-func LoadMmap(reader *mmap.ReaderAt) (*LoadMmapResult, error) {
+// readSections reads the V2Header and locates the sections after it, the
+// points section runs to the end of the file.  The header size is checked
+// against size when it is known, a negative size means unknown.
+func readSections(reader io.ReaderAt, size int64) (Sections, error) {
 	offset := int64(8) // skip magic(4) + compat(4)
 
 	// Read V2Header size
 	var headerSizeBuf [4]byte
 	if _, err := reader.ReadAt(headerSizeBuf[:], offset); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to read header size: %w", err)
+		return Sections{}, fmt.Errorf("failed to read header size: %w", err)
 	}
 	headerSize := binary.LittleEndian.Uint32(headerSizeBuf[:])
 	offset += 4
+	if size >= 0 && int64(headerSize) > size-offset {
+		return Sections{}, fmt.Errorf("header of %d bytes doesn't fit the file of %d bytes", headerSize, size)
+	}
 
 	// Read V2Header
 	headerBytes := make([]byte, headerSize)
 	if _, err := reader.ReadAt(headerBytes, offset); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to read header: %w", err)
+		return Sections{}, fmt.Errorf("failed to read header: %w", err)
 	}
 	offset += int64(headerSize)
 
 	var header savev2proto.V2Header
 	if err := proto.Unmarshal(headerBytes, &header); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to unmarshal header: %w", err)
+		return Sections{}, fmt.Errorf("failed to unmarshal header: %w", err)
 	}
 
-	// Read metadata
-	metadataBytes := make([]byte, header.MetadataSize)
-	if _, err := reader.ReadAt(metadataBytes, offset); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to read metadata: %w", err)
+	// Sections follow the header back to back
+	next := func(size int64) Section {
+		s := Section{Reader: reader, Offset: offset, Size: size}
+		offset += size
+		return s
+	}
+	sections := Sections{
+		Metadata:            next(int64(header.MetadataSize)),
+		StringsIndex:        next(int64(header.StringsIndexSize)),
+		StringsData:         next(int64(header.StringsDataSize)),
+		Zones:               next(int64(header.ZonesSize)),
+		Footprints:          next(int64(header.FootprintsSize)),
+		FootprintsMaxExtent: header.FootprintsMaxExtent,
 	}
-	offset += int64(header.MetadataSize)
+	sections.Points = Section{Reader: reader, Offset: offset}
+	return sections, nil
+}
 
+// Section is a byte range of a cache, a part of the file or a section
+// decompressed into [kdbush.Bytes].
+type Section struct {
+	Reader io.ReaderAt
+	Offset int64
+	Size   int64 // KDBH blocks take their size from their header, [VerifySections] checks it against Size
+}
+
+func (s Section) read() ([]byte, error) {
+	buf := make([]byte, s.Size)
+	if s.Size == 0 {
+		return buf, nil
+	}
+	if _, err := s.Reader.ReadAt(buf, s.Offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Sections locates the parts of a cache for [OpenSections], the v2 layout
+// chains them after the V2Header, containers like v3 place them freely.
+type Sections struct {
+	Metadata     Section
+	StringsIndex Section
+	StringsData  Section
+	Zones        Section
+	// Footprints is the footprints KDBH block, a zero Size means the cache has none.
+	Footprints          Section
+	FootprintsMaxExtent float64
+	Points              Section
+}
+
+// OpenSections reads metadata, string index and zones into memory and opens
+// the KD-trees on their readers.  closer is closed by [LoadMmapResult.Close],
+// it may be nil.
+func OpenSections(s Sections, closer io.Closer) (*LoadMmapResult, error) {
+	metadataBytes, err := s.Metadata.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
 	var metadata savev1proto.CacheMetadata
 	if err := proto.Unmarshal(metadataBytes, &metadata); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to unmarshal metadata: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
 	}
 
 	// Read offset index into memory (small — N×4 bytes)
-	numStrings := header.StringsIndexSize / 4
-	stringsIndex := make([]uint32, numStrings)
-	indexBytes := make([]byte, header.StringsIndexSize)
-	if _, err := reader.ReadAt(indexBytes, offset); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to read string index: %w", err)
+	indexBytes, err := s.StringsIndex.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read string index: %w", err)
 	}
-	for i := range numStrings {
-		stringsIndex[i] = binary.LittleEndian.Uint32(indexBytes[i*4 : (i+1)*4])
+	stringsIndex := make([]uint32, len(indexBytes)/4)
+	for i := range stringsIndex {
+		stringsIndex[i] = binary.LittleEndian.Uint32(indexBytes[i*4:])
 	}
-	offset += int64(header.StringsIndexSize)
-
-	// Record string data block position (don't read it — lazy access)
-	stringsDataOffset := offset
-	offset += int64(header.StringsDataSize)
 
 	// Read and parse zones section
-	zonesBytes := make([]byte, header.ZonesSize)
-	if _, err := reader.ReadAt(zonesBytes, offset); err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to read zones: %w", err)
+	zonesBytes, err := s.Zones.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zones: %w", err)
 	}
-	offset += int64(header.ZonesSize)
-
 	parsedZones, err := parseV2Zones(zonesBytes)
 	if err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to parse zones: %w", err)
+		return nil, fmt.Errorf("failed to parse zones: %w", err)
+	}
+
+	// Open the footprints index if present
+	var footprints *kdbush.DiskKDBush[V2Footprint, *V2Footprint]
+	if s.Footprints.Size > 0 {
+		footprints, err = kdbush.OpenDiskReaderAt[V2Footprint, *V2Footprint](s.Footprints.Reader, s.Footprints.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open footprints: %w", err)
+		}
 	}
 
 	// Open DiskKDBush at the KDBH block offset
-	diskBush, err := kdbush.OpenDisk[V2PointData, *V2PointData](reader, offset)
+	diskBush, err := kdbush.OpenDiskReaderAt[V2PointData, *V2PointData](s.Points.Reader, s.Points.Offset)
 	if err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to open disk bush: %w", err)
+		return nil, fmt.Errorf("failed to open disk bush: %w", err)
 	}
 
-	dateCreated, err := time.Parse(time.RFC3339, metadata.DateCreated)
+	meta, err := savev1.ParseMetadata(&metadata)
 	if err != nil {
-		return nil, fmt.Errorf("v2 mmap: failed to parse date: %w", err)
+		return nil, err
 	}
 
 	return &LoadMmapResult{
-		DiskBush:          diskBush,
-		StringsIndex:      stringsIndex,
-		StringsDataOffset: stringsDataOffset,
-		Zones:             parsedZones,
-		Metadata: &cachemodel.Metadata{
-			Version:     metadata.Version,
-			Locale:      metadata.Locale,
-			DateCreated: dateCreated,
-		},
-		mmapReader: reader,
+		closer:              closer,
+		DiskBush:            diskBush,
+		StringsIndex:        stringsIndex,
+		StringsData:         s.StringsData.Reader,
+		StringsDataOffset:   s.StringsData.Offset,
+		stringsDataSize:     s.StringsData.Size,
+		Zones:               parsedZones,
+		Metadata:            &meta,
+		Footprints:          footprints,
+		FootprintsMaxExtent: s.FootprintsMaxExtent,
 	}, nil
 }
 
+// Points reads every point with its coordinates and footprint in the order
+// they were saved.  The string data and the KD-trees are read as a whole,
+// it's meant for converting a cache rather than for queries.
+func (r *LoadMmapResult) Points() iter.Seq2[cachemodel.Point, error] {
+	return func(yield func(cachemodel.Point, error) bool) {
+		stringsData, err := Section{Reader: r.StringsData, Offset: r.StringsDataOffset, Size: r.stringsDataSize}.read()
+		if err != nil {
+			yield(cachemodel.Point{}, fmt.Errorf("v2: failed to read string data: %w", err))
+			return
+		}
+
+		footprints := map[uint32]orb.Ring{}
+		if r.Footprints != nil {
+			for i := range r.Footprints.NumPoints() {
+				fp, err := r.Footprints.PointData(i)
+				if err != nil {
+					yield(cachemodel.Point{}, fmt.Errorf("v2: failed to read footprint[%d]: %w", i, err))
+					return
+				}
+				footprints[fp.PointIdx] = fp.Ring
+			}
+		}
+
+		coords, err := r.DiskBush.Coords()
+		if err != nil {
+			yield(cachemodel.Point{}, fmt.Errorf("v2: failed to read coordinates: %w", err))
+			return
+		}
+
+		for i := range r.DiskBush.NumPoints() {
+			data, err := r.DiskBush.PointData(i)
+			if err != nil {
+				yield(cachemodel.Point{}, fmt.Errorf("v2: failed to read point[%d]: %w", i, err))
+				return
+			}
+			point := resolvePointFromIndex(r.StringsIndex, stringsData, data)
+			point.X, point.Y = coords[2*i], coords[2*i+1]
+			point.Data.Footprint = footprints[uint32(i)]
+			if !yield(point, nil) {
+				return
+			}
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Helpers
 // ---------------------------------------------------------------------------
@@ -258,7 +415,7 @@ func readProto(r io.Reader, size uint32, msg proto.Message) error {
 // resolvePointFromIndex resolves V2PointData to cachemodel.Point using the string index.
 func resolvePointFromIndex(index []uint32, dataBlock []byte, data V2PointData) cachemodel.Point {
 	return cachemodel.Point{
-		X: 0, Y: 0, // coords not available in streaming path
+		// coordinates are set by the caller from the KD-tree
 		Data: cachemodel.Info{
 			Name:        unique.Make(readStrByID(index, dataBlock, data.NameID)),
 			Street:      unique.Make(readStrByID(index, dataBlock, data.StreetID)),
@@ -305,10 +462,14 @@ func parseV2Zones(data []byte) ([]cachemodel.Zone, error) {
 			continue
 		}
 		for _, z := range blob.Zones {
+			bounds, err := mapBoundsFromV2(z.Bounds)
+			if err != nil {
+				return nil, fmt.Errorf("v2: zone %q: %w", z.Name, err)
+			}
 			zones = append(zones, cachemodel.Zone{
 				Type:    zt,
 				Name:    unique.Make(string(z.Name)),
-				Bounds:  mapBoundsFromV2(z.Bounds),
+				Bounds:  bounds,
 				Polygon: mapMultiPolygonFromV2(z.MultiPolygon),
 			})
 		}
@@ -1,7 +1,10 @@
 package savev2
 
 import (
+	"math"
 	"testing"
+
+	"github.com/paulmach/orb"
 )
 
 func TestV2PointDataRoundTrip(t *testing.T) {
@@ -78,3 +81,47 @@ func TestV2PointDataZeroValues(t *testing.T) {
 		t.Fatalf("round-trip mismatch: %+v != %+v", decoded, orig)
 	}
 }
+
+func TestV2FootprintRoundTrip(t *testing.T) {
+	orig := V2Footprint{
+		PointIdx: 42,
+		Ring: orb.Ring{
+			{30.3930866, 59.9176846},
+			{30.3931866, 59.9176846},
+			{30.3931866, 59.9177846},
+			{30.3930866, 59.9176846},
+		},
+	}
+
+	data, err := orig.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(data) != 8+len(orig.Ring)*8 {
+		t.Fatalf("expected %d bytes, got %d", 8+len(orig.Ring)*8, len(data))
+	}
+
+	var decoded V2Footprint
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.PointIdx != orig.PointIdx {
+		t.Fatalf("PointIdx mismatch: %d != %d", decoded.PointIdx, orig.PointIdx)
+	}
+	if len(decoded.Ring) != len(orig.Ring) {
+		t.Fatalf("ring length mismatch: %d != %d", len(decoded.Ring), len(orig.Ring))
+	}
+	for i := range orig.Ring {
+		if math.Abs(decoded.Ring[i][0]-orig.Ring[i][0]) > 1e-7 || math.Abs(decoded.Ring[i][1]-orig.Ring[i][1]) > 1e-7 {
+			t.Errorf("vertex %d mismatch: %v != %v", i, decoded.Ring[i], orig.Ring[i])
+		}
+	}
+}
+
+func TestV2FootprintUnmarshalShort(t *testing.T) {
+	var f V2Footprint
+	data := []byte{1, 0, 0, 0, 3, 0, 0, 0} // claims 3 vertices, has none
+	if err := f.UnmarshalBinary(data); err == nil {
+		t.Fatal("expected error for truncated footprint")
+	}
+}
@@ -1,6 +1,8 @@
 package savev2
 
 import (
+	"errors"
+
 	"github.com/paulmach/orb"
 	savev2proto "github.com/royalcat/rgeocache/cachesaver/save/v2/proto"
 )
@@ -20,14 +22,17 @@ func mapBoundsToV2(bounds orb.Bound) *savev2proto.Bounds {
 	}
 }
 
-func mapBoundsFromV2(bounds *savev2proto.Bounds) orb.Bound {
+func mapBoundsFromV2(bounds *savev2proto.Bounds) (orb.Bound, error) {
 	if bounds == nil {
-		return orb.Bound{}
+		return orb.Bound{}, nil
+	}
+	if bounds.Max == nil || bounds.Min == nil {
+		return orb.Bound{}, errors.New("bounds without min or max corner")
 	}
 	return orb.Bound{
 		Max: orb.Point{float64(bounds.Max.Lon), float64(bounds.Max.Lat)},
 		Min: orb.Point{float64(bounds.Min.Lon), float64(bounds.Min.Lat)},
-	}
+	}, nil
 }
 
 func mapMultiPolygonToV2(mpolygon orb.MultiPolygon) *savev2proto.MultiPolygon {
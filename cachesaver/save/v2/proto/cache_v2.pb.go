@@ -22,13 +22,15 @@ const (
 )
 
 type V2Header struct {
-	state            protoimpl.MessageState `protogen:"open.v1"`
-	MetadataSize     uint32                 `protobuf:"varint,1,opt,name=metadata_size,json=metadataSize,proto3" json:"metadata_size,omitempty"`
-	StringsIndexSize uint32                 `protobuf:"varint,4,opt,name=strings_index_size,json=stringsIndexSize,proto3" json:"strings_index_size,omitempty"` // total bytes for offset index (N unique strings × 4)
-	StringsDataSize  uint32                 `protobuf:"varint,5,opt,name=strings_data_size,json=stringsDataSize,proto3" json:"strings_data_size,omitempty"`    // total bytes for null-terminated string data
-	ZonesSize        uint32                 `protobuf:"varint,3,opt,name=zones_size,json=zonesSize,proto3" json:"zones_size,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	state               protoimpl.MessageState `protogen:"open.v1"`
+	MetadataSize        uint32                 `protobuf:"varint,1,opt,name=metadata_size,json=metadataSize,proto3" json:"metadata_size,omitempty"`
+	StringsIndexSize    uint32                 `protobuf:"varint,4,opt,name=strings_index_size,json=stringsIndexSize,proto3" json:"strings_index_size,omitempty"` // total bytes for offset index (N unique strings × 4)
+	StringsDataSize     uint32                 `protobuf:"varint,5,opt,name=strings_data_size,json=stringsDataSize,proto3" json:"strings_data_size,omitempty"`    // total bytes for null-terminated string data
+	ZonesSize           uint32                 `protobuf:"varint,3,opt,name=zones_size,json=zonesSize,proto3" json:"zones_size,omitempty"`
+	FootprintsSize      uint64                 `protobuf:"varint,6,opt,name=footprints_size,json=footprintsSize,proto3" json:"footprints_size,omitempty"`                   // total bytes for the building footprints KDBH block, 0 when not stored
+	FootprintsMaxExtent float64                `protobuf:"fixed64,7,opt,name=footprints_max_extent,json=footprintsMaxExtent,proto3" json:"footprints_max_extent,omitempty"` // max centroid to vertex distance over all stored footprints, degrees
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
 }
 
 func (x *V2Header) Reset() {
@@ -89,6 +91,20 @@ func (x *V2Header) GetZonesSize() uint32 {
 	return 0
 }
 
+func (x *V2Header) GetFootprintsSize() uint64 {
+	if x != nil {
+		return x.FootprintsSize
+	}
+	return 0
+}
+
+func (x *V2Header) GetFootprintsMaxExtent() float64 {
+	if x != nil {
+		return x.FootprintsMaxExtent
+	}
+	return 0
+}
+
 type V2ZonesSection struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Blobs         []*V2ZoneBlob          `protobuf:"bytes,1,rep,name=blobs,proto3" json:"blobs,omitempty"`
@@ -485,13 +501,15 @@ var File_cache_v2_proto protoreflect.FileDescriptor
 
 const file_cache_v2_proto_rawDesc = "" +
 	"\n" +
-	"\x0ecache_v2.proto\x12\x12cachesaver.save.v2\"\xa8\x01\n" +
+	"\x0ecache_v2.proto\x12\x12cachesaver.save.v2\"\x85\x02\n" +
 	"\bV2Header\x12#\n" +
 	"\rmetadata_size\x18\x01 \x01(\rR\fmetadataSize\x12,\n" +
 	"\x12strings_index_size\x18\x04 \x01(\rR\x10stringsIndexSize\x12*\n" +
 	"\x11strings_data_size\x18\x05 \x01(\rR\x0fstringsDataSize\x12\x1d\n" +
 	"\n" +
-	"zones_size\x18\x03 \x01(\rR\tzonesSize\"F\n" +
+	"zones_size\x18\x03 \x01(\rR\tzonesSize\x12'\n" +
+	"\x0ffootprints_size\x18\x06 \x01(\x04R\x0efootprintsSize\x122\n" +
+	"\x15footprints_max_extent\x18\a \x01(\x01R\x13footprintsMaxExtent\"F\n" +
 	"\x0eV2ZonesSection\x124\n" +
 	"\x05blobs\x18\x01 \x03(\v2\x1e.cachesaver.save.v2.V2ZoneBlobR\x05blobs\"[\n" +
 	"\n" +
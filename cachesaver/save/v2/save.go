@@ -1,13 +1,14 @@
 package savev2
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 	"iter"
-	"time"
 
+	"github.com/paulmach/orb"
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
-	savev1proto "github.com/royalcat/rgeocache/cachesaver/save/v1/proto"
+	savev1 "github.com/royalcat/rgeocache/cachesaver/save/v1"
 	savev2proto "github.com/royalcat/rgeocache/cachesaver/save/v2/proto"
 	"github.com/royalcat/rgeocache/kdbush"
 	"google.golang.org/protobuf/proto"
@@ -27,8 +28,20 @@ const defaultNodeSize = kdbush.DefaultNodeSize
 //	[..+I]       offset index: []uint32 (N unique strings × 4)
 //	[..+D]       string data block (null-terminated concatenation)
 //	[..+S]       ZonesSection protobuf (V2ZonesSection)
+//	[..+F]       footprints KDBH block (V2Footprint), present only if any point has a footprint
 //	[..+Z]       KDBH binary block
-func Save(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata) error {
+//
+// opts are passed to both KD-tree builds, e.g. [kdbush.WithThreads].
+func Save(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, opts ...kdbush.BuildOption) error {
+	return Encode(points, zones, meta, func(e *Encoded) error {
+		return e.writeV2(w)
+	}, opts...)
+}
+
+// Encode encodes the sections of a cache in memory and passes them to
+// write, which lays them out, see [Save].  opts are passed to both KD-tree
+// builds.
+func Encode(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, write func(*Encoded) error, opts ...kdbush.BuildOption) error {
 	dedup := newStringsDedup()
 
 	// Phase 1: Materialize points with placeholder data.
@@ -39,7 +52,20 @@ func Save(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemo
 		weight                                  uint8
 	}
 	var rawPoints []rawPoint
+	var footprints []kdbush.Point[V2Footprint]
+	var footprintsMaxExtent float64
 	for p := range points {
+		if len(p.Data.Footprint) >= 4 {
+			extent := FootprintExtent(orb.Point{p.X, p.Y}, p.Data.Footprint)
+			if extent <= MaxFootprintExtent {
+				footprints = append(footprints, kdbush.Point[V2Footprint]{
+					X: p.X, Y: p.Y,
+					Data: V2Footprint{PointIdx: uint32(len(rawPoints)), Ring: p.Data.Footprint},
+				})
+				footprintsMaxExtent = max(footprintsMaxExtent, extent)
+			}
+		}
+
 		rawPoints = append(rawPoints, rawPoint{
 			x: p.X, y: p.Y,
 			name:        p.Data.Name.Value(),
@@ -57,10 +83,7 @@ func Save(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemo
 		dedup.regions.Add(p.Data.Region.Value())
 	}
 
-	// Phase 2: Build offset index and null-terminated string data block
-	offsetIndex, stringData := buildStringIndex(dedup)
-
-	// Phase 3: Fill V2PointData using the assigned IDs
+	// Phase 2: Fill V2PointData using the assigned IDs
 	v2points := make([]kdbush.Point[V2PointData], len(rawPoints))
 	for i, rp := range rawPoints {
 		v2points[i] = kdbush.Point[V2PointData]{
@@ -77,63 +100,116 @@ func Save(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemo
 	}
 	rawPoints = nil // release to GC
 
-	// Phase 4: Materialize zones with inline names
-	zonesSection := buildZonesSection(zones)
-	zonesBytes, err := proto.Marshal(zonesSection)
+	// Phase 3: Build the footprints block, it's small enough to be buffered
+	// to know its size for the header.
+	var footprintsBuf bytes.Buffer
+	if len(footprints) > 0 {
+		if _, err := kdbush.BuildDisk[V2Footprint, *V2Footprint](footprints, defaultNodeSize, &footprintsBuf, opts...); err != nil {
+			return err
+		}
+		footprints = nil // release to GC
+	}
+
+	// Phase 4: Encode the remaining sections and hand everything to the layout
+	e, err := encodeSections(dedup, zones, meta)
 	if err != nil {
 		return err
 	}
+	e.FootprintsSize = int64(footprintsBuf.Len())
+	e.FootprintsMaxExtent = footprintsMaxExtent
+	e.WriteFootprints = func(w io.Writer) error {
+		_, err := footprintsBuf.WriteTo(w)
+		return err
+	}
+	e.WritePoints = func(w io.Writer) error {
+		_, err := kdbush.BuildDisk[V2PointData, *V2PointData](v2points, defaultNodeSize, w, opts...)
+		return err
+	}
+	return write(e)
+}
+
+// Encoded holds the sections of a cache ready to be written.  The v2 layout
+// chains them after a V2Header, containers like v3 place them freely.
+type Encoded struct {
+	Metadata     []byte // CacheMetadata protobuf
+	StringsIndex []byte // offset index: []uint32
+	StringsData  []byte // null-terminated strings
+	Zones        []byte // V2ZonesSection protobuf
+
+	// FootprintsSize is the size of the footprints KDBH block, zero when no
+	// point has a footprint.
+	FootprintsSize int64
+	// FootprintsMaxExtent is the search radius needed to find every footprint containing a point.
+	FootprintsMaxExtent float64
+	// WriteFootprints writes the footprints KDBH block, it's called only
+	// when FootprintsSize is not zero.
+	WriteFootprints func(w io.Writer) error
+	// WritePoints writes the points KDBH block.
+	WritePoints func(w io.Writer) error
+}
 
-	// Phase 5: Marshal metadata
-	metadataProto := &savev1proto.CacheMetadata{
-		Version:     meta.Version,
-		DateCreated: meta.DateCreated.Format(time.RFC3339),
-		Locale:      meta.Locale,
+// encodeSections encodes metadata, string index, string data and zones.
+func encodeSections(dedup *stringsDedup, zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata) (*Encoded, error) {
+	// Build offset index and null-terminated string data block
+	offsetIndex, stringData := buildStringIndex(dedup)
+	indexBytes := make([]byte, 0, len(offsetIndex)*4)
+	for _, off := range offsetIndex {
+		indexBytes = binary.LittleEndian.AppendUint32(indexBytes, off)
 	}
-	metadataBytes, err := proto.Marshal(metadataProto)
+
+	// Materialize zones with inline names
+	zonesSection := buildZonesSection(zones)
+	zonesBytes, err := proto.Marshal(zonesSection)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	metadataBytes, err := proto.Marshal(savev1.MetadataProto(meta))
+	if err != nil {
+		return nil, err
 	}
 
-	// Phase 6: V2Header
+	return &Encoded{
+		Metadata:     metadataBytes,
+		StringsIndex: indexBytes,
+		StringsData:  stringData,
+		Zones:        zonesBytes,
+	}, nil
+}
+
+// writeV2 writes the V2Header and every section after it.
+func (e *Encoded) writeV2(w io.Writer) error {
 	header := &savev2proto.V2Header{
-		MetadataSize:     uint32(len(metadataBytes)),
-		StringsIndexSize: uint32(len(offsetIndex) * 4),
-		StringsDataSize:  uint32(len(stringData)),
-		ZonesSize:        uint32(len(zonesBytes)),
+		MetadataSize:        uint32(len(e.Metadata)),
+		StringsIndexSize:    uint32(len(e.StringsIndex)),
+		StringsDataSize:     uint32(len(e.StringsData)),
+		ZonesSize:           uint32(len(e.Zones)),
+		FootprintsSize:      uint64(e.FootprintsSize),
+		FootprintsMaxExtent: e.FootprintsMaxExtent,
 	}
 	headerBytes, err := proto.Marshal(header)
 	if err != nil {
 		return err
 	}
 
-	// Phase 7: Write everything sequentially
 	if err := binary.Write(w, binary.LittleEndian, uint32(len(headerBytes))); err != nil {
 		return err
 	}
 	if _, err := w.Write(headerBytes); err != nil {
 		return err
 	}
-	if _, err := w.Write(metadataBytes); err != nil {
-		return err
-	}
-	// Write offset index as raw uint32 array
-	if err := binary.Write(w, binary.LittleEndian, offsetIndex); err != nil {
-		return err
-	}
-	if _, err := w.Write(stringData); err != nil {
-		return err
+	for _, section := range [][]byte{e.Metadata, e.StringsIndex, e.StringsData, e.Zones} {
+		if _, err := w.Write(section); err != nil {
+			return err
+		}
 	}
-	if _, err := w.Write(zonesBytes); err != nil {
-		return err
+	if e.FootprintsSize > 0 {
+		if err := e.WriteFootprints(w); err != nil {
+			return err
+		}
 	}
-
 	// KDBH block
-	if _, err := kdbush.BuildDisk[V2PointData, *V2PointData](v2points, defaultNodeSize, w); err != nil {
-		return err
-	}
-
-	return nil
+	return e.WritePoints(w)
 }
 
 // buildZonesSection converts zones to V2ZonesSection proto with inline names and geometry.
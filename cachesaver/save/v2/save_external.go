@@ -0,0 +1,109 @@
+package savev2
+
+import (
+	"io"
+	"iter"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+// ExternalOptions configures [SaveExternal].
+type ExternalOptions struct {
+	// MaxMemory is the number of bytes of KD-tree items kept in memory while
+	// sorting, half of it goes to the points tree and half to the footprints.
+	MaxMemory int64
+	// TempDir holds the spill files, the default temporary directory is used if empty.
+	TempDir string
+	// Threads is the number of goroutines sorting a KD-tree that fits in MaxMemory, 1 if zero.
+	Threads int
+}
+
+// SaveExternal writes the same v2 cache as [Save], byte for byte, but spills
+// points and footprints to temporary files instead of materializing them.
+// The KD-tree order is built with an external sort bounded by opts.MaxMemory.
+//
+// Only the string dedup map stays in memory, it grows with the number of
+// unique strings rather than with the number of points.
+func SaveExternal(w io.Writer, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, opts ExternalOptions) error {
+	return EncodeExternal(points, zones, meta, opts, func(e *Encoded) error {
+		return e.writeV2(w)
+	})
+}
+
+// EncodeExternal is [Encode] with the KD-trees sorted externally, see
+// [SaveExternal].  The KDBH blocks are streamed from the spill files when
+// write calls WriteFootprints and WritePoints.
+func EncodeExternal(points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, opts ExternalOptions, write func(*Encoded) error) error {
+	dedup := newStringsDedup()
+	// both trees are buffered, their budgets add up to opts.MaxMemory
+	treeMemory := max(opts.MaxMemory/2, 1)
+
+	pointsBuilder, err := kdbush.NewExternalBuilder[V2PointData, *V2PointData](defaultNodeSize, treeMemory, opts.TempDir, kdbush.WithThreads(opts.Threads))
+	if err != nil {
+		return err
+	}
+	defer pointsBuilder.Close()
+
+	footprintsBuilder, err := kdbush.NewExternalBuilder[V2Footprint, *V2Footprint](defaultNodeSize, treeMemory, opts.TempDir, kdbush.WithThreads(opts.Threads))
+	if err != nil {
+		return err
+	}
+	defer footprintsBuilder.Close()
+
+	// Phase 1: Spill points, string IDs are assigned in the same order as Save does.
+	var footprintsMaxExtent float64
+	for p := range points {
+		pointIdx := uint32(pointsBuilder.NumPoints())
+
+		if len(p.Data.Footprint) >= 4 {
+			extent := FootprintExtent(orb.Point{p.X, p.Y}, p.Data.Footprint)
+			if extent <= MaxFootprintExtent {
+				err := footprintsBuilder.Add(kdbush.Point[V2Footprint]{
+					X: p.X, Y: p.Y,
+					Data: V2Footprint{PointIdx: pointIdx, Ring: p.Data.Footprint},
+				})
+				if err != nil {
+					return err
+				}
+				footprintsMaxExtent = max(footprintsMaxExtent, extent)
+			}
+		}
+
+		err := pointsBuilder.Add(kdbush.Point[V2PointData]{
+			X: p.X, Y: p.Y,
+			Data: V2PointData{
+				NameID:        dedup.names.Add(p.Data.Name.Value()),
+				StreetID:      dedup.streets.Add(p.Data.Street.Value()),
+				HouseNumberID: dedup.houseNumbers.Add(p.Data.HouseNumber.Value()),
+				CityID:        dedup.cities.Add(p.Data.City.Value()),
+				RegionID:      dedup.regions.Add(p.Data.Region.Value()),
+				Weight:        p.Data.Weight,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Phase 2: Encode the remaining sections, the KDBH blocks are sorted
+	// and streamed by the layout
+	e, err := encodeSections(dedup, zones, meta)
+	if err != nil {
+		return err
+	}
+	if footprintsBuilder.NumPoints() > 0 {
+		e.FootprintsSize = footprintsBuilder.Size()
+	}
+	e.FootprintsMaxExtent = footprintsMaxExtent
+	e.WriteFootprints = func(w io.Writer) error {
+		_, err := footprintsBuilder.WriteTo(w)
+		return err
+	}
+	e.WritePoints = func(w io.Writer) error {
+		_, err := pointsBuilder.WriteTo(w)
+		return err
+	}
+	return write(e)
+}
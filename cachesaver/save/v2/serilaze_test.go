@@ -2,12 +2,19 @@ package savev2
 
 import (
 	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 	"unique"
 
 	"github.com/paulmach/orb"
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"github.com/royalcat/rgeocache/kdbush"
+	"golang.org/x/exp/mmap"
 )
 
 func makeTestMetadata() cachemodel.Metadata {
@@ -133,6 +140,10 @@ func TestSaveLoadRoundTrip(t *testing.T) {
 		if lp.Data.Weight != p.Data.Weight {
 			t.Errorf("Point[%d] Weight mismatch: %d != %d", i, lp.Data.Weight, p.Data.Weight)
 		}
+		// coordinates are stored as fixed-point
+		if math.Abs(lp.X-p.X) > 1e-6 || math.Abs(lp.Y-p.Y) > 1e-6 {
+			t.Errorf("Point[%d] coordinates mismatch: (%v, %v) != (%v, %v)", i, lp.X, lp.Y, p.X, p.Y)
+		}
 	}
 
 	// Verify zone names
@@ -197,3 +208,204 @@ func sliceToSeq[T any](slice []T) func(yield func(T) bool) {
 		}
 	}
 }
+
+func TestSaveLoadFootprints(t *testing.T) {
+	footprint := orb.Ring{{10, 10}, {10.001, 10}, {10.001, 10.001}, {10, 10.001}, {10, 10}}
+	points := []cachemodel.Point{
+		{X: 10.0005, Y: 10.0005, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Main Street"),
+			HouseNumber: unique.Make("1"),
+			City:        unique.Make("Town"),
+			Region:      unique.Make(""),
+			Weight:      10,
+			Footprint:   footprint,
+		}},
+		{X: 10.002, Y: 10.002, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Main Street"),
+			HouseNumber: unique.Make("2"),
+			City:        unique.Make("Town"),
+			Region:      unique.Make(""),
+			Weight:      10,
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := Save(&buf, sliceToSeq(points), sliceToSeq([]cachemodel.Zone{}), makeTestMetadata()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	pointsIter, _, _, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var loaded []cachemodel.Point
+	for p, err := range pointsIter {
+		if err != nil {
+			t.Fatalf("point error: %v", err)
+		}
+		loaded = append(loaded, p)
+	}
+	if len(loaded) != 2 {
+		t.Fatalf("Points count mismatch: %d != 2", len(loaded))
+	}
+	if len(loaded[0].Data.Footprint) != len(footprint) {
+		t.Errorf("Point[0] footprint has %d vertices, want %d", len(loaded[0].Data.Footprint), len(footprint))
+	}
+	if loaded[1].Data.Footprint != nil {
+		t.Errorf("Point[1] has unexpected footprint %v", loaded[1].Data.Footprint)
+	}
+
+	path := filepath.Join(t.TempDir(), "footprints.rgc")
+	if err := os.WriteFile(path, append([]byte("RGEO\x02\x00\x00\x00"), buf.Bytes()...), 0o644); err != nil {
+		t.Fatalf("write cache: %v", err)
+	}
+	r, err := mmap.Open(path)
+	if err != nil {
+		t.Fatalf("mmap.Open: %v", err)
+	}
+	defer r.Close()
+
+	result, err := LoadMmap(r)
+	if err != nil {
+		t.Fatalf("LoadMmap failed: %v", err)
+	}
+	if result.Footprints == nil || result.Footprints.NumPoints() != 1 {
+		t.Fatalf("expected 1 footprint in mmap result")
+	}
+	if result.DiskBush.NumPoints() != 2 {
+		t.Fatalf("expected 2 points in mmap result, got %d", result.DiskBush.NumPoints())
+	}
+
+	var found []V2Footprint
+	err = result.Footprints.Within(10.0002, 10.0002, result.FootprintsMaxExtent, func(p kdbush.Point[V2Footprint]) bool {
+		found = append(found, p.Data)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Within failed: %v", err)
+	}
+	if len(found) != 1 || found[0].PointIdx != 0 {
+		t.Fatalf("expected footprint of point 0, got %+v", found)
+	}
+}
+
+func TestSaveExternalByteIdentical(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	streets := []string{"", "Main Street", "Second Street", "Park Lane"}
+	square := func(x, y float64) orb.Ring {
+		const d = 0.0001
+		return orb.Ring{{x - d, y - d}, {x + d, y - d}, {x + d, y + d}, {x - d, y + d}, {x - d, y - d}}
+	}
+
+	var points []cachemodel.Point
+	for i := range 5_000 {
+		x, y := rng.Float64()*10, rng.Float64()*10
+		p := cachemodel.Point{X: x, Y: y, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make(streets[rng.Intn(len(streets))]),
+			HouseNumber: unique.Make(strconv.Itoa(rng.Intn(100))),
+			City:        unique.Make("City"),
+			Region:      unique.Make("Region"),
+			Weight:      uint8(i % 10),
+		}}
+		if i%3 == 0 {
+			p.Data.Footprint = square(x, y)
+		}
+		points = append(points, p)
+	}
+	zones := []cachemodel.Zone{{
+		Type:   cachemodel.ZoneRegion,
+		Name:   unique.Make("Region"),
+		Bounds: orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}},
+	}}
+
+	var want bytes.Buffer
+	if err := Save(&want, sliceToSeq(points), sliceToSeq(zones), makeTestMetadata()); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	for _, maxMemory := range []int64{1 << 30, 4 << 10} {
+		var got bytes.Buffer
+		err := SaveExternal(&got, sliceToSeq(points), sliceToSeq(zones), makeTestMetadata(), ExternalOptions{
+			MaxMemory: maxMemory,
+			TempDir:   t.TempDir(),
+		})
+		if err != nil {
+			t.Fatalf("SaveExternal failed: %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("maxMemory %d: SaveExternal output differs from Save", maxMemory)
+		}
+	}
+}
+
+func TestLoadMmapPoints(t *testing.T) {
+	square := func(x, y float64) orb.Ring {
+		const d = 0.0001
+		return orb.Ring{{x - d, y - d}, {x + d, y - d}, {x + d, y + d}, {x - d, y + d}, {x - d, y - d}}
+	}
+	var points []cachemodel.Point
+	for i := range 1_000 {
+		p := cachemodel.Point{X: float64(i) * 0.01, Y: -float64(i) * 0.02, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Street " + strconv.Itoa(i%7)),
+			HouseNumber: unique.Make(strconv.Itoa(i)),
+			City:        unique.Make("City"),
+			Region:      unique.Make(""),
+			Weight:      uint8(i % 11),
+		}}
+		if i%100 == 0 {
+			p.Data.Footprint = square(p.X, p.Y)
+		}
+		points = append(points, p)
+	}
+
+	for _, layout := range []kdbush.DiskLayout{kdbush.LayoutFlat, kdbush.LayoutBlocked} {
+		buf := bytes.NewBufferString("RGEO\x02\x00\x00\x00")
+		if err := Save(buf, sliceToSeq(points), sliceToSeq([]cachemodel.Zone{}), makeTestMetadata(), kdbush.WithLayout(layout)); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		result, err := LoadMmap(kdbush.Bytes(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("LoadMmap failed: %v", err)
+		}
+
+		i := 0
+		for p, err := range result.Points() {
+			if err != nil {
+				t.Fatalf("layout %d: point error: %v", layout, err)
+			}
+			want := points[i]
+			// coordinates are stored as fixed-point
+			if math.Abs(p.X-want.X) > 1e-6 || math.Abs(p.Y-want.Y) > 1e-6 || p.Data.HouseNumber != want.Data.HouseNumber ||
+				p.Data.Street != want.Data.Street || p.Data.Weight != want.Data.Weight || len(p.Data.Footprint) != len(want.Data.Footprint) {
+				t.Fatalf("layout %d: point %d = %+v, want %+v", layout, i, p, want)
+			}
+			i++
+		}
+		if i != len(points) {
+			t.Errorf("layout %d: %d points, want %d", layout, i, len(points))
+		}
+
+		// the streaming path reads the coordinates from the tree section too
+		pointsIter, _, _, err := Load(bytes.NewReader(buf.Bytes()[8:]))
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		i = 0
+		for p, err := range pointsIter {
+			if err != nil {
+				t.Fatalf("layout %d: streamed point error: %v", layout, err)
+			}
+			if want := points[i]; math.Abs(p.X-want.X) > 1e-6 || math.Abs(p.Y-want.Y) > 1e-6 || p.Data.HouseNumber != want.Data.HouseNumber {
+				t.Fatalf("layout %d: streamed point %d = %+v, want %+v", layout, i, p, want)
+			}
+			i++
+		}
+		if i != len(points) {
+			t.Errorf("layout %d: %d streamed points, want %d", layout, i, len(points))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package savev2
+
+import (
+	"fmt"
+	"io"
+)
+
+// Verify checks a v2 cache of size bytes read from r, starting with the magic
+// bytes: the section sizes of the header against size, then the content of
+// the sections with [VerifySections].  It reads the whole file.
+func Verify(r io.ReaderAt, size int64) error {
+	s, err := readSections(r, size)
+	if err != nil {
+		return fmt.Errorf("v2 verify: %w", err)
+	}
+	for _, part := range []struct {
+		name    string
+		section Section
+	}{
+		{"metadata", s.Metadata},
+		{"strings index", s.StringsIndex},
+		{"strings data", s.StringsData},
+		{"zones", s.Zones},
+		{"footprints", s.Footprints},
+	} {
+		if end := part.section.Offset + part.section.Size; part.section.Size < 0 || end < part.section.Offset || end > size {
+			return fmt.Errorf("v2 verify: %s section of %d bytes at %d doesn't fit the file of %d bytes",
+				part.name, part.section.Size, part.section.Offset, size)
+		}
+	}
+	s.Points.Size = size - s.Points.Offset
+
+	if err := VerifySections(s); err != nil {
+		return fmt.Errorf("v2 verify: %w", err)
+	}
+	return nil
+}
+
+// VerifySections opens the sections like [OpenSections] and checks their
+// content: the structure of the KD-trees, the string IDs of every point
+// against the string index, the point indices of the footprints and the
+// rings of the zone polygons.  Sizes of KDBH blocks are checked against
+// their Section.Size.
+func VerifySections(s Sections) error {
+	if s.StringsIndex.Size%4 != 0 {
+		return fmt.Errorf("string index of %d bytes is not a multiple of 4", s.StringsIndex.Size)
+	}
+	r, err := OpenSections(s, nil)
+	if err != nil {
+		return err
+	}
+
+	for id, off := range r.StringsIndex {
+		if id > 0 && int64(off) >= s.StringsData.Size {
+			return fmt.Errorf("string %d at offset %d is outside the string data of %d bytes", id, off, s.StringsData.Size)
+		}
+	}
+
+	if err := r.DiskBush.Verify(s.Points.Size); err != nil {
+		return fmt.Errorf("points: %w", err)
+	}
+	numStrings := uint32(len(r.StringsIndex))
+	for i := range r.DiskBush.NumPoints() {
+		data, err := r.DiskBush.PointData(i)
+		if err != nil {
+			return fmt.Errorf("points: %w", err)
+		}
+		for _, field := range []struct {
+			name string
+			id   uint32
+		}{
+			{"name", data.NameID},
+			{"street", data.StreetID},
+			{"house number", data.HouseNumberID},
+			{"city", data.CityID},
+			{"region", data.RegionID},
+		} {
+			// ID 0 is the empty string and never looked up
+			if field.id != 0 && field.id >= numStrings {
+				return fmt.Errorf("point %d: %s id %d is outside the string index of %d strings", i, field.name, field.id, numStrings)
+			}
+		}
+	}
+
+	if r.Footprints != nil {
+		if err := r.Footprints.Verify(s.Footprints.Size); err != nil {
+			return fmt.Errorf("footprints: %w", err)
+		}
+		for i := range r.Footprints.NumPoints() {
+			fp, err := r.Footprints.PointData(i)
+			if err != nil {
+				return fmt.Errorf("footprints: %w", err)
+			}
+			if int(fp.PointIdx) >= r.DiskBush.NumPoints() {
+				return fmt.Errorf("footprint %d refers to point %d of %d", i, fp.PointIdx, r.DiskBush.NumPoints())
+			}
+		}
+	}
+
+	for _, z := range r.Zones {
+		if err := z.CheckRings(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
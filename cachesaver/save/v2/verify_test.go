@@ -0,0 +1,106 @@
+package savev2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev2proto "github.com/royalcat/rgeocache/cachesaver/save/v2/proto"
+	"github.com/royalcat/rgeocache/kdbush"
+	"google.golang.org/protobuf/proto"
+)
+
+func saveVerifyCache(t *testing.T, ring orb.Ring, opts ...kdbush.BuildOption) []byte {
+	t.Helper()
+	var points []cachemodel.Point
+	for i := range 500 {
+		p := cachemodel.Point{X: float64(i) * 0.001, Y: float64(i) * 0.002, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Street " + strconv.Itoa(i%5)),
+			HouseNumber: unique.Make(strconv.Itoa(i)),
+			City:        unique.Make("City"),
+			Region:      unique.Make("Region"),
+		}}
+		if i%50 == 0 {
+			const d = 0.0001
+			p.Data.Footprint = orb.Ring{{p.X - d, p.Y - d}, {p.X + d, p.Y - d}, {p.X + d, p.Y + d}, {p.X - d, p.Y - d}}
+		}
+		points = append(points, p)
+	}
+	zones := []cachemodel.Zone{{
+		Type:    cachemodel.ZoneRegion,
+		Name:    unique.Make("Region"),
+		Bounds:  orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}},
+		Polygon: orb.MultiPolygon{{ring}},
+	}}
+
+	buf := bytes.NewBufferString("RGEO\x02\x00\x00\x00")
+	if err := Save(buf, sliceToSeq(points), sliceToSeq(zones), makeTestMetadata(), opts...); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	closed := orb.Ring{{0, 0}, {1, 0}, {1, 1}, {0, 0}}
+	for _, layout := range []kdbush.DiskLayout{kdbush.LayoutFlat, kdbush.LayoutBlocked} {
+		b := saveVerifyCache(t, closed, kdbush.WithLayout(layout))
+		if err := Verify(kdbush.Bytes(b), int64(len(b))); err != nil {
+			t.Errorf("layout %d: Verify failed: %v", layout, err)
+		}
+		if err := Verify(kdbush.Bytes(b), int64(len(b)-1)); err == nil {
+			t.Errorf("layout %d: Verify of a truncated cache succeeded", layout)
+		}
+	}
+
+	b := saveVerifyCache(t, closed)
+	s, err := readSections(kdbush.Bytes(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Points.Size = int64(len(b)) - s.Points.Offset
+	s.StringsIndex.Size = 8 // two strings left
+	if err := VerifySections(s); err == nil || !strings.Contains(err.Error(), "outside the string index") {
+		t.Errorf("VerifySections with a short string index = %v", err)
+	}
+
+	// a damaged zones section which still unmarshals
+	zones, err := proto.Marshal(&savev2proto.V2ZonesSection{Blobs: []*savev2proto.V2ZoneBlob{{
+		ZoneType: 1,
+		Zones:    []*savev2proto.V2Zone{{Name: []byte("Region"), Bounds: &savev2proto.Bounds{Min: &savev2proto.LatLon{}}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = readSections(kdbush.Bytes(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Points.Size = int64(len(b)) - s.Points.Offset
+	s.Zones = Section{Reader: kdbush.Bytes(zones), Size: int64(len(zones))}
+	if err := VerifySections(s); err == nil || !strings.Contains(err.Error(), "without min or max") {
+		t.Errorf("VerifySections with zone bounds missing a corner = %v", err)
+	}
+
+	// a damaged node size of the points tree must fail, not stall the blocked layout
+	b = saveVerifyCache(t, closed, kdbush.WithLayout(kdbush.LayoutBlocked))
+	s, err = readSections(kdbush.Bytes(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint64(b[s.Points.Offset+8:], math.MaxUint64-1) // node size -2
+	if err := Verify(kdbush.Bytes(b), int64(len(b))); err == nil || !strings.Contains(err.Error(), "invalid header") {
+		t.Errorf("Verify with a negative node size = %v", err)
+	}
+
+	b = saveVerifyCache(t, orb.Ring{{0, 0}, {1, 0}, {1, 1}, {0, 1}})
+	if err := Verify(kdbush.Bytes(b), int64(len(b))); err == nil || !strings.Contains(err.Error(), "not a closed ring") {
+		t.Errorf("Verify with an open zone ring = %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package savev3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/dustin/go-humanize"
+)
+
+// PrintCacheAnalysis reads the header of a v3 cache from r and prints the
+// sections with their stored and raw sizes.  The reader must be positioned
+// immediately after the magic bytes and compatibility level.
+func PrintCacheAnalysis(r io.Reader) error {
+	page := make([]byte, HeaderSize)
+	copy(page, "RGEO")
+	binary.LittleEndian.PutUint32(page[4:], COMPATIBILITY_LEVEL)
+	if _, err := io.ReadFull(r, page[8:]); err != nil {
+		return fmt.Errorf("v3 analyze: failed to read header: %w", err)
+	}
+	header, err := ParseHeader(page)
+	if err != nil {
+		return err
+	}
+
+	var total, raw int64 = HeaderSize, HeaderSize
+	for _, e := range header.sorted() {
+		compression := ""
+		if e.Flags&FlagZstd != 0 {
+			compression = fmt.Sprintf(" (zstd, %s raw)", humanize.Bytes(uint64(e.RawSize)))
+		}
+		fmt.Printf("%s size: %s at %d, crc32c %08x%s\n", e.Kind, humanize.Bytes(uint64(e.Size)), e.Offset, e.Checksum, compression)
+		total = e.End()
+		raw += e.RawSize
+	}
+	fmt.Printf("Free TOC slots: %d of %d\n", TOCSlots-len(header.Entries), TOCSlots)
+	fmt.Printf("Total size: %s, uncompressed sections: %s\n", humanize.Bytes(uint64(total)), humanize.Bytes(uint64(raw)))
+	return nil
+}
@@ -0,0 +1,3 @@
+package savev3
+
+const COMPATIBILITY_LEVEL uint32 = 3
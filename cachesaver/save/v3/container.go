@@ -0,0 +1,311 @@
+package savev3
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+)
+
+// ---------------------------------------------------------------------------
+// Container layout
+// ---------------------------------------------------------------------------
+
+// A v3 cache is a container of sections located by a fixed table of
+// contents in the first page:
+//
+//	[0..3]        "RGEO" magic
+//	[4..7]        uint32 compat level = 3
+//	[8..11]       uint32 section alignment = 4096
+//	[12..15]      uint32 number of TOC slots = 16
+//	[16..784)     TOC: 16 slots × 48 bytes
+//	[784..788)    uint32 CRC32C of bytes [0..784)
+//	[788..4096)   zero
+//	[4096..)      sections, each starting on an aligned offset
+//
+// TOC slot (all little endian):
+//
+//	[0..4)    uint32 section kind, 0 for a free slot
+//	[4..8)    uint32 flags
+//	[8..16)   uint64 offset from the start of the file
+//	[16..24)  uint64 stored size
+//	[24..32)  uint64 size after decompression
+//	[32..40)  uint64 section specific value, e.g. the max footprint extent
+//	[40..44)  uint32 CRC32C of the stored bytes
+//	[44..48)  reserved, zero
+//
+// The sections hold the same encodings as v2, so KDBH blocks start on a
+// page boundary and the pages of the blocked layout are pages of the file.
+// Free slots are reserved for sections added later: readers skip kinds they
+// don't know unless the section is flagged [FlagRequired].
+
+const (
+	// HeaderSize is the size of the first page holding the TOC.
+	HeaderSize = 4096
+	// SectionAlignment is the alignment of section offsets.
+	SectionAlignment = 4096
+	// TOCSlots is the number of slots of the table of contents.
+	TOCSlots = 16
+
+	tocOffset      = 16
+	entrySize      = 48
+	checksumOffset = tocOffset + TOCSlots*entrySize
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// SectionKind identifies the content of a section.
+type SectionKind uint32
+
+const (
+	// SectionMetadata is the CacheMetadata protobuf.
+	SectionMetadata SectionKind = iota + 1
+	// SectionStringsIndex is the []uint32 offset index of the strings.
+	SectionStringsIndex
+	// SectionStringsData is the block of null-terminated strings.
+	SectionStringsData
+	// SectionZones is the V2ZonesSection protobuf.
+	SectionZones
+	// SectionFootprints is the footprints KDBH block, the aux value holds the
+	// bits of the max footprint extent.
+	SectionFootprints
+	// SectionPoints is the points KDBH block.
+	SectionPoints
+
+	// SectionPOIs is reserved for points of interest.
+	SectionPOIs
+	// SectionPostcodes is reserved for postcode areas.
+	SectionPostcodes
+)
+
+var sectionNames = map[SectionKind]string{
+	SectionMetadata:     "metadata",
+	SectionStringsIndex: "strings index",
+	SectionStringsData:  "strings data",
+	SectionZones:        "zones",
+	SectionFootprints:   "footprints",
+	SectionPoints:       "points",
+	SectionPOIs:         "pois",
+	SectionPostcodes:    "postcodes",
+}
+
+func (k SectionKind) String() string {
+	if name, ok := sectionNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("section %d", uint32(k))
+}
+
+// known reports whether this version reads the section.
+func (k SectionKind) known() bool {
+	return k >= SectionMetadata && k <= SectionPoints
+}
+
+// SectionFlags describe how a section is stored.
+type SectionFlags uint32
+
+const (
+	// FlagZstd marks a zstd compressed section.
+	FlagZstd SectionFlags = 1 << iota
+	// FlagRequired marks a section readers must understand to use the cache.
+	FlagRequired
+
+	knownFlags = FlagZstd | FlagRequired
+)
+
+// Entry is a used slot of the table of contents.
+type Entry struct {
+	Kind     SectionKind
+	Flags    SectionFlags
+	Offset   int64
+	Size     int64 // stored size
+	RawSize  int64 // size after decompression
+	Aux      uint64
+	Checksum uint32 // CRC32C of the stored bytes
+}
+
+// End returns the offset of the first byte after the section.
+func (e Entry) End() int64 { return e.Offset + e.Size }
+
+// Header is the parsed first page of a v3 cache.
+type Header struct {
+	// Entries are the used slots in TOC order.
+	Entries []Entry
+}
+
+// Section returns the entry of kind.
+func (h *Header) Section(kind SectionKind) (Entry, bool) {
+	for _, e := range h.Entries {
+		if e.Kind == kind {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// ParseHeader parses and checks the first page of a v3 cache, b holds at
+// least the TOC and its checksum.
+func ParseHeader(b []byte) (*Header, error) {
+	if len(b) < checksumOffset+4 {
+		return nil, fmt.Errorf("v3: header truncated: %d bytes", len(b))
+	}
+	if string(b[0:4]) != "RGEO" {
+		return nil, fmt.Errorf("v3: invalid magic bytes: %q", b[0:4])
+	}
+	if level := binary.LittleEndian.Uint32(b[4:8]); level != COMPATIBILITY_LEVEL {
+		return nil, fmt.Errorf("v3: unexpected compat level %d", level)
+	}
+	if sum := crc32.Checksum(b[:checksumOffset], castagnoli); sum != binary.LittleEndian.Uint32(b[checksumOffset:]) {
+		return nil, errors.New("v3: header checksum mismatch")
+	}
+	if align := binary.LittleEndian.Uint32(b[8:12]); align != SectionAlignment {
+		return nil, fmt.Errorf("v3: unsupported section alignment %d", align)
+	}
+	if slots := binary.LittleEndian.Uint32(b[12:16]); slots != TOCSlots {
+		return nil, fmt.Errorf("v3: unsupported TOC size %d", slots)
+	}
+
+	h := &Header{}
+	for i := range TOCSlots {
+		s := b[tocOffset+i*entrySize:]
+		e := Entry{
+			Kind:     SectionKind(binary.LittleEndian.Uint32(s[0:])),
+			Flags:    SectionFlags(binary.LittleEndian.Uint32(s[4:])),
+			Offset:   int64(binary.LittleEndian.Uint64(s[8:])),
+			Size:     int64(binary.LittleEndian.Uint64(s[16:])),
+			RawSize:  int64(binary.LittleEndian.Uint64(s[24:])),
+			Aux:      binary.LittleEndian.Uint64(s[32:]),
+			Checksum: binary.LittleEndian.Uint32(s[40:]),
+		}
+		if e.Kind == 0 {
+			continue
+		}
+		if err := e.check(); err != nil {
+			return nil, err
+		}
+		if _, ok := h.Section(e.Kind); ok {
+			return nil, fmt.Errorf("v3: duplicate %s section", e.Kind)
+		}
+		h.Entries = append(h.Entries, e)
+	}
+
+	sorted := h.sorted()
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Offset < sorted[i-1].End() {
+			return nil, fmt.Errorf("v3: %s section overlaps %s section", sorted[i].Kind, sorted[i-1].Kind)
+		}
+	}
+	return h, nil
+}
+
+func (e Entry) check() error {
+	switch {
+	case e.Flags&^knownFlags != 0:
+		return fmt.Errorf("v3: %s section has unknown flags %#x", e.Kind, uint32(e.Flags&^knownFlags))
+	case !e.Kind.known() && e.Flags&FlagRequired != 0:
+		return fmt.Errorf("v3: %s section is required but not supported, the cache needs a newer version", e.Kind)
+	case e.Offset < HeaderSize || e.Offset%SectionAlignment != 0:
+		return fmt.Errorf("v3: %s section at unaligned offset %d", e.Kind, e.Offset)
+	case e.Size < 0 || e.RawSize < 0 || e.End() < e.Offset:
+		return fmt.Errorf("v3: %s section has invalid size %d", e.Kind, e.Size)
+	case e.Flags&FlagZstd == 0 && e.RawSize != e.Size:
+		return fmt.Errorf("v3: uncompressed %s section has size %d and raw size %d", e.Kind, e.Size, e.RawSize)
+	}
+	return nil
+}
+
+// sorted returns the entries in file order.
+func (h *Header) sorted() []Entry {
+	return slices.SortedFunc(slices.Values(h.Entries), func(a, b Entry) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+}
+
+// marshal encodes the first page.
+func (h *Header) marshal() ([]byte, error) {
+	if len(h.Entries) > TOCSlots {
+		return nil, fmt.Errorf("v3: %d sections don't fit %d TOC slots", len(h.Entries), TOCSlots)
+	}
+	b := make([]byte, HeaderSize)
+	copy(b, "RGEO")
+	binary.LittleEndian.PutUint32(b[4:], COMPATIBILITY_LEVEL)
+	binary.LittleEndian.PutUint32(b[8:], SectionAlignment)
+	binary.LittleEndian.PutUint32(b[12:], TOCSlots)
+	for i, e := range h.Entries {
+		s := b[tocOffset+i*entrySize:]
+		binary.LittleEndian.PutUint32(s[0:], uint32(e.Kind))
+		binary.LittleEndian.PutUint32(s[4:], uint32(e.Flags))
+		binary.LittleEndian.PutUint64(s[8:], uint64(e.Offset))
+		binary.LittleEndian.PutUint64(s[16:], uint64(e.Size))
+		binary.LittleEndian.PutUint64(s[24:], uint64(e.RawSize))
+		binary.LittleEndian.PutUint64(s[32:], e.Aux)
+		binary.LittleEndian.PutUint32(s[40:], e.Checksum)
+	}
+	binary.LittleEndian.PutUint32(b[checksumOffset:], crc32.Checksum(b[:checksumOffset], castagnoli))
+	return b, nil
+}
+
+// ReadHeader reads and parses the first page of a v3 cache.
+func ReadHeader(r io.ReaderAt) (*Header, error) {
+	page := make([]byte, checksumOffset+4)
+	if _, err := r.ReadAt(page, 0); err != nil {
+		return nil, fmt.Errorf("v3: failed to read header: %w", err)
+	}
+	return ParseHeader(page)
+}
+
+// Verify checks the header of a v3 cache of size bytes, the checksums of all
+// its sections and their content with [savev2.VerifySections].  Unlike
+// loading, which checks only the sections read into memory, it reads the
+// whole file.
+func Verify(r io.ReaderAt, size int64) error {
+	h, err := ReadHeader(r)
+	if err != nil {
+		return err
+	}
+	for _, kind := range []SectionKind{SectionMetadata, SectionStringsIndex, SectionStringsData, SectionZones, SectionPoints} {
+		if _, ok := h.Section(kind); !ok {
+			return fmt.Errorf("v3: missing %s section", kind)
+		}
+	}
+	for _, e := range h.Entries {
+		if e.End() > size {
+			return fmt.Errorf("v3: %s section ends at %d past the end of the file at %d", e.Kind, e.End(), size)
+		}
+		if err := checksum(io.NewSectionReader(r, e.Offset, e.Size), e); err != nil {
+			return err
+		}
+	}
+
+	s, err := mmapSections(r, h)
+	if err != nil {
+		return err
+	}
+	if err := savev2.VerifySections(s); err != nil {
+		return fmt.Errorf("v3: %w", err)
+	}
+	return nil
+}
+
+// checksum reads the stored bytes of e from r and compares their CRC32C.
+func checksum(r io.Reader, e Entry) error {
+	crc := crc32.New(castagnoli)
+	if _, err := io.CopyN(crc, r, e.Size); err != nil {
+		return fmt.Errorf("v3: failed to read %s section: %w", e.Kind, err)
+	}
+	if crc.Sum32() != e.Checksum {
+		return fmt.Errorf("v3: %s section checksum mismatch", e.Kind)
+	}
+	return nil
+}
+
+// footprintsExtent decodes the aux value of the footprints section.
+func footprintsExtent(e Entry) float64 {
+	return math.Float64frombits(e.Aux)
+}
@@ -0,0 +1,190 @@
+package savev3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+
+	"github.com/klauspost/compress/zstd"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+// decoder decompresses sections, DecodeAll is safe for concurrent use.
+var decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+
+// ---------------------------------------------------------------------------
+// Full-memory path: Load from streaming io.Reader
+// ---------------------------------------------------------------------------
+
+// Load reads a v3 cache from r positioned right after the magic bytes and
+// compat level, like [savev2.Load].  Sections are read in file order and
+// their checksums are verified.
+func Load(r io.Reader) (iter.Seq2[cachemodel.Point, error], iter.Seq2[cachemodel.Zone, error], *cachemodel.Metadata, error) {
+	page := make([]byte, HeaderSize)
+	copy(page, "RGEO")
+	binary.LittleEndian.PutUint32(page[4:], COMPATIBILITY_LEVEL)
+	if _, err := io.ReadFull(r, page[8:]); err != nil {
+		return nil, nil, nil, fmt.Errorf("v3 load: failed to read header: %w", err)
+	}
+	header, err := ParseHeader(page)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sections := map[SectionKind]savev2.Section{}
+	pos := int64(HeaderSize)
+	for _, e := range header.sorted() {
+		if _, err := io.CopyN(io.Discard, r, e.Offset-pos); err != nil {
+			return nil, nil, nil, fmt.Errorf("v3 load: failed to skip to %s section: %w", e.Kind, err)
+		}
+		pos = e.End()
+		if !e.Kind.known() {
+			if _, err := io.CopyN(io.Discard, r, e.Size); err != nil {
+				return nil, nil, nil, fmt.Errorf("v3 load: failed to skip %s section: %w", e.Kind, err)
+			}
+			continue
+		}
+		stored := make([]byte, e.Size)
+		if _, err := io.ReadFull(r, stored); err != nil {
+			return nil, nil, nil, fmt.Errorf("v3 load: failed to read %s section: %w", e.Kind, err)
+		}
+		section, err := decode(stored, e)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		sections[e.Kind] = section
+	}
+
+	s, err := locate(header, func(kind SectionKind) (savev2.Section, error) {
+		return sections[kind], nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	result, err := savev2.OpenSections(s, nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("v3 load: %w", err)
+	}
+
+	zonesIter := func(yield func(cachemodel.Zone, error) bool) {
+		for _, z := range result.Zones {
+			if !yield(z, nil) {
+				return
+			}
+		}
+	}
+	return result.Points(), zonesIter, result.Metadata, nil
+}
+
+// ---------------------------------------------------------------------------
+// Low-memory mmap path
+// ---------------------------------------------------------------------------
+
+// LoadMmap opens a v3 cache from a memory-mapped file or any other
+// [io.ReaderAt], like [savev2.LoadMmap].  Uncompressed string data and
+// KD-trees are read on demand, their checksums are checked by [Verify]
+// only.  Every other section is read into memory and checked.
+func LoadMmap(reader io.ReaderAt) (*savev2.LoadMmapResult, error) {
+	header, err := ReadHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := mmapSections(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	closer, _ := reader.(io.Closer)
+	result, err := savev2.OpenSections(s, closer)
+	if err != nil {
+		return nil, fmt.Errorf("v3 mmap: %w", err)
+	}
+	return result, nil
+}
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+// mmapSections locates the sections of header in reader.  Uncompressed
+// string data and KD-trees stay on the reader, other sections are read
+// into memory, checked and decompressed.
+func mmapSections(reader io.ReaderAt, header *Header) (savev2.Sections, error) {
+	return locate(header, func(kind SectionKind) (savev2.Section, error) {
+		e, _ := header.Section(kind)
+		// a truncated file fails here rather than at query time
+		if e.Size > 0 {
+			var last [1]byte
+			if _, err := reader.ReadAt(last[:], e.End()-1); err != nil {
+				return savev2.Section{}, fmt.Errorf("v3 mmap: %s section is truncated: %w", kind, err)
+			}
+		}
+
+		lazy := kind == SectionStringsData || kind == SectionFootprints || kind == SectionPoints
+		if lazy && e.Flags&FlagZstd == 0 {
+			return savev2.Section{Reader: reader, Offset: e.Offset, Size: e.Size}, nil
+		}
+		stored := make([]byte, e.Size)
+		if _, err := reader.ReadAt(stored, e.Offset); err != nil {
+			return savev2.Section{}, fmt.Errorf("v3 mmap: failed to read %s section: %w", kind, err)
+		}
+		return decode(stored, e)
+	})
+}
+
+// locate maps the sections of header with open, the footprints section is optional.
+func locate(header *Header, open func(SectionKind) (savev2.Section, error)) (savev2.Sections, error) {
+	var s savev2.Sections
+	for _, part := range []struct {
+		kind SectionKind
+		dst  *savev2.Section
+	}{
+		{SectionMetadata, &s.Metadata},
+		{SectionStringsIndex, &s.StringsIndex},
+		{SectionStringsData, &s.StringsData},
+		{SectionZones, &s.Zones},
+		{SectionFootprints, &s.Footprints},
+		{SectionPoints, &s.Points},
+	} {
+		e, ok := header.Section(part.kind)
+		if !ok {
+			if part.kind == SectionFootprints {
+				continue
+			}
+			return s, fmt.Errorf("v3: missing %s section", part.kind)
+		}
+		section, err := open(part.kind)
+		if err != nil {
+			return s, err
+		}
+		*part.dst = section
+		if part.kind == SectionFootprints {
+			s.FootprintsMaxExtent = footprintsExtent(e)
+		}
+	}
+	return s, nil
+}
+
+// decode verifies the stored bytes of a section and decompresses them.
+func decode(stored []byte, e Entry) (savev2.Section, error) {
+	if crc32.Checksum(stored, castagnoli) != e.Checksum {
+		return savev2.Section{}, fmt.Errorf("v3: %s section checksum mismatch", e.Kind)
+	}
+	raw := stored
+	if e.Flags&FlagZstd != 0 {
+		var err error
+		raw, err = decoder.DecodeAll(stored, make([]byte, 0, e.RawSize))
+		if err != nil {
+			return savev2.Section{}, fmt.Errorf("v3: failed to decompress %s section: %w", e.Kind, err)
+		}
+		if int64(len(raw)) != e.RawSize {
+			return savev2.Section{}, fmt.Errorf("v3: %s section decompressed to %d bytes, want %d", e.Kind, len(raw), e.RawSize)
+		}
+	}
+	return savev2.Section{Reader: kdbush.Bytes(raw), Size: int64(len(raw))}, nil
+}
@@ -0,0 +1,175 @@
+package savev3
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"math"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+// Options configures [Save].
+type Options struct {
+	// Compress lists the sections stored zstd compressed.  Compressed
+	// sections are decompressed into memory on load, so compressing the
+	// string data or the KD-trees trades lazy loading for a smaller file.
+	Compress []SectionKind
+	// Build is passed to the KD-tree builds, e.g. [kdbush.WithThreads].
+	Build []kdbush.BuildOption
+	// External sorts the KD-trees externally with bounded memory when set,
+	// see [savev2.SaveExternal].
+	External *savev2.ExternalOptions
+}
+
+// Save writes a v3 cache to w, starting with the magic bytes.  The header
+// is written last, so w has to seek back to where the cache starts.
+func Save(w io.WriteSeeker, points iter.Seq[cachemodel.Point], zones iter.Seq[cachemodel.Zone], meta cachemodel.Metadata, opts Options) error {
+	write := func(e *savev2.Encoded) error {
+		return writeContainer(w, e, opts)
+	}
+	if opts.External != nil {
+		return savev2.EncodeExternal(points, zones, meta, *opts.External, write)
+	}
+	return savev2.Encode(points, zones, meta, write, opts.Build...)
+}
+
+func writeContainer(w io.WriteSeeker, e *savev2.Encoded, opts Options) error {
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	sw := &sectionWriter{w: w}
+	// the header page is filled in once the sections are written
+	if err := sw.pad(HeaderSize); err != nil {
+		return err
+	}
+
+	var header Header
+	section := func(kind SectionKind, aux uint64, write func(w io.Writer) error) error {
+		entry, err := sw.section(kind, slices.Contains(opts.Compress, kind), write)
+		if err != nil {
+			return fmt.Errorf("v3: writing %s section: %w", kind, err)
+		}
+		entry.Aux = aux
+		header.Entries = append(header.Entries, entry)
+		return nil
+	}
+	bytesSection := func(kind SectionKind, b []byte) error {
+		return section(kind, 0, func(w io.Writer) error {
+			_, err := w.Write(b)
+			return err
+		})
+	}
+
+	// sections read into memory come first, then the lazily read ones
+	if err := bytesSection(SectionMetadata, e.Metadata); err != nil {
+		return err
+	}
+	if err := bytesSection(SectionStringsIndex, e.StringsIndex); err != nil {
+		return err
+	}
+	if err := bytesSection(SectionZones, e.Zones); err != nil {
+		return err
+	}
+	if err := bytesSection(SectionStringsData, e.StringsData); err != nil {
+		return err
+	}
+	if e.FootprintsSize > 0 {
+		if err := section(SectionFootprints, math.Float64bits(e.FootprintsMaxExtent), e.WriteFootprints); err != nil {
+			return err
+		}
+	}
+	if err := section(SectionPoints, 0, e.WritePoints); err != nil {
+		return err
+	}
+
+	page, err := header.marshal()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.Write(page); err != nil {
+		return err
+	}
+	_, err = w.Seek(start+sw.off, io.SeekStart)
+	return err
+}
+
+// sectionWriter tracks the offset in the cache and the checksum of the
+// current section.
+type sectionWriter struct {
+	w   io.Writer
+	off int64
+	crc uint32
+}
+
+func (s *sectionWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.crc = crc32.Update(s.crc, castagnoli, p[:n])
+	s.off += int64(n)
+	return n, err
+}
+
+// pad writes zeros up to the offset.
+func (s *sectionWriter) pad(to int64) error {
+	if to <= s.off {
+		return nil
+	}
+	_, err := s.Write(make([]byte, to-s.off))
+	return err
+}
+
+// section writes an aligned section and returns its entry.
+func (s *sectionWriter) section(kind SectionKind, compress bool, write func(w io.Writer) error) (Entry, error) {
+	if err := s.pad((s.off + SectionAlignment - 1) / SectionAlignment * SectionAlignment); err != nil {
+		return Entry{}, err
+	}
+	entry := Entry{Kind: kind, Offset: s.off}
+	s.crc = 0
+
+	if compress {
+		enc, err := zstd.NewWriter(s)
+		if err != nil {
+			return Entry{}, err
+		}
+		raw := &countingWriter{w: enc}
+		if err := write(raw); err != nil {
+			enc.Close()
+			return Entry{}, err
+		}
+		if err := enc.Close(); err != nil {
+			return Entry{}, err
+		}
+		entry.Flags |= FlagZstd
+		entry.RawSize = raw.n
+	} else if err := write(s); err != nil {
+		return Entry{}, err
+	}
+
+	entry.Size = s.off - entry.Offset
+	if !compress {
+		entry.RawSize = entry.Size
+	}
+	entry.Checksum = s.crc
+	return entry, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,273 @@
+package savev3
+
+import (
+	"bytes"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"github.com/royalcat/rgeocache/kdbush"
+)
+
+func sliceToSeq[T any](slice []T) func(yield func(T) bool) {
+	return func(yield func(T) bool) {
+		for _, v := range slice {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+func makeTestCache() ([]cachemodel.Point, []cachemodel.Zone, cachemodel.Metadata) {
+	square := func(x, y float64) orb.Ring {
+		const d = 0.0001
+		return orb.Ring{{x - d, y - d}, {x + d, y - d}, {x + d, y + d}, {x - d, y + d}, {x - d, y - d}}
+	}
+	var points []cachemodel.Point
+	for i := range 2_000 {
+		p := cachemodel.Point{X: float64(i) * 0.01, Y: -float64(i) * 0.02, Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Street " + strconv.Itoa(i%7)),
+			HouseNumber: unique.Make(strconv.Itoa(i)),
+			City:        unique.Make("City"),
+			Region:      unique.Make("Region"),
+			Weight:      uint8(i % 11),
+		}}
+		if i%100 == 0 {
+			p.Data.Footprint = square(p.X, p.Y)
+		}
+		points = append(points, p)
+	}
+	zones := []cachemodel.Zone{{
+		Type:   cachemodel.ZoneRegion,
+		Name:   unique.Make("Region"),
+		Bounds: orb.Bound{Min: orb.Point{-40, 0}, Max: orb.Point{0, 20}},
+	}}
+	meta := cachemodel.Metadata{
+		Version:     3,
+		Locale:      "en",
+		DateCreated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	return points, zones, meta
+}
+
+// saveTestCache saves the test cache to a file and returns its contents.
+func saveTestCache(t *testing.T, opts Options) []byte {
+	t.Helper()
+	points, zones, meta := makeTestCache()
+	f, err := os.Create(filepath.Join(t.TempDir(), "cache.rgc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := Save(f, sliceToSeq(points), sliceToSeq(zones), meta, opts); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func checkPoints(t *testing.T, got func(yield func(cachemodel.Point, error) bool)) {
+	t.Helper()
+	points, _, _ := makeTestCache()
+	i := 0
+	for p, err := range got {
+		if err != nil {
+			t.Fatalf("point error: %v", err)
+		}
+		want := points[i]
+		// coordinates are stored as fixed-point
+		if math.Abs(p.X-want.X) > 1e-6 || math.Abs(p.Y-want.Y) > 1e-6 || p.Data.HouseNumber != want.Data.HouseNumber ||
+			p.Data.Street != want.Data.Street || p.Data.Weight != want.Data.Weight || len(p.Data.Footprint) != len(want.Data.Footprint) {
+			t.Fatalf("point %d = %+v, want %+v", i, p, want)
+		}
+		i++
+	}
+	if i != len(points) {
+		t.Errorf("%d points, want %d", i, len(points))
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"plain":   {},
+		"blocked": {Build: []kdbush.BuildOption{kdbush.WithLayout(kdbush.LayoutBlocked)}},
+		"zstd":    {Compress: []SectionKind{SectionMetadata, SectionStringsIndex, SectionZones, SectionStringsData, SectionPoints}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := saveTestCache(t, opts)
+			if err := Verify(kdbush.Bytes(b), int64(len(b))); err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+
+			header, err := ReadHeader(kdbush.Bytes(b))
+			if err != nil {
+				t.Fatalf("ReadHeader failed: %v", err)
+			}
+			for _, e := range header.Entries {
+				if e.Offset%SectionAlignment != 0 {
+					t.Errorf("%s section at unaligned offset %d", e.Kind, e.Offset)
+				}
+				if compressed := e.Flags&FlagZstd != 0; compressed != (len(opts.Compress) > 0 && e.Kind != SectionFootprints) {
+					t.Errorf("%s section compressed = %v", e.Kind, compressed)
+				}
+			}
+			if _, ok := header.Section(SectionFootprints); !ok {
+				t.Errorf("missing footprints section")
+			}
+
+			pointsIter, zonesIter, meta, err := Load(bytes.NewReader(b[8:]))
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			if meta.Version != 3 || meta.Locale != "en" {
+				t.Errorf("unexpected metadata %+v", meta)
+			}
+			checkPoints(t, pointsIter)
+			var zones []cachemodel.Zone
+			for z, err := range zonesIter {
+				if err != nil {
+					t.Fatalf("zone error: %v", err)
+				}
+				zones = append(zones, z)
+			}
+			if len(zones) != 1 || zones[0].Name.Value() != "Region" {
+				t.Errorf("unexpected zones %+v", zones)
+			}
+
+			result, err := LoadMmap(kdbush.Bytes(b))
+			if err != nil {
+				t.Fatalf("LoadMmap failed: %v", err)
+			}
+			checkPoints(t, result.Points())
+			if result.Footprints == nil || result.Footprints.NumPoints() != 20 {
+				t.Fatalf("expected 20 footprints in mmap result")
+			}
+		})
+	}
+}
+
+func TestCorruptedSection(t *testing.T) {
+	b := saveTestCache(t, Options{})
+	header, err := ReadHeader(kdbush.Bytes(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zones, _ := header.Section(SectionZones)
+	points, _ := header.Section(SectionPoints)
+
+	corrupt := bytes.Clone(b)
+	corrupt[zones.Offset] ^= 0xff
+	if _, err := LoadMmap(kdbush.Bytes(corrupt)); err == nil || !strings.Contains(err.Error(), "zones section checksum mismatch") {
+		t.Errorf("LoadMmap of corrupted zones: %v", err)
+	}
+	if _, _, _, err := Load(bytes.NewReader(corrupt[8:])); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Load of corrupted zones: %v", err)
+	}
+
+	// lazily read sections are only checked by Verify
+	corrupt = bytes.Clone(b)
+	corrupt[points.End()-1] ^= 0xff
+	if err := Verify(kdbush.Bytes(corrupt), int64(len(corrupt))); err == nil || !strings.Contains(err.Error(), "points section checksum mismatch") {
+		t.Errorf("Verify of corrupted points: %v", err)
+	}
+
+	corrupt = bytes.Clone(b)
+	corrupt[tocOffset+8] ^= 0xff
+	if _, err := ReadHeader(kdbush.Bytes(corrupt)); err == nil || !strings.Contains(err.Error(), "header checksum mismatch") {
+		t.Errorf("ReadHeader of corrupted TOC: %v", err)
+	}
+}
+
+func TestTruncatedFile(t *testing.T) {
+	b := saveTestCache(t, Options{})
+	truncated := b[:len(b)-1]
+	if _, err := LoadMmap(kdbush.Bytes(truncated)); err == nil {
+		t.Errorf("LoadMmap of truncated file succeeded")
+	}
+	if err := Verify(kdbush.Bytes(truncated), int64(len(truncated))); err == nil {
+		t.Errorf("Verify of truncated file succeeded")
+	}
+	if _, _, _, err := Load(bytes.NewReader(truncated[8:])); err == nil {
+		t.Errorf("Load of truncated file succeeded")
+	}
+}
+
+// addSection appends a section of kind to a saved cache and rewrites its header.
+func addSection(t *testing.T, b []byte, kind SectionKind, flags SectionFlags) []byte {
+	t.Helper()
+	header, err := ReadHeader(kdbush.Bytes(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("future section")
+	off := (int64(len(b)) + SectionAlignment - 1) / SectionAlignment * SectionAlignment
+	b = append(b, make([]byte, off-int64(len(b)))...)
+	b = append(b, payload...)
+	header.Entries = append(header.Entries, Entry{
+		Kind:     kind,
+		Flags:    flags,
+		Offset:   off,
+		Size:     int64(len(payload)),
+		RawSize:  int64(len(payload)),
+		Checksum: crc32.Checksum(payload, castagnoli),
+	})
+	page, err := header.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(b, page)
+	return b
+}
+
+func TestUnknownSection(t *testing.T) {
+	b := saveTestCache(t, Options{})
+
+	optional := addSection(t, bytes.Clone(b), SectionPOIs, 0)
+	if err := Verify(kdbush.Bytes(optional), int64(len(optional))); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	pointsIter, _, _, err := Load(bytes.NewReader(optional[8:]))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checkPoints(t, pointsIter)
+	result, err := LoadMmap(kdbush.Bytes(optional))
+	if err != nil {
+		t.Fatalf("LoadMmap failed: %v", err)
+	}
+	checkPoints(t, result.Points())
+
+	required := addSection(t, bytes.Clone(b), SectionPOIs, FlagRequired)
+	if _, err := LoadMmap(kdbush.Bytes(required)); err == nil || !strings.Contains(err.Error(), "required but not supported") {
+		t.Errorf("LoadMmap with a required unknown section: %v", err)
+	}
+}
+
+func TestParseHeaderRejectsOverlap(t *testing.T) {
+	b := saveTestCache(t, Options{})
+	header, err := ReadHeader(kdbush.Bytes(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.Entries[1].Offset = header.Entries[0].Offset
+	page, err := header.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseHeader(page); err == nil || !strings.Contains(err.Error(), "overlaps") {
+		t.Errorf("ParseHeader of overlapping sections: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package cachesaver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
+)
+
+// Verify checks a cache of size bytes read from r.  v2 and v3 caches are
+// checked section by section with [savev2.Verify] and [savev3.Verify].  Older
+// formats have no sizes to check, they are decoded completely and the rings
+// of their zone polygons are checked.
+func Verify(r io.ReaderAt, size int64, log *slog.Logger) error {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return fmt.Errorf("error reading cache header: %w", err)
+	}
+
+	if string(header[:4]) == string(MAGIC_BYTES) {
+		switch compatibilityLevel := binary.LittleEndian.Uint32(header[4:]); compatibilityLevel {
+		case savev2.COMPATIBILITY_LEVEL:
+			log.Info("Verifying v2 cache format")
+			return savev2.Verify(r, size)
+		case savev3.COMPATIBILITY_LEVEL:
+			log.Info("Verifying v3 cache format")
+			return savev3.Verify(r, size)
+		}
+	}
+
+	points, zones, _, err := LoadFromReaderWithMetadata(io.NewSectionReader(r, 0, size), log)
+	if err != nil {
+		return err
+	}
+	for _, z := range zones {
+		if err := z.CheckRings(); err != nil {
+			return err
+		}
+	}
+	log.Info("Decoded cache", "points", len(points), "zones", len(zones))
+	return nil
+}
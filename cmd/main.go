@@ -1,14 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
@@ -16,8 +22,12 @@ import (
 	"time"
 
 	"github.com/KimMachineGun/automemlimit/memlimit"
+	"github.com/dustin/go-humanize"
+	"github.com/klauspost/compress/zstd"
 	"github.com/royalcat/osmpbfdb"
+	"github.com/royalcat/rgeocache/cachesaver"
 	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
 	"github.com/royalcat/rgeocache/geocoder"
 	"github.com/royalcat/rgeocache/geoparser"
 	"github.com/royalcat/rgeocache/internal/stats"
@@ -41,9 +51,10 @@ func main() {
 				Name:  "serve",
 				Usage: "serve a rgeocache api",
 				Flags: []cli.Flag{
-					&cli.StringFlag{
+					&cli.StringSliceFlag{
 						Name:      "points",
 						Aliases:   []string{"p"},
+						Usage:     "cache file, repeat to serve several caches routed by their coverage",
 						Required:  true,
 						TakesFile: true,
 					},
@@ -64,8 +75,110 @@ func main() {
 					},
 					&cli.StringFlag{
 						Name:  "listen",
+						Usage: "TCP address or unix socket as unix:///run/rgeocache.sock",
 						Value: ":8080",
 					},
+					&cli.StringFlag{
+						Name:      "tls.cert",
+						Usage:     "PEM certificate file, serves HTTPS and is reloaded on change",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "tls.key",
+						Usage:     "PEM key file of --tls.cert",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "tls.client-ca",
+						Usage:     "PEM file of CAs, clients must present a certificate signed by one of them",
+						TakesFile: true,
+					},
+					&cli.Float64Flag{
+						Name:  "max-radius",
+						Usage: "largest radius query parameter in meters, larger radii are rejected",
+						Value: server.DefaultMaxRadius,
+					},
+					&cli.IntFlag{
+						Name:  "response-cache.size",
+						Usage: "number of answers kept in the in-process LRU, 0 disables the cache",
+					},
+					&cli.Float64Flag{
+						Name:  "response-cache.grid",
+						Usage: "grid step in degrees, coordinates are snapped to it before lookup and caching",
+						Value: 0.00001,
+					},
+					&cli.DurationFlag{
+						Name:  "response-cache.ttl",
+						Usage: "time an answer is kept, 0 keeps answers until evicted",
+						Value: 10 * time.Minute,
+					},
+					&cli.StringFlag{
+						Name:      "api-keys",
+						Usage:     "YAML file with api keys and their quotas, geocoding endpoints require a key when set",
+						TakesFile: true,
+						Sources:   cli.EnvVars("RGEOCACHE_API_KEYS_FILE"),
+					},
+					&cli.StringFlag{
+						Name:    "api-keys.list",
+						Usage:   "comma separated name:key pairs, in addition to --api-keys",
+						Sources: cli.EnvVars("RGEOCACHE_API_KEYS"),
+					},
+					&cli.StringFlag{
+						Name:      "overlay",
+						Usage:     "JSON or GeoJSON file of custom addresses and suppressions served over the caches, created on the first change",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:    "overlay.admin-key",
+						Usage:   "key of the /admin/overlay endpoints, the endpoints are disabled when empty",
+						Sources: cli.EnvVars("RGEOCACHE_OVERLAY_ADMIN_KEY"),
+					},
+					&cli.Float64Flag{
+						Name:  "api-keys.rate",
+						Usage: "points per second of keys without their own rate",
+						Value: 100,
+					},
+					&cli.Float64Flag{
+						Name:  "api-keys.burst",
+						Usage: "burst in points of keys without their own burst, the largest allowed batch",
+						Value: 10000,
+					},
+					&cli.Float64Flag{
+						Name:  "access-log.sample",
+						Usage: "share of requests written to the access log, from 0 to 1",
+					},
+					&cli.DurationFlag{
+						Name:  "access-log.slow",
+						Usage: "requests slower than this are always logged, 0 disables the threshold",
+						Value: time.Second,
+					},
+					&cli.IntFlag{
+						Name:  "access-log.precision",
+						Usage: "decimals coordinates are rounded to in the access log, -1 drops them",
+						Value: 2,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout.read",
+						Usage: "time allowed to read a request, 0 disables the timeout",
+						Value: 30 * time.Second,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout.write",
+						Usage: "time allowed to write a response, 0 disables the timeout",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout.idle",
+						Usage: "time a keep-alive connection waits for the next request, 0 uses --timeout.read",
+					},
+					&cli.DurationFlag{
+						Name:  "shutdown.delay",
+						Usage: "time /readyz fails before the listener is closed on shutdown",
+					},
+					&cli.DurationFlag{
+						Name:  "shutdown.timeout",
+						Usage: "time requests in flight are waited for on shutdown, 0 waits for all of them",
+						Value: 30 * time.Second,
+					},
 				},
 				Action: serve,
 			},
@@ -89,6 +202,13 @@ func main() {
 						Required:  false,
 						TakesFile: true,
 					},
+					&cli.StringFlag{
+						Name:      "output-v3",
+						Aliases:   []string{"o-v3"},
+						Usage:     "write a v3 cache, a container of page-aligned and checksummed sections",
+						Required:  false,
+						TakesFile: true,
+					},
 					&cli.StringSliceFlag{
 						Name:      "input",
 						Aliases:   []string{"i"},
@@ -97,6 +217,7 @@ func main() {
 					&cli.IntFlag{
 						Name:        "threads",
 						Aliases:     []string{"t"},
+						Usage:       "goroutines parsing the input and sorting the KD-trees",
 						DefaultText: "max",
 					},
 					&cli.IntFlag{
@@ -104,6 +225,29 @@ func main() {
 						Aliases:     []string{},
 						DefaultText: "1",
 					},
+					&cli.BoolFlag{
+						Name:  "footprints",
+						Usage: "store simplified building footprints for point-in-building matching (v2 and v3 formats only)",
+					},
+					&cli.StringFlag{
+						Name:  "max-memory",
+						Usage: "bound memory used to build v2 and v3 caches (e.g. 8GB), points are spilled to disk and sorted externally",
+					},
+					&cli.StringFlag{
+						Name:      "tmp-dir",
+						Usage:     "directory for spill files of --max-memory, system temp directory if not set",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "resume",
+						Usage:     "work directory for checkpoints, a run with the same directory skips completed stages and objects",
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "rules",
+						Usage:     "YAML file with rules deciding which OSM objects become points, built-in rules are used if not set",
+						TakesFile: true,
+					},
 					&cli.StringFlag{
 						Name:        "preferred-localization",
 						Aliases:     []string{"l"},
@@ -152,6 +296,96 @@ func main() {
 				},
 				Action: analyze,
 			},
+			{
+				Name:  "verify",
+				Usage: "check the integrity of a cache file, exits non-zero if it is damaged",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:      "points",
+						Aliases:   []string{"p"},
+						Required:  true,
+						TakesFile: true,
+					},
+				},
+				Action: verify,
+			},
+			{
+				Name:  "convert",
+				Usage: "convert a cache of any format, including legacy gob caches, to another format",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:      "input",
+						Aliases:   []string{"i"},
+						Required:  true,
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "output",
+						Aliases:   []string{"o"},
+						Required:  true,
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "output format: v1, v2 or v3",
+						Value:   "v2",
+					},
+					&cli.IntFlag{
+						Name:        "threads",
+						Aliases:     []string{"t"},
+						Usage:       "goroutines sorting the KD-trees",
+						DefaultText: "max",
+					},
+					&cli.StringFlag{
+						Name:  "max-memory",
+						Usage: "bound memory used to build v2 and v3 caches (e.g. 8GB), points are spilled to disk and sorted externally",
+					},
+					&cli.StringFlag{
+						Name:      "tmp-dir",
+						Usage:     "directory for spill files of --max-memory, system temp directory if not set",
+						TakesFile: true,
+					},
+				},
+				Action: convert,
+			},
+			{
+				Name:  "merge",
+				Usage: "merge caches of neighbouring areas into one, dropping the duplicates of their overlap",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:      "input",
+						Aliases:   []string{"i"},
+						Usage:     "cache file, repeat for every cache, points of earlier caches win over their duplicates",
+						Required:  true,
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:      "output",
+						Aliases:   []string{"o"},
+						Required:  true,
+						TakesFile: true,
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "output format: v1, v2 or v3",
+						Value:   "v2",
+					},
+					&cli.FloatFlag{
+						Name:        "dedup-radius",
+						Usage:       "distance in degrees under which points of different caches with the same address are duplicates",
+						DefaultText: "0.0001",
+					},
+					&cli.IntFlag{
+						Name:        "threads",
+						Aliases:     []string{"t"},
+						Usage:       "goroutines sorting the KD-trees",
+						DefaultText: "max",
+					},
+				},
+				Action: merge,
+			},
 		},
 	}
 
@@ -167,9 +401,190 @@ func analyze(ctx context.Context, cmd *cli.Command) error {
 	return geocoder.PrintCacheSizeAnalysisForFile(cmd.String("points"))
 }
 
+func verify(ctx context.Context, cmd *cli.Command) error {
+	log := slog.Default()
+	file := cmd.String("points")
+	if err := geocoder.VerifyFile(file, log); err != nil {
+		return fmt.Errorf("cache %s is damaged: %w", file, err)
+	}
+	log.Info("Cache verified", "file", file)
+	return nil
+}
+
+func convert(ctx context.Context, cmd *cli.Command) error {
+	log := slog.Default()
+	input, output := cmd.String("input"), cmd.String("output")
+	if err := checkNotInput(output, input); err != nil {
+		return err
+	}
+
+	saveOpts, err := saveOptions(cmd)
+	if err != nil {
+		return err
+	}
+	r, modTime, closeInput, err := openCache(input)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+	opts := cachesaver.ConvertOptions{
+		SaveOptions: saveOpts,
+		// legacy caches have no metadata, the file time is the best guess of their creation
+		LegacyMetadata: cachesaver.Metadata{DateCreated: modTime},
+	}
+
+	log.Info("Converting cache", "input", input, "output", output, "format", opts.Format)
+	err = writeOutput(output, func(f *os.File) error {
+		return cachesaver.Convert(r, f, opts, log)
+	})
+	if err != nil {
+		return fmt.Errorf("error converting %s: %w", input, err)
+	}
+	log.Info("Cache converted", "output", output)
+	return nil
+}
+
+func merge(ctx context.Context, cmd *cli.Command) error {
+	log := slog.Default()
+	inputs, output := cmd.StringSlice("input"), cmd.String("output")
+	if len(inputs) < 2 {
+		return fmt.Errorf("at least two inputs are needed to merge, got %d", len(inputs))
+	}
+	if err := checkNotInput(output, inputs...); err != nil {
+		return err
+	}
+
+	// the inputs are loaded into memory, there is no --max-memory to bound it
+	opts := cachesaver.MergeOptions{
+		Format:      cmd.String("format"),
+		Threads:     int(cmd.Int("threads")),
+		DedupRadius: cmd.Float("dedup-radius"),
+	}
+	if opts.Threads == 0 {
+		opts.Threads = runtime.GOMAXPROCS(0)
+	}
+
+	mergeInputs := make([]cachesaver.MergeInput, 0, len(inputs))
+	for _, input := range inputs {
+		r, modTime, closeInput, err := openCache(input)
+		if err != nil {
+			return err
+		}
+		defer closeInput()
+		mergeInputs = append(mergeInputs, cachesaver.MergeInput{
+			Name:           filepath.Base(input),
+			Reader:         r,
+			LegacyMetadata: cachesaver.Metadata{DateCreated: modTime},
+		})
+	}
+
+	log.Info("Merging caches", "inputs", inputs, "output", output, "format", opts.Format)
+	err := writeOutput(output, func(f *os.File) error {
+		return cachesaver.Merge(mergeInputs, f, opts, log)
+	})
+	if err != nil {
+		return fmt.Errorf("error merging caches: %w", err)
+	}
+	log.Info("Caches merged", "output", output)
+	return nil
+}
+
+// checkNotInput fails when output is the file of one of the inputs.  Files
+// are compared by identity, so a.rgc matches ./a.rgc and links to it.
+func checkNotInput(output string, inputs ...string) error {
+	out, err := os.Stat(output)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, input := range inputs {
+		in, err := os.Stat(input)
+		if err != nil {
+			return err
+		}
+		if os.SameFile(in, out) {
+			return fmt.Errorf("output %s is the input %s", output, input)
+		}
+	}
+	return nil
+}
+
+// writeOutput writes a temporary file next to output and renames it into
+// place only when write succeeds, a failed write leaves output untouched.
+func writeOutput(output string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	// CreateTemp makes the file private, caches are readable like any output
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), output)
+}
+
+// saveOptions reads the output flags of convert.
+func saveOptions(cmd *cli.Command) (cachesaver.SaveOptions, error) {
+	opts := cachesaver.SaveOptions{
+		Format:  cmd.String("format"),
+		Threads: int(cmd.Int("threads")),
+	}
+	if opts.Threads == 0 {
+		opts.Threads = runtime.GOMAXPROCS(0)
+	}
+	if maxMemory := cmd.String("max-memory"); maxMemory != "" {
+		limit, err := humanize.ParseBytes(maxMemory)
+		if err != nil {
+			return opts, fmt.Errorf("invalid max memory %q: %w", maxMemory, err)
+		}
+		debug.SetMemoryLimit(int64(limit))
+		opts.MaxMemory = int64(limit) / 2
+		opts.TempDir = cmd.String("tmp-dir")
+	}
+	return opts, nil
+}
+
+// openCache opens a cache file of any format for streaming, .zst files are
+// decompressed.  It returns the file modification time, the best guess of the
+// creation of legacy caches, which have no metadata.
+func openCache(file string) (io.Reader, time.Time, func(), error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, time.Time{}, nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, nil, err
+	}
+
+	var r io.Reader = bufio.NewReader(f)
+	if !strings.HasSuffix(file, ".zst") {
+		return r, stat.ModTime().UTC(), func() { f.Close() }, nil
+	}
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		f.Close()
+		return nil, time.Time{}, nil, err
+	}
+	return dec, stat.ModTime().UTC(), func() { dec.Close(); f.Close() }, nil
+}
+
 func generate(ctx context.Context, cmd *cli.Command) error {
-	if !cmd.IsSet("output") && !cmd.IsSet("output-v2") {
-		return fmt.Errorf("either 'output' or 'output-v2' must be set")
+	if !cmd.IsSet("output") && !cmd.IsSet("output-v2") && !cmd.IsSet("output-v3") {
+		return fmt.Errorf("one of 'output', 'output-v2' or 'output-v3' must be set")
 	}
 
 	telemetryClient, err := telemetry.Setup(ctx, "rgeocache", cmd.String("otel.endpoint"))
@@ -249,7 +664,15 @@ func generate(ctx context.Context, cmd *cli.Command) error {
 	log.Info("Input maps", "maps", inputs)
 
 	inputsReaders := make([]io.ReaderAt, 0, len(inputs))
+	// identify the inputs in checkpoints, an updated extract isn't resumed
+	inputIDs := make([]string, 0, len(inputs))
 	for _, input := range inputs {
+		stat, err := os.Stat(input)
+		if err != nil {
+			return err
+		}
+		inputIDs = append(inputIDs, fmt.Sprintf("%d %d", stat.Size(), stat.ModTime().UnixNano()))
+
 		file, err := mmap.Open(input)
 		if err != nil {
 			return err
@@ -278,8 +701,33 @@ func generate(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	config := geoparser.ConfigDefault()
+	config.Threads = int(threads)
+	config.Inputs = inputIDs
 	config.PreferredLocalization = preferredLocalization
 	config.Version = uint32(version)
+	config.BuildingFootprints = cmd.Bool("footprints")
+	if maxMemory := cmd.String("max-memory"); maxMemory != "" {
+		limit, err := humanize.ParseBytes(maxMemory)
+		if err != nil {
+			return fmt.Errorf("invalid max memory %q: %w", maxMemory, err)
+		}
+		// keep the heap within the same bound, the external sort gets half of it
+		debug.SetMemoryLimit(int64(limit))
+		config.MaxMemory = int64(limit) / 2
+		config.TempDir = cmd.String("tmp-dir")
+		log.Info("Bounding memory", "limit", humanize.IBytes(limit), "tmp-dir", config.TempDir)
+	}
+	if workDir := cmd.String("resume"); workDir != "" {
+		config.WorkDir = workDir
+		log.Info("Checkpoints enabled", "work-dir", workDir, "interval", config.CheckpointInterval)
+	}
+	if rulesPath := cmd.String("rules"); rulesPath != "" {
+		config.Rules, err = geoparser.LoadRules(rulesPath)
+		if err != nil {
+			return err
+		}
+		log.Info("Using custom rules", "path", rulesPath, "rules", len(config.Rules))
+	}
 
 	geoGen, err := geoparser.NewGeoGen(osmdb, config)
 	if err != nil {
@@ -325,6 +773,24 @@ func generate(ctx context.Context, cmd *cli.Command) error {
 			Writer: outputFile,
 		})
 	}
+	if saveFilePath := cmd.String("output-v3"); saveFilePath != "" {
+		if !strings.HasSuffix(saveFilePath, ".rgc") {
+			saveFilePath = saveFilePath + ".rgc"
+		}
+
+		outputFile, err := os.OpenFile(saveFilePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, os.ModePerm)
+		if err != nil {
+			return err
+		}
+		defer outputFile.Close()
+
+		log.Info("Saving cache in v3 format", "path", saveFilePath)
+
+		outputs = append(outputs, geoparser.ParseOutput{
+			Format: "v3",
+			Writer: outputFile,
+		})
+	}
 
 	if len(outputs) == 0 {
 		log.Info("No output specified")
@@ -392,64 +858,253 @@ func serve(ctx context.Context, cmd *cli.Command) error {
 		pointsPerThread = 1000
 	}
 
-	cacheFile := cmd.String("points")
+	cacheFiles := cmd.StringSlice("points")
 
-	// Detect cache format to decide loading path
-	isV2 := detectV2Cache(cacheFile)
+	// the server closes the geocoder
+	load := func(context.Context) (geocoder.Geocoder, []server.CacheInfo, error) {
+		rgeo, infos, err := loadCaches(cacheFiles, log, radius)
+		if err != nil {
+			return nil, nil, err
+		}
+		runtime.GC()
+		return rgeo, infos, nil
+	}
 
-	var rgeo geocoder.Geocoder
-	var closer io.Closer
+	opts := []server.Option{
+		server.WithAccessLog(cmd.Float64("access-log.sample"),
+			cmd.Duration("access-log.slow"), cmd.Int("access-log.precision")),
+		server.WithTimeouts(cmd.Duration("timeout.read"),
+			cmd.Duration("timeout.write"), cmd.Duration("timeout.idle")),
+		server.WithShutdown(cmd.Duration("shutdown.delay"), cmd.Duration("shutdown.timeout")),
+		server.WithMaxRadius(cmd.Float64("max-radius")),
+	}
+	if size := cmd.Int("response-cache.size"); size > 0 {
+		opts = append(opts, server.WithResponseCache(size,
+			cmd.Float64("response-cache.grid"), cmd.Duration("response-cache.ttl")))
+	}
 
-	if isV2 {
-		log.Info("Detected v2 cache, loading via mmap")
-		rgeoDisk, err := geocoder.LoadGeoCoderFromFileDisk(cacheFile,
-			geocoder.WithLogger(log), geocoder.WithSearchRadius(radius))
+	certFile, keyFile, clientCA := cmd.String("tls.cert"), cmd.String("tls.key"), cmd.String("tls.client-ca")
+	switch {
+	case (certFile == "") != (keyFile == ""):
+		return fmt.Errorf("--tls.cert and --tls.key must be set together")
+	case clientCA != "" && certFile == "":
+		return fmt.Errorf("--tls.client-ca requires --tls.cert and --tls.key")
+	case certFile != "":
+		opts = append(opts, server.WithTLS(certFile, keyFile))
+		if clientCA != "" {
+			opts = append(opts, server.WithClientCA(clientCA))
+		}
+	}
+
+	keys, err := loadAPIKeys(cmd)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		opts = append(opts, server.WithAPIKeys(keys))
+	}
+
+	if file := cmd.String("overlay"); file != "" {
+		overlay, err := geocoder.LoadOverlay(file)
 		if err != nil {
 			return err
 		}
-		rgeo = rgeoDisk
-		closer = rgeoDisk
-	} else {
-		rgeoMem, err := geocoder.LoadGeoCoderFromFile(cacheFile,
-			geocoder.WithLogger(log), geocoder.WithSearchRadius(radius))
+		opts = append(opts, server.WithOverlay(overlay, cmd.String("overlay.admin-key")))
+	} else if cmd.String("overlay.admin-key") != "" {
+		return fmt.Errorf("--overlay.admin-key requires --overlay")
+	}
+
+	return server.Run(ctx, cmd.String("listen"), load, pointsPerThread, log, opts...)
+}
+
+// loadAPIKeys reads keys from the --api-keys file and the --api-keys.list.
+func loadAPIKeys(cmd *cli.Command) ([]server.APIKey, error) {
+	rate, burst := cmd.Float64("api-keys.rate"), cmd.Float64("api-keys.burst")
+
+	var keys []server.APIKey
+	if file := cmd.String("api-keys"); file != "" {
+		fileKeys, err := server.LoadAPIKeys(file, rate, burst)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+	if list := cmd.String("api-keys.list"); list != "" {
+		listKeys, err := server.ParseAPIKeyList(list, rate, burst)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, listKeys...)
+	}
+	return keys, nil
+}
+
+// loadCaches loads all cache files, several caches are served by a [geocoder.MultiGeocoder].
+func loadCaches(cacheFiles []string, log *slog.Logger, radius float64) (geocoder.Geocoder, []server.CacheInfo, error) {
+	caches := make([]geocoder.Cache, 0, len(cacheFiles))
+	infos := make([]server.CacheInfo, 0, len(cacheFiles))
+	closeAll := func() {
+		for _, c := range caches {
+			closeGeocoder(c.Geocoder)
+		}
+	}
+
+	names, err := cacheNames(cacheFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, cacheFile := range cacheFiles {
+		rgeo, err := loadGeocoder(cacheFile, log, radius)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
 		}
-		rgeo = rgeoMem
+		name := names[i]
+		caches = append(caches, geocoder.Cache{Name: name, Geocoder: rgeo})
+
+		info, err := cacheInfo(name, cacheFile, rgeo)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	if len(caches) == 1 {
+		return caches[0].Geocoder, infos, nil
+	}
+
+	multi, err := geocoder.NewMultiGeocoder(caches, geocoder.WithLogger(log))
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return multi, infos, nil
+}
+
+// cacheInfo describes a loaded cache for the /info endpoint.
+func cacheInfo(name, cacheFile string, rgeo geocoder.Geocoder) (server.CacheInfo, error) {
+	f, err := os.Open(cacheFile)
+	if err != nil {
+		return server.CacheInfo{}, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return server.CacheInfo{}, fmt.Errorf("error hashing cache file: %w", err)
+	}
+
+	info := server.CacheInfo{
+		Name:   name,
+		File:   cacheFile,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}
+	if described, ok := rgeo.(interface{ CacheInfo() geocoder.CacheInfo }); ok {
+		ci := described.CacheInfo()
+		info.Loader = ci.Loader
+		info.Points = ci.Points
+		info.Zones = ci.Zones
+		info.Metadata = server.CacheMetadata{
+			Version:     ci.Metadata.Version,
+			Locale:      ci.Metadata.Locale,
+			DateCreated: ci.Metadata.DateCreated,
+		}
+		for _, src := range ci.Metadata.Sources {
+			info.Metadata.Sources = append(info.Metadata.Sources, server.CacheSource{
+				Name:        src.Name,
+				DateCreated: src.DateCreated,
+			})
+		}
+	}
+	return info, nil
+}
+
+// loadGeocoder loads a cache file, v2 and v3 caches are mmapped.
+func loadGeocoder(cacheFile string, log *slog.Logger, radius float64) (geocoder.Geocoder, error) {
+	// Detect cache format to decide loading path
+	if level, ok := detectDiskCache(cacheFile); ok {
+		log.Info("Detected disk cache, loading via mmap", "file", cacheFile, "format", level)
+		return geocoder.LoadGeoCoderFromFileDisk(cacheFile,
+			geocoder.WithLogger(log), geocoder.WithSearchRadius(radius))
 	}
+	return geocoder.LoadGeoCoderFromFile(cacheFile,
+		geocoder.WithLogger(log), geocoder.WithSearchRadius(radius))
+}
 
-	if closer != nil {
-		defer closer.Close()
+// cacheNames names the caches by their file names without the extension,
+// parent directories are kept in names shared by several files, so
+// eu/roads.rgc and us/roads.rgc are eu/roads and us/roads.
+func cacheNames(cacheFiles []string) ([]string, error) {
+	parts := make([][]string, len(cacheFiles))
+	for i, file := range cacheFiles {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		abs = strings.TrimSuffix(abs, filepath.Ext(abs))
+		parts[i] = strings.Split(filepath.ToSlash(abs), "/")
 	}
 
-	runtime.GC()
+	names := make([]string, len(cacheFiles))
+	depth := make([]int, len(cacheFiles))
+	for {
+		files := map[string][]int{}
+		for i, p := range parts {
+			depth[i] = max(depth[i], 1)
+			names[i] = strings.Join(p[len(p)-depth[i]:], "/")
+			files[names[i]] = append(files[names[i]], i)
+		}
 
-	return server.Run(ctx, cmd.String("listen"), rgeo, pointsPerThread, log)
+		shared := false
+		for name, idxs := range files {
+			if len(idxs) < 2 {
+				continue
+			}
+			shared = true
+			for _, i := range idxs {
+				if depth[i] == len(parts[i]) {
+					return nil, fmt.Errorf("caches %s and %s have the same name %s", cacheFiles[idxs[0]], cacheFiles[idxs[1]], name)
+				}
+				depth[i]++
+			}
+		}
+		if !shared {
+			return names, nil
+		}
+	}
+}
+
+func closeGeocoder(rgeo geocoder.Geocoder) {
+	if closer, ok := rgeo.(io.Closer); ok {
+		closer.Close()
+	}
 }
 
-// detectV2Cache reads the first 8 bytes of a cache file and returns true
-// if it's a v2 format cache (magic "RGEO" + compat level 2).
-func detectV2Cache(file string) bool {
+// detectDiskCache reads the first 8 bytes of a cache file and returns its
+// compat level if it's a format loaded via mmap (magic "RGEO" + compat level 2 or 3).
+func detectDiskCache(file string) (uint32, bool) {
 	f, err := os.Open(file)
 	if err != nil {
-		return false
+		return 0, false
 	}
 	defer f.Close()
 
 	var magic [4]byte
 	if _, err := f.Read(magic[:]); err != nil {
-		return false
+		return 0, false
 	}
 	if string(magic[:]) != "RGEO" {
-		return false
+		return 0, false
 	}
 
 	var compatBuf [4]byte
 	if _, err := f.Read(compatBuf[:]); err != nil {
-		return false
+		return 0, false
 	}
 
-	return binary.LittleEndian.Uint32(compatBuf[:]) == savev2.COMPATIBILITY_LEVEL
+	level := binary.LittleEndian.Uint32(compatBuf[:])
+	return level, level == savev2.COMPATIBILITY_LEVEL || level == savev3.COMPATIBILITY_LEVEL
 }
 
 func tuneGC() error {
@@ -0,0 +1,188 @@
+package geocoder
+
+import (
+	"cmp"
+	"math"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// BatchGeocoder resolves many points at once, see [ResolveBatch].
+type BatchGeocoder interface {
+	Geocoder
+	// FindBatch resolves points given as lat, lon pairs, results are in the
+	// order of points and empty where nothing was found.
+	FindBatch(points [][2]float64) []InfoModel
+	// FindBatchQuery is FindBatch with per-request parameters.
+	FindBatchQuery(points [][2]float64, q Query) []InfoModel
+}
+
+var (
+	_ BatchGeocoder = (*RGeoCoder)(nil)
+	_ BatchGeocoder = (*RGeoCoderDisk)(nil)
+	_ BatchGeocoder = (*MultiGeocoder)(nil)
+	_ BatchGeocoder = (*OverlayGeocoder)(nil)
+)
+
+// FindBatch returns the addresses of points given as lat, lon pairs, see [ResolveBatch].
+func (f *RGeoCoder) FindBatch(points [][2]float64) []InfoModel {
+	return f.FindBatchQuery(points, Query{})
+}
+
+// FindBatchQuery is [RGeoCoder.FindBatch] with per-request parameters.
+func (f *RGeoCoder) FindBatchQuery(points [][2]float64, q Query) []InfoModel {
+	return ResolveBatch(points, runtime.GOMAXPROCS(0), func(lat, lon float64) (InfoModel, bool) {
+		return f.FindQuery(lat, lon, q)
+	})
+}
+
+// FindBatch returns the addresses of points given as lat, lon pairs, see [ResolveBatch].
+func (f *RGeoCoderDisk) FindBatch(points [][2]float64) []InfoModel {
+	return f.FindBatchQuery(points, Query{})
+}
+
+// FindBatchQuery is [RGeoCoderDisk.FindBatch] with per-request parameters.
+func (f *RGeoCoderDisk) FindBatchQuery(points [][2]float64, q Query) []InfoModel {
+	return ResolveBatch(points, runtime.GOMAXPROCS(0), func(lat, lon float64) (InfoModel, bool) {
+		return f.FindQuery(lat, lon, q)
+	})
+}
+
+// FindBatch returns the addresses of points given as lat, lon pairs, see [ResolveBatch].
+func (m *MultiGeocoder) FindBatch(points [][2]float64) []InfoModel {
+	return m.FindBatchQuery(points, Query{})
+}
+
+// FindBatchQuery is [MultiGeocoder.FindBatch] with per-request parameters.
+func (m *MultiGeocoder) FindBatchQuery(points [][2]float64, q Query) []InfoModel {
+	return ResolveBatch(points, runtime.GOMAXPROCS(0), func(lat, lon float64) (InfoModel, bool) {
+		return m.FindQuery(lat, lon, q)
+	})
+}
+
+// FindBatch returns the addresses of points given as lat, lon pairs, see [ResolveBatch].
+func (g *OverlayGeocoder) FindBatch(points [][2]float64) []InfoModel {
+	return g.FindBatchQuery(points, Query{})
+}
+
+// FindBatchQuery is [OverlayGeocoder.FindBatch] with per-request parameters.
+func (g *OverlayGeocoder) FindBatchQuery(points [][2]float64, q Query) []InfoModel {
+	return ResolveBatch(points, runtime.GOMAXPROCS(0), func(lat, lon float64) (InfoModel, bool) {
+		return g.FindQuery(lat, lon, q)
+	})
+}
+
+// chunksPerThread splits the sorted points into more chunks than threads, a
+// worker done with a sparse area takes the next chunk instead of idling.
+const chunksPerThread = 4
+
+// ResolveBatch resolves points given as lat, lon pairs with lookup on up to
+// threads goroutines.  Points are sorted along a Hilbert curve and handed out
+// in contiguous chunks, so every worker walks one area of the index instead
+// of jumping around the memory map.  Identical coordinates are resolved once.
+// Results are in the order of points, empty where lookup found nothing.
+func ResolveBatch(points [][2]float64, threads int, lookup func(lat, lon float64) (InfoModel, bool)) []InfoModel {
+	res := make([]InfoModel, len(points))
+	if len(points) == 0 {
+		return res
+	}
+
+	keys := make([]uint64, len(points))
+	order := make([]int32, len(points))
+	for i, p := range points {
+		keys[i] = hilbertKey(p[0], p[1])
+		order[i] = int32(i)
+	}
+	slices.SortFunc(order, func(a, b int32) int {
+		return cmp.Or(
+			cmp.Compare(keys[a], keys[b]),
+			cmp.Compare(points[a][0], points[b][0]),
+			cmp.Compare(points[a][1], points[b][1]),
+		)
+	})
+
+	// unique[u] is the first point with its coordinates, slot[k] the unique
+	// point of order[k]
+	unique := make([]int32, 0, len(points))
+	slot := make([]int32, len(points))
+	for k, i := range order {
+		if k == 0 || points[i] != points[unique[len(unique)-1]] {
+			unique = append(unique, i)
+		}
+		slot[k] = int32(len(unique) - 1)
+	}
+
+	found := make([]InfoModel, len(unique))
+	resolve := func(from, to int) {
+		for u := from; u < to; u++ {
+			p := points[unique[u]]
+			found[u], _ = lookup(p[0], p[1])
+		}
+	}
+
+	threads = min(max(threads, 1), len(unique))
+	if threads == 1 {
+		resolve(0, len(unique))
+	} else {
+		chunk := (len(unique) + threads*chunksPerThread - 1) / (threads * chunksPerThread)
+		var next atomic.Int64
+		var wg sync.WaitGroup
+		for range threads {
+			wg.Go(func() {
+				for {
+					from := int(next.Add(int64(chunk))) - chunk
+					if from >= len(unique) {
+						return
+					}
+					resolve(from, min(from+chunk, len(unique)))
+				}
+			})
+		}
+		wg.Wait()
+	}
+
+	for k, i := range order {
+		res[i] = found[slot[k]]
+	}
+	return res
+}
+
+// hilbertKey is the position of lat, lon on a Hilbert curve filling the
+// world on a 2^32 x 2^32 grid, nearby points get close keys.
+func hilbertKey(lat, lon float64) uint64 {
+	x, y := gridCoord(lon, 180), gridCoord(lat, 90)
+	var d uint64
+	for s := uint32(1) << 31; s > 0; s >>= 1 {
+		var rx, ry uint32
+		if x&s != 0 {
+			rx = 1
+		}
+		if y&s != 0 {
+			ry = 1
+		}
+		d += uint64(s) * uint64(s) * uint64((3*rx)^ry)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = ^x, ^y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// gridCoord maps v from [-limit, limit] to the grid, out of range values and
+// NaN are clamped.
+func gridCoord(v, limit float64) uint32 {
+	f := (v + limit) / (2 * limit) * math.MaxUint32
+	switch {
+	case !(f > 0):
+		return 0
+	case f >= math.MaxUint32:
+		return math.MaxUint32
+	default:
+		return uint32(f)
+	}
+}
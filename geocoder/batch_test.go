@@ -0,0 +1,68 @@
+package geocoder
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"testing"
+
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+)
+
+func TestResolveBatch(t *testing.T) {
+	var points []cachemodel.Point
+	for i := range 100 {
+		points = append(points, testBuilding(float64(i%10)*0.001, float64(i/10)*0.001, fmt.Sprint(i), nil))
+	}
+	rgeo := NewGeoCoderFromPoints(points, WithSearchRadius(0.0005))
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+	batch := make([][2]float64, 1000)
+	for i := range batch {
+		if i > 0 && i%3 == 0 {
+			batch[i] = batch[rnd.IntN(i)] // duplicates
+			continue
+		}
+		// some points fall outside the cache
+		batch[i] = [2]float64{rnd.Float64()*0.011 - 0.0005, rnd.Float64()*0.011 - 0.0005}
+	}
+
+	for _, threads := range []int{1, 3, 16} {
+		var lookups atomic.Int64
+		res := ResolveBatch(batch, threads, func(lat, lon float64) (InfoModel, bool) {
+			lookups.Add(1)
+			return rgeo.Find(lat, lon)
+		})
+		if len(res) != len(batch) {
+			t.Fatalf("threads %d: %d results for %d points", threads, len(res), len(batch))
+		}
+		for i, p := range batch {
+			want, _ := rgeo.Find(p[0], p[1])
+			if res[i] != want {
+				t.Fatalf("threads %d: point %d %v got %q, want %q", threads, i, p, res[i].HouseNumber, want.HouseNumber)
+			}
+		}
+		if n := lookups.Load(); n > int64(len(batch))*2/3+1 {
+			t.Errorf("threads %d: %d lookups, duplicates were not resolved once", threads, n)
+		}
+	}
+
+	if res := rgeo.FindBatch(nil); len(res) != 0 {
+		t.Errorf("empty batch: %d results", len(res))
+	}
+	if res := rgeo.FindBatchQuery(batch[:10], Query{Types: PointRoad}); res[0] != (InfoModel{}) {
+		t.Errorf("query filters apply to batches, got %q", res[0].HouseNumber)
+	}
+}
+
+func TestHilbertKeyLocality(t *testing.T) {
+	// neighbours in a fine grid stay closer on the curve than distant points
+	near := hilbertKey(55.7558, 37.6173) ^ hilbertKey(55.7559, 37.6174)
+	far := hilbertKey(55.7558, 37.6173) ^ hilbertKey(-33.8688, 151.2093)
+	if near >= far {
+		t.Errorf("near keys differ in %x, far keys in %x", near, far)
+	}
+	if hilbertKey(91, 181) != hilbertKey(90, 180) {
+		t.Error("out of range coordinates are not clamped")
+	}
+}
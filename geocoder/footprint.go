@@ -0,0 +1,137 @@
+package geocoder
+
+import (
+	"context"
+	"unique"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/planar"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	"github.com/royalcat/rgeocache/internal/bordertree"
+	"github.com/royalcat/rgeocache/kdbush"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// footprint is a building outline linked to its address.
+type footprint struct {
+	ring  orb.Ring
+	bound orb.Bound
+	info  *geoInfo
+}
+
+// buildFootprints indexes footprints of raw points by their centroids.
+// points must be the optimized version of raw with the same order.
+// Returns nil if no point has a footprint.
+func buildFootprints(raw []cachemodel.Point, points []kdbush.Point[*geoInfo]) (*kdbush.KDBush[*footprint], float64) {
+	var fps []kdbush.Point[*footprint]
+	var maxExtent float64
+	for i, p := range raw {
+		if len(p.Data.Footprint) < 4 {
+			continue
+		}
+		extent := savev2.FootprintExtent(orb.Point{p.X, p.Y}, p.Data.Footprint)
+		if extent > savev2.MaxFootprintExtent {
+			continue
+		}
+		maxExtent = max(maxExtent, extent)
+		fps = append(fps, kdbush.Point[*footprint]{
+			X: p.X, Y: p.Y,
+			Data: &footprint{
+				ring:  p.Data.Footprint,
+				bound: p.Data.Footprint.Bound(),
+				info:  points[i].Data,
+			},
+		})
+	}
+	if len(fps) == 0 {
+		return nil, 0
+	}
+	return kdbush.NewBush(fps, kdbush.DefaultNodeSize), maxExtent
+}
+
+// findFootprint returns the address of the building containing the point,
+// buildings hidden by an overlay are skipped.
+func (f *RGeoCoder) findFootprint(ctx context.Context, lon, lat float64, q Query) (*geoInfo, bool) {
+	if f.footprints == nil {
+		return nil, false
+	}
+	_, span := startSpan(ctx, "footprints.Within")
+	defer span.End()
+
+	point := orb.Point{lon, lat}
+	var found *geoInfo
+	f.footprints.Within(lon, lat, f.footprintsExtent, func(p kdbush.Point[*footprint]) bool {
+		if p.Data.bound.Contains(point) && planar.RingContains(p.Data.ring, point) && q.visible(p.X, p.Y) {
+			found = p.Data.info
+			return false
+		}
+		return true
+	})
+	return found, found != nil
+}
+
+// findFootprint returns the point data of the building containing the point,
+// buildings hidden by an overlay are skipped.
+func (f *RGeoCoderDisk) findFootprint(ctx context.Context, lon, lat float64, q Query) (savev2.V2PointData, bool, error) {
+	if f.footprints == nil {
+		return savev2.V2PointData{}, false, nil
+	}
+	_, span := startSpan(ctx, "footprints.Within")
+	defer span.End()
+
+	point := orb.Point{lon, lat}
+	pointIdx := -1
+	err := f.footprints.Within(lon, lat, f.footprintsExtent, func(p kdbush.Point[savev2.V2Footprint]) bool {
+		if p.Data.Ring.Bound().Contains(point) && planar.RingContains(p.Data.Ring, point) && q.visible(p.X, p.Y) {
+			pointIdx = int(p.Data.PointIdx)
+			return false
+		}
+		return true
+	})
+	if err != nil || pointIdx < 0 {
+		return savev2.V2PointData{}, false, err
+	}
+
+	data, err := f.diskTree.PointData(pointIdx)
+	if err != nil {
+		return savev2.V2PointData{}, false, err
+	}
+	return data, true, nil
+}
+
+// fillZones sets missing region and country of out from the zone borders.
+func fillZones(ctx context.Context, out *InfoModel, regions, countries *bordertree.BorderTree[unique.Handle[string]], point orb.Point) {
+	if out.Region == "" && regions != nil {
+		if region, ok := queryZone(ctx, "region", regions, point); ok {
+			out.Region = region.Value()
+		}
+	}
+	if out.Country == "" && countries != nil {
+		if country, ok := queryZone(ctx, "country", countries, point); ok {
+			out.Country = country.Value()
+		}
+	}
+}
+
+// queryZone runs the polygon checks of a border tree in its own span.
+func queryZone(ctx context.Context, zone string, tree *bordertree.BorderTree[unique.Handle[string]], point orb.Point) (unique.Handle[string], bool) {
+	_, span := startSpan(ctx, "bordertree.QueryPoint", trace.WithAttributes(attribute.String("zone", zone)))
+	defer span.End()
+
+	name, ok := tree.QueryPoint(point)
+	span.SetAttributes(attribute.Bool("found", ok))
+	return name, ok
+}
+
+// findZones returns only the region and country of the point, it's the answer
+// when there is no address around.
+func findZones(ctx context.Context, regions, countries *bordertree.BorderTree[unique.Handle[string]], point orb.Point) (InfoModel, bool) {
+	out := InfoModel{}
+	fillZones(ctx, &out, regions, countries, point)
+	if out.Country != "" || out.Region != "" {
+		return out, true
+	}
+	return InfoModel{}, false
+}
@@ -0,0 +1,41 @@
+package geocoder
+
+import cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+
+// Loader types reported by [CacheInfo].
+const (
+	LoaderMemory   = "memory"
+	LoaderMmap     = "mmap"
+	LoaderReaderAt = "reader"
+	LoaderBytes    = "bytes"
+)
+
+// CacheInfo describes a loaded cache.
+type CacheInfo struct {
+	// Metadata is zero for legacy caches without metadata.
+	Metadata cachemodel.Metadata
+	Points   int
+	Zones    int
+	// Loader is one of the Loader constants.
+	Loader string
+}
+
+// CacheInfo describes the loaded cache.
+func (f *RGeoCoder) CacheInfo() CacheInfo {
+	return CacheInfo{
+		Metadata: f.metadata,
+		Points:   f.tree.NumPoints(),
+		Zones:    f.numZones,
+		Loader:   LoaderMemory,
+	}
+}
+
+// CacheInfo describes the loaded cache.
+func (f *RGeoCoderDisk) CacheInfo() CacheInfo {
+	return CacheInfo{
+		Metadata: f.metadata,
+		Points:   f.diskTree.NumPoints(),
+		Zones:    f.numZones,
+		Loader:   f.loader,
+	}
+}
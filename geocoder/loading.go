@@ -14,6 +14,7 @@ import (
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	"github.com/royalcat/rgeocache/internal/bordertree"
 	"github.com/royalcat/rgeocache/kdbush"
+	"golang.org/x/exp/mmap"
 )
 
 func LoadGeoCoderFromReader(r io.Reader, opts ...Option) (*RGeoCoder, error) {
@@ -21,13 +22,14 @@ func LoadGeoCoderFromReader(r io.Reader, opts ...Option) (*RGeoCoder, error) {
 	log := options.logger
 
 	log.Info("Loading geocoder points from reader")
-	pointsRaw, zonesRaw, err := cachesaver.LoadFromReader(r, log)
+	pointsRaw, zonesRaw, metadata, err := cachesaver.LoadFromReaderWithMetadata(r, log)
 	if err != nil {
 		return nil, fmt.Errorf("error loading points: %s", err.Error())
 	}
 
 	points := optimizePoints(pointsRaw)
 	tree := kdbush.NewBush(points, kdbush.DefaultNodeSize)
+	footprints, footprintsExtent := buildFootprints(pointsRaw, points)
 
 	regions := bordertree.NewBorderTree[unique.Handle[string]]()
 	countries := bordertree.NewBorderTree[unique.Handle[string]]()
@@ -40,7 +42,13 @@ func LoadGeoCoderFromReader(r io.Reader, opts ...Option) (*RGeoCoder, error) {
 		}
 	}
 
-	return newRGeoCoder(tree, regions, countries, opts...), nil
+	rgeo := newRGeoCoder(tree, regions, countries, opts...)
+	rgeo.footprints, rgeo.footprintsExtent = footprints, footprintsExtent
+	rgeo.numZones = len(zonesRaw)
+	if metadata != nil {
+		rgeo.metadata = *metadata
+	}
+	return rgeo, nil
 }
 
 func LoadGeoCoderFromFile(file string, opts ...Option) (*RGeoCoder, error) {
@@ -90,7 +98,9 @@ func NewGeoCoderFromPoints(points []cachemodel.Point, opts ...Option) *RGeoCoder
 	tree := kdbush.NewBush(optimized, 128)
 	regions := bordertree.NewBorderTree[unique.Handle[string]]()
 	countries := bordertree.NewBorderTree[unique.Handle[string]]()
-	return newRGeoCoder(tree, regions, countries, opts...)
+	rgeo := newRGeoCoder(tree, regions, countries, opts...)
+	rgeo.footprints, rgeo.footprintsExtent = buildFootprints(points, optimized)
+	return rgeo
 }
 
 func newRGeoCoder(tree *kdbush.KDBush[*geoInfo], regions *bordertree.BorderTree[unique.Handle[string]], countries *bordertree.BorderTree[unique.Handle[string]], opts ...Option) *RGeoCoder {
@@ -151,3 +161,27 @@ func PrintCacheSizeAnalysisForFile(file string) error {
 
 	return cachesaver.PrintCacheSizeAnalysis(reader)
 }
+
+// VerifyFile checks the cache file with [cachesaver.Verify].  Files are
+// mmapped, zstd compressed files are decompressed into memory first.
+func VerifyFile(file string, log *slog.Logger) error {
+	if strings.HasSuffix(file, ".zst") {
+		reader, err := openReader(file)
+		if err != nil {
+			return fmt.Errorf("error opening points file: %s", err.Error())
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("error decompressing points file: %w", err)
+		}
+		return cachesaver.Verify(kdbush.Bytes(data), int64(len(data)), log)
+	}
+
+	reader, err := mmap.Open(file)
+	if err != nil {
+		return fmt.Errorf("error opening points file: %s", err.Error())
+	}
+	defer reader.Close()
+	return cachesaver.Verify(reader, int64(reader.Len()), log)
+}
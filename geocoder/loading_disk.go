@@ -3,57 +3,93 @@ package geocoder
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"unique"
 
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
 	"github.com/royalcat/rgeocache/internal/bordertree"
+	"github.com/royalcat/rgeocache/kdbush"
 	"golang.org/x/exp/mmap"
 )
 
-// LoadGeoCoderFromFileDisk loads a v2 cache file using mmap for the spatial index.
-// This is the default loading path for v2 caches — only string tables and zone
+// LoadGeoCoderFromFileDisk loads a v2 or v3 cache file using mmap for the spatial index.
+// This is the default loading path for v2 and v3 caches — only string tables and zone
 // polygons are loaded into memory; the KD-tree index is accessed via mmap.
 //
 // The returned RGeoCoderDisk must be closed after use to release the mmap mapping.
 func LoadGeoCoderFromFileDisk(file string, opts ...Option) (*RGeoCoderDisk, error) {
 	options := loadOptions(opts...)
-	log := options.logger
-
-	log.Info("Loading v2 geocoder from file via mmap", "file", file)
+	options.logger.Info("Loading disk geocoder from file via mmap", "file", file)
 
 	reader, err := mmap.Open(file)
 	if err != nil {
 		return nil, fmt.Errorf("error mmapping cache file: %w", err)
 	}
 
+	coder, err := loadGeoCoderDisk(reader, LoaderMmap, options)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return coder, nil
+}
+
+// LoadGeoCoderFromReaderAt loads a v2 or v3 cache from any [io.ReaderAt], e.g. an
+// embedded file or a range-reading object store client, with the same lazy
+// access as [LoadGeoCoderFromFileDisk].  Every lookup reads the tree nodes it
+// visits, so the reader should be cheap to read at random offsets.
+//
+// Close closes r if it is an [io.Closer].
+func LoadGeoCoderFromReaderAt(r io.ReaderAt, opts ...Option) (*RGeoCoderDisk, error) {
+	options := loadOptions(opts...)
+	options.logger.Info("Loading disk geocoder from reader")
+
+	return loadGeoCoderDisk(r, LoaderReaderAt, options)
+}
+
+// LoadGeoCoderFromBytes loads a v2 or v3 cache held in memory without copying or
+// decoding it, e.g. a cache embedded with go:embed.  data must not be
+// modified while the geocoder is used.
+func LoadGeoCoderFromBytes(data []byte, opts ...Option) (*RGeoCoderDisk, error) {
+	options := loadOptions(opts...)
+	options.logger.Info("Loading disk geocoder from bytes", "size", len(data))
+
+	return loadGeoCoderDisk(kdbush.Bytes(data), LoaderBytes, options)
+}
+
+func loadGeoCoderDisk(reader io.ReaderAt, loader string, options options) (*RGeoCoderDisk, error) {
+	log := options.logger
+
 	// Verify magic bytes and compat level
 	var magic [4]byte
 	if _, err := reader.ReadAt(magic[:], 0); err != nil {
-		reader.Close()
 		return nil, fmt.Errorf("error reading magic bytes: %w", err)
 	}
 	if string(magic[:]) != "RGEO" {
-		reader.Close()
 		return nil, fmt.Errorf("invalid magic bytes: %q", string(magic[:]))
 	}
 
 	var compatBuf [4]byte
 	if _, err := reader.ReadAt(compatBuf[:], 4); err != nil {
-		reader.Close()
 		return nil, fmt.Errorf("error reading compatibility level: %w", err)
 	}
 	compatLevel := binary.LittleEndian.Uint32(compatBuf[:])
-	if compatLevel != savev2.COMPATIBILITY_LEVEL {
-		reader.Close()
-		return nil, fmt.Errorf("expected v2 cache (compat level %d), got %d", savev2.COMPATIBILITY_LEVEL, compatLevel)
-	}
 
-	// Load via mmap
-	result, err := savev2.LoadMmap(reader)
+	var result *savev2.LoadMmapResult
+	var err error
+	switch compatLevel {
+	case savev2.COMPATIBILITY_LEVEL:
+		result, err = savev2.LoadMmap(reader)
+	case savev3.COMPATIBILITY_LEVEL:
+		result, err = savev3.LoadMmap(reader)
+	default:
+		return nil, fmt.Errorf("expected v2 or v3 cache (compat level %d or %d), got %d",
+			savev2.COMPATIBILITY_LEVEL, savev3.COMPATIBILITY_LEVEL, compatLevel)
+	}
 	if err != nil {
-		reader.Close()
-		return nil, fmt.Errorf("error loading v2 cache via mmap: %w", err)
+		return nil, fmt.Errorf("error loading v%d cache via %s: %w", compatLevel, loader, err)
 	}
 
 	// Build border trees for region/country lookups
@@ -68,20 +104,35 @@ func LoadGeoCoderFromFileDisk(file string, opts ...Option) (*RGeoCoderDisk, erro
 		}
 	}
 
-	log.Info("v2 geocoder loaded via mmap",
+	log.Info("Disk geocoder loaded",
+		"loader", loader,
+		"format", compatLevel,
 		"num_points", result.DiskBush.NumPoints(),
 		"num_zones", len(result.Zones),
 		"node_size", result.DiskBush.NodeSize(),
+		"has_footprints", result.Footprints != nil,
 	)
 
+	var metadata cachemodel.Metadata
+	if result.Metadata != nil {
+		metadata = *result.Metadata
+	}
+
+	closer, _ := reader.(io.Closer)
 	return &RGeoCoderDisk{
 		diskTree:          result.DiskBush,
-		mmapReader:        reader,
+		footprints:        result.Footprints,
+		footprintsExtent:  result.FootprintsMaxExtent,
+		reader:            result.StringsData,
+		closer:            closer,
+		loader:            loader,
 		stringsIndex:      result.StringsIndex,
 		stringsDataOffset: result.StringsDataOffset,
 		regions:           regions,
 		countries:         countries,
 		searchRadius:      options.searchRadius,
 		logger:            log,
+		metadata:          metadata,
+		numZones:          len(result.Zones),
 	}, nil
 }
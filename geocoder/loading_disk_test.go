@@ -0,0 +1,137 @@
+package geocoder
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/royalcat/rgeocache/cachesaver"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
+)
+
+func TestLoadGeoCoderFromBytes(t *testing.T) {
+	var buf bytes.Buffer
+	points := []cachemodel.Point{
+		testBuilding(0, 0, "1", nil),
+		testBuilding(0.01, 0.01, "2", nil),
+	}
+	meta := cachemodel.Metadata{Version: 2, Locale: "en", DateCreated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := cachesaver.SaveV2(slices.Values(points), slices.Values([]cachemodel.Zone{}), meta, &buf); err != nil {
+		t.Fatalf("SaveV2: %v", err)
+	}
+
+	loaders := map[string]func() (*RGeoCoderDisk, error){
+		LoaderBytes: func() (*RGeoCoderDisk, error) {
+			return LoadGeoCoderFromBytes(buf.Bytes(), WithSearchRadius(0.001))
+		},
+		LoaderReaderAt: func() (*RGeoCoderDisk, error) {
+			return LoadGeoCoderFromReaderAt(bytes.NewReader(buf.Bytes()), WithSearchRadius(0.001))
+		},
+	}
+	for loader, load := range loaders {
+		t.Run(loader, func(t *testing.T) {
+			rgeo, err := load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rgeo.Close()
+
+			info, ok := rgeo.Find(0.01, 0.01)
+			if !ok || info.HouseNumber != "2" || info.Street != "Test Street" {
+				t.Errorf("Find = %+v %v, want house 2", info, ok)
+			}
+			if ci := rgeo.CacheInfo(); ci.Loader != loader || ci.Points != 2 || ci.Metadata.Locale != "en" {
+				t.Errorf("CacheInfo = %+v", ci)
+			}
+		})
+	}
+
+	if _, err := LoadGeoCoderFromBytes([]byte("RGEO\x01\x00\x00\x00")); err == nil {
+		t.Error("expected an error for a v1 cache")
+	}
+}
+
+func TestLoadGeoCoderFromBytesV3(t *testing.T) {
+	points := []cachemodel.Point{
+		testBuilding(0, 0, "1", nil),
+		testBuilding(0.01, 0.01, "2", nil),
+	}
+	meta := cachemodel.Metadata{Version: 3, Locale: "en", DateCreated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f, err := os.Create(filepath.Join(t.TempDir(), "cache.rgc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	opts := savev3.Options{Compress: []savev3.SectionKind{savev3.SectionZones, savev3.SectionStringsData}}
+	if err := cachesaver.SaveV3(slices.Values(points), slices.Values([]cachemodel.Zone{}), meta, f, opts); err != nil {
+		t.Fatalf("SaveV3: %v", err)
+	}
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rgeo, err := LoadGeoCoderFromBytes(b, WithSearchRadius(0.001))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rgeo.Close()
+
+	info, ok := rgeo.Find(0.01, 0.01)
+	if !ok || info.HouseNumber != "2" || info.Street != "Test Street" {
+		t.Errorf("Find = %+v %v, want house 2", info, ok)
+	}
+	if ci := rgeo.CacheInfo(); ci.Points != 2 || ci.Metadata.Version != 3 {
+		t.Errorf("CacheInfo = %+v", ci)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	points := []cachemodel.Point{
+		testBuilding(0, 0, "1", nil),
+		testBuilding(0.01, 0.01, "2", nil),
+	}
+	meta := cachemodel.Metadata{Version: 2, Locale: "en", DateCreated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	dir := t.TempDir()
+
+	for name, save := range map[string]func(w *os.File) error{
+		"v1": func(w *os.File) error {
+			return cachesaver.SaveV1(slices.Values(points), slices.Values([]cachemodel.Zone{}), meta, w)
+		},
+		"v2": func(w *os.File) error {
+			return cachesaver.SaveV2(slices.Values(points), slices.Values([]cachemodel.Zone{}), meta, w)
+		},
+		"v3": func(w *os.File) error {
+			return cachesaver.SaveV3(slices.Values(points), slices.Values([]cachemodel.Zone{}), meta, w, savev3.Options{})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".rgc")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := save(f); err != nil {
+				t.Fatal(err)
+			}
+			size, _ := f.Seek(0, io.SeekCurrent)
+			f.Close()
+
+			if err := VerifyFile(path, slog.New(slog.DiscardHandler)); err != nil {
+				t.Errorf("VerifyFile: %v", err)
+			}
+			if err := os.Truncate(path, size-1); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyFile(path, slog.New(slog.DiscardHandler)); err == nil {
+				t.Error("VerifyFile of a truncated cache succeeded")
+			}
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package geocoder
 
 import (
+	"context"
 	"log/slog"
 	"math"
 	"unique"
 
 	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	"github.com/royalcat/rgeocache/geomodel"
 	"github.com/royalcat/rgeocache/internal/bordertree"
 	"github.com/royalcat/rgeocache/kdbush"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // internal memory-optimized representation of geomodel.Info
@@ -38,11 +42,16 @@ type Geocoder interface {
 }
 
 type RGeoCoder struct {
-	tree         *kdbush.KDBush[*geoInfo]
-	regions      *bordertree.BorderTree[unique.Handle[string]]
-	countries    *bordertree.BorderTree[unique.Handle[string]]
-	searchRadius float64
-	logger       *slog.Logger
+	tree             *kdbush.KDBush[*geoInfo]
+	footprints       *kdbush.KDBush[*footprint]
+	footprintsExtent float64
+	regions          *bordertree.BorderTree[unique.Handle[string]]
+	countries        *bordertree.BorderTree[unique.Handle[string]]
+	searchRadius     float64
+	logger           *slog.Logger
+
+	metadata cachemodel.Metadata
+	numZones int
 }
 
 type InfoModel struct {
@@ -50,13 +59,64 @@ type InfoModel struct {
 }
 
 func (f *RGeoCoder) Find(lat, lon float64) (i InfoModel, ok bool) {
-	return f.FindInRadius(lat, lon, f.searchRadius)
+	return f.FindInRadiusContext(context.Background(), lat, lon, f.searchRadius)
 }
 
+// FindInRadius returns the address of the building containing the point,
+// or the closest address within the given radius if there is none.
 func (f *RGeoCoder) FindInRadius(lat, lon float64, radius float64) (i InfoModel, ok bool) {
+	return f.FindInRadiusContext(context.Background(), lat, lon, radius)
+}
+
+// FindQuery returns the address matching the per-request parameters.
+func (f *RGeoCoder) FindQuery(lat, lon float64, q Query) (InfoModel, bool) {
+	return f.FindQueryContext(context.Background(), lat, lon, q)
+}
+
+// FindContext is [RGeoCoder.Find] recording spans under the span of ctx.
+func (f *RGeoCoder) FindContext(ctx context.Context, lat, lon float64) (InfoModel, bool) {
+	return f.FindInRadiusContext(ctx, lat, lon, f.searchRadius)
+}
+
+// FindInRadiusContext is [RGeoCoder.FindInRadius] recording spans under the span of ctx.
+func (f *RGeoCoder) FindInRadiusContext(ctx context.Context, lat, lon float64, radius float64) (InfoModel, bool) {
+	return f.find(ctx, lat, lon, radius, Query{})
+}
+
+// FindQueryContext is [RGeoCoder.FindQuery] recording spans under the span of ctx.
+func (f *RGeoCoder) FindQueryContext(ctx context.Context, lat, lon float64, q Query) (InfoModel, bool) {
+	return f.find(ctx, lat, lon, q.radius(lat, f.searchRadius), q)
+}
+
+func (f *RGeoCoder) find(ctx context.Context, lat, lon float64, radius float64, q Query) (InfoModel, bool) {
+	ctx, span := startSpan(ctx, "RGeoCoder.Find", trace.WithAttributes(attribute.Float64("radius", radius)))
+	defer span.End()
+
+	if c, ok := f.findCandidate(ctx, lat, lon, radius, q); ok {
+		return c.info, true
+	}
+
+	// point not found, trying determine region and country by borders
+	return findZones(ctx, f.regions, f.countries, orb.Point{lon, lat})
+}
+
+func (f *RGeoCoder) findCandidate(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool) {
+	if info, ok := f.findFootprint(ctx, lon, lat, q); ok && q.accepts(info.Weight) {
+		out := InfoModel{Info: info.value()}
+		out.MatchType = geomodel.MatchInside
+		fillZones(ctx, &out, f.regions, f.countries, orb.Point{lon, lat})
+		return candidate{info: out, inside: true}, true
+	}
+
+	_, span := startSpan(ctx, "kdbush.Within")
+	visited := 0
 	finPoint := kdbush.Point[*geoInfo]{}
 	finDist := math.Inf(1)
 	f.tree.Within(lon, lat, radius, func(p kdbush.Point[*geoInfo]) bool {
+		visited++
+		if !q.accepts(p.Data.Weight) || !q.withinDistance(lat, lon, p.X, p.Y) || !q.visible(p.X, p.Y) {
+			return true
+		}
 		dist := distanceSquared(lon, lat, p.X, p.Y)
 		if dist < finDist || p.Data.Weight > finPoint.Data.Weight {
 			finPoint = p
@@ -69,46 +129,17 @@ func (f *RGeoCoder) FindInRadius(lat, lon float64, radius float64) (i InfoModel,
 
 		return true
 	})
+	span.SetAttributes(attribute.Int("points", visited))
+	span.End()
 
-	// point found (happy path)
-	if !math.IsInf(finDist, 1) {
-		out := InfoModel{Info: finPoint.Data.value()}
-
-		if out.Region == "" && f.regions != nil {
-			if region, ok := f.regions.QueryPoint(orb.Point{lon, lat}); ok {
-				out.Region = region.Value()
-			}
-		}
-
-		if out.Country == "" && f.countries != nil {
-			if country, ok := f.countries.QueryPoint(orb.Point{lon, lat}); ok {
-				out.Country = country.Value()
-			}
-		}
-
-		return out, true
-	}
-
-	// point not found, trying determine region and country by borders
-	out := InfoModel{}
-	if f.countries != nil {
-		country, ok := f.countries.QueryPoint(orb.Point{lon, lat})
-		if ok {
-			out.Country = country.Value()
-		}
-	}
-	if f.regions != nil {
-		region, ok := f.regions.QueryPoint(orb.Point{lon, lat})
-		if ok {
-			out.Region = region.Value()
-		}
-	}
-	if out.Country != "" || out.Region != "" {
-		return out, true
+	if math.IsInf(finDist, 1) {
+		return candidate{}, false
 	}
 
-	// nothing found
-	return InfoModel{}, false
+	out := InfoModel{Info: finPoint.Data.value()}
+	out.MatchType = geomodel.MatchNearest
+	fillZones(ctx, &out, f.regions, f.countries, orb.Point{lon, lat})
+	return candidate{info: out, dist: finDist}, true
 }
 
 func distanceSquared(x1, y1, x2, y2 float64) (distance float64) {
@@ -1,43 +1,110 @@
 package geocoder
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"math"
 	"unique"
 
 	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
 	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	"github.com/royalcat/rgeocache/geomodel"
 	"github.com/royalcat/rgeocache/internal/bordertree"
 	"github.com/royalcat/rgeocache/kdbush"
-	"golang.org/x/exp/mmap"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// RGeoCoderDisk is a disk-backed reverse geocoder that uses mmap for the
-// spatial index and for lazy string resolution. Strings are read from the
-// mmap'd file only when a point is matched.
+// RGeoCoderDisk is a disk-backed reverse geocoder that uses mmap (or another
+// [io.ReaderAt]) for the spatial index and for lazy string resolution.
+// Strings are read from the file only when a point is matched.
 type RGeoCoderDisk struct {
 	diskTree          *kdbush.DiskKDBush[savev2.V2PointData, *savev2.V2PointData]
-	mmapReader        *mmap.ReaderAt
+	footprints        *kdbush.DiskKDBush[savev2.V2Footprint, *savev2.V2Footprint]
+	footprintsExtent  float64
+	reader            io.ReaderAt // reader of the string data, the file or a decompressed section
+	closer            io.Closer   // closes the loaded reader, nil when it needs no closing
+	loader            string
 	stringsIndex      []uint32 // offset index: id → byte offset into string data
-	stringsDataOffset int64    // byte offset of the string data block in the mmap'd file
+	stringsDataOffset int64    // byte offset of the string data block in reader
 	regions           *bordertree.BorderTree[unique.Handle[string]]
 	countries         *bordertree.BorderTree[unique.Handle[string]]
 	searchRadius      float64
 	logger            *slog.Logger
+
+	metadata cachemodel.Metadata
+	numZones int
 }
 
 // Find returns the closest address for the given coordinates.
 func (f *RGeoCoderDisk) Find(lat, lon float64) (InfoModel, bool) {
-	return f.FindInRadius(lat, lon, f.searchRadius)
+	return f.FindInRadiusContext(context.Background(), lat, lon, f.searchRadius)
 }
 
-// FindInRadius returns the closest address within the given radius.
+// FindInRadius returns the address of the building containing the point,
+// or the closest address within the given radius if there is none.
 func (f *RGeoCoderDisk) FindInRadius(lat, lon float64, radius float64) (i InfoModel, ok bool) {
+	return f.FindInRadiusContext(context.Background(), lat, lon, radius)
+}
+
+// FindQuery returns the address matching the per-request parameters.
+func (f *RGeoCoderDisk) FindQuery(lat, lon float64, q Query) (InfoModel, bool) {
+	return f.FindQueryContext(context.Background(), lat, lon, q)
+}
+
+// FindContext is [RGeoCoderDisk.Find] recording spans under the span of ctx.
+func (f *RGeoCoderDisk) FindContext(ctx context.Context, lat, lon float64) (InfoModel, bool) {
+	return f.FindInRadiusContext(ctx, lat, lon, f.searchRadius)
+}
+
+// FindInRadiusContext is [RGeoCoderDisk.FindInRadius] recording spans under the span of ctx.
+func (f *RGeoCoderDisk) FindInRadiusContext(ctx context.Context, lat, lon float64, radius float64) (InfoModel, bool) {
+	return f.find(ctx, lat, lon, radius, Query{})
+}
+
+// FindQueryContext is [RGeoCoderDisk.FindQuery] recording spans under the span of ctx.
+func (f *RGeoCoderDisk) FindQueryContext(ctx context.Context, lat, lon float64, q Query) (InfoModel, bool) {
+	return f.find(ctx, lat, lon, q.radius(lat, f.searchRadius), q)
+}
+
+func (f *RGeoCoderDisk) find(ctx context.Context, lat, lon float64, radius float64, q Query) (InfoModel, bool) {
+	ctx, span := startSpan(ctx, "RGeoCoderDisk.Find", trace.WithAttributes(attribute.Float64("radius", radius)))
+	defer span.End()
+
+	if c, ok := f.findCandidate(ctx, lat, lon, radius, q); ok {
+		return c.info, true
+	}
+
+	// Fallback: region/country from borders alone
+	return findZones(ctx, f.regions, f.countries, orb.Point{lon, lat})
+}
+
+func (f *RGeoCoderDisk) findCandidate(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool) {
+	data, inside, err := f.findFootprint(ctx, lon, lat, q)
+	if err != nil {
+		f.logger.Error("error querying footprints", "error", err)
+	}
+	if inside && q.accepts(data.Weight) {
+		out := InfoModel{Info: f.resolvePointData(ctx, data).value()}
+		out.MatchType = geomodel.MatchInside
+		fillZones(ctx, &out, f.regions, f.countries, orb.Point{lon, lat})
+		return candidate{info: out, inside: true}, true
+	}
+
+	_, span := startSpan(ctx, "kdbush.Within")
+	visited := 0
 	finPoint := kdbush.Point[savev2.V2PointData]{}
 	finDist := math.Inf(1)
 	hasBest := false
 
-	err := f.diskTree.Within(lon, lat, radius, func(p kdbush.Point[savev2.V2PointData]) bool {
+	err = f.diskTree.Within(lon, lat, radius, func(p kdbush.Point[savev2.V2PointData]) bool {
+		visited++
+		if !q.accepts(p.Data.Weight) || !q.withinDistance(lat, lon, p.X, p.Y) || !q.visible(p.X, p.Y) {
+			return true
+		}
 		dist := distanceSquared(lon, lat, p.X, p.Y)
 		if dist < finDist || p.Data.Weight > finPoint.Data.Weight {
 			finPoint = p
@@ -46,51 +113,33 @@ func (f *RGeoCoderDisk) FindInRadius(lat, lon float64, radius float64) (i InfoMo
 		}
 		return true
 	})
+	span.SetAttributes(attribute.Int("points", visited))
 	if err != nil {
-		f.logger.Error("error querying disk tree", "error", err)
-		return InfoModel{}, false
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "error querying disk tree")
 	}
-
-	if hasBest {
-		gi := f.resolvePointData(finPoint.Data)
-		out := InfoModel{Info: gi.value()}
-
-		if out.Region == "" && f.regions != nil {
-			if region, ok := f.regions.QueryPoint(orb.Point{lon, lat}); ok {
-				out.Region = region.Value()
-			}
-		}
-		if out.Country == "" && f.countries != nil {
-			if country, ok := f.countries.QueryPoint(orb.Point{lon, lat}); ok {
-				out.Country = country.Value()
-			}
-		}
-		return out, true
+	span.End()
+	if err != nil {
+		f.logger.Error("error querying disk tree", "error", err)
+		return candidate{}, false
 	}
 
-	// Fallback: region/country from borders alone
-	out := InfoModel{}
-	if f.countries != nil {
-		country, ok := f.countries.QueryPoint(orb.Point{lon, lat})
-		if ok {
-			out.Country = country.Value()
-		}
-	}
-	if f.regions != nil {
-		region, ok := f.regions.QueryPoint(orb.Point{lon, lat})
-		if ok {
-			out.Region = region.Value()
-		}
-	}
-	if out.Country != "" || out.Region != "" {
-		return out, true
+	if !hasBest {
+		return candidate{}, false
 	}
 
-	return InfoModel{}, false
+	gi := f.resolvePointData(ctx, finPoint.Data)
+	out := InfoModel{Info: gi.value()}
+	out.MatchType = geomodel.MatchNearest
+	fillZones(ctx, &out, f.regions, f.countries, orb.Point{lon, lat})
+	return candidate{info: out, dist: finDist}, true
 }
 
 // resolvePointData reads strings lazily from the mmap'd string data block.
-func (f *RGeoCoderDisk) resolvePointData(data savev2.V2PointData) *geoInfo {
+func (f *RGeoCoderDisk) resolvePointData(ctx context.Context, data savev2.V2PointData) *geoInfo {
+	_, span := startSpan(ctx, "RGeoCoderDisk.readStr")
+	defer span.End()
+
 	return &geoInfo{
 		Name:        f.readStr(data.NameID),
 		Street:      f.readStr(data.StreetID),
@@ -110,7 +159,7 @@ func (f *RGeoCoderDisk) readStr(id uint32) unique.Handle[string] {
 	// Read a buffer large enough for any address string.
 	// The null terminator tells us where the string ends.
 	buf := make([]byte, 512)
-	n, err := f.mmapReader.ReadAt(buf, f.stringsDataOffset+int64(start))
+	n, err := f.reader.ReadAt(buf, f.stringsDataOffset+int64(start))
 	if err != nil && n == 0 {
 		return unique.Make("")
 	}
@@ -127,8 +176,8 @@ func (f *RGeoCoderDisk) readStr(id uint32) unique.Handle[string] {
 
 // Close releases the mmap resources.
 func (f *RGeoCoderDisk) Close() error {
-	if f.mmapReader != nil {
-		return f.mmapReader.Close()
+	if f.closer != nil {
+		return f.closer.Close()
 	}
 	return nil
 }
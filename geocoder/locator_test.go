@@ -0,0 +1,88 @@
+package geocoder
+
+import (
+	"testing"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"github.com/royalcat/rgeocache/geomodel"
+)
+
+func testBuilding(x, y float64, house string, footprint orb.Ring) cachemodel.Point {
+	return cachemodel.Point{
+		X: x, Y: y,
+		Data: cachemodel.Info{
+			Name:        unique.Make(""),
+			Street:      unique.Make("Test Street"),
+			HouseNumber: unique.Make(house),
+			City:        unique.Make(""),
+			Region:      unique.Make(""),
+			Weight:      10,
+			Footprint:   footprint,
+		},
+	}
+}
+
+func TestFindInsideFootprint(t *testing.T) {
+	// Building 1 is large, its centroid is farther from the query point than
+	// the centroid of building 2, but the query point lies inside building 1.
+	square := orb.Ring{{-0.001, -0.001}, {0.001, -0.001}, {0.001, 0.001}, {-0.001, 0.001}, {-0.001, -0.001}}
+	rgeo := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(0, 0, "1", square),
+		testBuilding(0.0011, 0, "2", nil),
+	}, WithSearchRadius(0.01))
+
+	info, ok := rgeo.Find(0, 0.0009)
+	if !ok {
+		t.Fatal("expected a match inside the footprint")
+	}
+	if info.HouseNumber != "1" || info.MatchType != geomodel.MatchInside {
+		t.Errorf("expected house 1 matched inside, got house %q matched %q", info.HouseNumber, info.MatchType)
+	}
+
+	info, ok = rgeo.Find(0, 0.0015)
+	if !ok {
+		t.Fatal("expected a nearest match outside the footprint")
+	}
+	if info.HouseNumber != "2" || info.MatchType != geomodel.MatchNearest {
+		t.Errorf("expected house 2 matched nearest, got house %q matched %q", info.HouseNumber, info.MatchType)
+	}
+}
+
+func TestFindQuery(t *testing.T) {
+	road := testBuilding(0.0001, 0, "road", nil)
+	road.Data.Weight = 5
+	rgeo := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(0.0005, 0, "building", nil), // ~55m east
+		road,                                     // ~11m east
+	}, WithSearchRadius(0.01))
+
+	tests := []struct {
+		name      string
+		q         Query
+		wantHouse string
+		wantOK    bool
+	}{
+		{"buildings only", Query{Types: PointBuilding}, "building", true},
+		{"min weight", Query{MinWeight: 6}, "building", true},
+		{"radius in meters", Query{RadiusMeters: 20}, "road", true},
+		{"radius excludes everything", Query{RadiusMeters: 5}, "", false},
+		{"no areas", Query{Types: PointArea}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, ok := rgeo.FindQuery(0, 0, tt.q)
+			if ok != tt.wantOK || info.HouseNumber != tt.wantHouse {
+				t.Errorf("FindQuery = %q %v, want %q %v", info.HouseNumber, ok, tt.wantHouse, tt.wantOK)
+			}
+		})
+	}
+
+	if _, err := ParsePointTypes("building,lake"); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+	if types, err := ParsePointTypes("building, road"); err != nil || types != PointBuilding|PointRoad {
+		t.Errorf("ParsePointTypes = %v %v", types, err)
+	}
+}
@@ -0,0 +1,308 @@
+package geocoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"unique"
+
+	"github.com/paulmach/orb"
+	"github.com/royalcat/rgeocache/internal/bordertree"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var meter = otel.Meter("github.com/royalcat/rgeocache/geocoder")
+
+// candidate is an address found by a single cache, results of several caches
+// are compared by it.
+type candidate struct {
+	info   InfoModel
+	dist   float64 // squared distance in degrees, zero for footprint matches
+	inside bool
+}
+
+// better reports whether c should be returned instead of other: a building
+// containing the point wins, then the closest point, then the heavier one.
+func (c candidate) better(other candidate) bool {
+	if c.inside != other.inside {
+		return c.inside
+	}
+	if c.dist != other.dist {
+		return c.dist < other.dist
+	}
+	return c.info.Weight > other.info.Weight
+}
+
+// routable is implemented by geocoders which can be served by [MultiGeocoder].
+type routable interface {
+	Geocoder
+	findCandidate(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool)
+	zones() (regions, countries *bordertree.BorderTree[unique.Handle[string]])
+	pointsBound() (orb.Bound, bool, error)
+	defaultRadius() float64
+}
+
+func (f *RGeoCoder) zones() (regions, countries *bordertree.BorderTree[unique.Handle[string]]) {
+	return f.regions, f.countries
+}
+
+func (f *RGeoCoder) pointsBound() (orb.Bound, bool, error) {
+	minX, minY, maxX, maxY, ok := f.tree.Bounds()
+	return orb.Bound{Min: orb.Point{minX, minY}, Max: orb.Point{maxX, maxY}}, ok, nil
+}
+
+func (f *RGeoCoder) defaultRadius() float64 { return f.searchRadius }
+
+func (f *RGeoCoderDisk) zones() (regions, countries *bordertree.BorderTree[unique.Handle[string]]) {
+	return f.regions, f.countries
+}
+
+func (f *RGeoCoderDisk) pointsBound() (orb.Bound, bool, error) {
+	minX, minY, maxX, maxY, ok, err := f.diskTree.Bounds()
+	return orb.Bound{Min: orb.Point{minX, minY}, Max: orb.Point{maxX, maxY}}, ok, err
+}
+
+func (f *RGeoCoderDisk) defaultRadius() float64 { return f.searchRadius }
+
+// Cache is a named geocoder served by [MultiGeocoder].
+// Geocoder must be an [*RGeoCoder] or an [*RGeoCoderDisk].
+type Cache struct {
+	Name     string
+	Geocoder Geocoder
+}
+
+// MultiGeocoder serves several caches from one process.
+//
+// Every query is routed to the caches whose coverage contains the point:
+// the bounding box of their points padded by the search radius, or one of
+// their country and region zones.  Caches whose points span more than 180
+// degrees of longitude, usually crossing the antimeridian, are routed by
+// their zones only. When several caches cover the point, at
+// borders of extracts, all of them are queried and the best result wins.
+type MultiGeocoder struct {
+	caches []*routedCache
+	logger *slog.Logger
+
+	metricQueries metric.Int64Counter
+	metricMatches metric.Int64Counter
+	metricMerges  metric.Int64Counter
+}
+
+type routedCache struct {
+	name      string
+	coder     routable
+	regions   *bordertree.BorderTree[unique.Handle[string]]
+	countries *bordertree.BorderTree[unique.Handle[string]]
+	bound     orb.Bound
+	hasPoints bool
+	attrs     metric.MeasurementOption
+}
+
+var _ Geocoder = (*MultiGeocoder)(nil)
+
+// NewMultiGeocoder routes queries between caches. Caches are queried in the
+// given order, so on equal results the earlier one wins.
+// Only the logger option is used, search radius is taken from each cache.
+func NewMultiGeocoder(caches []Cache, opts ...Option) (*MultiGeocoder, error) {
+	options := loadOptions(opts...)
+
+	if len(caches) == 0 {
+		return nil, errors.New("no caches to serve")
+	}
+
+	m := &MultiGeocoder{logger: options.logger}
+
+	var err error
+	m.metricQueries, err = meter.Int64Counter("geocoder_cache_query_total",
+		metric.WithDescription("queries routed to a cache"))
+	if err != nil {
+		return nil, err
+	}
+	m.metricMatches, err = meter.Int64Counter("geocoder_cache_match_total",
+		metric.WithDescription("queries answered with an address from a cache"))
+	if err != nil {
+		return nil, err
+	}
+	m.metricMerges, err = meter.Int64Counter("geocoder_cache_merge_total",
+		metric.WithDescription("queries covered by several caches and merged"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, c := range caches {
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate cache name %q", c.Name)
+		}
+		names[c.Name] = true
+
+		coder, ok := c.Geocoder.(routable)
+		if !ok {
+			return nil, fmt.Errorf("cache %q: unsupported geocoder type %T", c.Name, c.Geocoder)
+		}
+
+		bound, hasPoints, err := coder.pointsBound()
+		if err != nil {
+			return nil, fmt.Errorf("cache %q: error computing bounds: %w", c.Name, err)
+		}
+		regions, countries := coder.zones()
+
+		// points crossing the antimeridian, from Chukotka to Kaliningrad, have
+		// the bounds of points spanning the globe, every longitude would be
+		// routed to the cache, so it's routed by its zones when it has any
+		if hasPoints && bound.Max[0]-bound.Min[0] > 180 && (hasBorders(regions) || hasBorders(countries)) {
+			m.logger.Warn("Cache spans over 180 degrees of longitude, routing it by zones only", "name", c.Name, "bound", bound)
+			hasPoints = false
+		}
+
+		m.caches = append(m.caches, &routedCache{
+			name:      c.Name,
+			coder:     coder,
+			regions:   regions,
+			countries: countries,
+			bound:     bound,
+			hasPoints: hasPoints,
+			attrs:     metric.WithAttributeSet(attribute.NewSet(attribute.String("cache", c.Name))),
+		})
+
+		m.logger.Info("Serving cache", "name", c.Name, "bound", bound, "has_points", hasPoints)
+	}
+
+	return m, nil
+}
+
+// Find routes the query using the search radius of every cache.
+func (m *MultiGeocoder) Find(lat, lon float64) (InfoModel, bool) {
+	return m.FindContext(context.Background(), lat, lon)
+}
+
+// FindInRadius routes the query with the same radius for every cache.
+func (m *MultiGeocoder) FindInRadius(lat, lon float64, radius float64) (InfoModel, bool) {
+	return m.FindInRadiusContext(context.Background(), lat, lon, radius)
+}
+
+// FindQuery routes the query with per-request parameters.
+func (m *MultiGeocoder) FindQuery(lat, lon float64, q Query) (InfoModel, bool) {
+	return m.FindQueryContext(context.Background(), lat, lon, q)
+}
+
+// FindContext is [MultiGeocoder.Find] recording spans under the span of ctx.
+func (m *MultiGeocoder) FindContext(ctx context.Context, lat, lon float64) (InfoModel, bool) {
+	return m.find(ctx, lat, lon, math.NaN(), Query{})
+}
+
+// FindInRadiusContext is [MultiGeocoder.FindInRadius] recording spans under the span of ctx.
+func (m *MultiGeocoder) FindInRadiusContext(ctx context.Context, lat, lon float64, radius float64) (InfoModel, bool) {
+	return m.find(ctx, lat, lon, radius, Query{})
+}
+
+// FindQueryContext is [MultiGeocoder.FindQuery] recording spans under the span of ctx.
+func (m *MultiGeocoder) FindQueryContext(ctx context.Context, lat, lon float64, q Query) (InfoModel, bool) {
+	return m.find(ctx, lat, lon, q.radius(lat, math.NaN()), q)
+}
+
+// find queries caches covering the point, a NaN radius selects the search
+// radius of each cache.
+func (m *MultiGeocoder) find(ctx context.Context, lat, lon float64, radius float64, q Query) (InfoModel, bool) {
+	ctx, span := startSpan(ctx, "MultiGeocoder.Find")
+	defer span.End()
+
+	point := orb.Point{lon, lat}
+
+	var routedBuf [4]*routedCache
+	routed := m.route(ctx, routedBuf[:0], point, radius)
+	span.SetAttributes(attribute.Int("caches", len(routed)))
+
+	if best, ok := m.findRouted(ctx, routed, lat, lon, radius, q); ok {
+		// zones missing in the cache of the address may be known by another one
+		for _, c := range routed {
+			fillZones(ctx, &best.info, c.regions, c.countries, point)
+		}
+		return best.info, true
+	}
+
+	// point not found, trying determine region and country by borders
+	out := InfoModel{}
+	for _, c := range routed {
+		fillZones(ctx, &out, c.regions, c.countries, point)
+	}
+	return out, out.Country != "" || out.Region != ""
+}
+
+// route appends the caches covering the point to routed.
+func (m *MultiGeocoder) route(ctx context.Context, routed []*routedCache, point orb.Point, radius float64) []*routedCache {
+	for _, c := range m.caches {
+		if c.covers(point, c.radius(radius)) {
+			routed = append(routed, c)
+		}
+	}
+	if len(routed) > 1 {
+		m.metricMerges.Add(ctx, 1)
+	}
+	return routed
+}
+
+// findRouted returns the best candidate of the routed caches.
+func (m *MultiGeocoder) findRouted(ctx context.Context, routed []*routedCache, lat, lon float64, radius float64, q Query) (candidate, bool) {
+	var best candidate
+	var bestCache *routedCache
+	for _, c := range routed {
+		m.metricQueries.Add(ctx, 1, c.attrs)
+		cand, ok := c.coder.findCandidate(ctx, lat, lon, c.radius(radius), q)
+		if ok && (bestCache == nil || cand.better(best)) {
+			best, bestCache = cand, c
+		}
+	}
+	if bestCache == nil {
+		return candidate{}, false
+	}
+	m.metricMatches.Add(ctx, 1, bestCache.attrs)
+	return best, true
+}
+
+// Close closes every cache holding resources, like mmapped files.
+func (m *MultiGeocoder) Close() error {
+	var errs []error
+	for _, c := range m.caches {
+		if closer, ok := c.coder.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("cache %q: %w", c.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *routedCache) radius(radius float64) float64 {
+	if math.IsNaN(radius) {
+		return c.coder.defaultRadius()
+	}
+	return radius
+}
+
+func hasBorders(tree *bordertree.BorderTree[unique.Handle[string]]) bool {
+	return tree != nil && tree.Len() > 0
+}
+
+// covers reports whether the cache may have an answer for the point.
+func (c *routedCache) covers(point orb.Point, radius float64) bool {
+	if c.hasPoints && c.bound.Pad(radius).Contains(point) {
+		return true
+	}
+	if c.countries != nil {
+		if _, ok := c.countries.QueryPoint(point); ok {
+			return true
+		}
+	}
+	if c.regions != nil {
+		if _, ok := c.regions.QueryPoint(point); ok {
+			return true
+		}
+	}
+	return false
+}
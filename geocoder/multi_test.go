@@ -0,0 +1,119 @@
+package geocoder
+
+import (
+	"slices"
+	"testing"
+	"unique"
+
+	"github.com/paulmach/orb"
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+)
+
+func TestMultiGeocoderRouting(t *testing.T) {
+	// Two extracts touching at lon=1, each with its own addresses.
+	west := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(0.5, 0, "w1", nil),
+		testBuilding(0.998, 0, "w2", nil),
+	}, WithSearchRadius(0.01))
+	east := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(1.001, 0, "e1", nil),
+		testBuilding(1.5, 0, "e2", nil),
+	}, WithSearchRadius(0.01))
+
+	multi, err := NewMultiGeocoder([]Cache{
+		{Name: "west", Geocoder: west},
+		{Name: "east", Geocoder: east},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		lat, lon  float64
+		wantHouse string
+		wantOK    bool
+	}{
+		{"inside west", 0, 0.501, "w1", true},
+		{"inside east", 0, 1.499, "e2", true},
+		// covered by both, the closest address is in the other extract
+		{"border closer to east", 0, 0.9995, "e1", true},
+		{"border closer to west", 0, 0.9985, "w2", true},
+		{"outside both", 10, 10, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, ok := multi.Find(tt.lat, tt.lon)
+			if ok != tt.wantOK {
+				t.Fatalf("Find ok = %v, want %v", ok, tt.wantOK)
+			}
+			if info.HouseNumber != tt.wantHouse {
+				t.Errorf("Find house = %q, want %q", info.HouseNumber, tt.wantHouse)
+			}
+		})
+	}
+
+	info, ok := multi.FindInRadius(0, 1.2, 0.5)
+	if !ok || info.HouseNumber != "e1" {
+		t.Errorf("FindInRadius = %q %v, want e1", info.HouseNumber, ok)
+	}
+}
+
+func TestMultiGeocoderInvalid(t *testing.T) {
+	rgeo := NewGeoCoderFromPoints(nil)
+	if _, err := NewMultiGeocoder(nil); err == nil {
+		t.Error("expected an error without caches")
+	}
+	if _, err := NewMultiGeocoder([]Cache{{Name: "a", Geocoder: rgeo}, {Name: "a", Geocoder: rgeo}}); err == nil {
+		t.Error("expected an error on duplicate names")
+	}
+}
+
+func TestMultiGeocoderAntimeridian(t *testing.T) {
+	// points on both sides of the antimeridian, their bounds span the globe
+	chukotka := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(179.5, 65, "c1", nil),
+		testBuilding(-179.5, 65, "c2", nil),
+	}, WithSearchRadius(0.01))
+	chukotka.countries.InsertBorder(unique.Make("Russia"), orb.MultiPolygon{
+		{{{179, 64}, {180, 64}, {180, 66}, {179, 66}, {179, 64}}},
+		{{{-180, 64}, {-179, 64}, {-179, 66}, {-180, 66}, {-180, 64}}},
+	})
+	europe := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(10, 65, "e1", nil),
+	}, WithSearchRadius(0.01))
+
+	multi, err := NewMultiGeocoder([]Cache{
+		{Name: "chukotka", Geocoder: chukotka},
+		{Name: "europe", Geocoder: europe},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		lon    float64
+		routed []string
+	}{
+		{"east of antimeridian", 179.5, []string{"chukotka"}},
+		{"west of antimeridian", -179.5, []string{"chukotka"}},
+		{"between the bounds", 10, []string{"europe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, c := range multi.route(t.Context(), nil, orb.Point{tt.lon, 65}, 0.01) {
+				names = append(names, c.name)
+			}
+			if !slices.Equal(names, tt.routed) {
+				t.Errorf("routed to %v, want %v", names, tt.routed)
+			}
+		})
+	}
+
+	info, ok := multi.Find(65, -179.5)
+	if !ok || info.HouseNumber != "c2" {
+		t.Errorf("Find = %q %v, want c2", info.HouseNumber, ok)
+	}
+}
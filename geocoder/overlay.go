@@ -0,0 +1,568 @@
+package geocoder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/royalcat/rgeocache/geomodel"
+	"github.com/royalcat/rgeocache/kdbush"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxOverlayHideRadius is the largest hide radius of an overlay point in meters.
+const MaxOverlayHideRadius = 1000.0
+
+// overlayDefaultWeight is the weight of overlay addresses without one, a building.
+const overlayDefaultWeight = 10
+
+// OverlayPoint is a custom or corrected address layered over the caches, or
+// a suppression of wrong cache points.
+type OverlayPoint struct {
+	// ID identifies the point for updates and deletes.
+	ID  string  `json:"id"`
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+	// HideRadius hides cache points closer than this many meters, so the
+	// overlay address replaces a wrong one. Zero hides nothing.
+	HideRadius float64 `json:"hide_radius,omitempty"`
+	// Address is the answer for queries near the point, nil for a point which
+	// only hides cache points. Addresses without a weight get 10, a building.
+	Address *geomodel.Info `json:"address,omitempty"`
+}
+
+// overlayFile is the JSON format of an overlay, it's also the persisted one.
+type overlayFile struct {
+	Points []OverlayPoint `json:"points"`
+}
+
+func (p *OverlayPoint) normalize() error {
+	switch {
+	case p.ID == "":
+		return errors.New("overlay point without an id")
+	case !(p.Lat >= -90 && p.Lat <= 90) || !(p.Lon >= -180 && p.Lon <= 180):
+		return fmt.Errorf("overlay point %q: invalid coordinates %v, %v", p.ID, p.Lat, p.Lon)
+	case !(p.HideRadius >= 0 && p.HideRadius <= MaxOverlayHideRadius):
+		return fmt.Errorf("overlay point %q: hide radius must be from 0 to %v meters", p.ID, MaxOverlayHideRadius)
+	case p.Address == nil && p.HideRadius == 0:
+		return fmt.Errorf("overlay point %q has neither an address nor a hide radius", p.ID)
+	}
+	if p.Address != nil {
+		address := *p.Address
+		address.MatchType = ""
+		if address.Weight == 0 {
+			address.Weight = overlayDefaultWeight
+		}
+		p.Address = &address
+	}
+	return nil
+}
+
+// ParseOverlay reads overlay points from JSON, an object with a "points"
+// array of [OverlayPoint], or from a GeoJSON FeatureCollection of points.
+// GeoJSON features keep the id, hide_radius and address fields in their
+// properties, a feature without address fields only hides cache points.
+func ParseOverlay(data []byte) ([]OverlayPoint, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("error parsing overlay: %w", err)
+	}
+
+	var points []OverlayPoint
+	if head.Type != "" {
+		var err error
+		points, err = parseOverlayGeoJSON(data, head.Type)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var file overlayFile
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return nil, fmt.Errorf("error parsing overlay: %w", err)
+		}
+		points = file.Points
+	}
+
+	ids := map[string]bool{}
+	for i := range points {
+		if err := points[i].normalize(); err != nil {
+			return nil, err
+		}
+		if ids[points[i].ID] {
+			return nil, fmt.Errorf("duplicate overlay point id %q", points[i].ID)
+		}
+		ids[points[i].ID] = true
+	}
+	return points, nil
+}
+
+func parseOverlayGeoJSON(data []byte, typ string) ([]OverlayPoint, error) {
+	var features []*geojson.Feature
+	switch typ {
+	case "FeatureCollection":
+		fc, err := geojson.UnmarshalFeatureCollection(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing overlay geojson: %w", err)
+		}
+		features = fc.Features
+	case "Feature":
+		f, err := geojson.UnmarshalFeature(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing overlay geojson: %w", err)
+		}
+		features = []*geojson.Feature{f}
+	default:
+		return nil, fmt.Errorf("unsupported overlay geojson type %q", typ)
+	}
+
+	points := make([]OverlayPoint, 0, len(features))
+	for i, f := range features {
+		pt, ok := f.Geometry.(orb.Point)
+		if !ok {
+			return nil, fmt.Errorf("overlay feature %d: geometry must be a Point", i)
+		}
+		props := f.Properties
+		p := OverlayPoint{
+			ID:         props.MustString("id", ""),
+			Lat:        pt.Lat(),
+			Lon:        pt.Lon(),
+			HideRadius: props.MustFloat64("hide_radius", 0),
+		}
+		if p.ID == "" && f.ID != nil {
+			p.ID = fmt.Sprint(f.ID)
+		}
+
+		weight := props.MustInt("weight", 0)
+		if weight < 0 || weight > math.MaxUint8 {
+			return nil, fmt.Errorf("overlay feature %d: weight must be from 0 to 255", i)
+		}
+		address := geomodel.Info{
+			Name:        props.MustString("name", ""),
+			Street:      props.MustString("street", ""),
+			HouseNumber: props.MustString("house_number", ""),
+			City:        props.MustString("city", ""),
+			Region:      props.MustString("region", ""),
+			Country:     props.MustString("country", ""),
+			Weight:      uint8(weight),
+		}
+		if address != (geomodel.Info{}) {
+			p.Address = &address
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// Overlay is a small mutable index of custom addresses and suppressions,
+// served over the caches by an [OverlayGeocoder].
+//
+// Writes rebuild the index and swap it atomically, queries never wait for them.
+type Overlay struct {
+	// path is written on every change, empty to keep the overlay in memory
+	path string
+
+	mu     sync.Mutex // serializes writes
+	points map[string]OverlayPoint
+	index  atomic.Pointer[overlayIndex]
+}
+
+// NewOverlay creates an overlay kept in memory.
+func NewOverlay(points []OverlayPoint) (*Overlay, error) {
+	o := &Overlay{}
+	if err := o.Replace(points); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// LoadOverlay reads an overlay in JSON or GeoJSON from the file, every
+// change is written back to it in JSON. A missing file is an empty overlay,
+// it's created on the first change.
+func LoadOverlay(path string) (*Overlay, error) {
+	o := &Overlay{points: map[string]OverlayPoint{}}
+	o.index.Store(newOverlayIndex(nil))
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("error reading overlay: %w", err)
+	default:
+		points, err := ParseOverlay(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range points {
+			o.points[p.ID] = p
+		}
+		o.index.Store(newOverlayIndex(o.points))
+	}
+	o.path = path
+	return o, nil
+}
+
+// Len returns the number of overlay points.
+func (o *Overlay) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.points)
+}
+
+// Points returns the overlay points ordered by ID.
+func (o *Overlay) Points() []OverlayPoint {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return sortedOverlayPoints(o.points)
+}
+
+// Put adds points or replaces the points with the same IDs.
+func (o *Overlay) Put(points ...OverlayPoint) error {
+	return o.update(false, points)
+}
+
+// Replace replaces all points of the overlay.
+func (o *Overlay) Replace(points []OverlayPoint) error {
+	return o.update(true, points)
+}
+
+// Delete removes the point, it reports false if there is no point with the ID.
+func (o *Overlay) Delete(id string) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.points[id]; !ok {
+		return false, nil
+	}
+	points := maps.Clone(o.points)
+	delete(points, id)
+	return true, o.commit(points)
+}
+
+func (o *Overlay) update(replace bool, add []OverlayPoint) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	points := map[string]OverlayPoint{}
+	if !replace {
+		points = maps.Clone(o.points)
+	}
+	for _, p := range add {
+		if err := p.normalize(); err != nil {
+			return err
+		}
+		points[p.ID] = p
+	}
+	return o.commit(points)
+}
+
+// commit persists the points and serves them, on a write error the overlay is unchanged.
+func (o *Overlay) commit(points map[string]OverlayPoint) error {
+	if o.path != "" {
+		if err := writeOverlayFile(o.path, sortedOverlayPoints(points)); err != nil {
+			return err
+		}
+	}
+	o.points = points
+	o.index.Store(newOverlayIndex(points))
+	return nil
+}
+
+// WriteTo writes the overlay in the JSON format read by [ParseOverlay].
+func (o *Overlay) WriteTo(w io.Writer) (int64, error) {
+	data, err := marshalOverlay(o.Points())
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+func marshalOverlay(points []OverlayPoint) ([]byte, error) {
+	if points == nil {
+		points = []OverlayPoint{}
+	}
+	data, err := json.MarshalIndent(overlayFile{Points: points}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeOverlayFile replaces the file atomically, a crash leaves the old or the new overlay.
+func writeOverlayFile(path string, points []OverlayPoint) error {
+	data, err := marshalOverlay(points)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error writing overlay: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing overlay: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing overlay: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing overlay: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing overlay: %w", err)
+	}
+	return nil
+}
+
+func sortedOverlayPoints(points map[string]OverlayPoint) []OverlayPoint {
+	out := slices.Collect(maps.Values(points))
+	slices.SortFunc(out, func(a, b OverlayPoint) int { return strings.Compare(a.ID, b.ID) })
+	return out
+}
+
+// overlayIndex is an immutable snapshot of the overlay points.
+type overlayIndex struct {
+	addresses *kdbush.KDBush[*OverlayPoint]
+	hiders    *kdbush.KDBush[*OverlayPoint]
+	// maxHide is the largest hide radius in meters
+	maxHide float64
+}
+
+func newOverlayIndex(points map[string]OverlayPoint) *overlayIndex {
+	var addresses, hiders []kdbush.Point[*OverlayPoint]
+	ix := &overlayIndex{}
+	for _, p := range points {
+		kp := kdbush.Point[*OverlayPoint]{X: p.Lon, Y: p.Lat, Data: &p}
+		if p.Address != nil {
+			addresses = append(addresses, kp)
+		}
+		if p.HideRadius > 0 {
+			hiders = append(hiders, kp)
+			ix.maxHide = max(ix.maxHide, p.HideRadius)
+		}
+	}
+	if len(addresses) > 0 {
+		ix.addresses = kdbush.NewBush(addresses, overlayNodeSize)
+	}
+	if len(hiders) > 0 {
+		ix.hiders = kdbush.NewBush(hiders, overlayNodeSize)
+	}
+	return ix
+}
+
+const overlayNodeSize = 16
+
+// hides reports whether the cache point x (lon), y (lat) is within the hide
+// radius of an overlay point.
+func (ix *overlayIndex) hides(x, y float64) bool {
+	if ix == nil || ix.hiders == nil {
+		return false
+	}
+	hidden := false
+	ix.hiders.Within(x, y, metersToDegrees(y, ix.maxHide), func(p kdbush.Point[*OverlayPoint]) bool {
+		r := p.Data.HideRadius
+		if metersSquared(y, x, p.X, p.Y) <= r*r {
+			hidden = true
+			return false
+		}
+		return true
+	})
+	return hidden
+}
+
+// findCandidate returns the closest overlay address, like the caches do.
+func (ix *overlayIndex) findCandidate(lat, lon float64, radius float64, q Query) (candidate, bool) {
+	if ix == nil || ix.addresses == nil {
+		return candidate{}, false
+	}
+	var best *OverlayPoint
+	bestDist := math.Inf(1)
+	ix.addresses.Within(lon, lat, radius, func(p kdbush.Point[*OverlayPoint]) bool {
+		if !q.accepts(p.Data.Address.Weight) || !q.withinDistance(lat, lon, p.X, p.Y) {
+			return true
+		}
+		if dist := distanceSquared(lon, lat, p.X, p.Y); dist < bestDist {
+			best, bestDist = p.Data, dist
+		}
+		return true
+	})
+	if best == nil {
+		return candidate{}, false
+	}
+	out := InfoModel{Info: *best.Address}
+	out.MatchType = geomodel.MatchNearest
+	return candidate{info: out, dist: bestDist}, true
+}
+
+// ---------------------------------------------------------------------------
+// OverlayGeocoder
+// ---------------------------------------------------------------------------
+
+// overlayBase is implemented by the geocoders an [OverlayGeocoder] serves.
+type overlayBase interface {
+	Geocoder
+	// findBase returns the best cache candidate, a NaN radius selects the
+	// search radius of each cache.
+	findBase(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool)
+	fillAllZones(ctx context.Context, out *InfoModel, point orb.Point)
+	defaultRadius() float64
+}
+
+func (f *RGeoCoder) findBase(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool) {
+	if math.IsNaN(radius) {
+		radius = f.searchRadius
+	}
+	return f.findCandidate(ctx, lat, lon, radius, q)
+}
+
+func (f *RGeoCoder) fillAllZones(ctx context.Context, out *InfoModel, point orb.Point) {
+	fillZones(ctx, out, f.regions, f.countries, point)
+}
+
+func (f *RGeoCoderDisk) findBase(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool) {
+	if math.IsNaN(radius) {
+		radius = f.searchRadius
+	}
+	return f.findCandidate(ctx, lat, lon, radius, q)
+}
+
+func (f *RGeoCoderDisk) fillAllZones(ctx context.Context, out *InfoModel, point orb.Point) {
+	fillZones(ctx, out, f.regions, f.countries, point)
+}
+
+func (m *MultiGeocoder) findBase(ctx context.Context, lat, lon float64, radius float64, q Query) (candidate, bool) {
+	var routedBuf [4]*routedCache
+	routed := m.route(ctx, routedBuf[:0], orb.Point{lon, lat}, radius)
+	return m.findRouted(ctx, routed, lat, lon, radius, q)
+}
+
+func (m *MultiGeocoder) fillAllZones(ctx context.Context, out *InfoModel, point orb.Point) {
+	for _, c := range m.caches {
+		fillZones(ctx, out, c.regions, c.countries, point)
+	}
+}
+
+// defaultRadius is the largest search radius of the caches.
+func (m *MultiGeocoder) defaultRadius() float64 {
+	radius := 0.0
+	for _, c := range m.caches {
+		radius = max(radius, c.coder.defaultRadius())
+	}
+	return radius
+}
+
+// OverlayGeocoder answers from an [Overlay] before its base geocoder.
+//
+// Cache points within the hide radius of an overlay point are skipped. An
+// overlay address competes with the remaining cache points like the caches
+// of a [MultiGeocoder] do: a building containing the query point wins, then
+// the closest address, the overlay winning ties. Missing region and country
+// of overlay addresses are filled from the zones of the caches.
+type OverlayGeocoder struct {
+	base    overlayBase
+	overlay *Overlay
+}
+
+var (
+	_ ContextGeocoder = (*OverlayGeocoder)(nil)
+	_ QueryGeocoder   = (*OverlayGeocoder)(nil)
+)
+
+// NewOverlayGeocoder serves the overlay over base, an [*RGeoCoder],
+// [*RGeoCoderDisk] or [*MultiGeocoder].
+func NewOverlayGeocoder(base Geocoder, overlay *Overlay) (*OverlayGeocoder, error) {
+	b, ok := base.(overlayBase)
+	if !ok {
+		return nil, fmt.Errorf("unsupported geocoder type %T under an overlay", base)
+	}
+	return &OverlayGeocoder{base: b, overlay: overlay}, nil
+}
+
+// Find returns the closest address using the search radius of the base geocoder.
+func (g *OverlayGeocoder) Find(lat, lon float64) (InfoModel, bool) {
+	return g.FindContext(context.Background(), lat, lon)
+}
+
+// FindInRadius returns the closest address within the radius in degrees.
+func (g *OverlayGeocoder) FindInRadius(lat, lon float64, radius float64) (InfoModel, bool) {
+	return g.FindInRadiusContext(context.Background(), lat, lon, radius)
+}
+
+// FindQuery returns the address matching the per-request parameters.
+func (g *OverlayGeocoder) FindQuery(lat, lon float64, q Query) (InfoModel, bool) {
+	return g.FindQueryContext(context.Background(), lat, lon, q)
+}
+
+// FindContext is [OverlayGeocoder.Find] recording spans under the span of ctx.
+func (g *OverlayGeocoder) FindContext(ctx context.Context, lat, lon float64) (InfoModel, bool) {
+	return g.find(ctx, lat, lon, math.NaN(), Query{})
+}
+
+// FindInRadiusContext is [OverlayGeocoder.FindInRadius] recording spans under the span of ctx.
+func (g *OverlayGeocoder) FindInRadiusContext(ctx context.Context, lat, lon float64, radius float64) (InfoModel, bool) {
+	return g.find(ctx, lat, lon, radius, Query{})
+}
+
+// FindQueryContext is [OverlayGeocoder.FindQuery] recording spans under the span of ctx.
+func (g *OverlayGeocoder) FindQueryContext(ctx context.Context, lat, lon float64, q Query) (InfoModel, bool) {
+	return g.find(ctx, lat, lon, q.radius(lat, math.NaN()), q)
+}
+
+func (g *OverlayGeocoder) find(ctx context.Context, lat, lon float64, radius float64, q Query) (InfoModel, bool) {
+	ctx, span := startSpan(ctx, "OverlayGeocoder.Find")
+	defer span.End()
+
+	ix := g.overlay.index.Load()
+	q.hidden = ix
+	point := orb.Point{lon, lat}
+
+	best, ok := g.base.findBase(ctx, lat, lon, radius, q)
+
+	overlayRadius := radius
+	if math.IsNaN(overlayRadius) {
+		overlayRadius = g.base.defaultRadius()
+	}
+	if c, found := ix.findCandidate(lat, lon, overlayRadius, q); found && (!ok || !best.better(c)) {
+		span.SetAttributes(attribute.Bool("overlay", true))
+		best, ok = c, true
+	}
+
+	if ok {
+		g.base.fillAllZones(ctx, &best.info, point)
+		return best.info, true
+	}
+
+	out := InfoModel{}
+	g.base.fillAllZones(ctx, &out, point)
+	return out, out.Country != "" || out.Region != ""
+}
+
+// Close closes the base geocoder if it holds resources.
+func (g *OverlayGeocoder) Close() error {
+	if closer, ok := g.base.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package geocoder
+
+import (
+	"path/filepath"
+	"testing"
+
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"github.com/royalcat/rgeocache/geomodel"
+)
+
+func TestParseOverlay(t *testing.T) {
+	native := `{"points": [
+		{"id": "fix-1", "lat": 1, "lon": 2, "hide_radius": 15, "address": {"street": "Main", "house_number": "5"}},
+		{"id": "hide-1", "lat": 3, "lon": 4, "hide_radius": 30}
+	]}`
+	geo := `{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "id": "fix-1", "geometry": {"type": "Point", "coordinates": [2, 1]},
+		 "properties": {"hide_radius": 15, "street": "Main", "house_number": "5"}},
+		{"type": "Feature", "geometry": {"type": "Point", "coordinates": [4, 3]},
+		 "properties": {"id": "hide-1", "hide_radius": 30}}
+	]}`
+
+	for name, data := range map[string]string{"json": native, "geojson": geo} {
+		t.Run(name, func(t *testing.T) {
+			points, err := ParseOverlay([]byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != 2 {
+				t.Fatalf("parsed %d points, want 2", len(points))
+			}
+			fix, hide := points[0], points[1]
+			if fix.ID != "fix-1" || fix.Lat != 1 || fix.Lon != 2 || fix.HideRadius != 15 || fix.Address == nil ||
+				fix.Address.HouseNumber != "5" || fix.Address.Weight != overlayDefaultWeight {
+				t.Errorf("address point %+v %+v", fix, fix.Address)
+			}
+			if hide.ID != "hide-1" || hide.HideRadius != 30 || hide.Address != nil {
+				t.Errorf("suppression %+v", hide)
+			}
+		})
+	}
+
+	invalid := map[string]string{
+		"no id":           `{"points": [{"lat": 1, "lon": 2, "hide_radius": 5}]}`,
+		"nothing to do":   `{"points": [{"id": "a", "lat": 1, "lon": 2}]}`,
+		"bad latitude":    `{"points": [{"id": "a", "lat": 91, "lon": 2, "hide_radius": 5}]}`,
+		"huge radius":     `{"points": [{"id": "a", "lat": 1, "lon": 2, "hide_radius": 5000}]}`,
+		"duplicate id":    `{"points": [{"id": "a", "lat": 1, "lon": 2, "hide_radius": 5}, {"id": "a", "lat": 1, "lon": 2, "hide_radius": 5}]}`,
+		"unknown field":   `{"points": [], "extra": 1}`,
+		"not a point":     `{"type": "Feature", "geometry": {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}, "properties": {"id": "a"}}`,
+		"unknown geojson": `{"type": "Point", "coordinates": [0, 0]}`,
+	}
+	for name, data := range invalid {
+		if _, err := ParseOverlay([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOverlayGeocoder(t *testing.T) {
+	// ~11m and ~33m east of the query point at 0, 0
+	base := NewGeoCoderFromPoints([]cachemodel.Point{
+		testBuilding(0.0001, 0, "wrong", nil),
+		testBuilding(0.0003, 0, "far", nil),
+	}, WithSearchRadius(0.001))
+
+	overlay, err := NewOverlay(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgeo, err := NewOverlayGeocoder(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	find := func() string {
+		t.Helper()
+		info, ok := rgeo.Find(0, 0)
+		if !ok {
+			return ""
+		}
+		return info.HouseNumber
+	}
+	if got := find(); got != "wrong" {
+		t.Fatalf("empty overlay: got %q", got)
+	}
+
+	// the suppression hides the closest cache point only
+	if err := overlay.Put(OverlayPoint{ID: "hide", Lat: 0, Lon: 0.0001, HideRadius: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(); got != "far" {
+		t.Errorf("suppressed: got %q, want far", got)
+	}
+
+	// a farther correction loses to a closer cache point
+	if err := overlay.Put(OverlayPoint{ID: "fix", Lat: 0, Lon: 0.0005, Address: &geomodel.Info{HouseNumber: "fixed"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(); got != "far" {
+		t.Errorf("correction behind a cache point: got %q, want far", got)
+	}
+
+	// moved onto the hidden point it replaces it
+	if err := overlay.Put(OverlayPoint{ID: "fix", Lat: 0, Lon: 0.0001, Address: &geomodel.Info{HouseNumber: "fixed"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(); got != "fixed" {
+		t.Errorf("correction: got %q, want fixed", got)
+	}
+	info, _ := rgeo.FindQuery(0, 0, Query{Types: PointRoad})
+	if info.HouseNumber != "" {
+		t.Errorf("query filters apply to overlay addresses, got %q", info.HouseNumber)
+	}
+
+	if ok, err := overlay.Delete("hide"); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if ok, _ := overlay.Delete("hide"); ok {
+		t.Error("deleted a missing point")
+	}
+	if err := overlay.Replace(nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(); got != "wrong" {
+		t.Errorf("after replace: got %q", got)
+	}
+}
+
+func TestOverlayPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overlay.json")
+
+	overlay, err := LoadOverlay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlay.Len() != 0 {
+		t.Fatalf("missing file loaded %d points", overlay.Len())
+	}
+	if err := overlay.Put(
+		OverlayPoint{ID: "b", Lat: 1, Lon: 1, HideRadius: 10},
+		OverlayPoint{ID: "a", Lat: 2, Lon: 2, Address: &geomodel.Info{Street: "Main"}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := overlay.Put(OverlayPoint{ID: "c"}); err == nil {
+		t.Fatal("expected an error for an invalid point")
+	}
+
+	reloaded, err := LoadOverlay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := reloaded.Points()
+	if len(points) != 2 || points[0].ID != "a" || points[0].Address.Street != "Main" || points[1].HideRadius != 10 {
+		t.Errorf("reloaded %+v", points)
+	}
+
+	// a failed write leaves the overlay unchanged
+	broken, err := LoadOverlay(filepath.Join(t.TempDir(), "missing", "overlay.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := broken.Put(OverlayPoint{ID: "d", Lat: 0, Lon: 0, HideRadius: 1}); err == nil {
+		t.Error("expected a write error")
+	}
+	if broken.Len() != 0 {
+		t.Errorf("failed write changed the overlay to %d points", broken.Len())
+	}
+}
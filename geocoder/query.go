@@ -0,0 +1,128 @@
+package geocoder
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// PointType classifies points by their weight. Caches don't store the kind of
+// the OSM object, so types follow the weights assigned by the default rules.
+type PointType uint8
+
+const (
+	// PointBuilding is a point with weight 10 and above, an addressed building.
+	PointBuilding PointType = 1 << iota
+	// PointRoad is a point with weight from 5 to 9, a sample along a highway.
+	PointRoad
+	// PointArea is a point with weight below 5, a fill of an industrial or protected area.
+	PointArea
+)
+
+var pointTypeNames = map[string]PointType{
+	"building": PointBuilding,
+	"road":     PointRoad,
+	"area":     PointArea,
+}
+
+// ParsePointTypes parses a comma separated list like "building,road".
+func ParsePointTypes(s string) (PointType, error) {
+	var types PointType
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		t, ok := pointTypeNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown point type %q", name)
+		}
+		types |= t
+	}
+	return types, nil
+}
+
+func pointTypeOf(weight uint8) PointType {
+	switch {
+	case weight >= 10:
+		return PointBuilding
+	case weight >= 5:
+		return PointRoad
+	default:
+		return PointArea
+	}
+}
+
+// metersPerDegree is the length of a degree of latitude.
+const metersPerDegree = 111_320.0
+
+// Query holds per-request search parameters, the zero value searches like Find.
+type Query struct {
+	// RadiusMeters limits the distance to the address,
+	// the search radius of the geocoder is used if zero.
+	RadiusMeters float64
+	// MinWeight excludes points with a lower weight.
+	MinWeight uint8
+	// Types keeps only points of the given types, zero keeps all.
+	Types PointType
+
+	// hidden are the cache points hidden by an overlay, set by [OverlayGeocoder].
+	hidden *overlayIndex
+}
+
+// QueryGeocoder is a [Geocoder] accepting per-request parameters.
+type QueryGeocoder interface {
+	Geocoder
+	FindQuery(lat, lon float64, q Query) (InfoModel, bool)
+}
+
+var (
+	_ QueryGeocoder = (*RGeoCoder)(nil)
+	_ QueryGeocoder = (*RGeoCoderDisk)(nil)
+	_ QueryGeocoder = (*MultiGeocoder)(nil)
+)
+
+// accepts is the filter applied inside the spatial search.
+func (q Query) accepts(weight uint8) bool {
+	if weight < q.MinWeight {
+		return false
+	}
+	return q.Types == 0 || q.Types&pointTypeOf(weight) != 0
+}
+
+// radius returns the search radius in degrees. A radius in meters covers
+// more degrees of longitude away from the equator, it's widened accordingly
+// and the circle is cut by withinDistance.
+func (q Query) radius(lat float64, defaultRadius float64) float64 {
+	if q.RadiusMeters <= 0 {
+		return defaultRadius
+	}
+	return metersToDegrees(lat, q.RadiusMeters)
+}
+
+// visible reports whether the cache point x (lon), y (lat) is not hidden by an overlay.
+func (q Query) visible(x, y float64) bool {
+	return !q.hidden.hides(x, y)
+}
+
+// withinDistance reports whether the point x (lon), y (lat) is within RadiusMeters of the query.
+func (q Query) withinDistance(lat, lon, x, y float64) bool {
+	if q.RadiusMeters <= 0 {
+		return true
+	}
+	return metersSquared(lat, lon, x, y) <= q.RadiusMeters*q.RadiusMeters
+}
+
+// metersToDegrees returns the radius in degrees covering meters around the
+// latitude, a degree of longitude is shorter away from the equator.
+func metersToDegrees(lat, meters float64) float64 {
+	cos := max(math.Cos(lat*math.Pi/180), 0.01)
+	return meters / metersPerDegree / cos
+}
+
+// metersSquared is the squared distance in meters between lat, lon and the point x (lon), y (lat).
+func metersSquared(lat, lon, x, y float64) float64 {
+	dx := (x - lon) * math.Cos((lat+y)/2*math.Pi/180)
+	dy := y - lat
+	return (dx*dx + dy*dy) * metersPerDegree * metersPerDegree
+}
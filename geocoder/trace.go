@@ -0,0 +1,37 @@
+package geocoder
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/royalcat/rgeocache/geocoder")
+
+// noopSpan is returned instead of child spans of a non-recording parent,
+// ending it never touches the parent.
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// ContextGeocoder is a [Geocoder] recording trace spans under the span of ctx.
+type ContextGeocoder interface {
+	Geocoder
+	FindContext(ctx context.Context, lat, lon float64) (InfoModel, bool)
+	FindInRadiusContext(ctx context.Context, lat, lon float64, radius float64) (InfoModel, bool)
+	FindQueryContext(ctx context.Context, lat, lon float64, q Query) (InfoModel, bool)
+}
+
+var (
+	_ ContextGeocoder = (*RGeoCoder)(nil)
+	_ ContextGeocoder = (*RGeoCoderDisk)(nil)
+	_ ContextGeocoder = (*MultiGeocoder)(nil)
+)
+
+// startSpan starts a child span only under a recording parent, so queries
+// without a traced context don't pay for tracing.
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, noopSpan
+	}
+	return tracer.Start(ctx, name, opts...)
+}
@@ -0,0 +1,44 @@
+package geocoder
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestFindContextSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	rgeo := NewGeoCoderFromPoints([]cachemodel.Point{testBuilding(0, 0, "1", nil)})
+
+	// no spans without a traced context
+	rgeo.Find(0, 0)
+	if n := len(recorder.Ended()); n != 0 {
+		t.Fatalf("expected no spans for Find, got %d", n)
+	}
+
+	ctx, root := provider.Tracer("test").Start(context.Background(), "request")
+	if _, ok := rgeo.FindContext(ctx, 0, 0); !ok {
+		t.Fatal("expected a match")
+	}
+	root.End()
+
+	var names []string
+	for _, s := range recorder.Ended() {
+		names = append(names, s.Name())
+	}
+	for _, want := range []string{"RGeoCoder.Find", "kdbush.Within", "bordertree.QueryPoint", "request"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("span %q not recorded, got %v", want, names)
+		}
+	}
+}
@@ -18,8 +18,19 @@ type Info struct {
 	Country     string `json:"country"`
 
 	Weight uint8 `json:"weight"`
+
+	// MatchType tells how the address was matched, see MatchInside and MatchNearest.
+	// Empty when only region or country were resolved.
+	MatchType string `json:"match_type,omitempty"`
 }
 
+const (
+	// MatchInside means the query point lies inside the building footprint of the address.
+	MatchInside = "inside"
+	// MatchNearest means the address is the nearest point within the search radius.
+	MatchNearest = "nearest"
+)
+
 type Zone struct {
 	Name    string
 	Bounds  orb.Bound
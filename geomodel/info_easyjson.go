@@ -143,6 +143,12 @@ func easyjsonDdc53814DecodeGithubComRoyalcatRgeocacheGeomodel1(in *jlexer.Lexer,
 			} else {
 				out.Weight = uint8(in.Uint8())
 			}
+		case "match_type":
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				out.MatchType = string(in.String())
+			}
 		default:
 			in.SkipRecursive()
 		}
@@ -192,6 +198,11 @@ func easyjsonDdc53814EncodeGithubComRoyalcatRgeocacheGeomodel1(out *jwriter.Writ
 		out.RawString(prefix)
 		out.Uint8(uint8(in.Weight))
 	}
+	if in.MatchType != "" {
+		const prefix string = ",\"match_type\":"
+		out.RawString(prefix)
+		out.String(string(in.MatchType))
+	}
 	out.RawByte('}')
 }
 
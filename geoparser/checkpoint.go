@@ -0,0 +1,421 @@
+package geoparser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"unique"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/royalcat/rgeocache/geomodel"
+	"github.com/royalcat/rgeocache/internal/bordertree"
+	"github.com/royalcat/rgeocache/internal/rangeindex"
+)
+
+// Files of the checkpoint work directory.
+const (
+	relCacheFile = "relcache.gob" // stage 3 result
+	progressFile = "progress.gob" // stage 4 progress
+	pointsFile   = "points.bin"   // points emitted by stage 4, valid up to progress.PointsSize
+)
+
+// checkpointer persists the generation state in a work directory,
+// so an interrupted run can continue from the last checkpoint.
+type checkpointer struct {
+	dir         string
+	fingerprint string
+
+	mu      sync.Mutex
+	points  *os.File
+	pointsW *bufio.Writer
+	buf     []byte
+	// err is the first failed append, the points log misses points after it
+	// and no further progress may be recorded
+	err error
+}
+
+// relCacheState is the result of "filling relations cache" stage.
+type relCacheState struct {
+	Fingerprint  string
+	Places       []bordertree.Border[string]
+	Regions      []bordertree.Border[string]
+	Localization map[string]string
+}
+
+// progressState is the progress of "generating database" stage.
+type progressState struct {
+	Fingerprint string
+	Done        bool
+
+	Nodes     []idRange
+	Ways      []idRange
+	Relations []idRange
+
+	Regions   []geomodel.Zone
+	Countries []geomodel.Zone
+
+	PointsSize int64
+}
+
+// idRange is a half-open range [Lo, Hi) of parsed object IDs.
+type idRange struct {
+	Lo, Hi int64
+}
+
+func collectIDRanges[K osm.NodeID | osm.WayID | osm.RelationID](idx *rangeindex.Index[K, struct{}]) []idRange {
+	var out []idRange
+	idx.Ranges(func(lo, hi K, _ struct{}) bool {
+		out = append(out, idRange{Lo: int64(lo), Hi: int64(hi)})
+		return true
+	})
+	return out
+}
+
+func restoreIDRanges[K osm.NodeID | osm.WayID | osm.RelationID](idx *rangeindex.Index[K, struct{}], ranges []idRange) {
+	for _, r := range ranges {
+		idx.SetRange(K(r.Lo), K(r.Hi), struct{}{})
+	}
+}
+
+func newCheckpointer(dir, fingerprint string) (*checkpointer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating work directory: %w", err)
+	}
+	return &checkpointer{
+		dir:         dir,
+		fingerprint: fingerprint,
+	}, nil
+}
+
+// fingerprint identifies the input and the settings which affect the output,
+// a work directory can't be resumed with a different fingerprint.
+func (f *GeoGen) fingerprint() string {
+	return configFingerprint(f.config, f.osmdb.CountNodes(), f.osmdb.CountWays(), f.osmdb.CountRelations())
+}
+
+func configFingerprint(config Config, nodes, ways, relations int64) string {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%d/%d|%q|%s|%v|%v|%+v",
+		nodes, ways, relations, config.Inputs,
+		config.PreferredLocalization, config.HighwayPointsDistance, config.BuildingFootprints,
+		config.Rules,
+	)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// restoreRelCache loads the relations cache, returns false if it was not saved yet.
+func (f *GeoGen) restoreRelCache() (bool, error) {
+	var state relCacheState
+	ok, err := f.checkpoints.load(relCacheFile, &state)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	for _, b := range state.Places {
+		f.placeIndex.RestoreBorder(b)
+	}
+	for _, b := range state.Regions {
+		f.regionIndex.RestoreBorder(b)
+	}
+	for k, v := range state.Localization {
+		f.localizationCache.Store(k, v)
+	}
+	return true, nil
+}
+
+func (f *GeoGen) saveRelCache() error {
+	state := relCacheState{
+		Fingerprint:  f.checkpoints.fingerprint,
+		Places:       f.placeIndex.Borders(),
+		Regions:      f.regionIndex.Borders(),
+		Localization: map[string]string{},
+	}
+	f.localizationCache.Range(func(k, v string) bool {
+		state.Localization[k] = v
+		return true
+	})
+	return f.checkpoints.save(relCacheFile, &state)
+}
+
+// restoreProgress loads the progress of the last checkpoint and replays
+// the points emitted before it. Returns true if the stage was completed.
+func (f *GeoGen) restoreProgress() (bool, error) {
+	var state progressState
+	ok, err := f.checkpoints.load(progressFile, &state)
+	if err != nil {
+		return false, err
+	}
+
+	// points after the checkpoint belong to objects which will be parsed again
+	if err := f.checkpoints.openPoints(state.PointsSize); err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, nil
+	}
+
+	restoreIDRanges(f.parsedNodes, state.Nodes)
+	restoreIDRanges(f.parsedWays, state.Ways)
+	restoreIDRanges(f.parsedRelations, state.Relations)
+	f.regions = state.Regions
+	f.countries = state.Countries
+
+	replayed := 0
+	err = f.checkpoints.replayPoints(state.PointsSize, func(p geoPoint) {
+		f.parsedPoints <- p
+		replayed++
+	})
+	if err != nil {
+		return false, err
+	}
+	f.log.Info("Restored generation progress", "points", replayed, "done", state.Done)
+
+	return state.Done, nil
+}
+
+// saveProgress writes a checkpoint, no object may be in parsing while it runs.
+func (f *GeoGen) saveProgress(done bool) error {
+	pointsSize, err := f.checkpoints.flushPoints()
+	if err != nil {
+		return err
+	}
+
+	state := progressState{
+		Fingerprint: f.checkpoints.fingerprint,
+		Done:        done,
+		Nodes:       collectIDRanges(f.parsedNodes),
+		Ways:        collectIDRanges(f.parsedWays),
+		Relations:   collectIDRanges(f.parsedRelations),
+		PointsSize:  pointsSize,
+	}
+
+	f.regionsMu.Lock()
+	state.Regions = f.regions
+	f.regionsMu.Unlock()
+	f.countriesMu.Lock()
+	state.Countries = f.countries
+	f.countriesMu.Unlock()
+
+	return f.checkpoints.save(progressFile, &state)
+}
+
+// load decodes a state file, returns false if it doesn't exist.
+func (c *checkpointer) load(name string, state interface{ fingerprintOf() string }) (bool, error) {
+	file, err := os.Open(filepath.Join(c.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error opening checkpoint: %w", err)
+	}
+	defer file.Close()
+
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(state); err != nil {
+		return false, fmt.Errorf("error reading checkpoint %s: %w", name, err)
+	}
+	if state.fingerprintOf() != c.fingerprint {
+		return false, fmt.Errorf("checkpoint %s was made for different input or settings, use another work directory", name)
+	}
+	return true, nil
+}
+
+func (s *relCacheState) fingerprintOf() string { return s.Fingerprint }
+func (s *progressState) fingerprintOf() string { return s.Fingerprint }
+
+// save atomically replaces a state file.
+func (c *checkpointer) save(name string, state any) error {
+	tmp, err := os.CreateTemp(c.dir, name+".*")
+	if err != nil {
+		return fmt.Errorf("error creating checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	if err := gob.NewEncoder(w).Encode(state); err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %w", name, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %w", name, err)
+	}
+	return nil
+}
+
+// openPoints opens the points log for appending after the first size bytes.
+func (c *checkpointer) openPoints(size int64) error {
+	file, err := os.OpenFile(filepath.Join(c.dir, pointsFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening points log: %w", err)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return fmt.Errorf("error truncating points log: %w", err)
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("error seeking points log: %w", err)
+	}
+	c.points = file
+	c.pointsW = bufio.NewWriterSize(file, 1<<20)
+	return nil
+}
+
+func (c *checkpointer) appendPoint(p geoPoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return c.err
+	}
+	c.buf = appendGeoPoint(c.buf[:0], p)
+	if _, err := c.pointsW.Write(c.buf); err != nil {
+		c.err = fmt.Errorf("error writing points log: %w", err)
+	}
+	return c.err
+}
+
+// Err returns the error of the first failed append.
+func (c *checkpointer) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// flushPoints syncs the points log and returns its size.
+func (c *checkpointer) flushPoints() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return 0, c.err
+	}
+	if err := c.pointsW.Flush(); err != nil {
+		return 0, fmt.Errorf("error writing points log: %w", err)
+	}
+	if err := c.points.Sync(); err != nil {
+		return 0, fmt.Errorf("error writing points log: %w", err)
+	}
+	return c.points.Seek(0, io.SeekCurrent)
+}
+
+func (c *checkpointer) replayPoints(size int64, fn func(p geoPoint)) error {
+	r := bufio.NewReaderSize(io.NewSectionReader(c.points, 0, size), 1<<20)
+	for {
+		p, err := readGeoPoint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading points log: %w", err)
+		}
+		fn(p)
+	}
+}
+
+func (c *checkpointer) Close() error {
+	if c.points == nil {
+		return nil
+	}
+	return c.points.Close()
+}
+
+// Points log record: float64 x, y, uint8 weight, name, street, house number,
+// city, region and country as uvarint length prefixed strings, then uvarint
+// footprint length and float64 footprint coordinates.
+
+func appendGeoPoint(buf []byte, p geoPoint) []byte {
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.X()))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(p.Y()))
+	buf = append(buf, p.Weight)
+	for _, s := range []string{p.Name, p.Street.Value(), p.HouseNumber.Value(), p.City.Value(), p.Region.Value(), p.Country.Value()} {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(p.Footprint)))
+	for _, fp := range p.Footprint {
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(fp[0]))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(fp[1]))
+	}
+	return buf
+}
+
+func readGeoPoint(r *bufio.Reader) (geoPoint, error) {
+	var fixed [17]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return geoPoint{}, err
+	}
+
+	var strs [6]string
+	for i := range strs {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return geoPoint{}, noEOF(err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return geoPoint{}, noEOF(err)
+		}
+		strs[i] = string(b)
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return geoPoint{}, noEOF(err)
+	}
+	var footprint orb.Ring
+	if n > 0 {
+		footprint = make(orb.Ring, n)
+		var coords [16]byte
+		for i := range footprint {
+			if _, err := io.ReadFull(r, coords[:]); err != nil {
+				return geoPoint{}, noEOF(err)
+			}
+			footprint[i] = orb.Point{
+				math.Float64frombits(binary.LittleEndian.Uint64(coords[0:8])),
+				math.Float64frombits(binary.LittleEndian.Uint64(coords[8:16])),
+			}
+		}
+	}
+
+	return geoPoint{
+		Point: orb.Point{
+			math.Float64frombits(binary.LittleEndian.Uint64(fixed[0:8])),
+			math.Float64frombits(binary.LittleEndian.Uint64(fixed[8:16])),
+		},
+		Weight:      fixed[16],
+		Name:        strs[0],
+		Street:      unique.Make(strs[1]),
+		HouseNumber: unique.Make(strs[2]),
+		City:        unique.Make(strs[3]),
+		Region:      unique.Make(strs[4]),
+		Country:     unique.Make(strs[5]),
+		Footprint:   footprint,
+	}, nil
+}
+
+// noEOF reports a record cut in the middle as corrupted.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+package geoparser
+
+import (
+	"bufio"
+	"errors"
+	"slices"
+	"testing"
+	"unique"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/royalcat/rgeocache/geomodel"
+)
+
+func newTestGeoGen(t *testing.T, workDir string) *GeoGen {
+	t.Helper()
+
+	gen, err := NewGeoGen(nil, ConfigDefault())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.checkpoints, err = newCheckpointer(workDir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gen.checkpoints.Close() })
+	gen.parsedPoints = make(chan geoPoint, 100)
+	return gen
+}
+
+func testPoint(x float64, house string) geoPoint {
+	return geoPoint{
+		Point:       orb.Point{x, 1},
+		Name:        "",
+		Street:      unique.Make("Main"),
+		HouseNumber: unique.Make(house),
+		City:        unique.Make("City"),
+		Region:      unique.Make(""),
+		Country:     unique.Make(""),
+		Weight:      10,
+		Footprint:   orb.Ring{{0, 0}, {1, 0}, {1, 1}, {0, 0}},
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	square := orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}}}
+
+	// first run: stage 3, then one checkpoint, then a point lost in a crash
+	gen := newTestGeoGen(t, dir)
+	gen.placeIndex.InsertBorder("Town", square)
+	gen.localizationCache.Store("Town", "Localized Town")
+	if err := gen.saveRelCache(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gen.restoreProgress(); err != nil {
+		t.Fatal(err)
+	}
+	gen.parsedWays.Set(osm.WayID(10), struct{}{})
+	gen.parsedWays.Set(osm.WayID(11), struct{}{})
+	gen.regions = append(gen.regions, geomodel.Zone{Name: "Region", Bounds: square.Bound(), Polygon: square})
+	gen.emitPoint(testPoint(0.5, "1"))
+	gen.emitPoint(testPoint(0.6, "2"))
+	if err := gen.saveProgress(false); err != nil {
+		t.Fatal(err)
+	}
+	gen.parsedWays.Set(osm.WayID(12), struct{}{})
+	gen.emitPoint(testPoint(0.7, "3"))
+	if _, err := gen.checkpoints.flushPoints(); err != nil { // on disk, but after the checkpoint
+		t.Fatal(err)
+	}
+	gen.checkpoints.Close()
+
+	// second run
+	resumed := newTestGeoGen(t, dir)
+	ok, err := resumed.restoreRelCache()
+	if err != nil || !ok {
+		t.Fatalf("expected restored relations cache, got %v %v", ok, err)
+	}
+	if place := resumed.calcPlace(orb.Point{0.5, 0.5}); place != "Town" {
+		t.Errorf("expected restored place Town, got %q", place)
+	}
+	if name, _ := resumed.localizationCache.Load("Town"); name != "Localized Town" {
+		t.Errorf("expected restored localization, got %q", name)
+	}
+
+	done, err := resumed.restoreProgress()
+	if err != nil || done {
+		t.Fatalf("expected unfinished progress, got %v %v", done, err)
+	}
+	close(resumed.parsedPoints)
+	var houses []string
+	for p := range resumed.parsedPoints {
+		houses = append(houses, p.HouseNumber.Value())
+		if want := testPoint(p.X(), p.HouseNumber.Value()); !slices.Equal(p.Footprint, want.Footprint) || p.Street != want.Street || p.City != want.City {
+			t.Errorf("replayed point differs: %+v", p)
+		}
+	}
+	if !slices.Equal(houses, []string{"1", "2"}) {
+		t.Errorf("expected points before the checkpoint, got %v", houses)
+	}
+	if !resumed.parsedWays.Contains(10) || !resumed.parsedWays.Contains(11) || resumed.parsedWays.Contains(12) {
+		t.Errorf("unexpected restored ways %v", resumed.parsedWays.CollectRanges())
+	}
+	if len(resumed.regions) != 1 || resumed.regions[0].Name != "Region" {
+		t.Errorf("unexpected restored regions %v", resumed.regions)
+	}
+}
+
+func TestCheckpointFingerprintMismatch(t *testing.T) {
+	dir := t.TempDir()
+	gen := newTestGeoGen(t, dir)
+	if err := gen.saveRelCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newTestGeoGen(t, dir)
+	other.checkpoints.fingerprint = "other"
+	if _, err := other.restoreRelCache(); err == nil {
+		t.Error("expected an error for a different fingerprint")
+	}
+}
+
+func TestCheckpointInputChanged(t *testing.T) {
+	dir := t.TempDir()
+	config := ConfigDefault()
+	config.Inputs = []string{"1024 1700000000"}
+	gen := newTestGeoGen(t, dir)
+	gen.checkpoints.fingerprint = configFingerprint(config, 10, 5, 1)
+	if err := gen.saveRelCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	// an updated extract with the same number of objects
+	config.Inputs = []string{"1024 1700086400"}
+	other := newTestGeoGen(t, dir)
+	other.checkpoints.fingerprint = configFingerprint(config, 10, 5, 1)
+	if _, err := other.restoreRelCache(); err == nil {
+		t.Error("expected an error for a changed input")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("no space left on device") }
+
+func TestCheckpointPointsLogError(t *testing.T) {
+	gen := newTestGeoGen(t, t.TempDir())
+	if _, err := gen.restoreProgress(); err != nil {
+		t.Fatal(err)
+	}
+	gen.checkpoints.pointsW = bufio.NewWriterSize(failingWriter{}, 16)
+
+	gen.emitPoint(testPoint(0.5, "1"))
+	if err := gen.checkpoints.Err(); err == nil {
+		t.Fatal("expected the failed append to be recorded")
+	}
+	if len(gen.parsedPoints) != 0 {
+		t.Error("a point missing from the points log was saved")
+	}
+	// no progress may be recorded past the lost point
+	if err := gen.saveProgress(false); err == nil {
+		t.Error("expected saveProgress to fail after a lost point")
+	}
+}
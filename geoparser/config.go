@@ -1,12 +1,36 @@
 package geoparser
 
-import "runtime"
+import (
+	"runtime"
+	"time"
+)
 
 type Config struct {
 	Threads               int
 	Version               uint32
 	PreferredLocalization string
 	HighwayPointsDistance float64
+
+	// BuildingFootprints stores simplified building outlines for point-in-building matching.
+	BuildingFootprints bool
+
+	// MaxMemory bounds the memory used to build v2 and v3 caches, zero builds them in memory.
+	// Points are spilled to TempDir and ordered with an external sort, outputs
+	// written at once share the bound.
+	MaxMemory int64
+	TempDir   string
+
+	// WorkDir keeps checkpoints of the generation, a run with the same WorkDir
+	// continues from the last checkpoint. Empty disables checkpoints.
+	WorkDir            string
+	CheckpointInterval time.Duration
+	// Inputs identify the input files in checkpoints, for example by their
+	// sizes and modification times.  A work directory isn't resumed when they
+	// change, the counts of OSM objects alone don't tell an updated extract.
+	Inputs []string
+
+	// Rules decide which OSM objects become points, see DefaultRules.
+	Rules []Rule
 }
 
 func ConfigDefault() Config {
@@ -15,5 +39,8 @@ func ConfigDefault() Config {
 		Version:               1,
 		PreferredLocalization: "",
 		HighwayPointsDistance: 150,
+		BuildingFootprints:    false,
+		CheckpointInterval:    5 * time.Minute,
+		Rules:                 DefaultRules(),
 	}
 }
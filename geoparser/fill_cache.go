@@ -30,7 +30,10 @@ func (f *GeoGen) fillRelCache() error {
 }
 
 func (f *GeoGen) parseDatabase() error {
-	pool := pool.New().WithMaxGoroutines(f.config.Threads)
+	newPool := func() *pool.Pool {
+		return pool.New().WithMaxGoroutines(f.config.Threads)
+	}
+	pool := newPool()
 
 	objectsCount := int(f.osmdb.CountNodes() + f.osmdb.CountWays() + f.osmdb.CountRelations())
 	objectsIter := iterConcurrently(
@@ -39,16 +42,48 @@ func (f *GeoGen) parseDatabase() error {
 		castIterToObject(f.osmdb.IterRelations()),
 	)
 
+	lastCheckpoint := time.Now()
+	skipped := 0
 	for obj, err := range iterWithProgress(objectsIter, objectsCount, "4/4 generating database") {
 		if err != nil {
 			return err
 		}
+		if f.checkpoints != nil {
+			// the points log misses points, a resumed run would make an incomplete cache
+			if err := f.checkpoints.Err(); err != nil {
+				pool.Wait()
+				return err
+			}
+			if f.isParsed(obj) {
+				skipped++
+				continue
+			}
+		}
 		pool.Go(func() {
 			f.parseObject(obj)
 		})
+
+		if f.checkpoints != nil && time.Since(lastCheckpoint) >= f.config.CheckpointInterval {
+			// a checkpoint must not contain objects in the middle of parsing
+			pool.Wait()
+			if err := f.saveProgress(false); err != nil {
+				return err
+			}
+			pool = newPool()
+			lastCheckpoint = time.Now()
+		}
 	}
 
 	pool.Wait()
+	if f.checkpoints != nil {
+		if err := f.checkpoints.Err(); err != nil {
+			return err
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Skipped objects parsed before checkpoint: %d\n", skipped)
+	}
 
 	fmt.Printf("Duplicate node parse: %d\n", f.parsedNodesDupes.Load())
 	fmt.Printf("Duplicate way parse: %d\n", f.parsedWaysDupes.Load())
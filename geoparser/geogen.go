@@ -1,6 +1,7 @@
 package geoparser
 
 import (
+	"fmt"
 	"io"
 	"log/slog"
 	"runtime"
@@ -20,6 +21,10 @@ type GeoGen struct {
 	osmdb  osmpbfdb.OsmDB
 	config Config
 
+	nodeRules     []*Rule
+	wayRules      []*Rule
+	relationRules []*Rule
+
 	placeIndex  *bordertree.BorderTree[string]
 	regionIndex *bordertree.BorderTree[string]
 
@@ -35,6 +40,8 @@ type GeoGen struct {
 	parsedPoints chan geoPoint
 	parsingDone  chan struct{}
 
+	checkpoints *checkpointer
+
 	regionsMu sync.Mutex
 	regions   []geomodel.Zone
 
@@ -45,7 +52,11 @@ type GeoGen struct {
 }
 
 func NewGeoGen(db osmpbfdb.OsmDB, config Config) (*GeoGen, error) {
-	return &GeoGen{
+	if len(config.Rules) == 0 {
+		config.Rules = DefaultRules()
+	}
+
+	gen := &GeoGen{
 		osmdb:  db,
 		config: config,
 
@@ -61,7 +72,25 @@ func NewGeoGen(db osmpbfdb.OsmDB, config Config) (*GeoGen, error) {
 		countries: []geomodel.Zone{},
 
 		log: slog.Default(),
-	}, nil
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d (%s): %w", i, rule.Name, err)
+		}
+		if rule.appliesTo(ObjectNode) {
+			gen.nodeRules = append(gen.nodeRules, rule)
+		}
+		if rule.appliesTo(ObjectWay) {
+			gen.wayRules = append(gen.wayRules, rule)
+		}
+		if rule.appliesTo(ObjectRelation) {
+			gen.relationRules = append(gen.relationRules, rule)
+		}
+	}
+
+	return gen, nil
 }
 
 func (f *GeoGen) ResetCache() error {
@@ -73,6 +102,45 @@ func (f *GeoGen) ResetCache() error {
 	return nil
 }
 
+// generate runs stage 3 and 4, skipping what the checkpoints have already done.
+func (f *GeoGen) generate() error {
+	if f.checkpoints == nil {
+		if err := f.fillRelCache(); err != nil {
+			return err
+		}
+		return f.parseDatabase()
+	}
+
+	restored, err := f.restoreRelCache()
+	if err != nil {
+		return err
+	}
+	if restored {
+		f.log.Info("Relations cache restored from checkpoint, skipping stage 3")
+	} else {
+		if err := f.fillRelCache(); err != nil {
+			return err
+		}
+		if err := f.saveRelCache(); err != nil {
+			return err
+		}
+	}
+
+	done, err := f.restoreProgress()
+	if err != nil {
+		return err
+	}
+	if done {
+		f.log.Info("Database generated according to checkpoint, skipping stage 4")
+		return nil
+	}
+
+	if err := f.parseDatabase(); err != nil {
+		return err
+	}
+	return f.saveProgress(true)
+}
+
 type ParseOutput struct {
 	Format string
 	Writer io.Writer
@@ -82,25 +150,27 @@ func (f *GeoGen) ParseOSMData(outputs []ParseOutput) error {
 	f.parsedPoints = make(chan geoPoint, 10)
 	f.parsingDone = make(chan struct{})
 
+	if f.config.WorkDir != "" {
+		checkpoints, err := newCheckpointer(f.config.WorkDir, f.fingerprint())
+		if err != nil {
+			return err
+		}
+		defer checkpoints.Close()
+		f.checkpoints = checkpoints
+	}
+
 	var wg errgroup.Group
 	wg.Go(func() error {
 		return f.saveWorker(outputs)
 	})
 	wg.Go(func() error {
-		err := f.fillRelCache()
-		if err != nil {
-			return err
-		}
-
-		err = f.parseDatabase()
-		if err != nil {
-			return err
-		}
+		err := f.generate()
 
+		// closed on error too, the save worker would wait for them forever
 		close(f.parsedPoints)
 		close(f.parsingDone)
 
-		return nil
+		return err
 	})
 
 	return wg.Wait()
@@ -8,42 +8,48 @@ import (
 	"github.com/paulmach/osm"
 )
 
-func (f *GeoGen) getHighwayName(tags osm.Tags) string {
-	ref := tags.Find("ref")
-	highwayName := f.localizedName(tags)
-
-	builder := strings.Builder{}
-	if ref != "" {
-		builder.WriteString(ref)
-		builder.WriteString(" ")
-	}
-	if highwayName != "" {
-		builder.WriteString(highwayName)
-	}
-
-	return builder.String()
-}
-
 const nameKey = "name"
 
 func (f *GeoGen) localizedName(tags osm.Tags) string {
-	name := tags.Find(nameKey)
+	return f.localizedTag(tags, nameKey)
+}
+
+// localizedTag returns the value of key in the preferred localization if it is known.
+func (f *GeoGen) localizedTag(tags osm.Tags, key string) string {
+	value := tags.Find(key)
 
 	if f.config.PreferredLocalization != "" {
-		if localizedName := tags.Find(nameKey + ":" + f.config.PreferredLocalization); localizedName != "" {
-			return localizedName
+		if localizedValue := tags.Find(key + ":" + f.config.PreferredLocalization); localizedValue != "" {
+			return localizedValue
 		}
 
-		if localizedName, ok := f.localizationCache.Load(name); ok {
-			return localizedName
+		if localizedValue, ok := f.localizationCache.Load(value); ok {
+			return localizedValue
 		}
 	}
 
-	return name
+	return value
+}
+
+// localizedTemplateKey reports whether rule templates take key in the
+// preferred localization.  Only names are translated, values like ref or
+// addr:housenumber are used as tagged.
+func localizedTemplateKey(key string) bool {
+	switch key {
+	case nameKey, addrStreetKey, addrPlaceKey:
+		return true
+	}
+	return strings.HasSuffix(key, "_name")
 }
 
 const cityAddrKey = "addr:city"
 
+const addrStreetKey = "addr:street"
+
+// addrPlaceKey names the settlement of addresses without a street,
+// it is the last resort for the city when the point is outside of any place border.
+const addrPlaceKey = "addr:place"
+
 func (f *GeoGen) localizedCityAddr(tags osm.Tags, point orb.Point) unique.Handle[string] {
 	name := tags.Find(cityAddrKey)
 
@@ -51,7 +57,10 @@ func (f *GeoGen) localizedCityAddr(tags osm.Tags, point orb.Point) unique.Handle
 		if name != "" {
 			return unique.Make(name)
 		}
-		return unique.Make(f.calcPlace(point))
+		if calcPlaceName := f.calcPlace(point); calcPlaceName != "" {
+			return unique.Make(calcPlaceName)
+		}
+		return unique.Make(tags.Find(addrPlaceKey))
 	}
 
 	if localizedName := tags.Find(cityAddrKey + ":" + f.config.PreferredLocalization); localizedName != "" {
@@ -70,24 +79,8 @@ func (f *GeoGen) localizedCityAddr(tags osm.Tags, point orb.Point) unique.Handle
 		return unique.Make(calcPlaceName)
 	}
 
-	return unique.Make(name)
-}
-
-const addrStreetKey = "addr:street"
-
-func (f *GeoGen) localizedStreetName(tags osm.Tags) unique.Handle[string] {
-	name := tags.Find(addrStreetKey)
-
-	if f.config.PreferredLocalization == "" {
-		return unique.Make(name)
-	}
-
-	if localizedName := tags.Find(addrStreetKey + ":" + f.config.PreferredLocalization); localizedName != "" {
-		return unique.Make(localizedName)
-	}
-
-	if localizedName, ok := f.localizationCache.Load(name); ok {
-		return unique.Make(localizedName)
+	if name == "" {
+		return unique.Make(f.localizedTag(tags, addrPlaceKey))
 	}
 
 	return unique.Make(name)
@@ -2,7 +2,6 @@ package geoparser
 
 import (
 	"log/slog"
-	"slices"
 	"strings"
 	"unique"
 
@@ -21,19 +20,44 @@ func (f *GeoGen) parseObject(o osm.Object) {
 	switch obj := o.(type) {
 	case *osm.Node:
 		if point, ok := f.parseNode(obj); ok {
-			f.parsedPoints <- point
+			f.emitPoint(point)
 		}
 	case *osm.Way:
 		for _, point := range f.parseWay(obj) {
-			f.parsedPoints <- point
+			f.emitPoint(point)
 		}
 	case *osm.Relation:
 		for _, point := range f.parseRelation(obj) {
-			f.parsedPoints <- point
+			f.emitPoint(point)
 		}
 	}
 }
 
+// emitPoint sends the point to the save worker and records it in the checkpoints.
+// A point which can't be recorded is dropped, the error stops the generation
+// in parseDatabase, see [checkpointer.Err].
+func (f *GeoGen) emitPoint(point geoPoint) {
+	if f.checkpoints != nil {
+		if err := f.checkpoints.appendPoint(point); err != nil {
+			return
+		}
+	}
+	f.parsedPoints <- point
+}
+
+// isParsed reports if the object was parsed before, by an earlier object or a restored checkpoint.
+func (f *GeoGen) isParsed(o osm.Object) bool {
+	switch obj := o.(type) {
+	case *osm.Node:
+		return f.parsedNodes.Contains(obj.ID)
+	case *osm.Way:
+		return f.parsedWays.Contains(obj.ID)
+	case *osm.Relation:
+		return f.parsedRelations.Contains(obj.ID)
+	}
+	return false
+}
+
 type geoPoint struct {
 	orb.Point
 
@@ -45,35 +69,28 @@ type geoPoint struct {
 	Country     unique.Handle[string] `json:"country"`
 
 	Weight uint8 `json:"weight"`
-}
-
-const (
-	weightBuilding       = 10
-	weightRoad           = 5
-	weightAreaIndustrial = 3
-	weightAreaProtected  = 2
-)
 
-func isBuilding(tags osm.Tags) bool {
-	return tags.HasTag("addr:housenumber") && tags.HasTag("addr:street") && tags.HasTag("building")
+	Footprint orb.Ring `json:"footprint"`
 }
 
 func (f *GeoGen) parseNode(node *osm.Node) (geoPoint, bool) {
-	if isBuilding(node.Tags) {
-		point := orb.Point{node.Lon, node.Lat}
+	rule, ok := matchRule(f.nodeRules, node.Tags)
+	if !ok {
+		return geoPoint{}, false
+	}
+
+	// only matched nodes are recorded, most nodes have no tags and would fragment the index
+	if !f.parsedNodes.SetIfAbsent(node.ID, struct{}{}) {
+		f.parsedNodesDupes.Add(1)
+		return geoPoint{}, false
+	}
 
-		return geoPoint{
-			Point:       point,
-			Weight:      weightBuilding,
-			Name:        f.localizedName(node.Tags),
-			Street:      f.localizedStreetName(node.Tags),
-			HouseNumber: unique.Make(node.Tags.Find("addr:housenumber")),
-			City:        f.localizedCityAddr(node.Tags, point),
-			Region:      f.localizedRegion(point),
-		}, true
+	fields, ok := f.ruleFields(rule, node.Tags)
+	if !ok {
+		return geoPoint{}, false
 	}
 
-	return geoPoint{}, false
+	return f.rulePoint(rule, fields, node.Tags, orb.Point{node.Lon, node.Lat}), true
 }
 
 func (f *GeoGen) parseWay(way *osm.Way) []geoPoint {
@@ -82,16 +99,31 @@ func (f *GeoGen) parseWay(way *osm.Way) []geoPoint {
 		return []geoPoint{}
 	}
 
-	if isBuilding(way.Tags) {
-		return f.parseWayBuilding(way)
-	} else if slices.Contains([]string{"motorway", "trunk", "primary", "secondary", "tertiary"}, way.Tags.Find("highway")) {
-		return f.parseWayHighway(way)
+	rule, ok := matchRule(f.wayRules, way.Tags)
+	if !ok {
+		return []geoPoint{}
 	}
 
-	return []geoPoint{}
+	fields, ok := f.ruleFields(rule, way.Tags)
+	if !ok {
+		return []geoPoint{}
+	}
+
+	switch rule.Geometry {
+	case GeometryResample:
+		return f.parseWayResample(rule, fields, way)
+	case GeometryFill:
+		ring := orb.Ring(f.makeLineString(way.Nodes))
+		if len(ring) < 4 || !ring.Closed() {
+			return []geoPoint{}
+		}
+		return f.fillArea(rule, fields, way.Tags, orb.MultiPolygon{{ring}})
+	default:
+		return f.parseWayCentroid(rule, fields, way)
+	}
 }
 
-func (f *GeoGen) parseWayBuilding(way *osm.Way) []geoPoint {
+func (f *GeoGen) parseWayCentroid(rule *Rule, fields ruleFields, way *osm.Way) []geoPoint {
 	log := f.log.With("type", "way", "id", way.ID)
 
 	point := f.calcWayCenter(way)
@@ -101,20 +133,37 @@ func (f *GeoGen) parseWayBuilding(way *osm.Way) []geoPoint {
 		return []geoPoint{}
 	}
 
-	return []geoPoint{{
-		Point:       point,
-		Weight:      weightBuilding,
-		Name:        f.localizedName(way.Tags),
-		Street:      f.localizedStreetName(way.Tags),
-		HouseNumber: unique.Make(way.Tags.Find("addr:housenumber")),
-		City:        f.localizedCityAddr(way.Tags, point),
-		Region:      f.localizedRegion(point),
-	}}
+	out := f.rulePoint(rule, fields, way.Tags, point)
+	if rule.Footprint {
+		out.Footprint = f.buildingFootprint(orb.Ring(f.makeLineString(way.Nodes)))
+	}
+	return []geoPoint{out}
+}
+
+// footprintSimplifyThreshold is about 1 meter, enough to drop redundant vertices of building outlines.
+const footprintSimplifyThreshold = 0.00001
+
+// buildingFootprint returns a simplified building outline or nil
+// if footprints are disabled or the ring is not a valid polygon.
+func (f *GeoGen) buildingFootprint(ring orb.Ring) orb.Ring {
+	if !f.config.BuildingFootprints || len(ring) < 4 || !ring.Closed() {
+		return nil
+	}
+	ring = simplify.DouglasPeucker(footprintSimplifyThreshold).Ring(ring.Clone())
+	if len(ring) < 4 {
+		return nil
+	}
+	return ring
 }
 
-func (f *GeoGen) parseWayHighway(way *osm.Way) []geoPoint {
+func (f *GeoGen) parseWayResample(rule *Rule, fields ruleFields, way *osm.Way) []geoPoint {
+	distance := rule.ResampleDistance
+	if distance == 0 {
+		distance = f.config.HighwayPointsDistance
+	}
+
 	ls := f.makeLineString(way.Nodes)
-	ls = resample.ToInterval(ls, geo.Distance, f.config.HighwayPointsDistance)
+	ls = resample.ToInterval(ls, geo.Distance, distance)
 
 	if len(ls) == 0 {
 		return []geoPoint{}
@@ -122,22 +171,7 @@ func (f *GeoGen) parseWayHighway(way *osm.Way) []geoPoint {
 
 	out := make([]geoPoint, 0, len(ls))
 	for _, point := range ls {
-		name := f.getHighwayName(way.Tags)
-		street := f.localizedStreetName(way.Tags)
-		if street.Value() == "" {
-			street = unique.Make(name)
-			name = ""
-		}
-
-		out = append(out, geoPoint{
-			Point:       point,
-			Weight:      weightRoad,
-			Name:        name,
-			Street:      street,
-			HouseNumber: unique.Make(""),
-			City:        f.localizedCityAddr(way.Tags, point),
-			Region:      f.localizedRegion(point),
-		})
+		out = append(out, f.rulePoint(rule, fields, way.Tags, point))
 	}
 	return out
 }
@@ -148,18 +182,10 @@ func (f *GeoGen) parseRelation(rel *osm.Relation) []geoPoint {
 		return []geoPoint{}
 	}
 
+	// regions and countries are zones before any rule, a broad custom rule
+	// would otherwise turn them into points and drop them from the zones
 	switch rel.Tags.Find("type") {
 	case "multipolygon", "boundary":
-		switch rel.Tags.Find("landuse") {
-		case "quarry", "industrial":
-			return f.parseRelationArea(rel, weightAreaIndustrial)
-		}
-		if rel.Tags.Find("boundary") == "protected_area" {
-			return f.parseRelationArea(rel, weightAreaProtected)
-		}
-		if isBuilding(rel.Tags) {
-			return f.parseRelationBuilding(rel)
-		}
 		if rel.Tags.Find("boundary") == "administrative" {
 			switch rel.Tags.Find("admin_level") {
 			case "4":
@@ -169,8 +195,24 @@ func (f *GeoGen) parseRelation(rel *osm.Relation) []geoPoint {
 				f.parseRelationCountry(rel)
 				return []geoPoint{}
 			}
+		}
+	}
 
+	if rule, ok := matchRule(f.relationRules, rel.Tags); ok {
+		fields, ok := f.ruleFields(rule, rel.Tags)
+		if !ok {
+			return []geoPoint{}
 		}
+
+		switch rule.Geometry {
+		case GeometryFill:
+			return f.parseRelationFill(rule, fields, rel)
+		default:
+			return f.parseRelationCentroid(rule, fields, rel)
+		}
+	}
+
+	switch rel.Tags.Find("type") {
 	case "building":
 		if rel.Tags.Find("route") == "road" && strings.Contains(rel.Tags.Find("network"), "national") {
 			return f.parseRelationHighway(rel)
@@ -180,33 +222,27 @@ func (f *GeoGen) parseRelation(rel *osm.Relation) []geoPoint {
 	return []geoPoint{}
 }
 
-func (f *GeoGen) parseRelationBuilding(rel *osm.Relation) []geoPoint {
+func (f *GeoGen) parseRelationCentroid(rule *Rule, fields ruleFields, rel *osm.Relation) []geoPoint {
 	points := []geoPoint{}
 
-	if rel.Tags.Find("type") == "multipolygon" {
-		mpoly, err := f.buildPolygon(rel.Members)
-		if err != nil {
-			slog.Error("Error building polygon", "error", err.Error())
-			return points
-		}
-		if mpoly == nil && len(mpoly) == 0 {
-			slog.Error("Empty polygon", "name", rel.Tags.Find("name"))
-			return points
-		}
+	mpoly, err := f.buildPolygon(rel.Members)
+	if err != nil {
+		slog.Error("Error building polygon", "error", err.Error())
+		return points
+	}
+	if mpoly == nil && len(mpoly) == 0 {
+		slog.Error("Empty polygon", "name", rel.Tags.Find("name"))
+		return points
+	}
+
+	for _, poly := range mpoly {
+		p, _ := planar.CentroidArea(poly)
 
-		for _, poly := range mpoly {
-			p, _ := planar.CentroidArea(poly)
-
-			points = append(points, geoPoint{
-				Point:       p,
-				Weight:      weightBuilding,
-				Name:        f.localizedName(rel.Tags),
-				Street:      f.localizedStreetName(rel.Tags),
-				HouseNumber: unique.Make(rel.Tags.Find("addr:housenumber")),
-				City:        f.localizedCityAddr(rel.Tags, p),
-				Region:      f.localizedRegion(p),
-			})
+		point := f.rulePoint(rule, fields, rel.Tags, p)
+		if rule.Footprint {
+			point.Footprint = f.buildingFootprint(poly[0])
 		}
+		points = append(points, point)
 	}
 
 	return points
@@ -231,38 +267,86 @@ func (f *GeoGen) parseRelationHighway(rel *osm.Relation) []geoPoint {
 	return out
 }
 
-func (f *GeoGen) parseRelationArea(rel *osm.Relation, weight uint8) []geoPoint {
+func (f *GeoGen) parseRelationFill(rule *Rule, fields ruleFields, rel *osm.Relation) []geoPoint {
 	log := f.log.With("type", "relation", "id", rel.ID)
 
-	name := f.localizedName(rel.Tags)
-	if name == "" {
-		return []geoPoint{}
-	}
-
 	poly, err := f.buildPolygon(rel.Members)
 	if err != nil {
 		log.Error("Error building polygon", "error", err.Error())
 		return []geoPoint{}
 	}
 
-	points := fillPolygonWithPoints(poly, 0.01/2)
+	return f.fillArea(rule, fields, rel.Tags, poly)
+}
+
+func (f *GeoGen) fillArea(rule *Rule, fields ruleFields, tags osm.Tags, poly orb.MultiPolygon) []geoPoint {
+	distance := rule.FillDistance
+	if distance == 0 {
+		distance = defaultFillDistance
+	}
+
+	points := fillPolygonWithPoints(poly, distance)
 
 	out := make([]geoPoint, 0, len(points))
 	for _, p := range points {
-		out = append(out, geoPoint{
-			Point: p,
-
-			Weight:      weight,
-			Name:        name,
-			Street:      unique.Make(""),
-			HouseNumber: unique.Make(""),
-			City:        f.localizedCityAddr(rel.Tags, p),
-			Region:      f.localizedRegion(p),
-		})
+		out = append(out, f.rulePoint(rule, fields, tags, p))
 	}
 	return out
 }
 
+// ruleFields are the point fields which don't depend on the point location.
+type ruleFields struct {
+	name        string
+	street      unique.Handle[string]
+	houseNumber unique.Handle[string]
+}
+
+// ruleFields renders the field templates of rule, returns false
+// if any of the required fields is empty.
+func (f *GeoGen) ruleFields(rule *Rule, tags osm.Tags) (ruleFields, bool) {
+	lookup := func(key string) string {
+		if localizedTemplateKey(key) {
+			return f.localizedTag(tags, key)
+		}
+		return tags.Find(key)
+	}
+
+	name := rule.Fields.Name.execute(lookup)
+	street := rule.Fields.Street.execute(lookup)
+	houseNumber := rule.Fields.HouseNumber.execute(lookup)
+
+	for _, field := range rule.Required {
+		switch {
+		case field == "name" && name == "",
+			field == "street" && street == "",
+			field == "house_number" && houseNumber == "":
+			return ruleFields{}, false
+		}
+	}
+
+	if rule.DropNameEqualToStreet && name == street {
+		name = ""
+	}
+
+	return ruleFields{
+		name:        name,
+		street:      unique.Make(street),
+		houseNumber: unique.Make(houseNumber),
+	}, true
+}
+
+func (f *GeoGen) rulePoint(rule *Rule, fields ruleFields, tags osm.Tags, point orb.Point) geoPoint {
+	return geoPoint{
+		Point:       point,
+		Weight:      rule.Weight,
+		Name:        fields.name,
+		Street:      fields.street,
+		HouseNumber: fields.houseNumber,
+		City:        f.localizedCityAddr(tags, point),
+		Region:      f.localizedRegion(point),
+	}
+}
+
 func (f *GeoGen) parseRelationRegion(rel *osm.Relation) {
 	log := f.log.With("func", "parseRelationRegion", "type", "relation", "id", rel.ID)
 	name := f.localizedName(rel.Tags)
@@ -0,0 +1,315 @@
+package geoparser
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/paulmach/osm"
+	"gopkg.in/yaml.v3"
+)
+
+// Geometry describes how the points of a rule are placed on the object geometry.
+type Geometry string
+
+const (
+	// GeometryCentroid places a single point in the centroid of a way,
+	// or one point per polygon of a multipolygon relation.
+	GeometryCentroid Geometry = "centroid"
+	// GeometryResample places points along a way every ResampleDistance meters.
+	GeometryResample Geometry = "resample"
+	// GeometryFill fills the area of a closed way or a multipolygon relation
+	// with poisson disc sampled points FillDistance degrees apart.
+	GeometryFill Geometry = "fill"
+)
+
+// Object types a rule can be applied to.
+const (
+	ObjectNode     = "node"
+	ObjectWay      = "way"
+	ObjectRelation = "relation"
+)
+
+// Rules is the root of a rules file.
+type Rules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule declares which OSM objects become points and how the points are built.
+// Geometry is ignored for nodes, a node always becomes a single point at its location.
+// Administrative boundaries of admin_level 2 and 4 become country and region
+// zones, relation rules are never applied to them.
+type Rule struct {
+	Name    string   `yaml:"name"`
+	Objects []string `yaml:"objects"`
+	// Tags must all match the object tags.
+	Tags map[string]TagValues `yaml:"tags"`
+	// AnyTags requires at least one of the tags to match, ignored when empty.
+	AnyTags map[string]TagValues `yaml:"any_tags"`
+
+	Weight   uint8    `yaml:"weight"`
+	Geometry Geometry `yaml:"geometry"`
+	// ResampleDistance in meters, zero means Config.HighwayPointsDistance.
+	ResampleDistance float64 `yaml:"resample_distance"`
+	// FillDistance in degrees, zero means defaultFillDistance.
+	FillDistance float64 `yaml:"fill_distance"`
+	// Footprint stores the object outline when Config.BuildingFootprints is enabled,
+	// applies only to centroid geometry.
+	Footprint bool `yaml:"footprint"`
+
+	Fields RuleFields `yaml:"fields"`
+	// Required lists fields (name, street, house_number) that must not be empty,
+	// otherwise the object is skipped.
+	Required []string `yaml:"required"`
+	// DropNameEqualToStreet clears the name when it's the same as the street.
+	DropNameEqualToStreet bool `yaml:"drop_name_equal_to_street"`
+}
+
+// RuleFields holds templates of the point fields. City and region are always
+// resolved from addr:city and the place and region borders.
+type RuleFields struct {
+	Name        Templates `yaml:"name"`
+	Street      Templates `yaml:"street"`
+	HouseNumber Templates `yaml:"house_number"`
+}
+
+// defaultFillDistance is the default distance between fill points, in degrees.
+const defaultFillDistance = 0.01 / 2
+
+//go:embed rules_default.yaml
+var defaultRulesYAML []byte
+
+var defaultRules = sync.OnceValue(func() []Rule {
+	rules, err := ParseRules(defaultRulesYAML)
+	if err != nil {
+		panic(fmt.Sprintf("invalid default rules: %s", err.Error()))
+	}
+	return rules
+})
+
+// DefaultRules returns the built-in ruleset used when no rules file is given.
+func DefaultRules() []Rule {
+	return slices.Clone(defaultRules())
+}
+
+// LoadRules reads and validates a rules file.
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules file: %w", err)
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rules file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// ParseRules parses and validates rules in YAML format.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules Rules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	if len(rules.Rules) == 0 {
+		return nil, errors.New("no rules defined")
+	}
+	for i := range rules.Rules {
+		if err := rules.Rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, rules.Rules[i].Name, err)
+		}
+	}
+	return rules.Rules, nil
+}
+
+func (r *Rule) validate() error {
+	if len(r.Objects) == 0 {
+		return errors.New("no objects specified")
+	}
+	for _, o := range r.Objects {
+		switch o {
+		case ObjectNode, ObjectWay, ObjectRelation:
+		default:
+			return fmt.Errorf("unknown object type %q", o)
+		}
+	}
+	if len(r.Tags) == 0 && len(r.AnyTags) == 0 {
+		return errors.New("no tags specified, rule would match every object")
+	}
+
+	switch r.Geometry {
+	case GeometryCentroid, GeometryFill:
+	case GeometryResample:
+		if r.appliesTo(ObjectRelation) {
+			return errors.New("resample geometry is not supported for relations")
+		}
+	case "":
+		r.Geometry = GeometryCentroid
+	default:
+		return fmt.Errorf("unknown geometry %q", r.Geometry)
+	}
+
+	for _, field := range r.Required {
+		switch field {
+		case "name", "street", "house_number":
+		default:
+			return fmt.Errorf("unknown required field %q", field)
+		}
+	}
+	if r.ResampleDistance < 0 || r.FillDistance < 0 {
+		return errors.New("distances must not be negative")
+	}
+	return nil
+}
+
+func (r *Rule) appliesTo(object string) bool {
+	return slices.Contains(r.Objects, object)
+}
+
+func (r *Rule) matches(tags osm.Tags) bool {
+	for key, values := range r.Tags {
+		if !values.matches(tags.Find(key)) {
+			return false
+		}
+	}
+	if len(r.AnyTags) == 0 {
+		return true
+	}
+	for key, values := range r.AnyTags {
+		if values.matches(tags.Find(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRule returns the first rule matching the tags.
+func matchRule(rules []*Rule, tags osm.Tags) (*Rule, bool) {
+	for _, rule := range rules {
+		if rule.matches(tags) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+// TagValues is a set of accepted tag values. In YAML it is either a single
+// value or a list of values, "*" accepts any non-empty value.
+type TagValues []string
+
+func (v *TagValues) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = TagValues{node.Value}
+		return nil
+	}
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*v = values
+	return nil
+}
+
+func (v TagValues) matches(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, accepted := range v {
+		if accepted == "*" || accepted == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Templates is a list of alternative templates, the first one producing
+// a non-empty value is used. In YAML it is either a single template or a list.
+type Templates []Template
+
+func (t *Templates) UnmarshalYAML(node *yaml.Node) error {
+	var raw []string
+	if node.Kind == yaml.ScalarNode {
+		raw = []string{node.Value}
+	} else if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	*t = make(Templates, 0, len(raw))
+	for _, s := range raw {
+		tmpl, err := ParseTemplate(s)
+		if err != nil {
+			return err
+		}
+		*t = append(*t, tmpl)
+	}
+	return nil
+}
+
+// Template is a text with {tag} placeholders, for example "{ref} {name}".
+// Placeholders are replaced with the tag values, name-like tags (name,
+// addr:street, addr:place and *_name) in the preferred localization, then
+// whitespace left by empty values is trimmed.
+type Template struct {
+	parts []templatePart
+}
+
+type templatePart struct {
+	text string
+	tag  bool
+}
+
+// ParseTemplate parses a template with {tag} placeholders.
+func ParseTemplate(s string) (Template, error) {
+	var t Template
+	for s != "" {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			t.parts = append(t.parts, templatePart{text: s})
+			break
+		}
+		if start > 0 {
+			t.parts = append(t.parts, templatePart{text: s[:start]})
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return Template{}, fmt.Errorf("unclosed placeholder in template %q", s)
+		}
+		key := strings.TrimSpace(s[start+1 : start+end])
+		if key == "" {
+			return Template{}, fmt.Errorf("empty placeholder in template %q", s)
+		}
+		t.parts = append(t.parts, templatePart{text: key, tag: true})
+		s = s[start+end+1:]
+	}
+	return t, nil
+}
+
+// execute renders the template, lookup resolves a tag key to its value.
+func (t Template) execute(lookup func(key string) string) string {
+	if len(t.parts) == 1 && t.parts[0].tag {
+		return lookup(t.parts[0].text)
+	}
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.tag {
+			b.WriteString(lookup(part.text))
+		} else {
+			b.WriteString(part.text)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func (t Templates) execute(lookup func(key string) string) string {
+	for _, tmpl := range t {
+		if value := tmpl.execute(lookup); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,256 @@
+package geoparser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/royalcat/osmpbfdb"
+)
+
+func TestDefaultRules(t *testing.T) {
+	rules := DefaultRules()
+	if len(rules) == 0 {
+		t.Fatal("expected default rules")
+	}
+
+	ptrs := make([]*Rule, 0, len(rules))
+	for i := range rules {
+		if rules[i].appliesTo(ObjectWay) {
+			ptrs = append(ptrs, &rules[i])
+		}
+	}
+
+	tests := []struct {
+		tags osm.Tags
+		rule string
+	}{
+		{osm.Tags{{Key: "building", Value: "yes"}, {Key: "addr:street", Value: "Main"}, {Key: "addr:housenumber", Value: "1"}}, "building"},
+		{osm.Tags{{Key: "building", Value: "yes"}, {Key: "addr:street", Value: "Main"}}, ""},
+		{osm.Tags{{Key: "building", Value: "house"}, {Key: "addr:place", Value: "Village"}, {Key: "addr:housenumber", Value: "7"}}, "building"},
+		{osm.Tags{{Key: "building", Value: "house"}, {Key: "addr:housenumber", Value: "7"}}, ""},
+		{osm.Tags{{Key: "highway", Value: "primary"}}, "highway"},
+		{osm.Tags{{Key: "highway", Value: "footway"}}, ""},
+	}
+	for _, tt := range tests {
+		rule, ok := matchRule(ptrs, tt.tags)
+		if tt.rule == "" {
+			if ok {
+				t.Errorf("tags %v: expected no rule, got %q", tt.tags, rule.Name)
+			}
+			continue
+		}
+		if !ok || rule.Name != tt.rule {
+			t.Errorf("tags %v: expected rule %q, got %v", tt.tags, tt.rule, rule)
+		}
+	}
+}
+
+// TestDefaultRulesBaseline checks that the default rules give the fields of
+// the generator before rules, which localized only names and streets.
+func TestDefaultRulesBaseline(t *testing.T) {
+	config := ConfigDefault()
+	config.PreferredLocalization = "en"
+	gen, err := NewGeoGen(nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen.localizationCache.Store("Главная", "Main")
+	gen.localizationCache.Store("М1", "M-one")
+	gen.localizationCache.Store("1а", "1a")
+
+	rules := make([]*Rule, 0, len(gen.config.Rules))
+	for i := range gen.config.Rules {
+		if gen.config.Rules[i].appliesTo(ObjectWay) {
+			rules = append(rules, &gen.config.Rules[i])
+		}
+	}
+
+	// the fields as the generator computed them before rules
+	baselineStreet := func(tags osm.Tags) string {
+		return gen.localizedTag(tags, "addr:street")
+	}
+	baselineBuilding := func(tags osm.Tags) (string, string, string) {
+		return gen.localizedName(tags), baselineStreet(tags), tags.Find("addr:housenumber")
+	}
+	baselineHighway := func(tags osm.Tags) (string, string, string) {
+		name := strings.TrimSpace(tags.Find("ref") + " " + gen.localizedName(tags))
+		street := baselineStreet(tags)
+		if street == "" {
+			street, name = name, ""
+		}
+		return name, street, ""
+	}
+
+	tests := []struct {
+		tags     osm.Tags
+		baseline func(osm.Tags) (string, string, string)
+	}{
+		{osm.Tags{{Key: "building", Value: "yes"}, {Key: "addr:street", Value: "Главная"}, {Key: "addr:housenumber", Value: "1а"}}, baselineBuilding},
+		{osm.Tags{{Key: "building", Value: "yes"}, {Key: "name", Value: "Школа"}, {Key: "name:en", Value: "School"},
+			{Key: "addr:street", Value: "Главная"}, {Key: "addr:street:en", Value: "Main Street"},
+			{Key: "addr:housenumber", Value: "1а"}, {Key: "addr:housenumber:en", Value: "1 A"}}, baselineBuilding},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "ref", Value: "М1"}, {Key: "ref:en", Value: "M1"}, {Key: "name", Value: "Главная"}}, baselineHighway},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "ref", Value: "М1"}}, baselineHighway},
+		{osm.Tags{{Key: "highway", Value: "primary"}, {Key: "ref", Value: "М1"}, {Key: "name", Value: "Трасса"},
+			{Key: "addr:street", Value: "Главная"}}, baselineHighway},
+	}
+	for _, tt := range tests {
+		rule, ok := matchRule(rules, tt.tags)
+		if !ok {
+			t.Fatalf("tags %v: no rule", tt.tags)
+		}
+		fields, ok := gen.ruleFields(rule, tt.tags)
+		if !ok {
+			t.Fatalf("tags %v: required fields missing", tt.tags)
+		}
+		name, street, houseNumber := tt.baseline(tt.tags)
+		if fields.name != name || fields.street.Value() != street || fields.houseNumber.Value() != houseNumber {
+			t.Errorf("tags %v: got %q, %q, %q, want %q, %q, %q", tt.tags,
+				fields.name, fields.street.Value(), fields.houseNumber.Value(), name, street, houseNumber)
+		}
+	}
+}
+
+// Buildings addressed by addr:place get it as the street, and as the city
+// only outside of any place border.
+func TestAddrPlace(t *testing.T) {
+	tags := osm.Tags{{Key: "building", Value: "house"}, {Key: "addr:place", Value: "Village"}, {Key: "addr:housenumber", Value: "7"}}
+
+	for _, localization := range []string{"", "en"} {
+		t.Run("localization="+localization, func(t *testing.T) {
+			config := ConfigDefault()
+			config.PreferredLocalization = localization
+			gen, err := NewGeoGen(nil, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gen.placeIndex.InsertBorder("Town", orb.MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 1}, {0, 0}}}})
+			want := func(name string) string { return name }
+			if localization != "" {
+				gen.localizationCache.Store("Town", "Town EN")
+				gen.localizationCache.Store("Village", "Village EN")
+				want = func(name string) string { return name + " EN" }
+			}
+
+			rules := make([]*Rule, 0, len(gen.config.Rules))
+			for i := range gen.config.Rules {
+				if gen.config.Rules[i].appliesTo(ObjectWay) {
+					rules = append(rules, &gen.config.Rules[i])
+				}
+			}
+			rule, ok := matchRule(rules, tags)
+			if !ok {
+				t.Fatal("no rule for a building with addr:place")
+			}
+			fields, ok := gen.ruleFields(rule, tags)
+			if !ok {
+				t.Fatal("required fields missing")
+			}
+
+			inside := gen.rulePoint(rule, fields, tags, orb.Point{0.5, 0.5})
+			if inside.Street.Value() != want("Village") || inside.HouseNumber.Value() != "7" {
+				t.Errorf("street %q, house number %q, want %q, 7", inside.Street.Value(), inside.HouseNumber.Value(), want("Village"))
+			}
+			if inside.City.Value() != want("Town") {
+				t.Errorf("city inside the place border = %q, want %q", inside.City.Value(), want("Town"))
+			}
+			outside := gen.rulePoint(rule, fields, tags, orb.Point{5, 5})
+			if outside.City.Value() != want("Village") {
+				t.Errorf("city outside of place borders = %q, want %q", outside.City.Value(), want("Village"))
+			}
+		})
+	}
+}
+
+// wayDB serves ways with node coordinates, other methods are not implemented.
+type wayDB struct {
+	osmpbfdb.OsmDB
+	ways map[osm.WayID]*osm.Way
+}
+
+func (db wayDB) GetWay(id osm.WayID) (*osm.Way, error) {
+	way, ok := db.ways[id]
+	if !ok {
+		return nil, fmt.Errorf("way %d not found", id)
+	}
+	return way, nil
+}
+
+func TestRelationRulesSkipZones(t *testing.T) {
+	rules, err := ParseRules([]byte(`rules: [{objects: [relation], tags: {name: "*"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ConfigDefault()
+	config.Rules = rules
+	gen, err := NewGeoGen(wayDB{ways: map[osm.WayID]*osm.Way{
+		1: {ID: 1, Nodes: osm.WayNodes{{Lat: 1, Lon: 1}, {Lat: 1, Lon: 2}, {Lat: 2, Lon: 2}, {Lat: 1, Lon: 1}}},
+	}}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boundary := func(id osm.RelationID, level, name string) *osm.Relation {
+		return &osm.Relation{ID: id, Tags: osm.Tags{
+			{Key: "type", Value: "boundary"}, {Key: "boundary", Value: "administrative"},
+			{Key: "admin_level", Value: level}, {Key: "name", Value: name},
+		}, Members: osm.Members{{Type: osm.TypeWay, Ref: 1, Role: "outer"}}}
+	}
+	if points := gen.parseRelation(boundary(1, "2", "Country")); len(points) != 0 {
+		t.Errorf("country boundary became %d points", len(points))
+	}
+	if points := gen.parseRelation(boundary(2, "4", "Region")); len(points) != 0 {
+		t.Errorf("region boundary became %d points", len(points))
+	}
+	if len(gen.countries) != 1 || gen.countries[0].Name != "Country" {
+		t.Errorf("countries = %v", gen.countries)
+	}
+	if len(gen.regions) != 1 || gen.regions[0].Name != "Region" {
+		t.Errorf("regions = %v", gen.regions)
+	}
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	for _, data := range []string{
+		"rules: []",
+		"rules: [{objects: [area], tags: {a: b}}]",
+		"rules: [{objects: [way]}]",
+		"rules: [{objects: [relation], tags: {a: b}, geometry: resample}]",
+		"rules: [{objects: [way], tags: {a: b}, fields: {name: '{name'}}]",
+	} {
+		if _, err := ParseRules([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tags := map[string]string{"ref": "M1", "name": "Main"}
+	lookup := func(key string) string { return tags[key] }
+
+	tests := []struct {
+		templates []string
+		want      string
+	}{
+		{[]string{"{ref} {name}"}, "M1 Main"},
+		{[]string{"{missing} {name}"}, "Main"},
+		{[]string{"{missing}", "{name}"}, "Main"},
+		{[]string{"No. {ref}"}, "No. M1"},
+	}
+	for _, tt := range tests {
+		var templates Templates
+		for _, s := range tt.templates {
+			tmpl, err := ParseTemplate(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			templates = append(templates, tmpl)
+		}
+		if got := templates.execute(lookup); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.templates, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package geoparser
 import (
 	"cmp"
 	"fmt"
+	"io"
 	"iter"
 	"slices"
 	"sync"
@@ -11,6 +12,9 @@ import (
 
 	"github.com/royalcat/rgeocache/cachesaver"
 	cachemodel "github.com/royalcat/rgeocache/cachesaver/model"
+	savev2 "github.com/royalcat/rgeocache/cachesaver/save/v2"
+	savev3 "github.com/royalcat/rgeocache/cachesaver/save/v3"
+	"github.com/royalcat/rgeocache/kdbush"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -27,6 +31,7 @@ func (f *GeoGen) saveWorker(outputs []ParseOutput) error {
 					City:        point.City,
 					Region:      point.Region,
 					Weight:      point.Weight,
+					Footprint:   point.Footprint,
 				},
 			}) {
 				return
@@ -69,16 +74,57 @@ func (f *GeoGen) saveWorker(outputs []ParseOutput) error {
 	pointsTee := Tee(points, len(outputs), 1)
 	zonesTee := Tee(zones, len(outputs), 1)
 
+	// outputs are written concurrently, they share the threads for sorting
+	// and the memory of the external sorts
+	threads := max(f.config.Threads/max(len(outputs), 1), 1)
+	external := 0
+	for _, output := range outputs {
+		if output.Format == "v2" || output.Format == "v3" {
+			external++
+		}
+	}
+	maxMemory := f.config.MaxMemory / int64(max(external, 1))
+
 	var wg errgroup.Group
 	for i, output := range outputs {
 		switch output.Format {
 		case "v1":
+			if f.config.MaxMemory > 0 {
+				f.log.Warn("v1 format is always built in memory, max memory applies only to v2")
+			}
 			wg.Go(func() error {
 				return cachesaver.SaveV1(pointsTee[i], zonesTee[i], meta, output.Writer)
 			})
 		case "v2":
+			if f.config.MaxMemory > 0 {
+				opts := savev2.ExternalOptions{
+					MaxMemory: maxMemory,
+					TempDir:   f.config.TempDir,
+					Threads:   threads,
+				}
+				wg.Go(func() error {
+					return cachesaver.SaveV2External(pointsTee[i], zonesTee[i], meta, output.Writer, opts)
+				})
+				continue
+			}
 			wg.Go(func() error {
-				return cachesaver.SaveV2(pointsTee[i], zonesTee[i], meta, output.Writer)
+				return cachesaver.SaveV2(pointsTee[i], zonesTee[i], meta, output.Writer, kdbush.WithThreads(threads))
+			})
+		case "v3":
+			w, ok := output.Writer.(io.WriteSeeker)
+			if !ok {
+				return fmt.Errorf("v3 format needs a seekable writer, got %T", output.Writer)
+			}
+			opts := savev3.Options{Build: []kdbush.BuildOption{kdbush.WithThreads(threads)}}
+			if f.config.MaxMemory > 0 {
+				opts.External = &savev2.ExternalOptions{
+					MaxMemory: maxMemory,
+					TempDir:   f.config.TempDir,
+					Threads:   threads,
+				}
+			}
+			wg.Go(func() error {
+				return cachesaver.SaveV3(pointsTee[i], zonesTee[i], meta, w, opts)
 			})
 		default:
 			return fmt.Errorf("unsupported format: %s", output.Format)
@@ -97,13 +143,19 @@ func uniqueGeoPoints(points []geoPoint) []geoPoint {
 
 		return (x+y)*(x+y+1)/2 + y
 	}
+	// footprints are not comparable and follow the address, so they are left out of equality
+	equal := func(a, b geoPoint) bool {
+		return a.Point == b.Point && a.Name == b.Name && a.Street == b.Street &&
+			a.HouseNumber == b.HouseNumber && a.City == b.City && a.Region == b.Region &&
+			a.Country == b.Country && a.Weight == b.Weight
+	}
 	slices.SortFunc(points, func(a, b geoPoint) int {
-		if a == b {
+		if equal(a, b) {
 			return 0
 		}
 		return cmp.Compare(cantorPairFunc(a.X(), a.Y()), cantorPairFunc(b.X(), b.Y()))
 	})
-	return slices.Compact(points)
+	return slices.CompactFunc(points, equal)
 }
 
 // Tee duplicates a source iterator into 'n' independent copies.
@@ -1,6 +1,7 @@
 package bordertree
 
 import (
+	"slices"
 	"sync"
 
 	"github.com/paulmach/orb"
@@ -13,7 +14,7 @@ import (
 type BorderTree[Data any] struct {
 	mu        sync.RWMutex
 	idCounter uint64
-	borders   []border[Data]
+	borders   []Border[Data]
 	qt        qtree.QTree
 }
 
@@ -21,26 +22,48 @@ func NewBorderTree[Data any]() *BorderTree[Data] {
 	return &BorderTree[Data]{}
 }
 
-type border[D any] struct {
+// Border is a stored border. Polygon is simplified, Bound is the bound of the original polygon.
+type Border[D any] struct {
 	Data D
 
+	Bound   orb.Bound
 	Polygon orb.MultiPolygon
 }
 
 func (bt *BorderTree[Data]) InsertBorder(data Data, b orb.MultiPolygon) {
-	bound := b.Bound()
+	bt.RestoreBorder(Border[Data]{
+		Data:    data,
+		Bound:   b.Bound(),
+		Polygon: simplify.DouglasPeucker(0.01).MultiPolygon(b.Clone()),
+	})
+}
 
+// RestoreBorder inserts a border returned by Borders as is, without simplifying it again.
+func (bt *BorderTree[Data]) RestoreBorder(b Border[Data]) {
 	bt.mu.Lock()
 	defer bt.mu.Unlock()
 
-	bt.borders = append(bt.borders, border[Data]{
-		Data:    data,
-		Polygon: simplify.DouglasPeucker(0.01).MultiPolygon(b.Clone()),
-	})
-	bt.qt.Insert(bound.Min, bound.Max, bt.idCounter)
+	bt.borders = append(bt.borders, b)
+	bt.qt.Insert(b.Bound.Min, b.Bound.Max, bt.idCounter)
 	bt.idCounter++
 }
 
+// Borders returns a snapshot of all borders in insertion order.
+func (bt *BorderTree[Data]) Borders() []Border[Data] {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	return slices.Clone(bt.borders)
+}
+
+// Len returns the number of borders.
+func (bt *BorderTree[Data]) Len() int {
+	bt.mu.RLock()
+	defer bt.mu.RUnlock()
+
+	return len(bt.borders)
+}
+
 func (bt *BorderTree[Data]) QueryPoint(point orb.Point) (Data, bool) {
 	bt.mu.RLock()
 	defer bt.mu.RUnlock()
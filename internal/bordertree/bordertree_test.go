@@ -64,3 +64,22 @@ func FuzzSimpleBoundCheck(f *testing.F) {
 		}
 	})
 }
+
+func TestRestoreBorders(t *testing.T) {
+	bt := bordertree.NewBorderTree[string]()
+	bt.InsertBorder("1", polygonFromBounds(0, 0, 1, 1))
+	bt.InsertBorder("2", polygonFromBounds(-1, -1, 0, 0))
+
+	restored := bordertree.NewBorderTree[string]()
+	for _, b := range bt.Borders() {
+		restored.RestoreBorder(b)
+	}
+
+	for _, p := range []orb.Point{{0.5, 0.5}, {-0.5, -0.5}, {2, 2}} {
+		want, wantOk := bt.QueryPoint(p)
+		got, gotOk := restored.QueryPoint(p)
+		if got != want || gotOk != wantOk {
+			t.Fatalf("point %v: expected %q %v, got %q %v", p, want, wantOk, got, gotOk)
+		}
+	}
+}
@@ -247,6 +247,15 @@ func (idx *Index[K, V]) Delete(key K) {
 	idx.internalDelete(key, key+1)
 }
 
+// SetRange assigns value to every key of the half-open interval [lo, hi).
+// It restores segments returned by CollectRanges.
+func (idx *Index[K, V]) SetRange(lo, hi K, value V) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.internalSet(lo, hi, value)
+}
+
 // SetIfAbsent assigns value to the given key only if it is not already
 // covered by any segment. Returns true if the key was set, false if it was
 // already present.
@@ -153,6 +153,23 @@ func TestNoMergeDifferentValue(t *testing.T) {
 	})
 }
 
+func TestSetRangeRestoresSegments(t *testing.T) {
+	src := New[int, string]()
+	setRange(src, 1, 5, "A")
+	src.Set(7, "B")
+
+	idx := New[int, string]()
+	for _, s := range src.CollectRanges() {
+		idx.SetRange(s.Lo, s.Hi, s.Value)
+	}
+	idx.SetRange(5, 7, "A") // merges with the left neighbor
+
+	expectSegments(t, idx, []Segment[int, string]{
+		seg(1, 7, "A"),
+		seg(7, 8, "B"),
+	})
+}
+
 func TestMergeFillsGap(t *testing.T) {
 	idx := New[int, string]()
 	idx.Set(1, "A")
@@ -2,6 +2,7 @@ package kdbush
 
 import (
 	"math"
+	"sync"
 )
 
 const DefaultNodeSize = 64
@@ -20,12 +21,31 @@ type KDBush[T any] struct {
 	coords []float64 //array of coordinates
 }
 
-func NewBush[T any](points []Point[T], nodeSize int) *KDBush[T] {
+func NewBush[T any](points []Point[T], nodeSize int, opts ...BuildOption) *KDBush[T] {
+	options := loadBuildOptions(opts...)
 	b := KDBush[T]{}
-	b.buildIndex(points, nodeSize)
+	b.buildIndex(points, nodeSize, options.threads)
 	return &b
 }
 
+// NumPoints returns the number of indexed points.
+func (bush *KDBush[T]) NumPoints() int { return len(bush.points) }
+
+// Bounds returns the bounding box of all indexed points, ok is false for an empty index.
+func (bush *KDBush[T]) Bounds() (minX, minY, maxX, maxY float64, ok bool) {
+	if len(bush.coords) == 0 {
+		return 0, 0, 0, 0, false
+	}
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	for i := 0; i < len(bush.coords); i += 2 {
+		x, y := bush.coords[i], bush.coords[i+1]
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	return minX, minY, maxX, maxY, true
+}
+
 // Finds all items within the given bounding box and returns an array of indices that refer to the items in the original points input slice.
 func (bush *KDBush[T]) Range(minX, minY, maxX, maxY float64) []int {
 	stack := []int{0, len(bush.idxs) - 1, 0}
@@ -134,7 +154,7 @@ func (bush *KDBush[T]) Within(qx, qy float64, radius float64, handler func(p Poi
 /// Sorting stuff
 ////////////////////////////////////////////////////////////////
 
-func (bush *KDBush[T]) buildIndex(points []Point[T], nodeSize int) {
+func (bush *KDBush[T]) buildIndex(points []Point[T], nodeSize, threads int) {
 	bush.nodeSize = nodeSize
 	bush.points = points
 
@@ -147,7 +167,49 @@ func (bush *KDBush[T]) buildIndex(points []Point[T], nodeSize int) {
 		bush.coords[i*2+1] = v.Y
 	}
 
-	sort(bush.idxs, bush.coords, bush.nodeSize, 0, len(bush.idxs)-1, 0)
+	sortParallel(bush.idxs, bush.coords, bush.nodeSize, threads)
+}
+
+// parallelSortMin is the smallest range [sortParallel] hands to another
+// goroutine, smaller ranges don't pay for the scheduling.
+const parallelSortMin = 1 << 16
+
+// sortParallel sorts the whole arrays like [sort] using up to threads
+// goroutines.  After a range is partitioned its halves are disjoint, so they
+// are sorted concurrently and the result doesn't depend on the scheduling.
+func sortParallel(idxs []int, coords []float64, nodeSize, threads int) {
+	n := len(idxs)
+	if threads <= 1 || n < 2*parallelSortMin {
+		sort(idxs, coords, nodeSize, 0, n-1, 0)
+		return
+	}
+
+	sem := make(chan struct{}, threads-1)
+	var wg sync.WaitGroup
+	var rec func(left, right, depth int)
+	rec = func(left, right, depth int) {
+		if right-left < parallelSortMin || right-left <= nodeSize {
+			sort(idxs, coords, nodeSize, left, right, depth)
+			return
+		}
+
+		m := floor(float64(left+right) / 2.0)
+
+		sselect(idxs, coords, m, left, right, depth%2)
+
+		select {
+		case sem <- struct{}{}:
+			wg.Go(func() {
+				defer func() { <-sem }()
+				rec(left, m-1, depth+1)
+			})
+		default:
+			rec(left, m-1, depth+1)
+		}
+		rec(m+1, right, depth+1)
+	}
+	rec(0, n-1, 0)
+	wg.Wait()
 }
 
 func sort(idxs []int, coords []float64, nodeSize int, left, right, depth int) {
@@ -66,3 +66,15 @@ func Benchmark(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkBuild(b *testing.B) {
+	pts := generatePoints(2_000_000, bound)
+
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("threads%d", threads), func(b *testing.B) {
+			for b.Loop() {
+				NewBush(pts, DefaultNodeSize, WithThreads(threads))
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package kdbush
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// ---------------------------------------------------------------------------
+// Layouts
+// ---------------------------------------------------------------------------
+
+// DiskLayout is the arrangement of the tree section of a KDBH block.
+type DiskLayout uint8
+
+const (
+	// LayoutFlat stores sorted indices and coordinates in two arrays.
+	LayoutFlat DiskLayout = iota
+	// LayoutBlocked stores the upper tree in BFS order followed by
+	// page-aligned leaf blocks, see below.
+	LayoutBlocked
+)
+
+// ---------------------------------------------------------------------------
+// Blocked layout
+// ---------------------------------------------------------------------------
+
+// Tree section of the blocked layout (offsets relative to the KDBH block):
+//
+//	[H : H + S*R)  slots   S × R      implicit binary tree in BFS order,
+//	                                  the children of slot k are 2k+1 and 2k+2
+//	[P : P + L  )  blocks  L pages    leaf blocks in sorted order
+//
+//	where  H = DiskHeaderSize, R = idxSize + 2*coordSize
+//	       S = 2^(depth+1) - 1, depth of the deepest leaf
+//	       P = H + S*R rounded up to blockPageSize
+//
+// An internal slot holds the median point (index, x, y), so a node costs a
+// single read and the upper levels of the tree share the first pages.
+// A leaf slot holds the block offset relative to P (uint64) and its length
+// (uint32).  Slots of missing nodes in the last level are zero.
+//
+// A leaf block holds the count points of the leaf:
+//
+//	idxs    count × idxSize
+//	coords  count × 2 × coordSize
+//	lens    count × uint16    inline payload length, blockNotInlined if too large
+//	payloads concatenated inline payloads
+//
+// Blocks don't cross page boundaries unless they are larger than a page, in
+// which case they start on one.  A leaf query touches one page and matched
+// points with inline payloads need no further reads.  Payloads are still
+// stored in the data section for [DiskKDBush.PointData].
+//
+// Pages are aligned relative to the start of the KDBH block, containers
+// align the block itself.
+
+const (
+	blockPageSize = 4096
+	// blockInlineMax is the largest payload copied into leaf blocks.
+	blockInlineMax = 128
+	// blockNotInlined marks payloads which are read from the data section.
+	blockNotInlined = math.MaxUint16
+)
+
+// blockedDepth returns the depth of the deepest leaf of the tree [sort] builds
+// over n points: the larger half has n/2 points.
+func blockedDepth(n, nodeSize int) int {
+	depth := 0
+	for n-1 > nodeSize {
+		n /= 2
+		depth++
+	}
+	return depth
+}
+
+// blockedSlots returns the number of node slots of the blocked layout.
+func blockedSlots(n, nodeSize int) int64 {
+	return int64(1)<<(blockedDepth(n, nodeSize)+1) - 1
+}
+
+// blocksOffset returns the offset of the leaf blocks relative to the KDBH block.
+func (h DiskHeader) blocksOffset() int64 {
+	end := DiskHeaderSize + blockedSlots(h.NumPoints, h.NodeSize)*int64(h.recordSize())
+	return alignPage(end)
+}
+
+func alignPage(off int64) int64 {
+	return (off + blockPageSize - 1) / blockPageSize * blockPageSize
+}
+
+// writeBlocked writes a KDBH block in the blocked layout from the sorted arrays.
+func writeBlocked(w io.Writer, header DiskHeader, idxs []int, coords []float64, blobs [][]byte, offsets []int64) (int64, error) {
+	rec := header.recordSize()
+	nodes := make([]byte, header.blocksOffset()-DiskHeaderSize) // slots and page padding
+	var blocks []byte
+
+	// same recursion as the queries, leaves are visited in sorted order
+	var build func(left, right int, slot int64)
+	build = func(left, right int, slot int64) {
+		dst := nodes[slot*int64(rec):]
+		if right-left <= header.NodeSize {
+			block := encodeBlock(header, left, right, idxs, coords, blobs)
+			// start a new page if the block would cross a page boundary
+			if pageLeft := blockPageSize - len(blocks)%blockPageSize; len(block) > pageLeft && pageLeft < blockPageSize {
+				blocks = append(blocks, make([]byte, pageLeft)...)
+			}
+			diskByteOrder.PutUint64(dst[0:8], uint64(len(blocks)))
+			diskByteOrder.PutUint32(dst[8:12], uint32(len(block)))
+			blocks = append(blocks, block...)
+			return
+		}
+		m := floor(float64(left+right) / 2.0)
+		putIdx(dst, idxs[m], header.IdxSize)
+		putCoord(dst[header.IdxSize:], coords[2*m], header.CoordSize)
+		putCoord(dst[header.IdxSize+header.CoordSize:], coords[2*m+1], header.CoordSize)
+		build(left, m-1, 2*slot+1)
+		build(m+1, right, 2*slot+2)
+	}
+	if header.NumPoints > 0 {
+		build(0, header.NumPoints-1, 0)
+	}
+
+	blocks = append(blocks, make([]byte, int(alignPage(int64(len(blocks)))-int64(len(blocks))))...)
+	if len(blocks)/blockPageSize > math.MaxUint32 {
+		return 0, fmt.Errorf("kdbush: %d bytes of leaf blocks exceed the blocked layout limit", len(blocks))
+	}
+	header.blockPages = uint32(len(blocks) / blockPageSize)
+
+	var written int64
+	headerBytes := header.marshal()
+	for _, section := range []struct {
+		name string
+		data []byte
+	}{
+		{"header", headerBytes[:]},
+		{"node slots", nodes},
+		{"leaf blocks", blocks},
+	} {
+		nn, err := w.Write(section.data)
+		written += int64(nn)
+		if err != nil {
+			return written, fmt.Errorf("kdbush: writing %s: %w", section.name, err)
+		}
+	}
+
+	n64, err := diskWriteInt64s(w, offsets)
+	written += n64
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing data offsets: %w", err)
+	}
+	n64, err = diskWriteBlobs(w, blobs)
+	written += n64
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing data blobs: %w", err)
+	}
+	return written, nil
+}
+
+// encodeBlock encodes the leaf of sorted positions [left, right].
+func encodeBlock(header DiskHeader, left, right int, idxs []int, coords []float64, blobs [][]byte) []byte {
+	count := right - left + 1
+	coordsOff := count * header.IdxSize
+	lensOff := count * header.recordSize()
+	payloadOff := lensOff + count*2
+
+	size := payloadOff
+	for i := left; i <= right; i++ {
+		if blob := blobs[idxs[i]]; len(blob) <= blockInlineMax {
+			size += len(blob)
+		}
+	}
+
+	block := make([]byte, size)
+	for j := range count {
+		i := left + j
+		putIdx(block[j*header.IdxSize:], idxs[i], header.IdxSize)
+		c := coordsOff + j*2*header.CoordSize
+		putCoord(block[c:], coords[2*i], header.CoordSize)
+		putCoord(block[c+header.CoordSize:], coords[2*i+1], header.CoordSize)
+
+		blob := blobs[idxs[i]]
+		if len(blob) > blockInlineMax {
+			diskByteOrder.PutUint16(block[lensOff+j*2:], blockNotInlined)
+			continue
+		}
+		diskByteOrder.PutUint16(block[lensOff+j*2:], uint16(len(blob)))
+		payloadOff += copy(block[payloadOff:], blob)
+	}
+	return block
+}
+
+func putIdx(dst []byte, idx int, size int) {
+	if size == 4 {
+		diskByteOrder.PutUint32(dst, uint32(idx))
+	} else {
+		diskByteOrder.PutUint64(dst, uint64(idx))
+	}
+}
+
+func putCoord(dst []byte, v float64, size int) {
+	if size == 4 {
+		diskByteOrder.PutUint32(dst, uint32(toFixedPoint(v)))
+	} else {
+		diskByteOrder.PutUint64(dst, math.Float64bits(v))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Blocked traversal
+// ---------------------------------------------------------------------------
+
+// blockedVisitor receives the points of a blocked traversal.  payload is the
+// inline payload, inline is false when it has to be read from the data section.
+// Return false to stop.
+type blockedVisitor func(idx int, x, y float64, payload []byte, inline bool) (bool, error)
+
+// walkBlocked traverses the blocked tree in the same order as the flat
+// queries.  inside reports whether a point matches, descend whether the
+// children of a node splitting axis at (x, y) may contain matches.
+func (d *DiskKDBush[V, VP]) walkBlocked(
+	inside func(x, y float64) bool,
+	descend func(axis int, x, y float64) (left, right bool),
+	visit blockedVisitor,
+) error {
+	if d.numPoints == 0 {
+		return nil
+	}
+
+	rec := d.idxSize + 2*d.coordSize
+	depth := blockedDepth(d.numPoints, d.nodeSize)
+	// left, right, axis, slot
+	stack := make([]int, 0, 4*(depth+2))
+	stack = append(stack, 0, d.numPoints-1, 0, 0)
+
+	var slotBuf [24]byte
+	var block []byte
+	for len(stack) > 0 {
+		slot := stack[len(stack)-1]
+		axis := stack[len(stack)-2]
+		right := stack[len(stack)-3]
+		left := stack[len(stack)-4]
+		stack = stack[:len(stack)-4]
+
+		buf := slotBuf[:rec]
+		if _, err := d.r.ReadAt(buf, d.idxsOffset+int64(slot)*int64(rec)); err != nil {
+			return fmt.Errorf("kdbush: reading node slot[%d]: %w", slot, err)
+		}
+
+		if right-left <= d.nodeSize {
+			off := int64(diskByteOrder.Uint64(buf[0:8]))
+			size := int(diskByteOrder.Uint32(buf[8:12]))
+			if cap(block) < size {
+				block = make([]byte, size)
+			}
+			block = block[:size]
+			if _, err := d.r.ReadAt(block, d.blocksOffset+off); err != nil {
+				return fmt.Errorf("kdbush: reading leaf block[%d:%d]: %w", left, right, err)
+			}
+			stop, err := d.visitBlock(block, right-left+1, inside, visit)
+			if err != nil || stop {
+				return err
+			}
+			continue
+		}
+
+		m := floor(float64(left+right) / 2.0)
+		x := d.decodeCoord(buf[d.idxSize:])
+		y := d.decodeCoord(buf[d.idxSize+d.coordSize:])
+		if inside(x, y) {
+			more, err := visit(d.decodeIdx(buf), x, y, nil, false)
+			if err != nil || !more {
+				return err
+			}
+		}
+
+		goLeft, goRight := descend(axis, x, y)
+		nextAxis := (axis + 1) % 2
+		if goLeft {
+			stack = append(stack, left, m-1, nextAxis, 2*slot+1)
+		}
+		if goRight {
+			stack = append(stack, m+1, right, nextAxis, 2*slot+2)
+		}
+	}
+	return nil
+}
+
+// visitBlock passes the matching points of a leaf block to visit, stop is
+// true when visit asked to stop.
+func (d *DiskKDBush[V, VP]) visitBlock(block []byte, count int, inside func(x, y float64) bool, visit blockedVisitor) (stop bool, err error) {
+	coordsOff := count * d.idxSize
+	lensOff := coordsOff + count*2*d.coordSize
+	payloadOff := lensOff + count*2
+	for j := range count {
+		payloadLen := int(diskByteOrder.Uint16(block[lensOff+j*2:]))
+		inline := payloadLen != blockNotInlined
+		var payload []byte
+		if inline {
+			payload = block[payloadOff : payloadOff+payloadLen]
+			payloadOff += payloadLen
+		}
+
+		c := coordsOff + j*2*d.coordSize
+		x := d.decodeCoord(block[c:])
+		y := d.decodeCoord(block[c+d.coordSize:])
+		if !inside(x, y) {
+			continue
+		}
+		more, err := visit(d.decodeIdx(block[j*d.idxSize:]), x, y, payload, inline)
+		if err != nil || !more {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// blockedPointData returns the point data from the inline payload when there is one.
+func (d *DiskKDBush[V, VP]) blockedPointData(idx int, payload []byte, inline bool) (V, error) {
+	if !inline {
+		return d.readPointData(idx)
+	}
+	var v V
+	if len(payload) == 0 {
+		return v, nil
+	}
+	if err := VP(&v).UnmarshalBinary(payload); err != nil {
+		return v, fmt.Errorf("kdbush: unmarshal point[%d]: %w", idx, err)
+	}
+	return v, nil
+}
+
+func (d *DiskKDBush[V, VP]) rangeBlocked(minX, minY, maxX, maxY float64) ([]Point[V], error) {
+	var result []Point[V]
+	err := d.walkBlocked(
+		func(x, y float64) bool { return x >= minX && x <= maxX && y >= minY && y <= maxY },
+		func(axis int, x, y float64) (bool, bool) {
+			if axis == 0 {
+				return minX <= x, maxX >= x
+			}
+			return minY <= y, maxY >= y
+		},
+		func(idx int, x, y float64, payload []byte, inline bool) (bool, error) {
+			data, err := d.blockedPointData(idx, payload, inline)
+			if err != nil {
+				return false, err
+			}
+			result = append(result, Point[V]{X: x, Y: y, Data: data})
+			return true, nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *DiskKDBush[V, VP]) withinBlocked(qx, qy, radius float64, handler func(p Point[V]) bool) error {
+	r2 := radius * radius
+	return d.walkBlocked(
+		func(x, y float64) bool { return sqrtDist(x, y, qx, qy) <= r2 },
+		func(axis int, x, y float64) (bool, bool) {
+			if axis == 0 {
+				return qx-radius <= x, qx+radius >= x
+			}
+			return qy-radius <= y, qy+radius >= y
+		},
+		func(idx int, x, y float64, payload []byte, inline bool) (bool, error) {
+			data, err := d.blockedPointData(idx, payload, inline)
+			if err != nil {
+				return false, err
+			}
+			return handler(Point[V]{X: x, Y: y, Data: data}), nil
+		},
+	)
+}
+
+func (d *DiskKDBush[V, VP]) boundsBlocked() (minX, minY, maxX, maxY float64, err error) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	err = d.walkBlocked(
+		func(x, y float64) bool { return true },
+		func(int, float64, float64) (bool, bool) { return true, true },
+		func(_ int, x, y float64, _ []byte, _ bool) (bool, error) {
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+			return true, nil
+		},
+	)
+	return minX, minY, maxX, maxY, err
+}
@@ -38,37 +38,166 @@ type binaryPointer[T any] interface {
 
 var (
 	diskMagic     = [4]byte{'K', 'D', 'B', 'H'}
-	diskVersion   = uint32(1)
+	diskVersion   = uint32(2)
 	diskByteOrder = binary.LittleEndian
 )
 
-const diskHeaderSize = 32
+// DiskHeaderSize is the size of the KDBH header, the tree section follows it.
+const DiskHeaderSize = 32
 
 // Binary layout (little-endian, all offsets are byte positions in the file):
 //
 //	Header  (32 bytes)
 //	  [0  : 4 )  magic     [4]byte   "KDBH"
-//	  [4  : 8 )  version   uint32    1
+//	  [4  : 8 )  version   uint32    1 or 2
 //	  [8  : 16)  nodeSize  int64
 //	  [16 : 24)  numPoints int64
-//	  [24 : 32)  reserved  [8]byte
+//	  [24]       idxSize   uint8     version 2: 4 (uint32) or 8 (int64)
+//	  [25]       coordSize uint8     version 2: 4 (int32 fixed-point, 1e-7) or 8 (float64)
+//	  [26]       layout    uint8     version 2: 0 flat, 1 blocked (see kdbush_blocked.go)
+//	  [27]       reserved  uint8
+//	  [28 : 32)  blocks    uint32    blocked layout: size of the leaf blocks in pages
 //
 //	Tree section  (spatial index — accessed during every traversal)
-//	  [H        : H + N*8  )  idxs    N × int64    sorted original indices
-//	  [H + N*8  : H + N*24 )  coords  N × 2 × float64  sorted (x,y) pairs
+//	  [H        : H + N*I      )  idxs    N × idxSize         sorted original indices
+//	  [H + N*I  : H + N*(I+2C) )  coords  N × 2 × coordSize   sorted (x,y) pairs
 //
 //	Data section  (point payloads — accessed only for matched points)
 //	  [D        : D + (N+1)*8 )  offsets  (N+1) × int64  cumulative byte offsets
 //	  [B        : EOF         )  blobs    concatenated MarshalBinary output
 //
-//	where  H = diskHeaderSize (32)
-//	       D = H + N*8 + N*16
+//	where  H = DiskHeaderSize (32)
+//	       I = idxSize, C = coordSize
+//	       D = H + N*(I+2C)
 //	       B = D + (N+1)*8
 //
+// The tree section of the blocked layout is described in kdbush_blocked.go,
+// the data section is the same for both layouts.
+//
+// Version 1 has no layout bytes, its indices and coordinates are always 8 bytes.
+// Version 2 uses uint32 indices when N fits and fixed-point coordinates when
+// every coordinate is within ±214.7483647, which halves the tree section.
+// Fixed-point coordinates are rounded before the tree is sorted, so queries
+// see exactly the stored values.
+//
 // The data section stores blobs in ORIGINAL point order (index 0, 1, 2 …)
 // so that a single original-index lookup requires exactly two ReadAt calls:
 // one for the offset pair, one for the blob.
 
+// fixedPointScale converts degrees to int32 fixed-point coordinates, 1e-7°
+// is about a centimeter and is the precision of OSM coordinates.
+const fixedPointScale = 1e7
+
+// maxFixedPoint is the largest absolute coordinate stored as fixed-point.
+const maxFixedPoint = math.MaxInt32 / fixedPointScale
+
+func toFixedPoint(v float64) int32 { return int32(math.Round(v * fixedPointScale)) }
+
+func fromFixedPoint(q int32) float64 { return float64(q) / fixedPointScale }
+
+// DiskHeader is the decoded header of a KDBH block.
+type DiskHeader struct {
+	Version   uint32
+	NodeSize  int
+	NumPoints int
+	// IdxSize is the size of a sorted index: 4 (uint32) or 8 (int64).
+	IdxSize int
+	// CoordSize is the size of a coordinate: 4 (int32 fixed-point) or 8 (float64).
+	CoordSize int
+	Layout    DiskLayout
+	// blockPages is the size of the leaf blocks of the blocked layout in pages.
+	blockPages uint32
+}
+
+// newDiskHeader picks the most compact layout for n points, fixedPoint
+// reports whether all coordinates fit in the fixed-point range.
+func newDiskHeader(nodeSize, n int, fixedPoint bool) DiskHeader {
+	h := DiskHeader{Version: diskVersion, NodeSize: nodeSize, NumPoints: n, IdxSize: 8, CoordSize: 8}
+	if uint64(n) <= math.MaxUint32 {
+		h.IdxSize = 4
+	}
+	if fixedPoint {
+		h.CoordSize = 4
+	}
+	return h
+}
+
+// ParseDiskHeader decodes and validates the first [DiskHeaderSize] bytes of a KDBH block.
+func ParseDiskHeader(b []byte) (DiskHeader, error) {
+	if len(b) < DiskHeaderSize {
+		return DiskHeader{}, fmt.Errorf("kdbush: header is %d bytes, want %d", len(b), DiskHeaderSize)
+	}
+
+	var m [4]byte
+	copy(m[:], b[0:4])
+	if m != diskMagic {
+		return DiskHeader{}, fmt.Errorf("kdbush: invalid magic bytes %q", m[:])
+	}
+
+	h := DiskHeader{
+		Version:   diskByteOrder.Uint32(b[4:8]),
+		NodeSize:  int(diskByteOrder.Uint64(b[8:16])),
+		NumPoints: int(diskByteOrder.Uint64(b[16:24])),
+	}
+	// the sizes of both layouts are derived from these, a damaged node size
+	// would stall the depth computation of the blocked layout
+	if h.NodeSize <= 0 || h.NumPoints < 0 {
+		return DiskHeader{}, fmt.Errorf("kdbush: invalid header: %d points, node size %d", h.NumPoints, h.NodeSize)
+	}
+	switch h.Version {
+	case 1:
+		h.IdxSize, h.CoordSize = 8, 8
+	case 2:
+		h.IdxSize, h.CoordSize = int(b[24]), int(b[25])
+		h.Layout = DiskLayout(b[26])
+		h.blockPages = diskByteOrder.Uint32(b[28:32])
+		if h.IdxSize != 4 && h.IdxSize != 8 {
+			return DiskHeader{}, fmt.Errorf("kdbush: invalid index size %d", h.IdxSize)
+		}
+		if h.CoordSize != 4 && h.CoordSize != 8 {
+			return DiskHeader{}, fmt.Errorf("kdbush: invalid coordinate size %d", h.CoordSize)
+		}
+		if h.Layout != LayoutFlat && h.Layout != LayoutBlocked {
+			return DiskHeader{}, fmt.Errorf("kdbush: unknown layout %d", h.Layout)
+		}
+	default:
+		return DiskHeader{}, fmt.Errorf("kdbush: unsupported version %d (want 1 or %d)", h.Version, diskVersion)
+	}
+	return h, nil
+}
+
+func (h DiskHeader) marshal() [DiskHeaderSize]byte {
+	var b [DiskHeaderSize]byte
+	copy(b[0:4], diskMagic[:])
+	diskByteOrder.PutUint32(b[4:8], h.Version)
+	diskByteOrder.PutUint64(b[8:16], uint64(h.NodeSize))
+	diskByteOrder.PutUint64(b[16:24], uint64(h.NumPoints))
+	b[24] = byte(h.IdxSize)
+	b[25] = byte(h.CoordSize)
+	b[26] = byte(h.Layout)
+	diskByteOrder.PutUint32(b[28:32], h.blockPages)
+	return b
+}
+
+// recordSize is the size of a point in the tree: its index and coordinates.
+func (h DiskHeader) recordSize() int {
+	return h.IdxSize + 2*h.CoordSize
+}
+
+// TreeSize returns the size of the tree section (indices and coordinates),
+// the data section starts right after it.
+func (h DiskHeader) TreeSize() int64 {
+	if h.Layout == LayoutBlocked {
+		return h.blocksOffset() - DiskHeaderSize + int64(h.blockPages)*blockPageSize
+	}
+	return int64(h.NumPoints) * int64(h.recordSize())
+}
+
+// DataOffsetsSize returns the size of the data offset table.
+func (h DiskHeader) DataOffsetsSize() int64 {
+	return int64(h.NumPoints+1) * 8
+}
+
 // ---------------------------------------------------------------------------
 // DiskKDBush — generic on-disk spatial index
 // ---------------------------------------------------------------------------
@@ -81,14 +210,19 @@ const diskHeaderSize = 32
 // only the compact tree section (indices + coordinates); point data is read
 // and unmarshaled lazily, only for points that actually match the query.
 //
-// The underlying [mmap.ReaderAt] must remain valid for the lifetime of the
-// DiskKDBush.  Using the concrete mmap type (rather than [io.ReaderAt])
-// allows the compiler to inline ReadAt calls and keep small read buffers
-// on the stack instead of escaping them to the heap.
+// The underlying reader must remain valid for the lifetime of the
+// DiskKDBush.  Reads from an [mmap.ReaderAt] or [Bytes] go to the concrete
+// type (rather than through [io.ReaderAt]), which allows the compiler to
+// inline ReadAt calls and keep small read buffers on the stack instead of
+// escaping them to the heap.
 type DiskKDBush[V any, VP binaryPointer[V]] struct {
-	r              *mmap.ReaderAt
+	r              source
 	nodeSize       int
 	numPoints      int
+	idxSize        int
+	coordSize      int
+	blocked        bool  // blocked layout, idxsOffset is the start of the node slots
+	blocksOffset   int64 // blocked layout: start of the leaf blocks
 	idxsOffset     int64
 	coordsOffset   int64
 	dataOffsetsOff int64
@@ -102,6 +236,82 @@ func (d *DiskKDBush[V, VP]) NumPoints() int { return d.numPoints }
 // NodeSize returns the node size used when the index was built.
 func (d *DiskKDBush[V, VP]) NodeSize() int { return d.nodeSize }
 
+// Bounds returns the bounding box of all indexed points, ok is false for an
+// empty index. It scans the whole coordinates section, so callers should
+// compute it once.
+func (d *DiskKDBush[V, VP]) Bounds() (minX, minY, maxX, maxY float64, ok bool, err error) {
+	if d.numPoints == 0 {
+		return 0, 0, 0, 0, false, nil
+	}
+	if d.blocked {
+		minX, minY, maxX, maxY, err = d.boundsBlocked()
+		return minX, minY, maxX, maxY, err == nil, err
+	}
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+
+	const chunk = 4096 // points per read
+	pairSize := 2 * d.coordSize
+	buf := make([]byte, chunk*pairSize)
+	for left := 0; left < d.numPoints; left += chunk {
+		count := min(chunk, d.numPoints-left)
+		b := buf[:count*pairSize]
+		if _, err := d.r.ReadAt(b, d.coordsOffset+int64(left*pairSize)); err != nil {
+			return 0, 0, 0, 0, false, fmt.Errorf("kdbush: reading coords[%d:%d]: %w", left, left+count-1, err)
+		}
+		for i := range count {
+			x := d.decodeCoord(b[i*pairSize:])
+			y := d.decodeCoord(b[i*pairSize+d.coordSize:])
+			minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+			minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		}
+	}
+	return minX, minY, maxX, maxY, true, nil
+}
+
+// Coords returns the coordinates of all points by original index, x and y
+// interleaved.  It reads the whole tree section, it's meant for converting
+// an index rather than for queries.
+func (d *DiskKDBush[V, VP]) Coords() ([]float64, error) {
+	coords := make([]float64, 2*d.numPoints)
+	set := func(idx int, x, y float64) error {
+		if idx < 0 || idx >= d.numPoints {
+			return fmt.Errorf("kdbush: point index %d out of range [0, %d)", idx, d.numPoints)
+		}
+		coords[2*idx], coords[2*idx+1] = x, y
+		return nil
+	}
+
+	if d.blocked {
+		err := d.walkBlocked(
+			func(x, y float64) bool { return true },
+			func(int, float64, float64) (bool, bool) { return true, true },
+			func(idx int, x, y float64, _ []byte, _ bool) (bool, error) {
+				return true, set(idx, x, y)
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		return coords, nil
+	}
+
+	const chunk = 4096 // points per read
+	for left := 0; left < d.numPoints; left += chunk {
+		right := min(left+chunk, d.numPoints) - 1
+		idxs, c, err := d.readLeaf(left, right)
+		if err != nil {
+			return nil, err
+		}
+		for i, idx := range idxs {
+			if err := set(idx, c[2*i], c[2*i+1]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return coords, nil
+}
+
 // ---------------------------------------------------------------------------
 // BuildDisk — build the index in memory and write everything to disk
 // ---------------------------------------------------------------------------
@@ -115,20 +325,31 @@ func (d *DiskKDBush[V, VP]) NodeSize() int { return d.nodeSize }
 // Point data is stored in a separate section after the tree so that queries
 // can traverse the spatial structure without touching data bytes.
 func BuildDisk[V encoding.BinaryMarshaler, VP binaryPointer[V]](
-	points []Point[V], nodeSize int, w io.Writer,
+	points []Point[V], nodeSize int, w io.Writer, opts ...BuildOption,
 ) (int64, error) {
+	options := loadBuildOptions(opts...)
 	n := len(points)
 
 	// --- build sorted index arrays (reuses package-level sort) -----------
 	idxs := make([]int, n)
 	coords := make([]float64, 2*n)
+	fixedPoint := true
 	for i, v := range points {
 		idxs[i] = i
 		coords[i*2] = v.X
 		coords[i*2+1] = v.Y
+		fixedPoint = fixedPoint && fitsFixedPoint(v.X) && fitsFixedPoint(v.Y)
+	}
+	header := newDiskHeader(nodeSize, n, fixedPoint)
+	header.Layout = options.layout
+	if header.CoordSize == 4 {
+		// sort the stored values, so queries see the same tree
+		for i, c := range coords {
+			coords[i] = fromFixedPoint(toFixedPoint(c))
+		}
 	}
 	if n > 0 {
-		sort(idxs, coords, nodeSize, 0, n-1, 0)
+		sortParallel(idxs, coords, nodeSize, options.threads)
 	}
 
 	// --- marshal every point's Data in original index order --------------
@@ -149,27 +370,27 @@ func BuildDisk[V encoding.BinaryMarshaler, VP binaryPointer[V]](
 	// --- write everything ------------------------------------------------
 	var written int64
 
+	if header.Layout == LayoutBlocked {
+		return writeBlocked(w, header, idxs, coords, blobs, offsets)
+	}
+
 	// header
-	var header [diskHeaderSize]byte
-	copy(header[0:4], diskMagic[:])
-	diskByteOrder.PutUint32(header[4:8], diskVersion)
-	diskByteOrder.PutUint64(header[8:16], uint64(nodeSize))
-	diskByteOrder.PutUint64(header[16:24], uint64(n))
-	nn, err := w.Write(header[:])
+	headerBytes := header.marshal()
+	nn, err := w.Write(headerBytes[:])
 	written += int64(nn)
 	if err != nil {
 		return written, fmt.Errorf("kdbush: writing header: %w", err)
 	}
 
 	// sorted indices
-	n64, err := diskWriteInts(w, idxs)
+	n64, err := diskWriteInts(w, idxs, header.IdxSize)
 	written += n64
 	if err != nil {
 		return written, fmt.Errorf("kdbush: writing indices: %w", err)
 	}
 
 	// sorted coordinates
-	n64, err = diskWriteFloat64s(w, coords)
+	n64, err = diskWriteCoords(w, coords, header.CoordSize)
 	written += n64
 	if err != nil {
 		return written, fmt.Errorf("kdbush: writing coords: %w", err)
@@ -198,40 +419,51 @@ func BuildDisk[V encoding.BinaryMarshaler, VP binaryPointer[V]](
 
 // OpenDisk opens an on-disk KDBush index backed by r.
 // The data must have been previously written by [BuildDisk].
+// Both header versions are supported.
 // Only the 32-byte header is read; all other data is accessed lazily via
 // [mmap.ReaderAt] during queries.
 //
 // offset is the byte position of the KDBH block within r. Pass 0 when the
 // index is stored at the start of the file.
 func OpenDisk[V any, VP binaryPointer[V]](r *mmap.ReaderAt, offset int64) (*DiskKDBush[V, VP], error) {
-	var header [diskHeaderSize]byte
+	return openDisk[V, VP](source{mm: r}, offset)
+}
+
+// OpenDiskReaderAt opens an on-disk KDBush index backed by any [io.ReaderAt],
+// like an [embed.FS] file, a range-reading client or [Bytes] for an index
+// held in memory.  [mmap.ReaderAt] and [Bytes] are read as fast as with
+// [OpenDisk], other readers cost an allocation per read.
+func OpenDiskReaderAt[V any, VP binaryPointer[V]](r io.ReaderAt, offset int64) (*DiskKDBush[V, VP], error) {
+	return openDisk[V, VP](newSource(r), offset)
+}
+
+func openDisk[V any, VP binaryPointer[V]](r source, offset int64) (*DiskKDBush[V, VP], error) {
+	var header [DiskHeaderSize]byte
 	if _, err := r.ReadAt(header[:], offset); err != nil {
 		return nil, fmt.Errorf("kdbush: reading header: %w", err)
 	}
-
-	var m [4]byte
-	copy(m[:], header[0:4])
-	if m != diskMagic {
-		return nil, fmt.Errorf("kdbush: invalid magic bytes %q", m[:])
+	h, err := ParseDiskHeader(header[:])
+	if err != nil {
+		return nil, err
 	}
 
-	v := diskByteOrder.Uint32(header[4:8])
-	if v != diskVersion {
-		return nil, fmt.Errorf("kdbush: unsupported version %d (want %d)", v, diskVersion)
+	idxsOff := offset + int64(DiskHeaderSize)
+	coordsOff := idxsOff + int64(h.NumPoints*h.IdxSize)
+	dataOffsetsOff := idxsOff + h.TreeSize()
+	dataBlobsOff := dataOffsetsOff + h.DataOffsetsSize()
+	var blocksOff int64
+	if h.Layout == LayoutBlocked {
+		blocksOff = offset + h.blocksOffset()
 	}
 
-	nodeSize := int(diskByteOrder.Uint64(header[8:16]))
-	numPoints := int(diskByteOrder.Uint64(header[16:24]))
-
-	idxsOff := offset + int64(diskHeaderSize)
-	coordsOff := idxsOff + int64(numPoints)*8
-	dataOffsetsOff := coordsOff + int64(numPoints)*16
-	dataBlobsOff := dataOffsetsOff + int64(numPoints+1)*8
-
 	return &DiskKDBush[V, VP]{
 		r:              r,
-		nodeSize:       nodeSize,
-		numPoints:      numPoints,
+		nodeSize:       h.NodeSize,
+		numPoints:      h.NumPoints,
+		idxSize:        h.IdxSize,
+		coordSize:      h.CoordSize,
+		blocked:        h.Layout == LayoutBlocked,
+		blocksOffset:   blocksOff,
 		idxsOffset:     idxsOff,
 		coordsOffset:   coordsOff,
 		dataOffsetsOff: dataOffsetsOff,
@@ -258,6 +490,9 @@ func (d *DiskKDBush[V, VP]) Range(minX, minY, maxX, maxY float64) ([]Point[V], e
 	if d.numPoints == 0 {
 		return nil, nil
 	}
+	if d.blocked {
+		return d.rangeBlocked(minX, minY, maxX, maxY)
+	}
 
 	stack := []int{0, d.numPoints - 1, 0}
 
@@ -346,6 +581,9 @@ func (d *DiskKDBush[V, VP]) Within(qx, qy, radius float64, handler func(p Point[
 	if d.numPoints == 0 {
 		return nil
 	}
+	if d.blocked {
+		return d.withinBlocked(qx, qy, radius, handler)
+	}
 
 	stack := []int{0, d.numPoints - 1, 0}
 	r2 := radius * radius
@@ -424,22 +662,21 @@ func (d *DiskKDBush[V, VP]) Within(qx, qy, radius float64, handler func(p Point[
 // concrete *mmap.ReaderAt (no interface escape).
 func (d *DiskKDBush[V, VP]) readIdx(i int) (int, error) {
 	var buf [8]byte
-	if _, err := d.r.ReadAt(buf[:], d.idxsOffset+int64(i)*8); err != nil {
+	if _, err := d.r.ReadAt(buf[:d.idxSize], d.idxsOffset+int64(i*d.idxSize)); err != nil {
 		return 0, fmt.Errorf("kdbush: reading idx[%d]: %w", i, err)
 	}
-	return int(diskByteOrder.Uint64(buf[:])), nil
+	return d.decodeIdx(buf[:]), nil
 }
 
 // readCoord reads the (x, y) coordinate pair for sorted position i.
 // buf is a stack-allocated [16]byte.
 func (d *DiskKDBush[V, VP]) readCoord(i int) (x, y float64, err error) {
 	var buf [16]byte
-	if _, err = d.r.ReadAt(buf[:], d.coordsOffset+int64(i)*16); err != nil {
+	pairSize := 2 * d.coordSize
+	if _, err = d.r.ReadAt(buf[:pairSize], d.coordsOffset+int64(i*pairSize)); err != nil {
 		return 0, 0, fmt.Errorf("kdbush: reading coord[%d]: %w", i, err)
 	}
-	x = math.Float64frombits(diskByteOrder.Uint64(buf[0:8]))
-	y = math.Float64frombits(diskByteOrder.Uint64(buf[8:16]))
-	return x, y, nil
+	return d.decodeCoord(buf[:]), d.decodeCoord(buf[d.coordSize:]), nil
 }
 
 // readLeaf batch-reads indices and coordinates for sorted positions [left, right].
@@ -450,31 +687,55 @@ func (d *DiskKDBush[V, VP]) readLeaf(left, right int) (idxs []int, coords []floa
 		return nil, nil, nil
 	}
 
-	ibuf := make([]byte, count*8)
-	if _, err = d.r.ReadAt(ibuf, d.idxsOffset+int64(left)*8); err != nil {
+	ibuf := make([]byte, count*d.idxSize)
+	if _, err = d.r.ReadAt(ibuf, d.idxsOffset+int64(left*d.idxSize)); err != nil {
 		return nil, nil, fmt.Errorf("kdbush: reading idxs[%d:%d]: %w", left, right, err)
 	}
 	idxs = make([]int, count)
 	for i := range count {
-		idxs[i] = int(diskByteOrder.Uint64(ibuf[i*8:]))
+		idxs[i] = d.decodeIdx(ibuf[i*d.idxSize:])
 	}
 
-	cbuf := make([]byte, count*16)
-	if _, err = d.r.ReadAt(cbuf, d.coordsOffset+int64(left)*16); err != nil {
+	cbuf := make([]byte, count*2*d.coordSize)
+	if _, err = d.r.ReadAt(cbuf, d.coordsOffset+int64(left*2*d.coordSize)); err != nil {
 		return nil, nil, fmt.Errorf("kdbush: reading coords[%d:%d]: %w", left, right, err)
 	}
 	coords = make([]float64, count*2)
 	for i := range count * 2 {
-		coords[i] = math.Float64frombits(diskByteOrder.Uint64(cbuf[i*8:]))
+		coords[i] = d.decodeCoord(cbuf[i*d.coordSize:])
 	}
 
 	return idxs, coords, nil
 }
 
+func (d *DiskKDBush[V, VP]) decodeIdx(b []byte) int {
+	if d.idxSize == 4 {
+		return int(diskByteOrder.Uint32(b))
+	}
+	return int(diskByteOrder.Uint64(b))
+}
+
+func (d *DiskKDBush[V, VP]) decodeCoord(b []byte) float64 {
+	if d.coordSize == 4 {
+		return fromFixedPoint(int32(diskByteOrder.Uint32(b)))
+	}
+	return math.Float64frombits(diskByteOrder.Uint64(b))
+}
+
 // ---------------------------------------------------------------------------
 // Data-section read helper  (called only for matched points)
 // ---------------------------------------------------------------------------
 
+// PointData reads and unmarshals the data payload of the point with the given
+// original index (its position in the slice passed to [BuildDisk]).
+func (d *DiskKDBush[V, VP]) PointData(origIdx int) (V, error) {
+	if origIdx < 0 || origIdx >= d.numPoints {
+		var zero V
+		return zero, fmt.Errorf("kdbush: point index %d out of range [0, %d)", origIdx, d.numPoints)
+	}
+	return d.readPointData(origIdx)
+}
+
 // readPointData reads and unmarshals the data payload for the point at the
 // given original index.  Exactly two ReadAt calls: one for the offset pair,
 // one for the blob.
@@ -532,20 +793,26 @@ func (d *DiskKDBush[V, VP]) readPointData(origIdx int) (V, error) {
 
 const diskWriteChunkSize = 4096 // elements per write ≈ 32 KiB buffer
 
-func diskWriteInts(w io.Writer, ints []int) (int64, error) {
+// fitsFixedPoint reports whether v can be stored as an int32 fixed-point coordinate.
+func fitsFixedPoint(v float64) bool {
+	return math.Abs(v) <= maxFixedPoint
+}
+
+// diskWriteInts writes indices as uint32 or int64 depending on size.
+func diskWriteInts(w io.Writer, ints []int, size int) (int64, error) {
 	var written int64
 	if len(ints) == 0 {
 		return 0, nil
 	}
 	chunkLen := min(len(ints), diskWriteChunkSize)
-	buf := make([]byte, chunkLen*8)
+	buf := make([]byte, chunkLen*size)
 
 	for i := 0; i < len(ints); {
 		n := min(len(ints)-i, diskWriteChunkSize)
 		for j := range n {
-			diskByteOrder.PutUint64(buf[j*8:], uint64(ints[i+j]))
+			putIdx(buf[j*size:], ints[i+j], size)
 		}
-		nn, err := w.Write(buf[:n*8])
+		nn, err := w.Write(buf[:n*size])
 		written += int64(nn)
 		if err != nil {
 			return written, err
@@ -555,20 +822,21 @@ func diskWriteInts(w io.Writer, ints []int) (int64, error) {
 	return written, nil
 }
 
-func diskWriteFloat64s(w io.Writer, floats []float64) (int64, error) {
+// diskWriteCoords writes coordinates as int32 fixed-point or float64 depending on size.
+func diskWriteCoords(w io.Writer, coords []float64, size int) (int64, error) {
 	var written int64
-	if len(floats) == 0 {
+	if len(coords) == 0 {
 		return 0, nil
 	}
-	chunkLen := min(len(floats), diskWriteChunkSize)
-	buf := make([]byte, chunkLen*8)
+	chunkLen := min(len(coords), diskWriteChunkSize)
+	buf := make([]byte, chunkLen*size)
 
-	for i := 0; i < len(floats); {
-		n := min(len(floats)-i, diskWriteChunkSize)
+	for i := 0; i < len(coords); {
+		n := min(len(coords)-i, diskWriteChunkSize)
 		for j := range n {
-			diskByteOrder.PutUint64(buf[j*8:], math.Float64bits(floats[i+j]))
+			putCoord(buf[j*size:], coords[i+j], size)
 		}
-		nn, err := w.Write(buf[:n*8])
+		nn, err := w.Write(buf[:n*size])
 		written += int64(nn)
 		if err != nil {
 			return written, err
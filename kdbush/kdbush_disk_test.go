@@ -3,10 +3,12 @@ package kdbush
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"golang.org/x/exp/mmap"
@@ -64,7 +66,7 @@ func generateTestPoints(n int) []Point[testData] {
 	return pts
 }
 
-func buildAndOpen(t *testing.T, pts []Point[testData], nodeSize int) *DiskKDBush[testData, *testData] {
+func buildAndOpen(t *testing.T, pts []Point[testData], nodeSize int, opts ...BuildOption) *DiskKDBush[testData, *testData] {
 	t.Helper()
 
 	path := filepath.Join(t.TempDir(), "test.kdbush")
@@ -72,7 +74,7 @@ func buildAndOpen(t *testing.T, pts []Point[testData], nodeSize int) *DiskKDBush
 	if err != nil {
 		t.Fatalf("create temp file: %v", err)
 	}
-	if _, err := BuildDisk[testData, *testData](pts, nodeSize, f); err != nil {
+	if _, err := BuildDisk[testData, *testData](pts, nodeSize, f, opts...); err != nil {
 		f.Close()
 		t.Fatalf("BuildDisk: %v", err)
 	}
@@ -188,6 +190,55 @@ func TestDisk_RoundTrip_Within(t *testing.T) {
 	}
 }
 
+func TestDisk_Bounds(t *testing.T) {
+	pts := generateTestPoints(10_000)
+	minX, minY := pts[0].X, pts[0].Y
+	maxX, maxY := minX, minY
+	for _, p := range pts {
+		minX, maxX = min(minX, p.X), max(maxX, p.X)
+		minY, maxY = min(minY, p.Y), max(maxY, p.Y)
+	}
+
+	bush := NewBush(pts, 64)
+	gotMinX, gotMinY, gotMaxX, gotMaxY, ok := bush.Bounds()
+	if !ok || gotMinX != minX || gotMinY != minY || gotMaxX != maxX || gotMaxY != maxY {
+		t.Errorf("mem Bounds = %v %v %v %v %v", gotMinX, gotMinY, gotMaxX, gotMaxY, ok)
+	}
+
+	disk := buildAndOpen(t, pts, 64)
+	gotMinX, gotMinY, gotMaxX, gotMaxY, ok, err := disk.Bounds()
+	if err != nil {
+		t.Fatalf("disk Bounds: %v", err)
+	}
+	if !ok || gotMinX != minX || gotMinY != minY || gotMaxX != maxX || gotMaxY != maxY {
+		t.Errorf("disk Bounds = %v %v %v %v %v", gotMinX, gotMinY, gotMaxX, gotMaxY, ok)
+	}
+
+	empty := buildAndOpen(t, nil, 64)
+	if _, _, _, _, ok, err := empty.Bounds(); ok || err != nil {
+		t.Errorf("empty Bounds: ok=%v err=%v", ok, err)
+	}
+}
+
+func TestDisk_Coords(t *testing.T) {
+	pts := generateTestPoints(10_000)
+	for _, layout := range []DiskLayout{LayoutFlat, LayoutBlocked} {
+		disk := buildAndOpen(t, pts, 16, WithLayout(layout))
+		coords, err := disk.Coords()
+		if err != nil {
+			t.Fatalf("layout %d: %v", layout, err)
+		}
+		if len(coords) != 2*len(pts) {
+			t.Fatalf("layout %d: %d coords for %d points", layout, len(coords), len(pts))
+		}
+		for i, p := range pts {
+			if coords[2*i] != p.X || coords[2*i+1] != p.Y {
+				t.Fatalf("layout %d: point %d at %v, %v, want %v, %v", layout, i, coords[2*i], coords[2*i+1], p.X, p.Y)
+			}
+		}
+	}
+}
+
 func TestDisk_DataIntegrity(t *testing.T) {
 	pts := []Point[testData]{
 		{X: 10, Y: 20, Data: testData{Value: 100, Label: makeLabel(100)}},
@@ -351,7 +402,7 @@ func writeTempFile(t *testing.T, data []byte) *mmap.ReaderAt {
 }
 
 func TestDisk_InvalidMagic(t *testing.T) {
-	data := make([]byte, diskHeaderSize)
+	data := make([]byte, DiskHeaderSize)
 	copy(data[0:4], []byte("NOPE"))
 
 	_, err := OpenDisk[testData, *testData](writeTempFile(t, data), 0)
@@ -361,7 +412,7 @@ func TestDisk_InvalidMagic(t *testing.T) {
 }
 
 func TestDisk_InvalidVersion(t *testing.T) {
-	data := make([]byte, diskHeaderSize)
+	data := make([]byte, DiskHeaderSize)
 	copy(data[0:4], diskMagic[:])
 	diskByteOrder.PutUint32(data[4:8], 99)
 
@@ -371,6 +422,22 @@ func TestDisk_InvalidVersion(t *testing.T) {
 	}
 }
 
+func TestDisk_InvalidHeader(t *testing.T) {
+	for _, layout := range []DiskLayout{LayoutFlat, LayoutBlocked} {
+		for _, tc := range []struct{ nodeSize, numPoints int64 }{{-2, 10}, {0, 10}, {64, -1}} {
+			h := DiskHeader{Version: diskVersion, IdxSize: 4, CoordSize: 4, Layout: layout}
+			data := h.marshal()
+			diskByteOrder.PutUint64(data[8:16], uint64(tc.nodeSize))
+			diskByteOrder.PutUint64(data[16:24], uint64(tc.numPoints))
+
+			_, err := OpenDiskReaderAt[testData, *testData](Bytes(data[:]), 0)
+			if err == nil || !strings.Contains(err.Error(), "invalid header") {
+				t.Errorf("layout %d, node size %d, %d points: err = %v", layout, tc.nodeSize, tc.numPoints, err)
+			}
+		}
+	}
+}
+
 func TestDisk_TruncatedHeader(t *testing.T) {
 	_, err := OpenDisk[testData, *testData](writeTempFile(t, []byte("KDB")), 0)
 	if err == nil {
@@ -378,6 +445,87 @@ func TestDisk_TruncatedHeader(t *testing.T) {
 	}
 }
 
+// The same index opened from a byte slice, a generic reader and at an offset
+// answers like the memory-mapped one.
+func TestDisk_ReaderAt(t *testing.T) {
+	pts := generateTestPoints(2_000)
+	mm := buildAndOpen(t, pts, 16)
+
+	for _, layout := range []DiskLayout{LayoutFlat, LayoutBlocked} {
+		var buf bytes.Buffer
+		buf.WriteString("prefix")
+		if _, err := BuildDisk[testData, *testData](pts, 16, &buf, WithLayout(layout)); err != nil {
+			t.Fatalf("BuildDisk: %v", err)
+		}
+		data := buf.Bytes()
+
+		readers := map[string]io.ReaderAt{
+			"bytes":   Bytes(data),
+			"generic": bytes.NewReader(data),
+		}
+		for name, r := range readers {
+			disk, err := OpenDiskReaderAt[testData, *testData](r, int64(len("prefix")))
+			if err != nil {
+				t.Fatalf("%s: OpenDiskReaderAt: %v", name, err)
+			}
+			if disk.NumPoints() != len(pts) {
+				t.Fatalf("%s: NumPoints %d, want %d", name, disk.NumPoints(), len(pts))
+			}
+
+			want, err := mm.Range(200, 200, 600, 600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := disk.Range(200, 200, 600, 600)
+			if err != nil {
+				t.Fatalf("%s: Range: %v", name, err)
+			}
+			byValue := func(a, b Point[testData]) int { return a.Data.Value - b.Data.Value }
+			slices.SortFunc(want, byValue)
+			slices.SortFunc(got, byValue)
+			if !slices.Equal(want, got) {
+				t.Errorf("%s layout %d: Range returned %d points, mmap %d", name, layout, len(got), len(want))
+			}
+		}
+	}
+
+	if _, err := OpenDiskReaderAt[testData, *testData](Bytes("KDB"), 0); err == nil {
+		t.Error("expected error for truncated header")
+	}
+}
+
+// The parallel sort builds the same tree as the serial one.
+func TestDisk_ParallelBuild(t *testing.T) {
+	pts := generateTestPoints(3 * parallelSortMin)
+	// duplicated coordinates exercise the equal-to-pivot branches
+	rng := rand.New(rand.NewSource(3))
+	for i := range 10_000 {
+		src := pts[rng.Intn(len(pts))]
+		pts = append(pts, Point[testData]{X: src.X, Y: src.Y, Data: testData{Value: len(pts) + i}})
+	}
+
+	var want bytes.Buffer
+	if _, err := BuildDisk[testData, *testData](pts, DefaultNodeSize, &want); err != nil {
+		t.Fatalf("BuildDisk: %v", err)
+	}
+	serial := NewBush(pts, DefaultNodeSize)
+
+	for _, threads := range []int{2, 8} {
+		var got bytes.Buffer
+		if _, err := BuildDisk[testData, *testData](pts, DefaultNodeSize, &got, WithThreads(threads)); err != nil {
+			t.Fatalf("BuildDisk: %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%d threads: BuildDisk differs from the serial build", threads)
+		}
+
+		parallel := NewBush(pts, DefaultNodeSize, WithThreads(threads))
+		if !slices.Equal(parallel.idxs, serial.idxs) || !slices.Equal(parallel.coords, serial.coords) {
+			t.Errorf("%d threads: NewBush differs from the serial build", threads)
+		}
+	}
+}
+
 func TestDisk_VariousNodeSizes(t *testing.T) {
 	pts := generateTestPoints(1_000)
 	nodeSizes := []int{1, 4, 16, 64, 256}
@@ -419,8 +567,9 @@ func TestDisk_WrittenSize(t *testing.T) {
 
 	// Each testData marshals to 16 bytes.
 	blobBytes := int64(n) * 16
-	expectedSize := int64(diskHeaderSize) +
-		int64(n)*8 + // idxs
+	// Test coordinates exceed the fixed-point range, indices fit uint32.
+	expectedSize := int64(DiskHeaderSize) +
+		int64(n)*4 + // idxs
 		int64(n)*16 + // coords
 		int64(n+1)*8 + // data offset table
 		blobBytes // data blobs
@@ -433,6 +582,278 @@ func TestDisk_WrittenSize(t *testing.T) {
 	}
 }
 
+// generateGeoPoints returns points on the 1e-7° grid of OSM coordinates.
+func generateGeoPoints(n int) []Point[testData] {
+	rng := rand.New(rand.NewSource(42))
+	pts := make([]Point[testData], n)
+	for i := range pts {
+		pts[i] = Point[testData]{
+			X:    float64(rng.Int63n(360e7)-180e7) / 1e7,
+			Y:    float64(rng.Int63n(170e7)-85e7) / 1e7,
+			Data: testData{Value: i, Label: makeLabel(i)},
+		}
+	}
+	return pts
+}
+
+func TestDisk_FixedPoint(t *testing.T) {
+	pts := generateGeoPoints(5_000)
+	bush := NewBush(pts, DefaultNodeSize)
+	disk := buildAndOpen(t, pts, DefaultNodeSize)
+
+	if disk.idxSize != 4 || disk.coordSize != 4 {
+		t.Fatalf("layout idx %d coord %d, want 4 and 4", disk.idxSize, disk.coordSize)
+	}
+	h := newDiskHeader(DefaultNodeSize, len(pts), true)
+	if got, v1 := h.TreeSize(), int64(len(pts))*24; got*2 != v1 {
+		t.Errorf("tree section is %d bytes, version 1 takes %d", got, v1)
+	}
+
+	for _, q := range [][4]float64{{-10, -10, 30, 40}, {100, 0, 101, 1}, {-180, -85, 180, 85}} {
+		want := bush.Range(q[0], q[1], q[2], q[3])
+		got, err := disk.Range(q[0], q[1], q[2], q[3])
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotIdxs := make([]int, len(got))
+		for i, p := range got {
+			gotIdxs[i] = p.Data.Value
+			if orig := pts[p.Data.Value]; p.X != orig.X || p.Y != orig.Y {
+				t.Errorf("point %d at (%v, %v), stored at (%v, %v)", p.Data.Value, p.X, p.Y, orig.X, orig.Y)
+			}
+		}
+		slices.Sort(want)
+		slices.Sort(gotIdxs)
+		if !slices.Equal(want, gotIdxs) {
+			t.Errorf("Range %v: mem=%d disk=%d", q, len(want), len(gotIdxs))
+		}
+	}
+
+	var want, got []int
+	bush.Within(37.6, 55.7, 20, func(p Point[testData]) bool {
+		want = append(want, p.Data.Value)
+		return true
+	})
+	if err := disk.Within(37.6, 55.7, 20, func(p Point[testData]) bool {
+		got = append(got, p.Data.Value)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(want)
+	slices.Sort(got)
+	if !slices.Equal(want, got) {
+		t.Errorf("Within: mem=%d disk=%d", len(want), len(got))
+	}
+}
+
+func TestDisk_FixedPointRounding(t *testing.T) {
+	// off-grid coordinates are rounded, the tree is sorted on rounded values
+	pts := []Point[testData]{
+		{X: 10.123456789, Y: 20.987654321, Data: testData{Value: 0}},
+		{X: 10.12345681, Y: 20.98765428, Data: testData{Value: 1}},
+	}
+	disk := buildAndOpen(t, pts, DefaultNodeSize)
+	got, err := disk.Range(10.1234568, 20.9876543, 10.1234568, 20.9876543)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Range on the rounded coordinate found %d points, want 2", len(got))
+	}
+	for _, p := range got {
+		if p.X != 10.1234568 || p.Y != 20.9876543 {
+			t.Errorf("point %d at (%v, %v)", p.Data.Value, p.X, p.Y)
+		}
+	}
+}
+
+// buildVersion1 writes points in the version 1 layout with 8-byte indices and coordinates.
+func buildVersion1(t *testing.T, pts []Point[testData], nodeSize int) []byte {
+	t.Helper()
+	n := len(pts)
+	idxs := make([]int, n)
+	coords := make([]float64, 2*n)
+	offsets := make([]int64, n+1)
+	blobs := make([][]byte, n)
+	for i, p := range pts {
+		idxs[i] = i
+		coords[2*i], coords[2*i+1] = p.X, p.Y
+		blobs[i], _ = p.Data.MarshalBinary()
+		offsets[i+1] = offsets[i] + int64(len(blobs[i]))
+	}
+	sort(idxs, coords, nodeSize, 0, n-1, 0)
+
+	var buf bytes.Buffer
+	header := make([]byte, DiskHeaderSize)
+	copy(header, diskMagic[:])
+	diskByteOrder.PutUint32(header[4:8], 1)
+	diskByteOrder.PutUint64(header[8:16], uint64(nodeSize))
+	diskByteOrder.PutUint64(header[16:24], uint64(n))
+	buf.Write(header)
+	diskWriteInts(&buf, idxs, 8)
+	diskWriteCoords(&buf, coords, 8)
+	diskWriteInt64s(&buf, offsets)
+	diskWriteBlobs(&buf, blobs)
+	return buf.Bytes()
+}
+
+func TestDisk_Version1(t *testing.T) {
+	pts := generateGeoPoints(2_000)
+	v1, err := OpenDisk[testData, *testData](writeTempFile(t, buildVersion1(t, pts, 16)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := buildAndOpen(t, pts, 16)
+
+	want, err := v1.Range(-50, -50, 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v2.Range(-50, -50, 50, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || !slices.EqualFunc(want, got, func(a, b Point[testData]) bool { return a == b }) {
+		t.Errorf("version 1 found %d points, version 2 %d", len(want), len(got))
+	}
+}
+
+// blobData is a payload of arbitrary size, large ones are not inlined in leaf blocks.
+type blobData []byte
+
+func (d blobData) MarshalBinary() ([]byte, error) { return d, nil }
+
+func (d *blobData) UnmarshalBinary(data []byte) error {
+	*d = slices.Clone(data)
+	return nil
+}
+
+func TestDisk_BlockedLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		pts  []Point[testData]
+	}{
+		{"fixed-point", generateGeoPoints(20_000)},
+		{"float64", generateTestPoints(20_000)},
+		{"single leaf", generateGeoPoints(10)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			flat := buildAndOpen(t, tc.pts, 16)
+			blocked := buildAndOpen(t, tc.pts, 16, WithLayout(LayoutBlocked))
+			if !blocked.blocked {
+				t.Fatal("layout is not recorded in the header")
+			}
+
+			minX, minY, maxX, maxY, _, _ := flat.Bounds()
+			bMinX, bMinY, bMaxX, bMaxY, ok, err := blocked.Bounds()
+			if err != nil || !ok || [4]float64{minX, minY, maxX, maxY} != [4]float64{bMinX, bMinY, bMaxX, bMaxY} {
+				t.Errorf("Bounds differ: %v %v", ok, err)
+			}
+
+			// both layouts traverse in the same order
+			cx, cy := (minX+maxX)/2, (minY+maxY)/2
+			w, h := (maxX-minX)/4, (maxY-minY)/4
+			want, err := flat.Range(cx-w, cy-h, cx+w, cy+h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := blocked.Range(cx-w, cy-h, cx+w, cy+h)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(want) == 0 || !slices.Equal(want, got) {
+				t.Errorf("Range: flat %d points, blocked %d", len(want), len(got))
+			}
+
+			var wantW, gotW []Point[testData]
+			flat.Within(cx, cy, w, func(p Point[testData]) bool { wantW = append(wantW, p); return true })
+			if err := blocked.Within(cx, cy, w, func(p Point[testData]) bool { gotW = append(gotW, p); return len(gotW) < len(wantW) }); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(wantW, gotW) {
+				t.Errorf("Within: flat %d points, blocked %d", len(wantW), len(gotW))
+			}
+
+			if data, err := blocked.PointData(3); err != nil || data.Value != 3 {
+				t.Errorf("PointData(3) = %+v, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestDisk_BlockedPages(t *testing.T) {
+	// payloads from 0 to 200 bytes, larger than blockInlineMax are read from the data section
+	rng := rand.New(rand.NewSource(1))
+	pts := make([]Point[blobData], 5_000)
+	for i := range pts {
+		data := make(blobData, rng.Intn(200))
+		rng.Read(data)
+		pts[i] = Point[blobData]{X: rng.Float64()*10 + 30, Y: rng.Float64()*10 + 50, Data: data}
+	}
+
+	var buf bytes.Buffer
+	if _, err := BuildDisk[blobData, *blobData](pts, DefaultNodeSize, &buf, WithLayout(LayoutBlocked)); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	header, err := ParseDiskHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blobsSize int64
+	for _, p := range pts {
+		blobsSize += int64(len(p.Data))
+	}
+	if want := DiskHeaderSize + header.TreeSize() + header.DataOffsetsSize() + blobsSize; int64(len(data)) != want {
+		t.Fatalf("block is %d bytes, header describes %d", len(data), want)
+	}
+
+	// every leaf slot points to a block which doesn't cross a page boundary
+	rec := header.recordSize()
+	blocksOff := header.blocksOffset()
+	var checkSlots func(left, right int, slot int64)
+	checkSlots = func(left, right int, slot int64) {
+		s := data[DiskHeaderSize+slot*int64(rec):]
+		if right-left <= header.NodeSize {
+			off := int64(diskByteOrder.Uint64(s[0:8]))
+			size := int64(diskByteOrder.Uint32(s[8:12]))
+			if size <= blockPageSize && off/blockPageSize != (off+size-1)/blockPageSize {
+				t.Errorf("leaf [%d:%d] block of %d bytes at %d crosses a page", left, right, size, off)
+			}
+			if blocksOff+off+size > DiskHeaderSize+header.TreeSize() {
+				t.Errorf("leaf [%d:%d] block is out of the tree section", left, right)
+			}
+			return
+		}
+		m := floor(float64(left+right) / 2.0)
+		checkSlots(left, m-1, 2*slot+1)
+		checkSlots(m+1, right, 2*slot+2)
+	}
+	checkSlots(0, len(pts)-1, 0)
+
+	disk, err := OpenDisk[blobData, *blobData](writeTempFile(t, data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := disk.Range(30, 50, 40, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != len(pts) {
+		t.Fatalf("Range found %d points, want %d", len(found), len(pts))
+	}
+	byCoord := map[[2]float64]blobData{}
+	for _, p := range pts {
+		byCoord[[2]float64{fromFixedPoint(toFixedPoint(p.X)), fromFixedPoint(toFixedPoint(p.Y))}] = p.Data
+	}
+	for _, p := range found {
+		if want := byCoord[[2]float64{p.X, p.Y}]; !bytes.Equal(p.Data, want) {
+			t.Fatalf("payload of (%v, %v) is %d bytes, want %d", p.X, p.Y, len(p.Data), len(want))
+		}
+	}
+}
+
 // ---------------------------------------------------------------------------
 // Benchmarks
 // ---------------------------------------------------------------------------
@@ -505,3 +926,57 @@ func BenchmarkDisk(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkDisk_ColdPageFaults counts the pages a query touches in a fresh
+// mapping of the file, which is what a cold query costs in page faults.
+// The page cache itself stays warm, so faults are mostly minor.
+func BenchmarkDisk_ColdPageFaults(b *testing.B) {
+	if _, ok := pageFaults(); !ok {
+		b.Skip("page fault counters are not available")
+	}
+
+	pts := generateGeoPoints(500_000)
+	for _, layout := range []struct {
+		name string
+		opt  DiskLayout
+	}{
+		{"flat", LayoutFlat},
+		{"blocked", LayoutBlocked},
+	} {
+		b.Run(layout.name, func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "bench.kdbush")
+			f, err := os.Create(path)
+			if err != nil {
+				b.Fatalf("create temp file: %v", err)
+			}
+			if _, err := BuildDisk[testData, *testData](pts, DefaultNodeSize, f, WithLayout(layout.opt)); err != nil {
+				f.Close()
+				b.Fatalf("BuildDisk: %v", err)
+			}
+			f.Close()
+
+			rng := rand.New(rand.NewSource(7))
+			var faults int64
+			b.ResetTimer()
+			for b.Loop() {
+				r, err := mmap.Open(path)
+				if err != nil {
+					b.Fatalf("mmap.Open: %v", err)
+				}
+				disk, err := OpenDisk[testData, *testData](r, 0)
+				if err != nil {
+					b.Fatalf("OpenDisk: %v", err)
+				}
+				qx, qy := rng.Float64()*360-180, rng.Float64()*170-85
+
+				before, _ := pageFaults()
+				disk.Within(qx, qy, 0.5, func(Point[testData]) bool { return true })
+				after, _ := pageFaults()
+				faults += after - before
+
+				r.Close()
+			}
+			b.ReportMetric(float64(faults)/float64(b.N), "faults/op")
+		})
+	}
+}
@@ -0,0 +1,644 @@
+package kdbush
+
+import (
+	"bufio"
+	"container/list"
+	"encoding"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// ---------------------------------------------------------------------------
+// ExternalBuilder — build a KDBH block with bounded memory
+// ---------------------------------------------------------------------------
+
+// externalItemSize is the size of a spilled tree item: int64 original index
+// followed by float64 x and y.
+const externalItemSize = 24
+
+// ExternalBuilder builds the same KDBH block as [BuildDisk] without holding
+// the points in memory.
+//
+// Points are spilled to temporary files as they are added.  [ExternalBuilder.WriteTo]
+// orders the spilled tree items with an external KD sort which keeps at most
+// maxMemory bytes of items in memory, then streams all sections to the writer.
+// The output is byte-identical to BuildDisk with the default flat layout for
+// the same points in the same order.
+type ExternalBuilder[V encoding.BinaryMarshaler, VP binaryPointer[V]] struct {
+	nodeSize  int
+	maxMemory int64
+	threads   int
+
+	items   *os.File // externalItemSize records in original order
+	offsets *os.File // int64 cumulative blob offsets
+	blobs   *os.File // concatenated MarshalBinary output
+
+	itemsW   *bufio.Writer
+	offsetsW *bufio.Writer
+	blobsW   *bufio.Writer
+
+	numPoints int
+	blobsSize int64
+	// fixedPoint is true while all coordinates fit the fixed-point range
+	fixedPoint bool
+}
+
+// NewExternalBuilder creates the temporary files of a builder in dir,
+// the default temporary directory is used if dir is empty.
+// Call [ExternalBuilder.Close] to remove them.
+//
+// [WithThreads] applies when all items fit in maxMemory, larger trees are
+// partitioned on disk by a single goroutine.
+func NewExternalBuilder[V encoding.BinaryMarshaler, VP binaryPointer[V]](nodeSize int, maxMemory int64, dir string, opts ...BuildOption) (*ExternalBuilder[V, VP], error) {
+	options := loadBuildOptions(opts...)
+	if options.layout != LayoutFlat {
+		return nil, fmt.Errorf("kdbush: external builder supports only the flat layout")
+	}
+
+	b := &ExternalBuilder[V, VP]{
+		nodeSize:   nodeSize,
+		maxMemory:  maxMemory,
+		threads:    options.threads,
+		fixedPoint: true,
+	}
+
+	var err error
+	for _, f := range []**os.File{&b.items, &b.offsets, &b.blobs} {
+		*f, err = os.CreateTemp(dir, "kdbush-*")
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("kdbush: creating temp file: %w", err)
+		}
+	}
+
+	b.itemsW = bufio.NewWriterSize(b.items, 64*1024)
+	b.offsetsW = bufio.NewWriterSize(b.offsets, 64*1024)
+	b.blobsW = bufio.NewWriterSize(b.blobs, 64*1024)
+
+	return b, nil
+}
+
+// Add appends a point, points get original indices in the order they are added.
+func (b *ExternalBuilder[V, VP]) Add(p Point[V]) error {
+	data, err := p.Data.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("kdbush: marshal point[%d]: %w", b.numPoints, err)
+	}
+
+	var item [externalItemSize]byte
+	diskByteOrder.PutUint64(item[0:8], uint64(b.numPoints))
+	diskByteOrder.PutUint64(item[8:16], math.Float64bits(p.X))
+	diskByteOrder.PutUint64(item[16:24], math.Float64bits(p.Y))
+	if _, err := b.itemsW.Write(item[:]); err != nil {
+		return fmt.Errorf("kdbush: spilling point[%d]: %w", b.numPoints, err)
+	}
+
+	var offset [8]byte
+	diskByteOrder.PutUint64(offset[:], uint64(b.blobsSize))
+	if _, err := b.offsetsW.Write(offset[:]); err != nil {
+		return fmt.Errorf("kdbush: spilling point[%d]: %w", b.numPoints, err)
+	}
+
+	if _, err := b.blobsW.Write(data); err != nil {
+		return fmt.Errorf("kdbush: spilling point[%d]: %w", b.numPoints, err)
+	}
+
+	b.blobsSize += int64(len(data))
+	b.numPoints++
+	b.fixedPoint = b.fixedPoint && fitsFixedPoint(p.X) && fitsFixedPoint(p.Y)
+	return nil
+}
+
+// NumPoints returns the number of added points.
+func (b *ExternalBuilder[V, VP]) NumPoints() int { return b.numPoints }
+
+// Size returns the number of bytes [ExternalBuilder.WriteTo] will write.
+func (b *ExternalBuilder[V, VP]) Size() int64 {
+	h := b.header()
+	return DiskHeaderSize + h.TreeSize() + h.DataOffsetsSize() + b.blobsSize
+}
+
+func (b *ExternalBuilder[V, VP]) header() DiskHeader {
+	return newDiskHeader(b.nodeSize, b.numPoints, b.fixedPoint)
+}
+
+// WriteTo sorts the spilled points and writes the KDBH block to w.
+// The builder must not be used after WriteTo except for Close.
+func (b *ExternalBuilder[V, VP]) WriteTo(w io.Writer) (int64, error) {
+	for _, bw := range []*bufio.Writer{b.itemsW, b.offsetsW, b.blobsW} {
+		if err := bw.Flush(); err != nil {
+			return 0, fmt.Errorf("kdbush: flushing temp file: %w", err)
+		}
+	}
+
+	n := b.numPoints
+	header := b.header()
+	if n > 0 && header.CoordSize == 4 {
+		if err := roundItems(b.items, n); err != nil {
+			return 0, err
+		}
+	}
+	if n > 0 {
+		if err := externalSort(b.items, n, b.nodeSize, b.maxMemory, b.threads); err != nil {
+			return 0, err
+		}
+	}
+
+	var written int64
+
+	// header
+	headerBytes := header.marshal()
+	nn, err := w.Write(headerBytes[:])
+	written += int64(nn)
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing header: %w", err)
+	}
+
+	// sorted indices, then sorted coordinates, both read from the sorted items
+	n64, err := writeItemIdxs(w, b.items, n, header.IdxSize)
+	written += n64
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing indices: %w", err)
+	}
+	n64, err = writeItemCoords(w, b.items, n, header.CoordSize)
+	written += n64
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing coords: %w", err)
+	}
+
+	// data offset table, the spilled offsets lack the total
+	n64, err = io.Copy(w, io.NewSectionReader(b.offsets, 0, int64(n)*8))
+	written += n64
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing data offsets: %w", err)
+	}
+	var total [8]byte
+	diskByteOrder.PutUint64(total[:], uint64(b.blobsSize))
+	nn, err = w.Write(total[:])
+	written += int64(nn)
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing data offsets: %w", err)
+	}
+
+	// data blobs
+	n64, err = io.Copy(w, io.NewSectionReader(b.blobs, 0, b.blobsSize))
+	written += n64
+	if err != nil {
+		return written, fmt.Errorf("kdbush: writing data blobs: %w", err)
+	}
+
+	return written, nil
+}
+
+// Close removes the temporary files.
+func (b *ExternalBuilder[V, VP]) Close() error {
+	var firstErr error
+	for _, f := range []*os.File{b.items, b.offsets, b.blobs} {
+		if f == nil {
+			continue
+		}
+		f.Close()
+		if err := os.Remove(f.Name()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// roundItems rounds the coordinates of every item in f to the fixed-point
+// precision, like [BuildDisk] does before sorting.
+func roundItems(f *os.File, n int) error {
+	const chunk = 4096 // items per read
+	buf := make([]byte, chunk*externalItemSize)
+	for left := 0; left < n; left += chunk {
+		b := buf[:min(chunk, n-left)*externalItemSize]
+		off := int64(left) * externalItemSize
+		if _, err := f.ReadAt(b, off); err != nil {
+			return fmt.Errorf("kdbush: reading spilled items: %w", err)
+		}
+		for i := 0; i < len(b); i += externalItemSize {
+			for _, c := range [2]int{8, 16} {
+				v := math.Float64frombits(diskByteOrder.Uint64(b[i+c:]))
+				diskByteOrder.PutUint64(b[i+c:], math.Float64bits(fromFixedPoint(toFixedPoint(v))))
+			}
+		}
+		if _, err := f.WriteAt(b, off); err != nil {
+			return fmt.Errorf("kdbush: writing spilled items: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeItemIdxs writes the index of every item in r as size bytes.
+func writeItemIdxs(w io.Writer, r io.ReaderAt, n int, size int) (int64, error) {
+	return writeItems(w, r, n, size, func(dst, item []byte) {
+		idx := diskByteOrder.Uint64(item[0:8])
+		if size == 4 {
+			diskByteOrder.PutUint32(dst, uint32(idx))
+		} else {
+			diskByteOrder.PutUint64(dst, idx)
+		}
+	})
+}
+
+// writeItemCoords writes the coordinates of every item in r, size bytes each.
+func writeItemCoords(w io.Writer, r io.ReaderAt, n int, size int) (int64, error) {
+	return writeItems(w, r, n, 2*size, func(dst, item []byte) {
+		if size == 4 {
+			for i, c := range [2]int{8, 16} {
+				v := math.Float64frombits(diskByteOrder.Uint64(item[c:]))
+				diskByteOrder.PutUint32(dst[i*4:], uint32(toFixedPoint(v)))
+			}
+		} else {
+			copy(dst, item[8:24])
+		}
+	})
+}
+
+// writeItems writes size bytes encoded from every item in r to w.
+func writeItems(w io.Writer, r io.ReaderAt, n int, size int, encode func(dst, item []byte)) (int64, error) {
+	br := bufio.NewReaderSize(io.NewSectionReader(r, 0, int64(n)*externalItemSize), 64*1024)
+	bw := bufio.NewWriterSize(w, 64*1024)
+
+	var item [externalItemSize]byte
+	var out [16]byte
+	for range n {
+		if _, err := io.ReadFull(br, item[:]); err != nil {
+			return 0, err
+		}
+		encode(out[:size], item[:])
+		if _, err := bw.Write(out[:size]); err != nil {
+			return 0, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(n) * int64(size), nil
+}
+
+// ---------------------------------------------------------------------------
+// External KD sort
+// ---------------------------------------------------------------------------
+
+// kdItems is the storage the external KD sort works on.  Indices are absolute
+// positions in the whole items file.
+type kdItems interface {
+	coord(i, axis int) float64
+	swap(i, j int)
+}
+
+// externalSort orders the items file the same way [sort] orders in-memory
+// arrays.  Ranges which fit in maxMemory are loaded and sorted in memory,
+// larger ranges are partitioned through a bounded page cache.
+func externalSort(f *os.File, n, nodeSize int, maxMemory int64, threads int) error {
+	if int64(n)*externalItemSize <= maxMemory {
+		// Everything fits: use the in-memory sort as is.
+		mem, err := loadMemItems(f, 0, n-1)
+		if err != nil {
+			return err
+		}
+		sortParallel(mem.idxs, mem.coords, nodeSize, threads)
+		return mem.store(f)
+	}
+
+	s := &externalSorter{
+		f:        f,
+		nodeSize: nodeSize,
+		maxItems: int(maxMemory / externalItemSize),
+		paged:    newPagedItems(f, n, maxMemory),
+	}
+	s.sort(0, n-1, 0)
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.paged.flush(); err != nil {
+		return err
+	}
+	return s.paged.err
+}
+
+type externalSorter struct {
+	f        *os.File
+	nodeSize int
+	maxItems int
+	paged    *pagedItems
+	err      error
+}
+
+// sort mirrors the package level [sort].
+func (s *externalSorter) sort(left, right, depth int) {
+	if (right-left) <= s.nodeSize || s.err != nil || s.paged.err != nil {
+		return
+	}
+
+	if right-left+1 <= s.maxItems {
+		s.sortInMemory(left, right, depth)
+		return
+	}
+
+	m := floor(float64(left+right) / 2.0)
+
+	selectItems(s.paged, m, left, right, depth%2)
+
+	s.sort(left, m-1, depth+1)
+	s.sort(m+1, right, depth+1)
+}
+
+func (s *externalSorter) sortInMemory(left, right, depth int) {
+	// Cached pages may hold newer items than the file, and the memory is needed for the range.
+	if err := s.paged.flush(); err != nil {
+		s.err = err
+		return
+	}
+
+	mem, err := loadMemItems(s.f, left, right)
+	if err != nil {
+		s.err = err
+		return
+	}
+	sortItems(mem, s.nodeSize, left, right, depth)
+	if err := mem.store(s.f); err != nil {
+		s.err = err
+	}
+}
+
+// sortItems mirrors [sort] over kdItems.
+func sortItems(items kdItems, nodeSize int, left, right, depth int) {
+	if (right - left) <= nodeSize {
+		return
+	}
+
+	m := floor(float64(left+right) / 2.0)
+
+	selectItems(items, m, left, right, depth%2)
+
+	sortItems(items, nodeSize, left, m-1, depth+1)
+	sortItems(items, nodeSize, m+1, right, depth+1)
+}
+
+// selectItems mirrors [sselect] over kdItems.  It must stay in sync with
+// sselect, otherwise the external build is no longer byte-identical.
+func selectItems(items kdItems, k, left, right, inc int) {
+	for right > left {
+		if (right - left) > 600 {
+			n := right - left + 1
+			m := k - left + 1
+			z := math.Log(float64(n))
+			s := 0.5 * math.Exp(2.0*z/3.0)
+			sds := 1.0
+			if float64(m)-float64(n)/2.0 < 0 {
+				sds = -1.0
+			}
+			n_s := float64(n) - s
+			sd := 0.5 * math.Sqrt(z*s*n_s/float64(n)) * sds
+			newLeft := iMax(left, floor(float64(k)-float64(m)*s/float64(n)+sd))
+			newRight := iMin(right, floor(float64(k)+float64(n-m)*s/float64(n)+sd))
+			selectItems(items, k, newLeft, newRight, inc)
+		}
+
+		t := items.coord(k, inc)
+		i := left
+		j := right
+
+		items.swap(left, k)
+		if items.coord(right, inc) > t {
+			items.swap(left, right)
+		}
+
+		for i < j {
+			items.swap(i, j)
+			i += 1
+			j -= 1
+			for items.coord(i, inc) < t {
+				i += 1
+			}
+			for items.coord(j, inc) > t {
+				j -= 1
+			}
+		}
+
+		if items.coord(left, inc) == t {
+			items.swap(left, j)
+		} else {
+			j += 1
+			items.swap(j, right)
+		}
+
+		if j <= k {
+			left = j + 1
+		}
+		if k <= j {
+			right = j - 1
+		}
+	}
+}
+
+// memItems is a range of the items file loaded into memory.
+type memItems struct {
+	base   int
+	idxs   []int
+	coords []float64
+}
+
+func loadMemItems(f *os.File, left, right int) (*memItems, error) {
+	n := right - left + 1
+	mem := &memItems{
+		base:   left,
+		idxs:   make([]int, n),
+		coords: make([]float64, 2*n),
+	}
+
+	br := bufio.NewReaderSize(io.NewSectionReader(f, int64(left)*externalItemSize, int64(n)*externalItemSize), 64*1024)
+	var item [externalItemSize]byte
+	for i := range n {
+		if _, err := io.ReadFull(br, item[:]); err != nil {
+			return nil, fmt.Errorf("kdbush: reading items: %w", err)
+		}
+		mem.idxs[i] = int(diskByteOrder.Uint64(item[0:8]))
+		mem.coords[2*i] = math.Float64frombits(diskByteOrder.Uint64(item[8:16]))
+		mem.coords[2*i+1] = math.Float64frombits(diskByteOrder.Uint64(item[16:24]))
+	}
+	return mem, nil
+}
+
+func (m *memItems) store(f *os.File) error {
+	bw := bufio.NewWriterSize(io.NewOffsetWriter(f, int64(m.base)*externalItemSize), 64*1024)
+	var item [externalItemSize]byte
+	for i := range m.idxs {
+		diskByteOrder.PutUint64(item[0:8], uint64(m.idxs[i]))
+		diskByteOrder.PutUint64(item[8:16], math.Float64bits(m.coords[2*i]))
+		diskByteOrder.PutUint64(item[16:24], math.Float64bits(m.coords[2*i+1]))
+		if _, err := bw.Write(item[:]); err != nil {
+			return fmt.Errorf("kdbush: writing items: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("kdbush: writing items: %w", err)
+	}
+	return nil
+}
+
+func (m *memItems) coord(i, axis int) float64 {
+	return m.coords[2*(i-m.base)+axis]
+}
+
+func (m *memItems) swap(i, j int) {
+	swapItem(m.idxs, m.coords, i-m.base, j-m.base)
+}
+
+// pagedItems gives random access to the items file through an LRU cache of
+// decoded pages.  I/O errors are sticky: after the first one coord returns NaN,
+// which terminates the partition loops, and swap does nothing.
+type pagedItems struct {
+	f         *os.File
+	numItems  int
+	pageItems int
+	maxPages  int
+
+	pages map[int]*list.Element
+	lru   *list.List // front is the most recently used *itemsPage
+
+	err error
+}
+
+type itemsPage struct {
+	num    int
+	idxs   []int
+	coords []float64
+	dirty  bool
+}
+
+// minCachedPages keeps enough pages for every position selectItems touches at once.
+const minCachedPages = 8
+
+func newPagedItems(f *os.File, numItems int, maxMemory int64) *pagedItems {
+	// Aim for at least 64 pages, but don't make pages smaller than 16 items
+	// or larger than a 96 KiB write.
+	pageItems := int(min(max(maxMemory/externalItemSize/64, 16), 4096))
+	maxPages := max(int(maxMemory/externalItemSize)/pageItems, minCachedPages)
+
+	return &pagedItems{
+		f:         f,
+		numItems:  numItems,
+		pageItems: pageItems,
+		maxPages:  maxPages,
+		pages:     make(map[int]*list.Element, maxPages),
+		lru:       list.New(),
+	}
+}
+
+func (p *pagedItems) page(num int) *itemsPage {
+	if e, ok := p.pages[num]; ok {
+		p.lru.MoveToFront(e)
+		return e.Value.(*itemsPage)
+	}
+
+	var page *itemsPage
+	if p.lru.Len() >= p.maxPages {
+		// reuse the buffers of the least recently used page
+		e := p.lru.Back()
+		page = e.Value.(*itemsPage)
+		if err := p.writePage(page); err != nil {
+			p.err = err
+			return nil
+		}
+		p.lru.Remove(e)
+		delete(p.pages, page.num)
+	} else {
+		page = &itemsPage{
+			idxs:   make([]int, p.pageItems),
+			coords: make([]float64, 2*p.pageItems),
+		}
+	}
+
+	page.num = num
+	page.dirty = false
+	if err := p.readPage(page); err != nil {
+		p.err = err
+		return nil
+	}
+	p.pages[num] = p.lru.PushFront(page)
+	return page
+}
+
+func (p *pagedItems) readPage(page *itemsPage) error {
+	buf := make([]byte, p.pageItems*externalItemSize)
+	n, err := p.f.ReadAt(buf, int64(page.num)*int64(len(buf)))
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("kdbush: reading items page %d: %w", page.num, err)
+	}
+	// the last page may be partial, its tail is never accessed
+	for i := range n / externalItemSize {
+		item := buf[i*externalItemSize:]
+		page.idxs[i] = int(diskByteOrder.Uint64(item[0:8]))
+		page.coords[2*i] = math.Float64frombits(diskByteOrder.Uint64(item[8:16]))
+		page.coords[2*i+1] = math.Float64frombits(diskByteOrder.Uint64(item[16:24]))
+	}
+	return nil
+}
+
+func (p *pagedItems) writePage(page *itemsPage) error {
+	if !page.dirty {
+		return nil
+	}
+	first := page.num * p.pageItems
+	n := min(p.pageItems, p.numItems-first)
+
+	buf := make([]byte, n*externalItemSize)
+	for i := range n {
+		item := buf[i*externalItemSize:]
+		diskByteOrder.PutUint64(item[0:8], uint64(page.idxs[i]))
+		diskByteOrder.PutUint64(item[8:16], math.Float64bits(page.coords[2*i]))
+		diskByteOrder.PutUint64(item[16:24], math.Float64bits(page.coords[2*i+1]))
+	}
+	if _, err := p.f.WriteAt(buf, int64(first)*externalItemSize); err != nil {
+		return fmt.Errorf("kdbush: writing items page %d: %w", page.num, err)
+	}
+	page.dirty = false
+	return nil
+}
+
+// flush writes all dirty pages and empties the cache.
+func (p *pagedItems) flush() error {
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		if err := p.writePage(e.Value.(*itemsPage)); err != nil {
+			p.err = err
+			return err
+		}
+	}
+	p.lru.Init()
+	clear(p.pages)
+	return nil
+}
+
+func (p *pagedItems) coord(i, axis int) float64 {
+	if p.err != nil {
+		return math.NaN()
+	}
+	page := p.page(i / p.pageItems)
+	if page == nil {
+		return math.NaN()
+	}
+	return page.coords[2*(i%p.pageItems)+axis]
+}
+
+func (p *pagedItems) swap(i, j int) {
+	if p.err != nil {
+		return
+	}
+	pi := p.page(i / p.pageItems)
+	pj := p.page(j / p.pageItems)
+	if pi == nil || pj == nil {
+		return
+	}
+	oi, oj := i%p.pageItems, j%p.pageItems
+
+	pi.idxs[oi], pj.idxs[oj] = pj.idxs[oj], pi.idxs[oi]
+	pi.coords[2*oi], pj.coords[2*oj] = pj.coords[2*oj], pi.coords[2*oi]
+	pi.coords[2*oi+1], pj.coords[2*oj+1] = pj.coords[2*oj+1], pi.coords[2*oi+1]
+	pi.dirty = true
+	pj.dirty = true
+}
@@ -0,0 +1,108 @@
+package kdbush
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func buildExternal(t *testing.T, pts []Point[testData], nodeSize int, maxMemory int64, opts ...BuildOption) []byte {
+	t.Helper()
+
+	b, err := NewExternalBuilder[testData, *testData](nodeSize, maxMemory, t.TempDir(), opts...)
+	if err != nil {
+		t.Fatalf("NewExternalBuilder: %v", err)
+	}
+	defer b.Close()
+
+	for _, p := range pts {
+		if err := b.Add(p); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) || n != b.Size() {
+		t.Fatalf("WriteTo returned %d, wrote %d, Size is %d", n, buf.Len(), b.Size())
+	}
+	return buf.Bytes()
+}
+
+func TestExternal_ByteIdentical(t *testing.T) {
+	pts := generateTestPoints(20_000)
+	// duplicated coordinates exercise the equal-to-pivot branches
+	rng := rand.New(rand.NewSource(7))
+	for i := range 2_000 {
+		src := pts[rng.Intn(len(pts))]
+		pts = append(pts, Point[testData]{X: src.X, Y: src.Y, Data: testData{Value: 20_000 + i}})
+	}
+
+	var want bytes.Buffer
+	if _, err := BuildDisk[testData, *testData](pts, DefaultNodeSize, &want); err != nil {
+		t.Fatalf("BuildDisk: %v", err)
+	}
+
+	for _, maxMemory := range []int64{
+		1 << 30,  // everything in memory
+		64 << 10, // paged top levels, in-memory subtrees
+		1 << 10,  // paged down to the leaves
+	} {
+		got := buildExternal(t, pts, DefaultNodeSize, maxMemory)
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("maxMemory %d: output differs from BuildDisk", maxMemory)
+		}
+	}
+}
+
+func TestExternal_Empty(t *testing.T) {
+	var want bytes.Buffer
+	if _, err := BuildDisk[testData, *testData](nil, DefaultNodeSize, &want); err != nil {
+		t.Fatalf("BuildDisk: %v", err)
+	}
+	if got := buildExternal(t, nil, DefaultNodeSize, 1<<10); !bytes.Equal(got, want.Bytes()) {
+		t.Error("empty output differs from BuildDisk")
+	}
+}
+
+func TestExternal_FixedPoint(t *testing.T) {
+	pts := generateGeoPoints(20_000)
+	// off-grid coordinates are rounded before the external sort
+	for i := range pts[:1_000] {
+		pts[i].X += 3e-8
+		pts[i].Y -= 4e-8
+	}
+
+	var want bytes.Buffer
+	if _, err := BuildDisk[testData, *testData](pts, DefaultNodeSize, &want); err != nil {
+		t.Fatalf("BuildDisk: %v", err)
+	}
+	h, err := ParseDiskHeader(want.Bytes())
+	if err != nil || h.CoordSize != 4 {
+		t.Fatalf("BuildDisk header %+v %v, want fixed-point coordinates", h, err)
+	}
+	for _, maxMemory := range []int64{1 << 30, 1 << 10} {
+		if got := buildExternal(t, pts, DefaultNodeSize, maxMemory); !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("maxMemory %d: output differs from BuildDisk", maxMemory)
+		}
+	}
+}
+
+func TestExternal_Threads(t *testing.T) {
+	pts := generateTestPoints(3 * parallelSortMin)
+
+	var want bytes.Buffer
+	if _, err := BuildDisk[testData, *testData](pts, DefaultNodeSize, &want); err != nil {
+		t.Fatalf("BuildDisk: %v", err)
+	}
+	if got := buildExternal(t, pts, DefaultNodeSize, 1<<30, WithThreads(4)); !bytes.Equal(got, want.Bytes()) {
+		t.Error("parallel in-memory sort differs from BuildDisk")
+	}
+
+	if _, err := NewExternalBuilder[testData, *testData](DefaultNodeSize, 1<<20, t.TempDir(), WithLayout(LayoutBlocked)); err == nil {
+		t.Error("expected an error for the blocked layout")
+	}
+}
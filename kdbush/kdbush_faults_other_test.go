@@ -0,0 +1,6 @@
+//go:build !unix
+
+package kdbush
+
+// pageFaults is not available on this platform.
+func pageFaults() (int64, bool) { return 0, false }
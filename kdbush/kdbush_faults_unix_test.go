@@ -0,0 +1,14 @@
+//go:build unix
+
+package kdbush
+
+import "syscall"
+
+// pageFaults returns the page faults of the process so far.
+func pageFaults() (int64, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return int64(ru.Minflt + ru.Majflt), true
+}
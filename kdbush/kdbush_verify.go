@@ -0,0 +1,272 @@
+package kdbush
+
+import (
+	"fmt"
+	"math"
+)
+
+// ---------------------------------------------------------------------------
+// Verify — check the structure of an on-disk index
+// ---------------------------------------------------------------------------
+
+// Verify checks the structure of the index, size is the number of bytes of
+// the KDBH block available in the reader.  It checks the section sizes
+// against size, that the data offsets are monotonic and within the blobs,
+// that every point lies in the partition of its node and that the sorted
+// indices are a permutation of the points.  In the blocked layout it also
+// checks the placement of the leaf blocks and their inline payloads.
+//
+// Verify reads the whole tree section, payloads are not unmarshaled.
+func (d *DiskKDBush[V, VP]) Verify(size int64) error {
+	base := d.idxsOffset - DiskHeaderSize
+	// negative counts and node sizes are rejected when the header is parsed,
+	// the point count is checked first, so the sizes below can't overflow
+	if int64(d.numPoints) > size/int64(d.idxSize+2*d.coordSize) {
+		return fmt.Errorf("kdbush: %d points don't fit a %d bytes block", d.numPoints, size)
+	}
+	if end := d.dataBlobsOff - base; end > size {
+		return fmt.Errorf("kdbush: tree and data offsets end at %d past the end of the block at %d", end, size)
+	}
+
+	offsets, err := d.verifyDataOffsets(size - (d.dataBlobsOff - base))
+	if err != nil {
+		return err
+	}
+
+	v := &treeVerifier{seen: make([]uint64, (d.numPoints+63)/64), offsets: offsets}
+	if d.blocked {
+		err = d.verifyBlocked(v)
+	} else {
+		err = d.verifyFlat(v)
+	}
+	if err != nil {
+		return err
+	}
+	if v.count != d.numPoints {
+		return fmt.Errorf("kdbush: tree holds %d points, header says %d", v.count, d.numPoints)
+	}
+	return nil
+}
+
+// verifyDataOffsets reads the data offset table and checks it against the
+// size of the blobs.
+func (d *DiskKDBush[V, VP]) verifyDataOffsets(blobsSize int64) ([]int64, error) {
+	offsets := make([]int64, d.numPoints+1)
+	const chunk = 4096 // offsets per read
+	buf := make([]byte, chunk*8)
+	for left := 0; left < len(offsets); left += chunk {
+		count := min(chunk, len(offsets)-left)
+		b := buf[:count*8]
+		if _, err := d.r.ReadAt(b, d.dataOffsetsOff+int64(left)*8); err != nil {
+			return nil, fmt.Errorf("kdbush: reading data offsets[%d:%d]: %w", left, left+count-1, err)
+		}
+		for i := range count {
+			offsets[left+i] = int64(diskByteOrder.Uint64(b[i*8:]))
+		}
+	}
+
+	if offsets[0] != 0 {
+		return nil, fmt.Errorf("kdbush: data offsets start at %d, want 0", offsets[0])
+	}
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			return nil, fmt.Errorf("kdbush: data offset[%d] = %d is before offset[%d] = %d", i, offsets[i], i-1, offsets[i-1])
+		}
+	}
+	if end := offsets[d.numPoints]; end > blobsSize {
+		return nil, fmt.Errorf("kdbush: data blobs end at %d past the end of the block, %d bytes left", end, blobsSize)
+	}
+	return offsets, nil
+}
+
+// treeVerifier collects the points visited while checking the tree.
+type treeVerifier struct {
+	seen    []uint64 // bitset of the visited original indices
+	count   int
+	offsets []int64
+}
+
+// partition is the area of a node: the splits of its ancestors.
+type partition struct {
+	minX, minY, maxX, maxY float64
+}
+
+var wholePlane = partition{math.Inf(-1), math.Inf(-1), math.Inf(1), math.Inf(1)}
+
+// split returns the partitions of the children of a node splitting axis at (x, y).
+func (p partition) split(axis int, x, y float64) (left, right partition) {
+	left, right = p, p
+	if axis == 0 {
+		left.maxX, right.minX = x, x
+	} else {
+		left.maxY, right.minY = y, y
+	}
+	return left, right
+}
+
+// point checks a point of sorted position i and marks its index as seen.
+func (v *treeVerifier) point(p partition, i, idx int, x, y float64) error {
+	if !(x >= p.minX && x <= p.maxX && y >= p.minY && y <= p.maxY) {
+		return fmt.Errorf("kdbush: point %d at sorted position %d (%v, %v) is outside its partition [%v, %v]×[%v, %v]",
+			idx, i, x, y, p.minX, p.maxX, p.minY, p.maxY)
+	}
+	if idx < 0 || idx >= len(v.offsets)-1 {
+		return fmt.Errorf("kdbush: point index %d at sorted position %d out of range [0, %d)", idx, i, len(v.offsets)-1)
+	}
+	if v.seen[idx/64]&(1<<(idx%64)) != 0 {
+		return fmt.Errorf("kdbush: point index %d appears twice in the tree", idx)
+	}
+	v.seen[idx/64] |= 1 << (idx % 64)
+	v.count++
+	return nil
+}
+
+// verifyNode is a node of the tree traversal: sorted positions [left, right].
+type verifyNode struct {
+	left, right, axis int
+	slot              int64
+	partition
+}
+
+func (d *DiskKDBush[V, VP]) verifyFlat(v *treeVerifier) error {
+	if d.numPoints == 0 {
+		return nil
+	}
+	stack := []verifyNode{{left: 0, right: d.numPoints - 1, partition: wholePlane}}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.left > n.right {
+			continue
+		}
+
+		if n.right-n.left <= d.nodeSize {
+			idxs, coords, err := d.readLeaf(n.left, n.right)
+			if err != nil {
+				return err
+			}
+			for i, idx := range idxs {
+				if err := v.point(n.partition, n.left+i, idx, coords[2*i], coords[2*i+1]); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		m := floor(float64(n.left+n.right) / 2.0)
+		x, y, err := d.readCoord(m)
+		if err != nil {
+			return err
+		}
+		idx, err := d.readIdx(m)
+		if err != nil {
+			return err
+		}
+		if err := v.point(n.partition, m, idx, x, y); err != nil {
+			return err
+		}
+		left, right := n.partition.split(n.axis, x, y)
+		nextAxis := (n.axis + 1) % 2
+		stack = append(stack,
+			verifyNode{left: m + 1, right: n.right, axis: nextAxis, partition: right},
+			verifyNode{left: n.left, right: m - 1, axis: nextAxis, partition: left},
+		)
+	}
+	return nil
+}
+
+func (d *DiskKDBush[V, VP]) verifyBlocked(v *treeVerifier) error {
+	if d.numPoints == 0 {
+		return nil
+	}
+	rec := d.idxSize + 2*d.coordSize
+	blocksSize := d.dataOffsetsOff - d.blocksOffset
+	var blocksEnd int64 // end of the previous leaf block, leaves are visited in sorted order
+
+	var slotBuf [24]byte
+	var block []byte
+	stack := []verifyNode{{left: 0, right: d.numPoints - 1, partition: wholePlane}}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.left > n.right {
+			continue
+		}
+
+		buf := slotBuf[:rec]
+		if _, err := d.r.ReadAt(buf, d.idxsOffset+n.slot*int64(rec)); err != nil {
+			return fmt.Errorf("kdbush: reading node slot[%d]: %w", n.slot, err)
+		}
+
+		if n.right-n.left <= d.nodeSize {
+			count := n.right - n.left + 1
+			off := int64(diskByteOrder.Uint64(buf[0:8]))
+			size := int64(diskByteOrder.Uint32(buf[8:12]))
+			switch {
+			case off < blocksEnd:
+				return fmt.Errorf("kdbush: leaf block[%d:%d] at %d overlaps the previous block ending at %d", n.left, n.right, off, blocksEnd)
+			case off+size > blocksSize:
+				return fmt.Errorf("kdbush: leaf block[%d:%d] ends at %d past the leaf blocks at %d", n.left, n.right, off+size, blocksSize)
+			case size < int64(count*(rec+2)):
+				return fmt.Errorf("kdbush: leaf block[%d:%d] is %d bytes, too small for %d points", n.left, n.right, size, count)
+			case off%blockPageSize != 0 && off/blockPageSize != (off+size-1)/blockPageSize:
+				return fmt.Errorf("kdbush: leaf block[%d:%d] at %d crosses a page boundary", n.left, n.right, off)
+			}
+			blocksEnd = off + size
+
+			if cap(block) < int(size) {
+				block = make([]byte, size)
+			}
+			block = block[:size]
+			if _, err := d.r.ReadAt(block, d.blocksOffset+off); err != nil {
+				return fmt.Errorf("kdbush: reading leaf block[%d:%d]: %w", n.left, n.right, err)
+			}
+			if err := d.verifyBlock(v, n, block); err != nil {
+				return err
+			}
+			continue
+		}
+
+		m := floor(float64(n.left+n.right) / 2.0)
+		x := d.decodeCoord(buf[d.idxSize:])
+		y := d.decodeCoord(buf[d.idxSize+d.coordSize:])
+		if err := v.point(n.partition, m, d.decodeIdx(buf), x, y); err != nil {
+			return err
+		}
+		left, right := n.partition.split(n.axis, x, y)
+		nextAxis := (n.axis + 1) % 2
+		stack = append(stack,
+			verifyNode{left: m + 1, right: n.right, axis: nextAxis, slot: 2*n.slot + 2, partition: right},
+			verifyNode{left: n.left, right: m - 1, axis: nextAxis, slot: 2*n.slot + 1, partition: left},
+		)
+	}
+	return nil
+}
+
+// verifyBlock checks the points of a leaf block and their inline payloads.
+func (d *DiskKDBush[V, VP]) verifyBlock(v *treeVerifier, n verifyNode, block []byte) error {
+	count := n.right - n.left + 1
+	coordsOff := count * d.idxSize
+	lensOff := coordsOff + count*2*d.coordSize
+	payloadOff := lensOff + count*2
+	for j := range count {
+		idx := d.decodeIdx(block[j*d.idxSize:])
+		c := coordsOff + j*2*d.coordSize
+		if err := v.point(n.partition, n.left+j, idx, d.decodeCoord(block[c:]), d.decodeCoord(block[c+d.coordSize:])); err != nil {
+			return err
+		}
+
+		payloadLen := int(diskByteOrder.Uint16(block[lensOff+j*2:]))
+		if payloadLen == blockNotInlined {
+			continue
+		}
+		if blobLen := v.offsets[idx+1] - v.offsets[idx]; int64(payloadLen) != blobLen {
+			return fmt.Errorf("kdbush: inline payload of point %d is %d bytes, its data blob %d", idx, payloadLen, blobLen)
+		}
+		payloadOff += payloadLen
+	}
+	if payloadOff != len(block) {
+		return fmt.Errorf("kdbush: leaf block[%d:%d] is %d bytes, its points take %d", n.left, n.right, len(block), payloadOff)
+	}
+	return nil
+}
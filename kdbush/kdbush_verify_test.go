@@ -0,0 +1,119 @@
+package kdbush
+
+import (
+	"bytes"
+	"encoding"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func buildBytes[V encoding.BinaryMarshaler, VP binaryPointer[V]](t *testing.T, pts []Point[V], opts ...BuildOption) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := BuildDisk[V, VP](pts, 16, &buf, opts...); err != nil {
+		t.Fatalf("BuildDisk: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func verifyBytes(t *testing.T, b []byte) error {
+	t.Helper()
+	disk, err := OpenDiskReaderAt[testData, *testData](Bytes(b), 0)
+	if err != nil {
+		t.Fatalf("OpenDiskReaderAt: %v", err)
+	}
+	return disk.Verify(int64(len(b)))
+}
+
+func TestDisk_Verify(t *testing.T) {
+	for _, layout := range []DiskLayout{LayoutFlat, LayoutBlocked} {
+		for name, pts := range map[string][]Point[testData]{
+			"fixed-point": generateGeoPoints(5_000),
+			"float64":     generateTestPoints(5_000),
+			"single leaf": generateGeoPoints(10),
+			"empty":       nil,
+		} {
+			if err := verifyBytes(t, buildBytes[testData](t, pts, WithLayout(layout))); err != nil {
+				t.Errorf("layout %d, %s: %v", layout, name, err)
+			}
+		}
+	}
+
+	// payloads larger than blockInlineMax aren't inlined
+	rng := rand.New(rand.NewSource(1))
+	pts := make([]Point[blobData], 2_000)
+	for i := range pts {
+		pts[i] = Point[blobData]{X: rng.Float64(), Y: rng.Float64(), Data: make(blobData, rng.Intn(200))}
+	}
+	b := buildBytes[blobData](t, pts, WithLayout(LayoutBlocked))
+	disk, err := OpenDiskReaderAt[blobData, *blobData](Bytes(b), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := disk.Verify(int64(len(b))); err != nil {
+		t.Errorf("blocked with large payloads: %v", err)
+	}
+}
+
+func TestDisk_VerifyCorrupted(t *testing.T) {
+	const n = 5_000
+	flat := buildBytes[testData](t, generateGeoPoints(n))
+	header, err := ParseDiskHeader(flat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idxsOff := DiskHeaderSize
+	coordsOff := idxsOff + n*header.IdxSize
+	offsetsOff := DiskHeaderSize + int(header.TreeSize())
+
+	for _, tc := range []struct {
+		name    string
+		corrupt func(b []byte) []byte
+		want    string
+	}{
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }, "past the end of the block"},
+		{"truncated offsets", func(b []byte) []byte { return b[:offsetsOff+8] }, "past the end of the block"},
+		{"unsorted", func(b []byte) []byte {
+			// the first sorted point belongs to the leftmost leaf
+			copy(b[coordsOff:], []byte{0xff, 0xff, 0xff, 0x7f})
+			return b
+		}, "outside its partition"},
+		{"duplicate index", func(b []byte) []byte {
+			copy(b[idxsOff+header.IdxSize:], b[idxsOff:idxsOff+header.IdxSize])
+			return b
+		}, "appears twice"},
+		{"index out of range", func(b []byte) []byte {
+			copy(b[idxsOff:], []byte{0xff, 0xff, 0xff, 0x7f})
+			return b
+		}, "out of range"},
+		{"data offsets", func(b []byte) []byte {
+			b[offsetsOff+8+7] = 0x7f
+			return b
+		}, "data offset[2]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyBytes(t, tc.corrupt(bytes.Clone(flat)))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Verify = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	blocked := buildBytes[testData](t, generateGeoPoints(n), WithLayout(LayoutBlocked))
+	bh, err := ParseDiskHeader(blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// point the first leaf block past the leaf blocks
+	var slot int64
+	for left, right := 0, n-1; right-left > bh.NodeSize; slot = 2*slot + 1 {
+		right = floor(float64(left+right)/2.0) - 1
+	}
+	b := bytes.Clone(blocked)
+	s := b[DiskHeaderSize+slot*int64(bh.recordSize()):]
+	diskByteOrder.PutUint64(s, uint64(bh.blockPages)*blockPageSize)
+	if err := verifyBytes(t, b); err == nil || !strings.Contains(err.Error(), "past the leaf blocks") {
+		t.Errorf("Verify of misplaced leaf block = %v", err)
+	}
+}
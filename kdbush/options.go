@@ -0,0 +1,50 @@
+package kdbush
+
+type buildOptions struct {
+	layout  DiskLayout
+	threads int
+}
+
+func loadBuildOptions(opts ...BuildOption) buildOptions {
+	options := buildOptions{
+		threads: 1,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	return options
+}
+
+// BuildOption configures [NewBush], [BuildDisk] and [NewExternalBuilder].
+type BuildOption interface {
+	apply(*buildOptions)
+}
+
+type layoutOption DiskLayout
+
+func (l layoutOption) apply(o *buildOptions) {
+	o.layout = DiskLayout(l)
+}
+
+// WithLayout sets the layout of the tree section written by [BuildDisk].
+// [NewBush] ignores it, [NewExternalBuilder] supports only LayoutFlat.
+//
+// Default: LayoutFlat
+func WithLayout(layout DiskLayout) BuildOption {
+	return layoutOption(layout)
+}
+
+type threadsOption int
+
+func (t threadsOption) apply(o *buildOptions) {
+	o.threads = max(int(t), 1)
+}
+
+// WithThreads sets the number of goroutines sorting the tree.  The tree is
+// the same for any number of threads, only subtrees of 64K points and more
+// are handed to other goroutines.
+//
+// Default: 1
+func WithThreads(threads int) BuildOption {
+	return threadsOption(threads)
+}
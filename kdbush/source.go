@@ -0,0 +1,71 @@
+package kdbush
+
+import (
+	"io"
+
+	"golang.org/x/exp/mmap"
+)
+
+// ---------------------------------------------------------------------------
+// Storage backends of DiskKDBush
+// ---------------------------------------------------------------------------
+
+// Bytes is an [io.ReaderAt] over an index held in memory, e.g. embedded in
+// the binary or downloaded as a whole.  [OpenDiskReaderAt] reads it directly,
+// the slice is neither copied nor modified and must stay valid while the
+// index is used.
+type Bytes []byte
+
+// ReadAt implements [io.ReaderAt].
+func (b Bytes) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// source dispatches reads to the concrete backend.  The memory map and byte
+// slice paths avoid an interface call, so read buffers of the callers stay
+// on the stack; other readers get a heap copy.
+type source struct {
+	mm *mmap.ReaderAt
+	b  Bytes
+	ra io.ReaderAt
+}
+
+func newSource(r io.ReaderAt) source {
+	switch r := r.(type) {
+	case *mmap.ReaderAt:
+		return source{mm: r}
+	case Bytes:
+		return source{b: r}
+	default:
+		return source{ra: r}
+	}
+}
+
+func (s *source) ReadAt(p []byte, off int64) (int, error) {
+	switch {
+	case s.mm != nil:
+		return s.mm.ReadAt(p, off)
+	case s.ra == nil:
+		return s.b.ReadAt(p, off)
+	default:
+		return s.readAtInterface(p, off)
+	}
+}
+
+// readAtInterface keeps p from escaping through the interface call.
+func (s *source) readAtInterface(p []byte, off int64) (int, error) {
+	buf := make([]byte, len(p))
+	n, err := s.ra.ReadAt(buf, off)
+	copy(p, buf[:n])
+	return n, err
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+// User values set by handlers for the access log.
+const (
+	accessLogPoints  = "access_log_points"
+	accessLogResults = "access_log_results"
+)
+
+// accessLog logs requests through the slog fanout of setupTelemetry.
+type accessLog struct {
+	log *slog.Logger
+	// sampleRate is the share of ordinary requests logged, from 0 to 1.
+	sampleRate float64
+	// slow requests are always logged, zero disables the threshold.
+	slow time.Duration
+	// precision is the number of decimals coordinates are rounded to,
+	// negative drops coordinates from the log.
+	precision int
+}
+
+// middleware wraps the router handler, the router must save matched route paths.
+func (a *accessLog) middleware(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		h(ctx)
+		latency := time.Since(start)
+
+		status := ctx.Response.StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case a.slow > 0 && latency >= a.slow:
+			level = slog.LevelWarn
+		case a.sampleRate <= 0 || rand.Float64() >= a.sampleRate:
+			return
+		}
+
+		// the route template is logged instead of the path, paths carry
+		// coordinates and query strings may carry api keys
+		route, _ := ctx.UserValue(router.MatchedRoutePathParam).(string)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", string(ctx.Method())),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("latency", latency),
+		}
+		if points, ok := ctx.UserValue(accessLogPoints).(int); ok {
+			results, _ := ctx.UserValue(accessLogResults).(int)
+			attrs = append(attrs,
+				slog.Int("points", points),
+				slog.Int("results", results),
+				slog.Int("no_results", points-results),
+			)
+		}
+		if a.precision >= 0 {
+			lat, latOK := ctx.UserValue("lat").(string)
+			lon, lonOK := ctx.UserValue("lon").(string)
+			if latOK && lonOK {
+				attrs = append(attrs,
+					slog.String("lat", a.round(lat)),
+					slog.String("lon", a.round(lon)),
+				)
+			}
+		}
+		if bucket, ok := ctx.UserValue(apiKeyUserValue).(*keyBucket); ok {
+			attrs = append(attrs, slog.String("api_key", bucket.Name))
+		}
+
+		a.log.LogAttrs(context.Background(), level, "request", attrs...)
+	}
+}
+
+// round rounds a coordinate from the path, invalid values are not logged.
+func (a *accessLog) round(coord string) string {
+	v, err := strconv.ParseFloat(coord, 64)
+	if err != nil {
+		return "invalid"
+	}
+	scale := math.Pow(10, float64(a.precision))
+	return strconv.FormatFloat(math.Round(v*scale)/scale, 'f', a.precision, 64)
+}
+
+// setResultCounts records the batch size and the number of found addresses for the access log.
+func setResultCounts(ctx *fasthttp.RequestCtx, points, results int) {
+	ctx.SetUserValue(accessLogPoints, points)
+	ctx.SetUserValue(accessLogResults, results)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAccessLog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	a := &accessLog{
+		log:        slog.New(slog.NewTextHandler(buf, nil)),
+		slow:       50 * time.Millisecond,
+		precision:  2,
+		sampleRate: 0,
+	}
+
+	r := router.New()
+	r.SaveMatchedRoutePath = true
+	r.GET("/rgeocode/address/{lat}/{lon}", func(ctx *fasthttp.RequestCtx) {
+		if ctx.QueryArgs().Has("slow") {
+			time.Sleep(60 * time.Millisecond)
+		}
+		setResultCounts(ctx, 1, 0)
+		ctx.Response.SetStatusCode(http.StatusOK)
+	})
+	r.GET("/fail", func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.SetStatusCode(http.StatusInternalServerError)
+	})
+	handler := a.middleware(r.Handler)
+
+	request := func(uri string) string {
+		buf.Reset()
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI(uri)
+		handler(ctx)
+		return buf.String()
+	}
+
+	if line := request("/rgeocode/address/55.123456/37.654321"); line != "" {
+		t.Errorf("unsampled request was logged: %s", line)
+	}
+
+	line := request("/rgeocode/address/55.123456/37.654321?slow")
+	for _, want := range []string{
+		"level=WARN",
+		"route=/rgeocode/address/{lat}/{lon}",
+		"status=200",
+		"points=1", "results=0", "no_results=1",
+		"lat=55.12", "lon=37.65",
+	} {
+		if !strings.Contains(line, want) {
+			t.Errorf("slow request log %q lacks %q", line, want)
+		}
+	}
+	if strings.Contains(line, "55.123456") {
+		t.Errorf("coordinates are not rounded: %s", line)
+	}
+
+	if line := request("/fail"); !strings.Contains(line, "level=ERROR") {
+		t.Errorf("server error was not logged: %q", line)
+	}
+
+	a.sampleRate = 1
+	a.precision = -1
+	line = request("/rgeocode/address/55.123456/37.654321")
+	if !strings.Contains(line, "level=INFO") || strings.Contains(line, "lat=") {
+		t.Errorf("sampled request log %q", line)
+	}
+}
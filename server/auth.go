@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"gopkg.in/yaml.v3"
+)
+
+// API keys are accepted in this header or query parameter.
+const (
+	APIKeyHeader = "X-API-Key"
+	APIKeyParam  = "api_key"
+)
+
+// APIKey is a client credential with a token-bucket quota counted in points,
+// a multiaddress request of 100 coordinates costs 100 points.
+type APIKey struct {
+	// Name identifies the client in metrics and logs, the key itself is never exported.
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// Rate is the number of points per second added to the bucket.
+	Rate float64 `yaml:"rate"`
+	// Burst is the bucket size, the largest batch a client can send at once.
+	Burst float64 `yaml:"burst"`
+}
+
+// APIKeys is the root of an API keys file.
+type APIKeys struct {
+	Keys []APIKey `yaml:"keys"`
+}
+
+// LoadAPIKeys reads a YAML keys file, keys without a quota get the given defaults.
+func LoadAPIKeys(path string, rate, burst float64) ([]APIKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening api keys file: %w", err)
+	}
+	defer f.Close()
+	return ParseAPIKeys(f, rate, burst)
+}
+
+// ParseAPIKeys reads API keys in YAML, keys without a quota get the given defaults.
+func ParseAPIKeys(r io.Reader, rate, burst float64) ([]APIKey, error) {
+	var file APIKeys
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error parsing api keys: %w", err)
+	}
+	for i := range file.Keys {
+		if file.Keys[i].Rate == 0 {
+			file.Keys[i].Rate = rate
+		}
+		if file.Keys[i].Burst == 0 {
+			file.Keys[i].Burst = burst
+		}
+	}
+	return file.Keys, validateAPIKeys(file.Keys)
+}
+
+// ParseAPIKeyList parses comma separated name:key pairs, as set in an environment variable.
+func ParseAPIKeyList(list string, rate, burst float64) ([]APIKey, error) {
+	var keys []APIKey
+	for entry := range strings.SplitSeq(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid api key entry %q, expected name:key", entry)
+		}
+		keys = append(keys, APIKey{Name: name, Key: key, Rate: rate, Burst: burst})
+	}
+	return keys, validateAPIKeys(keys)
+}
+
+func validateAPIKeys(keys []APIKey) error {
+	names := map[string]bool{}
+	values := map[string]bool{}
+	for _, k := range keys {
+		switch {
+		case k.Name == "":
+			return errors.New("api key without a name")
+		case k.Key == "":
+			return fmt.Errorf("api key %q is empty", k.Name)
+		case names[k.Name]:
+			return fmt.Errorf("duplicate api key name %q", k.Name)
+		case values[k.Key]:
+			return fmt.Errorf("api key %q reuses the key of another client", k.Name)
+		case k.Rate <= 0 || k.Burst <= 0:
+			return fmt.Errorf("api key %q must have a positive rate and burst", k.Name)
+		}
+		names[k.Name] = true
+		values[k.Key] = true
+	}
+	return nil
+}
+
+// keyAuth authenticates requests and applies per-key quotas.
+type keyAuth struct {
+	keys map[string]*keyBucket
+
+	metricPoints   metric.Int64Counter
+	metricRejected metric.Int64Counter
+}
+
+// keyBucket is the token bucket of a single key.
+type keyBucket struct {
+	APIKey
+	attrs metric.MeasurementOption
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+const apiKeyUserValue = "api_key"
+
+func newKeyAuth(keys []APIKey) (*keyAuth, error) {
+	if err := validateAPIKeys(keys); err != nil {
+		return nil, err
+	}
+
+	metricPoints, err := meter.Int64Counter("api_key_points_total",
+		metric.WithDescription("points requested with an api key"))
+	if err != nil {
+		return nil, err
+	}
+	metricRejected, err := meter.Int64Counter("api_key_rejected_total",
+		metric.WithDescription("requests of an api key rejected by the rate limit"))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &keyAuth{
+		keys:           make(map[string]*keyBucket, len(keys)),
+		metricPoints:   metricPoints,
+		metricRejected: metricRejected,
+	}
+	now := time.Now()
+	for _, k := range keys {
+		a.keys[k.Key] = &keyBucket{
+			APIKey: k,
+			attrs:  metric.WithAttributeSet(attribute.NewSet(attribute.String("key", k.Name))),
+			tokens: k.Burst,
+			last:   now,
+		}
+	}
+	return a, nil
+}
+
+// authenticate answers 401 to requests without a known key.
+func (a *keyAuth) authenticate(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		key := ctx.Request.Header.Peek(APIKeyHeader)
+		if len(key) == 0 {
+			key = ctx.QueryArgs().Peek(APIKeyParam)
+		}
+		bucket, ok := a.keys[string(key)]
+		if !ok {
+			ctx.Response.SetStatusCode(http.StatusUnauthorized)
+			ctx.Response.SetBodyString("missing or unknown api key")
+			return
+		}
+		ctx.SetUserValue(apiKeyUserValue, bucket)
+		h(ctx)
+	}
+}
+
+// charge takes points from the bucket of the request key, on failure the
+// response is written and false is returned.
+func (s *server) charge(ctx *fasthttp.RequestCtx, points int) bool {
+	bucket, ok := ctx.UserValue(apiKeyUserValue).(*keyBucket)
+	if !ok {
+		return true // authentication is disabled
+	}
+
+	if float64(points) > bucket.Burst {
+		s.auth.metricRejected.Add(ctx, 1, bucket.attrs)
+		ctx.Response.SetStatusCode(http.StatusRequestEntityTooLarge)
+		ctx.Response.SetBodyString(fmt.Sprintf("request of %d points exceeds the burst of the api key (%.0f points)", points, bucket.Burst))
+		return false
+	}
+
+	wait := bucket.take(float64(points), time.Now())
+	if wait > 0 {
+		s.auth.metricRejected.Add(ctx, 1, bucket.attrs)
+		ctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		ctx.Response.SetStatusCode(http.StatusTooManyRequests)
+		ctx.Response.SetBodyString("rate limit exceeded")
+		return false
+	}
+
+	s.auth.metricPoints.Add(ctx, int64(points), bucket.attrs)
+	return true
+}
+
+// take removes n tokens, if there are not enough nothing is taken and the
+// time until they are available is returned.
+func (b *keyBucket) take(n float64, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.Burst, b.tokens+now.Sub(b.last).Seconds()*b.Rate)
+	b.last = now
+
+	if b.tokens >= n {
+		b.tokens -= n
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.Rate * float64(time.Second))
+}
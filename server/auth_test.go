@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys(strings.NewReader(`
+keys:
+  - name: partner
+    key: secret
+    rate: 5
+  - name: internal
+    key: other
+`), 100, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIKey{
+		{Name: "partner", Key: "secret", Rate: 5, Burst: 1000},
+		{Name: "internal", Key: "other", Rate: 100, Burst: 1000},
+	}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("ParseAPIKeys = %+v, want %+v", keys, want)
+	}
+
+	keys, err = ParseAPIKeyList("a:1, b:2", 10, 20)
+	if err != nil || len(keys) != 2 || keys[1] != (APIKey{Name: "b", Key: "2", Rate: 10, Burst: 20}) {
+		t.Errorf("ParseAPIKeyList = %+v %v", keys, err)
+	}
+
+	for _, bad := range []string{"a", "a:1,a:2", "a:1,b:1", ":1"} {
+		if _, err := ParseAPIKeyList(bad, 10, 20); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	auth, err := newKeyAuth([]APIKey{{Name: "partner", Key: "secret", Rate: 1, Burst: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{auth: auth}
+	handler := auth.authenticate(func(ctx *fasthttp.RequestCtx) {
+		if !s.charge(ctx, len(ctx.Request.Body())) {
+			return
+		}
+		ctx.Response.SetStatusCode(http.StatusOK)
+	})
+
+	request := func(key, body string) *fasthttp.RequestCtx {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/rgeocode/multiaddress")
+		if key != "" {
+			ctx.Request.Header.Set(APIKeyHeader, key)
+		}
+		ctx.Request.SetBodyString(body)
+		handler(ctx)
+		return ctx
+	}
+
+	if ctx := request("", "x"); ctx.Response.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("without a key: status %d", ctx.Response.StatusCode())
+	}
+	if ctx := request("wrong", "x"); ctx.Response.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d", ctx.Response.StatusCode())
+	}
+
+	// query parameter works too
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/rgeocode/multiaddress?api_key=secret")
+	ctx.Request.SetBodyString("x")
+	handler(ctx)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("key in query: status %d", ctx.Response.StatusCode())
+	}
+
+	if ctx := request("secret", "xx"); ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("within burst: status %d", ctx.Response.StatusCode())
+	}
+	ctx = request("secret", "xx")
+	if ctx.Response.StatusCode() != http.StatusTooManyRequests {
+		t.Fatalf("over quota: status %d", ctx.Response.StatusCode())
+	}
+	if got := string(ctx.Response.Header.Peek(fasthttp.HeaderRetryAfter)); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if ctx := request("secret", "xxxx"); ctx.Response.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("over burst: status %d", ctx.Response.StatusCode())
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := &keyBucket{APIKey: APIKey{Rate: 10, Burst: 10}, tokens: 10, last: now}
+	if wait := b.take(10, now); wait != 0 {
+		t.Errorf("full bucket: wait %v", wait)
+	}
+	if wait := b.take(5, now); wait != 500*time.Millisecond {
+		t.Errorf("empty bucket: wait %v, want 500ms", wait)
+	}
+	if wait := b.take(5, now.Add(500*time.Millisecond)); wait != 0 {
+		t.Errorf("refilled bucket: wait %v", wait)
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/royalcat/rgeocache/geocoder"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// responseCache is a sharded LRU of answers in front of the geocoder.
+//
+// Coordinates are snapped to a grid and the answer is computed for the grid
+// node, so every query falling to the same node gets the same answer.
+type responseCache struct {
+	grid   float64
+	ttl    time.Duration
+	shards []cacheShard
+	// generation is incremented by every purge, answers looked up across a
+	// purge are computed from the old data and are not stored
+	generation atomic.Uint64
+
+	metricHits   metric.Int64Counter
+	metricMisses metric.Int64Counter
+}
+
+type cacheKey struct {
+	lat, lon int64
+	query    geocoder.Query
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	info    geocoder.InfoModel
+	ok      bool
+	expires time.Time
+}
+
+type cacheShard struct {
+	mu      sync.Mutex
+	items   map[cacheKey]*list.Element
+	lru     *list.List // front is the most recently used *cacheEntry
+	maxSize int
+}
+
+func newResponseCache(size int, grid float64, ttl time.Duration) (*responseCache, error) {
+	if grid <= 0 {
+		return nil, fmt.Errorf("response cache grid must be positive, got %v", grid)
+	}
+
+	metricHits, err := meter.Int64Counter("response_cache_hit_total")
+	if err != nil {
+		return nil, err
+	}
+	metricMisses, err := meter.Int64Counter("response_cache_miss_total")
+	if err != nil {
+		return nil, err
+	}
+
+	// power of two shards, so the shard is picked by a mask
+	numShards := 1
+	for numShards < 4*runtime.GOMAXPROCS(0) && numShards*2 <= size {
+		numShards *= 2
+	}
+
+	c := &responseCache{
+		grid:         grid,
+		ttl:          ttl,
+		shards:       make([]cacheShard, numShards),
+		metricHits:   metricHits,
+		metricMisses: metricMisses,
+	}
+	for i := range c.shards {
+		c.shards[i] = cacheShard{
+			items:   map[cacheKey]*list.Element{},
+			lru:     list.New(),
+			maxSize: max(1, size/numShards),
+		}
+	}
+	return c, nil
+}
+
+// find returns the cached answer for the grid node of the point, calling
+// lookup with the node coordinates on a miss.
+func (c *responseCache) find(ctx context.Context, lat, lon float64, q geocoder.Query, lookup func(ctx context.Context, lat, lon float64, q geocoder.Query) (geocoder.InfoModel, bool)) (geocoder.InfoModel, bool) {
+	key := cacheKey{
+		lat:   int64(math.Round(lat / c.grid)),
+		lon:   int64(math.Round(lon / c.grid)),
+		query: q,
+	}
+	shard := &c.shards[key.hash()&uint64(len(c.shards)-1)]
+
+	now := time.Now()
+	if entry, ok := shard.get(key, now); ok {
+		c.metricHits.Add(ctx, 1)
+		return entry.info, entry.ok
+	}
+	c.metricMisses.Add(ctx, 1)
+
+	gen := c.generation.Load()
+	info, ok := lookup(ctx, float64(key.lat)*c.grid, float64(key.lon)*c.grid, q)
+
+	entry := &cacheEntry{key: key, info: info, ok: ok}
+	if c.ttl > 0 {
+		entry.expires = now.Add(c.ttl)
+	}
+	shard.put(entry, gen, &c.generation)
+	return info, ok
+}
+
+// purge drops all answers, it's called when the served data changes.
+func (c *responseCache) purge() {
+	// incremented before clearing, a put checking it after the clear skips
+	c.generation.Add(1)
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		clear(shard.items)
+		shard.lru.Init()
+		shard.mu.Unlock()
+	}
+}
+
+func (k cacheKey) hash() uint64 {
+	h := uint64(k.lat)*0x9E3779B97F4A7C15 ^ uint64(k.lon)*0xC2B2AE3D27D4EB4F
+	return h ^ h>>29
+}
+
+func (s *cacheShard) get(key cacheKey, now time.Time) (*cacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		s.lru.Remove(e)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return entry, true
+}
+
+// put stores the entry unless the cache was purged since gen was read from
+// generation.
+func (s *cacheShard) put(entry *cacheEntry, gen uint64, generation *atomic.Uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation.Load() != gen {
+		return
+	}
+
+	if e, ok := s.items[entry.key]; ok {
+		e.Value = entry
+		s.lru.MoveToFront(e)
+		return
+	}
+	if s.lru.Len() >= s.maxSize {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.items, oldest.Value.(*cacheEntry).key)
+	}
+	s.items[entry.key] = s.lru.PushFront(entry)
+}
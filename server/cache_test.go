@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/royalcat/rgeocache/geocoder"
+)
+
+func TestResponseCache(t *testing.T) {
+	c, err := newResponseCache(2, 0.001, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lookups [][2]float64
+	lookup := func(_ context.Context, lat, lon float64, q geocoder.Query) (geocoder.InfoModel, bool) {
+		lookups = append(lookups, [2]float64{lat, lon})
+		info := geocoder.InfoModel{}
+		info.Weight = uint8(len(lookups))
+		return info, true
+	}
+
+	// both points snap to the node 0.001, 0.002
+	first, _ := c.find(t.Context(), 0.0011, 0.0021, geocoder.Query{}, lookup)
+	second, _ := c.find(t.Context(), 0.0009, 0.0019, geocoder.Query{}, lookup)
+	if len(lookups) != 1 || first != second {
+		t.Fatalf("expected one lookup for the same grid node, got %v", lookups)
+	}
+	if lookups[0] != [2]float64{0.001, 0.002} {
+		t.Errorf("lookup at %v, expected the grid node", lookups[0])
+	}
+
+	// the query is a part of the key
+	c.find(t.Context(), 0.001, 0.002, geocoder.Query{MinWeight: 5}, lookup)
+	if len(lookups) != 2 {
+		t.Errorf("expected a lookup for different parameters, got %d", len(lookups))
+	}
+
+	c.purge()
+	c.find(t.Context(), 0.001, 0.002, geocoder.Query{}, lookup)
+	if len(lookups) != 3 {
+		t.Errorf("expected a lookup after purge, got %d", len(lookups))
+	}
+}
+
+func TestResponseCachePurgeDuringLookup(t *testing.T) {
+	c, err := newResponseCache(2, 0.001, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookups := 0
+	lookup := func(_ context.Context, lat, lon float64, q geocoder.Query) (geocoder.InfoModel, bool) {
+		lookups++
+		if lookups == 1 {
+			// the data changes while the first answer is computed
+			c.purge()
+		}
+		return geocoder.InfoModel{}, true
+	}
+
+	c.find(t.Context(), 0.001, 0.002, geocoder.Query{}, lookup)
+	c.find(t.Context(), 0.001, 0.002, geocoder.Query{}, lookup)
+	if lookups != 2 {
+		t.Errorf("expected the answer computed across a purge not to be cached, got %d lookups", lookups)
+	}
+	c.find(t.Context(), 0.001, 0.002, geocoder.Query{}, lookup)
+	if lookups != 2 {
+		t.Errorf("expected a hit, got %d lookups", lookups)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	c, err := newResponseCache(1, 1, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.shards) != 1 {
+		t.Fatalf("expected a single shard, got %d", len(c.shards))
+	}
+
+	lookups := 0
+	lookup := func(_ context.Context, lat, lon float64, q geocoder.Query) (geocoder.InfoModel, bool) {
+		lookups++
+		return geocoder.InfoModel{}, false
+	}
+
+	c.find(t.Context(), 1, 1, geocoder.Query{}, lookup)
+	c.find(t.Context(), 2, 2, geocoder.Query{}, lookup) // evicts 1,1
+	c.find(t.Context(), 1, 1, geocoder.Query{}, lookup)
+	if lookups != 3 {
+		t.Errorf("expected the least recently used answer to be evicted, got %d lookups", lookups)
+	}
+
+	c.find(t.Context(), 1, 1, geocoder.Query{}, lookup)
+	if lookups != 3 {
+		t.Errorf("expected a hit, got %d lookups", lookups)
+	}
+	time.Sleep(20 * time.Millisecond)
+	c.find(t.Context(), 1, 1, geocoder.Query{}, lookup)
+	if lookups != 4 {
+		t.Errorf("expected the answer to expire, got %d lookups", lookups)
+	}
+
+	if _, err := newResponseCache(10, 0, 0); err == nil {
+		t.Error("expected an error for a zero grid")
+	}
+}
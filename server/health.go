@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// CacheInfo describes a served cache in the /info response.
+type CacheInfo struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	SHA256   string        `json:"sha256"`
+	Loader   string        `json:"loader"`
+	Points   int           `json:"points"`
+	Zones    int           `json:"zones"`
+	Metadata CacheMetadata `json:"metadata"`
+}
+
+// CacheMetadata is the metadata stored in the cache file.
+type CacheMetadata struct {
+	Version     uint32    `json:"version"`
+	Locale      string    `json:"locale"`
+	DateCreated time.Time `json:"date_created"`
+	// Sources are the caches merged into this one.
+	Sources []CacheSource `json:"sources,omitempty"`
+}
+
+// CacheSource is a cache merged into a served cache.
+type CacheSource struct {
+	Name        string    `json:"name"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+type infoResponse struct {
+	Ready         bool        `json:"ready"`
+	StartedAt     time.Time   `json:"started_at"`
+	UptimeSeconds float64     `json:"uptime_seconds"`
+	Caches        []CacheInfo `json:"caches"`
+}
+
+// HealthzHandler reports that the process is alive, it doesn't depend on the cache.
+func (s *server) HealthzHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBodyString("ok")
+}
+
+// ReadyzHandler reports whether the cache is loaded and queries are served.
+// It fails during shutdown while queries are still answered, so load
+// balancers stop sending traffic before connections are closed.
+func (s *server) ReadyzHandler(ctx *fasthttp.RequestCtx) {
+	if !s.ready.Load() {
+		ctx.Response.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.Response.SetBodyString("loading")
+		return
+	}
+	if s.draining.Load() {
+		ctx.Response.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.Response.SetBodyString("shutting down")
+		return
+	}
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBodyString("ok")
+}
+
+// InfoHandler describes the served caches and the uptime.
+func (s *server) InfoHandler(ctx *fasthttp.RequestCtx) {
+	res := infoResponse{
+		Ready:         s.ready.Load() && !s.draining.Load(),
+		StartedAt:     s.startedAt,
+		UptimeSeconds: time.Since(s.startedAt).Seconds(),
+		Caches:        []CacheInfo{},
+	}
+	if s.ready.Load() {
+		res.Caches = s.caches
+	}
+
+	out, err := json.Marshal(res)
+	if err != nil {
+		ctx.Response.SetStatusCode(http.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBody(out)
+}
+
+// protected wraps geocoding endpoints with readiness and api key checks.
+func (s *server) protected(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if s.auth != nil {
+		h = s.auth.authenticate(h)
+	}
+	return s.whenReady(h)
+}
+
+// whenReady answers 503 until the cache is loaded.
+func (s *server) whenReady(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if !s.ready.Load() {
+			ctx.Response.SetStatusCode(http.StatusServiceUnavailable)
+			ctx.Response.SetBodyString("cache is loading")
+			return
+		}
+		h(ctx)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestReadiness(t *testing.T) {
+	s := &server{startedAt: time.Now()}
+	handler := s.whenReady(func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.SetStatusCode(http.StatusOK)
+	})
+
+	check := func(name string, h fasthttp.RequestHandler, want int) {
+		t.Helper()
+		ctx := &fasthttp.RequestCtx{}
+		h(ctx)
+		if got := ctx.Response.StatusCode(); got != want {
+			t.Errorf("%s: status %d, want %d", name, got, want)
+		}
+	}
+
+	check("healthz while loading", s.HealthzHandler, http.StatusOK)
+	check("readyz while loading", s.ReadyzHandler, http.StatusServiceUnavailable)
+	check("query while loading", handler, http.StatusServiceUnavailable)
+
+	s.rgeo = buildTestGeoCoder(t, 1)
+	s.caches = []CacheInfo{{Name: "test", Loader: "memory", Points: 1}}
+	s.ready.Store(true)
+
+	check("readyz when loaded", s.ReadyzHandler, http.StatusOK)
+	check("query when loaded", handler, http.StatusOK)
+
+	ctx := &fasthttp.RequestCtx{}
+	s.InfoHandler(ctx)
+	var info infoResponse
+	if err := json.Unmarshal(ctx.Response.Body(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.Ready || len(info.Caches) != 1 || info.Caches[0].Name != "test" || info.Caches[0].Points != 1 {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
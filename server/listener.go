@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixScheme prefixes socket paths in the listen address, as in unix:///run/rgeocache.sock.
+const unixScheme = "unix://"
+
+// certReloadInterval is how often certificate files are checked for changes.
+const certReloadInterval = 10 * time.Second
+
+// listen opens a TCP or unix socket listener for the address, wrapped in TLS
+// when a certificate is configured.
+func listen(ctx context.Context, address string, options options, log *slog.Logger) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if options.tlsCert != "" {
+		var err error
+		tlsConfig, err = newTLSConfig(ctx, options, log)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ln net.Listener
+	if path, ok := strings.CutPrefix(address, unixScheme); ok {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		var err error
+		ln, err = net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("error listening on unix socket: %w", err)
+		}
+		// sidecars usually run under another user of the same group
+		if err := os.Chmod(path, 0o660); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("error setting unix socket permissions: %w", err)
+		}
+	} else {
+		var err error
+		ln, err = net.Listen("tcp", address)
+		if err != nil {
+			return nil, fmt.Errorf("error listening on %s: %w", address, err)
+		}
+	}
+
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes a socket left by a process that was killed,
+// other files at the path are kept.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking unix socket path: %w", err)
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("unix socket path %s exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
+
+// newTLSConfig loads the server certificate, reloaded on change until ctx is
+// done, and the client CA when client certificates are required.
+func newTLSConfig(ctx context.Context, options options, log *slog.Logger) (*tls.Config, error) {
+	certs := &certReloader{certFile: options.tlsCert, keyFile: options.tlsKey}
+	if _, err := certs.reload(); err != nil {
+		return nil, err
+	}
+	go certs.watch(ctx, certReloadInterval, log)
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+	}
+
+	if options.tlsClientCA != "" {
+		data, err := os.ReadFile(options.tlsClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", options.tlsClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// certReloader serves a certificate pair and reloads it when one of the files
+// changes, so renewed certificates are picked up without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// reload loads the pair if its files changed since the last load.
+// The current certificate is kept on error.
+func (c *certReloader) reload() (bool, error) {
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return false, fmt.Errorf("error reading tls certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("error reading tls key: %w", err)
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("error loading tls key pair: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.certMod = certInfo.ModTime()
+	c.keyMod = keyInfo.ModTime()
+	c.mu.Unlock()
+	return true, nil
+}
+
+// watch checks the files every interval until ctx is done.
+func (c *certReloader) watch(ctx context.Context, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				log.Error("Failed to reload tls certificate, keeping the previous one", "error", err)
+			} else if reloaded {
+				log.Info("TLS certificate reloaded", "cert", c.certFile)
+			}
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
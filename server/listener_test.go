@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// writeTestCert writes a self-signed certificate pair for localhost.
+func writeTestCert(t *testing.T, dir, name string, mod time.Time) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key := must(ecdsa.GenerateKey(elliptic.P256(), rand.Reader))
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der := must(x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key))
+	keyDER := must(x509.MarshalECPrivateKey(key))
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile, must(x509.ParseCertificate(der))
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile, _ := writeTestCert(t, dir, "server", now.Add(-time.Minute))
+
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if reloaded, err := c.reload(); err != nil || !reloaded {
+		t.Fatalf("initial load: %v %v", reloaded, err)
+	}
+	first, _ := c.getCertificate(nil)
+	if reloaded, err := c.reload(); err != nil || reloaded {
+		t.Errorf("unchanged files reloaded: %v %v", reloaded, err)
+	}
+
+	writeTestCert(t, dir, "server", now)
+	if reloaded, err := c.reload(); err != nil || !reloaded {
+		t.Fatalf("changed files not reloaded: %v %v", reloaded, err)
+	}
+	if second, _ := c.getCertificate(nil); second == first {
+		t.Error("certificate was not replaced")
+	}
+
+	// a broken renewal keeps the previous certificate
+	if err := os.WriteFile(certFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.reload(); err == nil {
+		t.Error("expected an error for a broken certificate")
+	}
+	if cert, _ := c.getCertificate(nil); cert == nil {
+		t.Error("certificate dropped after a failed reload")
+	}
+}
+
+// serveTest serves a handler answering 200 on the listener until the test ends.
+func serveTest(t *testing.T, ln net.Listener) {
+	srv := &fasthttp.Server{Handler: func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.SetStatusCode(http.StatusOK)
+		ctx.Response.SetBodyString("ok")
+	}}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Shutdown() })
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rgeocache.sock")
+	// a socket left by a killed process
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen(t.Context(), unixScheme+path, loadOptions(), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveTest(t, ln)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Errorf("body %q", body)
+	}
+
+	regular := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(t.Context(), unixScheme+regular, loadOptions(), slog.Default()); err == nil {
+		t.Error("expected an error for a regular file at the socket path")
+	}
+}
+
+func TestListenMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, serverCert := writeTestCert(t, dir, "server", time.Now())
+	clientCertFile, clientKeyFile, clientCert := writeTestCert(t, dir, "client", time.Now())
+
+	ln, err := listen(t.Context(), "127.0.0.1:0",
+		loadOptions(WithTLS(certFile, keyFile), WithClientCA(clientCertFile)), slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveTest(t, ln)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert)
+	get := func(certs ...tls.Certificate) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certs,
+		}}}
+		resp, err := client.Get("https://" + ln.Addr().String() + "/healthz")
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+	pair := must(tls.LoadX509KeyPair(clientCertFile, clientKeyFile))
+	if err := get(pair); err != nil {
+		t.Errorf("request with client certificate %s: %v", clientCert.Subject.CommonName, err)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	swaggerfiles "github.com/swaggo/files/v2"
+	"github.com/valyala/fasthttp"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPISpec documents every route of the server, TestOpenAPIRoutes checks it.
+//
+//go:embed openapi.yml
+var openAPISpec []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+// openAPIJSON converts the embedded spec to JSON once, on the first request.
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var spec map[string]any
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, fmt.Errorf("error parsing openapi spec: %w", err)
+	}
+	return json.Marshal(spec)
+})
+
+// OpenAPIHandler serves the API spec as JSON.
+func (s *server) OpenAPIHandler(ctx *fasthttp.RequestCtx) {
+	data, err := openAPIJSON()
+	if err != nil {
+		ctx.Response.SetStatusCode(http.StatusInternalServerError)
+		ctx.Response.SetBodyString(err.Error())
+		return
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBody(data)
+}
+
+// DocsHandler serves a Swagger UI page for the spec, the UI assets are
+// served from the binary by [DocsAssetHandler].
+func (s *server) DocsHandler(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.SetContentType("text/html; charset=utf-8")
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBody(docsPage)
+}
+
+// docsAssets are the Swagger UI files used by docs.html with their content
+// types, embedded by the swagger-ui-dist release pinned in go.mod.
+var docsAssets = map[string]string{
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+}
+
+// DocsAssetHandler serves a Swagger UI file of the docs page.
+func (s *server) DocsAssetHandler(ctx *fasthttp.RequestCtx) {
+	name := ctx.UserValue("asset").(string)
+	contentType, ok := docsAssets[name]
+	if !ok {
+		ctx.Response.SetStatusCode(http.StatusNotFound)
+		return
+	}
+	data, err := fs.ReadFile(swaggerfiles.FS, name)
+	if err != nil {
+		ctx.Response.SetStatusCode(http.StatusInternalServerError)
+		ctx.Response.SetBodyString(err.Error())
+		return
+	}
+	ctx.Response.Header.SetContentType(contentType)
+	ctx.Response.Header.Set("Cache-Control", "public, max-age=86400")
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBody(data)
+}
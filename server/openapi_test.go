@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/royalcat/rgeocache/geomodel"
+	"github.com/valyala/fasthttp"
+)
+
+type testSpec struct {
+	OpenAPI    string                    `json:"openapi"`
+	Paths      map[string]map[string]any `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadTestSpec(t *testing.T) testSpec {
+	t.Helper()
+	ctx := &fasthttp.RequestCtx{}
+	(&server{}).OpenAPIHandler(ctx)
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("status %d: %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	var spec testSpec
+	if err := json.Unmarshal(ctx.Response.Body(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	spec := loadTestSpec(t)
+	if spec.OpenAPI != "3.1.0" {
+		t.Errorf("openapi version %q", spec.OpenAPI)
+	}
+
+	routes := (&server{}).router().List()
+	for method, paths := range routes {
+		for _, path := range paths {
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("route %s %s is not documented in openapi.yml", method, path)
+			}
+		}
+	}
+
+	// and the spec documents no routes that don't exist
+	for path, item := range spec.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			if !slices.Contains(routes[strings.ToUpper(method)], path) {
+				t.Errorf("openapi.yml documents %s %s, the router doesn't serve it", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIAddressFields(t *testing.T) {
+	properties := loadTestSpec(t).Components.Schemas["Address"].Properties
+
+	typ := reflect.TypeFor[geomodel.Info]()
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if _, ok := properties[name]; !ok {
+			t.Errorf("address field %q is not documented", name)
+		}
+	}
+	if len(properties) != typ.NumField() {
+		t.Errorf("openapi.yml documents %d address fields, geomodel.Info has %d", len(properties), typ.NumField())
+	}
+}
+
+func TestDocsAssets(t *testing.T) {
+	// the page must work offline, without scripts of other origins
+	if strings.Contains(string(docsPage), "://") {
+		t.Error("docs.html loads assets from another origin")
+	}
+
+	handler := (&server{}).router().Handler
+	for asset, contentType := range docsAssets {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/docs/" + asset)
+		handler(ctx)
+		if ctx.Response.StatusCode() != http.StatusOK || len(ctx.Response.Body()) == 0 {
+			t.Errorf("%s: status %d, %d bytes", asset, ctx.Response.StatusCode(), len(ctx.Response.Body()))
+		}
+		if got := string(ctx.Response.Header.ContentType()); got != contentType {
+			t.Errorf("%s: content type %q, want %q", asset, got, contentType)
+		}
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/docs/index.html")
+	handler(ctx)
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Errorf("unknown asset: status %d", ctx.Response.StatusCode())
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"time"
+
+	"github.com/royalcat/rgeocache/geocoder"
+)
+
+type options struct {
+	cacheSize int
+	cacheGrid float64
+	cacheTTL  time.Duration
+	apiKeys   []APIKey
+
+	accessLogSampleRate float64
+	accessLogSlow       time.Duration
+	accessLogPrecision  int
+
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
+
+	overlay         *geocoder.Overlay
+	overlayAdminKey string
+
+	maxRadius float64
+}
+
+func loadOptions(opts ...Option) options {
+	options := options{
+		accessLogPrecision: 2,
+		readTimeout:        30 * time.Second,
+		shutdownTimeout:    30 * time.Second,
+		maxRadius:          DefaultMaxRadius,
+	}
+	for _, o := range opts {
+		o.apply(&options)
+	}
+	return options
+}
+
+type Option interface {
+	apply(*options)
+}
+
+type responseCacheOption struct {
+	size int
+	grid float64
+	ttl  time.Duration
+}
+
+func (c responseCacheOption) apply(o *options) {
+	o.cacheSize = c.size
+	o.cacheGrid = c.grid
+	o.cacheTTL = c.ttl
+}
+
+// WithResponseCache keeps up to size answers in an LRU keyed on coordinates
+// snapped to a grid of the given step in degrees. Answers expire after ttl,
+// zero ttl keeps them until evicted.
+//
+// Default: disabled
+func WithResponseCache(size int, grid float64, ttl time.Duration) Option {
+	return responseCacheOption{size: size, grid: grid, ttl: ttl}
+}
+
+type apiKeysOption []APIKey
+
+func (k apiKeysOption) apply(o *options) {
+	o.apiKeys = k
+}
+
+// WithAPIKeys requires one of the keys on geocoding endpoints and limits
+// every key to its quota. Probes, /info and /metrics stay open.
+//
+// Default: no authentication
+func WithAPIKeys(keys []APIKey) Option {
+	return apiKeysOption(keys)
+}
+
+type accessLogOption struct {
+	sampleRate float64
+	slow       time.Duration
+	precision  int
+}
+
+func (a accessLogOption) apply(o *options) {
+	o.accessLogSampleRate = a.sampleRate
+	o.accessLogSlow = a.slow
+	o.accessLogPrecision = a.precision
+}
+
+// WithAccessLog logs the given share of requests, from 0 to 1. Requests
+// slower than slow and server errors are always logged, zero slow disables
+// the threshold. Coordinates are rounded to precision decimals, negative
+// precision drops them.
+//
+// Default: only server errors are logged, coordinates rounded to 2 decimals
+func WithAccessLog(sampleRate float64, slow time.Duration, precision int) Option {
+	return accessLogOption{sampleRate: sampleRate, slow: slow, precision: precision}
+}
+
+type tlsOption struct {
+	certFile, keyFile string
+}
+
+func (t tlsOption) apply(o *options) {
+	o.tlsCert = t.certFile
+	o.tlsKey = t.keyFile
+}
+
+// WithTLS serves HTTPS with the PEM certificate and key files. The files are
+// checked for changes periodically, renewed certificates are used for new
+// connections without a restart.
+//
+// Default: plain HTTP
+func WithTLS(certFile, keyFile string) Option {
+	return tlsOption{certFile: certFile, keyFile: keyFile}
+}
+
+type clientCAOption string
+
+func (c clientCAOption) apply(o *options) {
+	o.tlsClientCA = string(c)
+}
+
+// WithClientCA requires client certificates signed by one of the CAs in the
+// PEM file. Has effect only together with [WithTLS].
+//
+// Default: client certificates are not requested
+func WithClientCA(caFile string) Option {
+	return clientCAOption(caFile)
+}
+
+type timeoutsOption struct {
+	read, write, idle time.Duration
+}
+
+func (t timeoutsOption) apply(o *options) {
+	o.readTimeout = t.read
+	o.writeTimeout = t.write
+	o.idleTimeout = t.idle
+}
+
+// WithTimeouts sets the time allowed to read a request, to write a response
+// and to wait for the next request on a keep-alive connection. Zero disables
+// a timeout, zero idle uses the read timeout.
+//
+// Default: 30s read timeout, no write timeout
+func WithTimeouts(read, write, idle time.Duration) Option {
+	return timeoutsOption{read: read, write: write, idle: idle}
+}
+
+type shutdownOption struct {
+	delay, timeout time.Duration
+}
+
+func (s shutdownOption) apply(o *options) {
+	o.shutdownDelay = s.delay
+	o.shutdownTimeout = s.timeout
+}
+
+// WithShutdown sets how long /readyz fails before the listener is closed on
+// shutdown, and how long requests in flight are waited for after that.
+// Zero timeout waits for all of them.
+//
+// Default: no delay, 30s timeout
+func WithShutdown(delay, timeout time.Duration) Option {
+	return shutdownOption{delay: delay, timeout: timeout}
+}
+
+type overlayOption struct {
+	overlay  *geocoder.Overlay
+	adminKey string
+}
+
+func (ov overlayOption) apply(o *options) {
+	o.overlay = ov.overlay
+	o.overlayAdminKey = ov.adminKey
+}
+
+// WithOverlay serves the overlay over the loaded geocoder, see
+// [geocoder.OverlayGeocoder]. The /admin/overlay endpoints edit it with the
+// admin key in the X-Admin-Key header, an empty key leaves them disabled.
+//
+// Default: no overlay
+func WithOverlay(overlay *geocoder.Overlay, adminKey string) Option {
+	return overlayOption{overlay: overlay, adminKey: adminKey}
+}
+
+// DefaultMaxRadius is the largest radius parameter in meters accepted by default.
+const DefaultMaxRadius = 5000
+
+type maxRadiusOption float64
+
+func (m maxRadiusOption) apply(o *options) {
+	o.maxRadius = float64(m)
+}
+
+// WithMaxRadius bounds the radius parameter of the geocoding endpoints in
+// meters, larger radii are answered with 400. The radius bounds the part of
+// the tree scanned for a query, so it can't be left to the clients.
+//
+// Default: [DefaultMaxRadius]
+func WithMaxRadius(meters float64) Option {
+	return maxRadiusOption(meters)
+}
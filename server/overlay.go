@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+
+	"github.com/royalcat/rgeocache/geocoder"
+	"github.com/valyala/fasthttp"
+)
+
+// AdminKeyHeader carries the admin key of the overlay endpoints.
+const AdminKeyHeader = "X-Admin-Key"
+
+// overlayAdmin edits the overlay served over the geocoder.
+type overlayAdmin struct {
+	overlay  *geocoder.Overlay
+	adminKey []byte
+	log      *slog.Logger
+}
+
+// admin checks the admin key, the endpoints are disabled without an overlay or a key.
+func (s *server) admin(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if s.overlay == nil || len(s.overlay.adminKey) == 0 {
+			ctx.Response.SetStatusCode(http.StatusNotFound)
+			ctx.Response.SetBodyString("overlay administration is disabled")
+			return
+		}
+		if subtle.ConstantTimeCompare(ctx.Request.Header.Peek(AdminKeyHeader), s.overlay.adminKey) != 1 {
+			ctx.Response.SetStatusCode(http.StatusUnauthorized)
+			ctx.Response.SetBodyString("invalid admin key")
+			return
+		}
+		h(ctx)
+	}
+}
+
+// OverlayHandler returns all overlay points.
+func (s *server) OverlayHandler(ctx *fasthttp.RequestCtx) {
+	var buf bytes.Buffer
+	if _, err := s.overlay.overlay.WriteTo(&buf); err != nil {
+		ctx.Response.SetStatusCode(http.StatusInternalServerError)
+		return
+	}
+	ctx.Response.Header.SetContentType("application/json")
+	ctx.Response.SetStatusCode(http.StatusOK)
+	ctx.Response.SetBody(buf.Bytes())
+}
+
+// OverlayReplaceHandler replaces the overlay with the points of the body.
+func (s *server) OverlayReplaceHandler(ctx *fasthttp.RequestCtx) {
+	points, ok := parseOverlayBody(ctx)
+	if !ok {
+		return
+	}
+	s.overlayChanged(ctx, s.overlay.overlay.Replace(points), "replace", len(points))
+}
+
+// OverlayPutHandler adds the points of the body or replaces the points with the same IDs.
+func (s *server) OverlayPutHandler(ctx *fasthttp.RequestCtx) {
+	points, ok := parseOverlayBody(ctx)
+	if !ok {
+		return
+	}
+	s.overlayChanged(ctx, s.overlay.overlay.Put(points...), "put", len(points))
+}
+
+// OverlayDeleteHandler removes a point.
+func (s *server) OverlayDeleteHandler(ctx *fasthttp.RequestCtx) {
+	id := ctx.UserValue("id").(string)
+	found, err := s.overlay.overlay.Delete(id)
+	if err == nil && !found {
+		ctx.Response.SetStatusCode(http.StatusNotFound)
+		ctx.Response.SetBodyString("overlay point not found")
+		return
+	}
+	s.overlayChanged(ctx, err, "delete", 1)
+}
+
+func parseOverlayBody(ctx *fasthttp.RequestCtx) ([]geocoder.OverlayPoint, bool) {
+	points, err := geocoder.ParseOverlay(ctx.Request.Body())
+	if err != nil {
+		ctx.Response.SetStatusCode(http.StatusBadRequest)
+		ctx.Response.SetBodyString(err.Error())
+		return nil, false
+	}
+	return points, true
+}
+
+// overlayChanged answers a write, cached answers of the old overlay are dropped.
+func (s *server) overlayChanged(ctx *fasthttp.RequestCtx, err error, op string, points int) {
+	if err != nil {
+		s.overlay.log.Error("Overlay change failed", "op", op, "error", err)
+		ctx.Response.SetStatusCode(http.StatusInternalServerError)
+		ctx.Response.SetBodyString(err.Error())
+		return
+	}
+	if s.cache != nil {
+		s.cache.purge()
+	}
+	s.overlay.log.Info("Overlay changed", "op", op, "points", points, "total", s.overlay.overlay.Len())
+	ctx.Response.SetStatusCode(http.StatusNoContent)
+}
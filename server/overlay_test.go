@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/royalcat/rgeocache/geocoder"
+	"github.com/valyala/fasthttp"
+)
+
+func TestOverlayAdmin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overlay.json")
+	overlay, err := geocoder.LoadOverlay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgeo, err := geocoder.NewOverlayGeocoder(buildTestGeoCoder(t, 3), overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := newResponseCache(100, 0.0001, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{
+		rgeo:    rgeo,
+		cache:   cache,
+		overlay: &overlayAdmin{overlay: overlay, adminKey: []byte("admin"), log: slog.Default()},
+	}
+	handler := s.router().Handler
+
+	request := func(method, uri, key, body string) *fasthttp.RequestCtx {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(uri)
+		if key != "" {
+			ctx.Request.Header.Set(AdminKeyHeader, key)
+		}
+		ctx.Request.SetBodyString(body)
+		handler(ctx)
+		return ctx
+	}
+	find := func() string {
+		t.Helper()
+		info, _ := s.find(t.Context(), 0.01, 0.01, geocoder.Query{})
+		return info.HouseNumber
+	}
+
+	if ctx := request(http.MethodGet, "/admin/overlay", "", ""); ctx.Response.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("without a key: status %d", ctx.Response.StatusCode())
+	}
+	if ctx := request(http.MethodGet, "/admin/overlay", "wrong", ""); ctx.Response.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("wrong key: status %d", ctx.Response.StatusCode())
+	}
+
+	// cached before the correction, the write purges it
+	if got := find(); got != "1" {
+		t.Fatalf("before the overlay: house %q", got)
+	}
+	fix := `{"type": "FeatureCollection", "features": [{"type": "Feature", "id": "fix",
+		"geometry": {"type": "Point", "coordinates": [0.01, 0.01]},
+		"properties": {"hide_radius": 10, "street": "Fixed Street", "house_number": "1a"}}]}`
+	if ctx := request(http.MethodPost, "/admin/overlay/points", "admin", fix); ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Fatalf("post: status %d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if got := find(); got != "1a" {
+		t.Errorf("after the correction: house %q", got)
+	}
+
+	if ctx := request(http.MethodPost, "/admin/overlay/points", "admin", `{"points": [{"id": "bad"}]}`); ctx.Response.StatusCode() != http.StatusBadRequest {
+		t.Errorf("invalid point: status %d", ctx.Response.StatusCode())
+	}
+
+	ctx := request(http.MethodGet, "/admin/overlay", "admin", "")
+	var got struct {
+		Points []geocoder.OverlayPoint `json:"points"`
+	}
+	if err := json.Unmarshal(ctx.Response.Body(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Points) != 1 || got.Points[0].ID != "fix" || got.Points[0].Address.Street != "Fixed Street" {
+		t.Errorf("get: %s", ctx.Response.Body())
+	}
+
+	// persisted for the next start
+	reloaded, err := geocoder.LoadOverlay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Len() != 1 {
+		t.Errorf("persisted %d points", reloaded.Len())
+	}
+
+	if ctx := request(http.MethodDelete, "/admin/overlay/points/fix", "admin", ""); ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Fatalf("delete: status %d", ctx.Response.StatusCode())
+	}
+	if ctx := request(http.MethodDelete, "/admin/overlay/points/fix", "admin", ""); ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Errorf("delete missing: status %d", ctx.Response.StatusCode())
+	}
+	if got := find(); got != "1" {
+		t.Errorf("after delete: house %q", got)
+	}
+
+	if ctx := request(http.MethodPut, "/admin/overlay", "admin", `{"points": [{"id": "h", "lat": 0.01, "lon": 0.01, "hide_radius": 10}]}`); ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Fatalf("put: status %d", ctx.Response.StatusCode())
+	}
+	if got := find(); got == "1" {
+		t.Error("suppressed point still found")
+	}
+}
+
+func TestOverlayAdminDisabled(t *testing.T) {
+	handler := (&server{startedAt: time.Now()}).router().Handler
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/admin/overlay")
+	ctx.Request.Header.Set(AdminKeyHeader, "")
+	handler(ctx)
+	if ctx.Response.StatusCode() != http.StatusNotFound {
+		t.Errorf("status %d", ctx.Response.StatusCode())
+	}
+}
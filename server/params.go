@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/royalcat/rgeocache/geocoder"
+	"github.com/royalcat/rgeocache/geomodel"
+	"github.com/valyala/fasthttp"
+)
+
+// queryParams are per-request parameters of the geocoding endpoints.
+type queryParams struct {
+	query geocoder.Query
+	// fields selects response fields, zero keeps all of them
+	fields fieldMask
+}
+
+// parseQueryParams reads radius (meters), fields, min_weight and types from the query string.
+// A radius above maxRadius is rejected.
+func parseQueryParams(args *fasthttp.Args, maxRadius float64) (queryParams, error) {
+	var p queryParams
+
+	if v := args.Peek("radius"); len(v) > 0 {
+		radius, err := strconv.ParseFloat(string(v), 64)
+		if err != nil || radius <= 0 {
+			return p, fmt.Errorf("invalid radius %q, expected a positive number of meters", v)
+		}
+		if radius > maxRadius {
+			return p, fmt.Errorf("radius %q exceeds the maximum of %g meters", v, maxRadius)
+		}
+		p.query.RadiusMeters = radius
+	}
+
+	if v := args.Peek("min_weight"); len(v) > 0 {
+		weight, err := strconv.ParseUint(string(v), 10, 8)
+		if err != nil {
+			return p, fmt.Errorf("invalid min_weight %q, expected a number from 0 to 255", v)
+		}
+		p.query.MinWeight = uint8(weight)
+	}
+
+	if v := args.Peek("types"); len(v) > 0 {
+		types, err := geocoder.ParsePointTypes(string(v))
+		if err != nil {
+			return p, err
+		}
+		p.query.Types = types
+	}
+
+	if v := args.Peek("fields"); len(v) > 0 {
+		fields, err := parseFieldMask(string(v))
+		if err != nil {
+			return p, err
+		}
+		p.fields = fields
+	}
+
+	return p, nil
+}
+
+// find answers from the response cache if it's enabled.
+func (s *server) find(ctx context.Context, lat, lon float64, q geocoder.Query) (geocoder.InfoModel, bool) {
+	if s.cache != nil {
+		return s.cache.find(ctx, lat, lon, q, s.findUncached)
+	}
+	return s.findUncached(ctx, lat, lon, q)
+}
+
+// findUncached uses the per-request parameters and the traced context when
+// the geocoder supports them.
+func (s *server) findUncached(ctx context.Context, lat, lon float64, q geocoder.Query) (geocoder.InfoModel, bool) {
+	if cg, ok := s.rgeo.(geocoder.ContextGeocoder); ok {
+		return cg.FindQueryContext(ctx, lat, lon, q)
+	}
+	if q != (geocoder.Query{}) {
+		if qg, ok := s.rgeo.(geocoder.QueryGeocoder); ok {
+			return qg.FindQuery(lat, lon, q)
+		}
+	}
+	return s.rgeo.Find(lat, lon)
+}
+
+// fieldMask is a set of geomodel.Info fields written to the response.
+type fieldMask uint16
+
+const (
+	fieldName fieldMask = 1 << iota
+	fieldStreet
+	fieldHouseNumber
+	fieldCity
+	fieldRegion
+	fieldCountry
+	fieldWeight
+	fieldMatchType
+)
+
+var fieldNames = map[string]fieldMask{
+	"name":         fieldName,
+	"street":       fieldStreet,
+	"house_number": fieldHouseNumber,
+	"city":         fieldCity,
+	"region":       fieldRegion,
+	"country":      fieldCountry,
+	"weight":       fieldWeight,
+	"match_type":   fieldMatchType,
+}
+
+// parseFieldMask parses a comma separated list of JSON field names like "street,city".
+func parseFieldMask(s string) (fieldMask, error) {
+	var mask fieldMask
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		f, ok := fieldNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %q", name)
+		}
+		mask |= f
+	}
+	return mask, nil
+}
+
+// writeInfo writes info with the selected fields in the same order and format as geomodel.Info.
+func (m fieldMask) writeInfo(w *jwriter.Writer, info geomodel.Info) {
+	w.RawByte('{')
+	first := true
+	field := func(name string) {
+		if !first {
+			w.RawByte(',')
+		}
+		first = false
+		w.String(name)
+		w.RawByte(':')
+	}
+
+	if m&fieldName != 0 {
+		field("name")
+		w.String(info.Name)
+	}
+	if m&fieldStreet != 0 {
+		field("street")
+		w.String(info.Street)
+	}
+	if m&fieldHouseNumber != 0 {
+		field("house_number")
+		w.String(info.HouseNumber)
+	}
+	if m&fieldCity != 0 {
+		field("city")
+		w.String(info.City)
+	}
+	if m&fieldRegion != 0 {
+		field("region")
+		w.String(info.Region)
+	}
+	if m&fieldCountry != 0 {
+		field("country")
+		w.String(info.Country)
+	}
+	if m&fieldWeight != 0 {
+		field("weight")
+		w.Uint8(info.Weight)
+	}
+	if m&fieldMatchType != 0 && info.MatchType != "" {
+		field("match_type")
+		w.String(info.MatchType)
+	}
+	w.RawByte('}')
+}
+
+// marshalInfo encodes a single address, trimmed to the selected fields.
+func (m fieldMask) marshalInfo(info geomodel.Info) ([]byte, error) {
+	if m == 0 {
+		return info.MarshalJSON()
+	}
+	w := jwriter.Writer{}
+	m.writeInfo(&w, info)
+	return w.BuildBytes()
+}
+
+// marshalList encodes a list of addresses, trimmed to the selected fields.
+func (m fieldMask) marshalList(list geomodel.InfoList) ([]byte, error) {
+	if m == 0 {
+		return list.MarshalJSON()
+	}
+	w := jwriter.Writer{}
+	w.RawByte('[')
+	for i, info := range list {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		m.writeInfo(&w, info)
+	}
+	w.RawByte(']')
+	return w.BuildBytes()
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/royalcat/rgeocache/geocoder"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseQueryParams(t *testing.T) {
+	args := fasthttp.Args{}
+	args.Parse("radius=50&min_weight=5&types=building,road&fields=street,city")
+	p, err := parseQueryParams(&args, DefaultMaxRadius)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := geocoder.Query{RadiusMeters: 50, MinWeight: 5, Types: geocoder.PointBuilding | geocoder.PointRoad}
+	if p.query != want || p.fields != fieldStreet|fieldCity {
+		t.Errorf("unexpected params %+v", p)
+	}
+
+	for _, bad := range []string{"radius=-1", "radius=abc", "radius=1e9", "min_weight=256", "types=lake", "fields=zip"} {
+		args := fasthttp.Args{}
+		args.Parse(bad)
+		if _, err := parseQueryParams(&args, DefaultMaxRadius); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestAddressFields(t *testing.T) {
+	s := &server{
+		rgeo:                            buildTestGeoCoder(t, 1),
+		pointsPerThread:                 1000,
+		maxRadius:                       DefaultMaxRadius,
+		metricHttpAddressCallCount:      must(meter.Int64Counter("http_address_call_total")),
+		metricHttpAddressMultiCallCount: must(meter.Int64Counter("http_address_multi_call_total")),
+		metricAddressesEncoded:          must(meter.Int64Counter("address_encoded_total")),
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/rgeocode/address/0/0?fields=name,street&radius=100")
+	ctx.SetUserValue("lat", "0")
+	ctx.SetUserValue("lon", "0")
+	s.RGeoCodeHandler(ctx)
+
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("status %d: %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if got, want := string(ctx.Response.Body()), `{"name":"point-0","street":"Test Street"}`; got != want {
+		t.Errorf("body %s, want %s", got, want)
+	}
+
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/rgeocode/multiaddress?fields=house_number")
+	ctx.Request.SetBodyString("[[0,0],[0,0]]")
+	s.RGeoMultipleCodeHandler(ctx)
+	if got, want := string(ctx.Response.Body()), `[{"house_number":"0"},{"house_number":"0"}]`; got != want {
+		t.Errorf("body %s, want %s", got, want)
+	}
+}
@@ -3,13 +3,15 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	stdlog "log"
+	"io"
 	"log/slog"
 	"net/http"
 	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/router"
@@ -19,6 +21,7 @@ import (
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -26,7 +29,16 @@ const MaxBodySize = 32 * 1000 * 1000 // 32MB
 
 var meter = otel.Meter("github.com/royalcat/rgeocache/server")
 
-func Run(ctx context.Context, address string, rgeo geocoder.Geocoder, pointsPerThread int, log *slog.Logger) error {
+// Loader loads the geocoder served by [Run] and describes its caches.
+// The server is already listening while it runs, with /readyz answering 503.
+// Run closes the geocoder when it implements [io.Closer], after a shutdown
+// which finished every request or as soon as it's loaded if the server
+// stopped in the meantime.
+type Loader func(ctx context.Context) (geocoder.Geocoder, []CacheInfo, error)
+
+func Run(ctx context.Context, address string, load Loader, pointsPerThread int, log *slog.Logger, opts ...Option) error {
+	options := loadOptions(opts...)
+
 	if err := setupTelemetry(ctx); err != nil {
 		return fmt.Errorf("failed to initialize otel metrics: %w", err)
 	}
@@ -43,52 +55,219 @@ func Run(ctx context.Context, address string, rgeo geocoder.Geocoder, pointsPerT
 	if err != nil {
 		return err
 	}
+	// the default logger is the slog and otel fanout after setupTelemetry
+	accessLog := &accessLog{
+		log:        slog.Default().With("component", "access_log"),
+		sampleRate: options.accessLogSampleRate,
+		slow:       options.accessLogSlow,
+		precision:  options.accessLogPrecision,
+	}
+
 	s := &server{
-		rgeo:            rgeo,
 		pointsPerThread: int(pointsPerThread),
+		maxRadius:       options.maxRadius,
+		startedAt:       time.Now(),
 
 		metricHttpAddressCallCount:      metricHttpAdressCallCount,
 		metricHttpAddressMultiCallCount: metricHttpAddressMultiCallCount,
 		metricAddressesEncoded:          metricHttpAdressEncoded,
 	}
 
-	r := router.New()
-	r.GET("/rgeocode/address/{lat}/{lon}", s.RGeoCodeHandler)
-	r.GET("/rgeocode/multiaddress", s.RGeoMultipleCodeHandler) // DEPRECATED use post endpoint
-	r.POST("/rgeocode/multiaddress", s.RGeoMultipleCodeHandler)
-	r.Handle(http.MethodGet, "/metrics", fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler()))
+	if options.cacheSize > 0 {
+		s.cache, err = newResponseCache(options.cacheSize, options.cacheGrid, options.cacheTTL)
+		if err != nil {
+			return err
+		}
+		log.Info("Response cache enabled", "size", options.cacheSize, "grid", options.cacheGrid, "ttl", options.cacheTTL)
+	}
+	if len(options.apiKeys) > 0 {
+		s.auth, err = newKeyAuth(options.apiKeys)
+		if err != nil {
+			return err
+		}
+		log.Info("API key authentication enabled", "keys", len(options.apiKeys))
+	}
+	if options.overlay != nil {
+		s.overlay = &overlayAdmin{
+			overlay:  options.overlay,
+			adminKey: []byte(options.overlayAdminKey),
+			log:      log.With("component", "overlay"),
+		}
+		log.Info("Overlay enabled", "points", options.overlay.Len(), "admin", options.overlayAdminKey != "")
+	}
+
+	r := s.router()
 
 	server := &fasthttp.Server{
-		ReadTimeout:        time.Second * 30,
+		ReadTimeout:        options.readTimeout,
+		WriteTimeout:       options.writeTimeout,
+		IdleTimeout:        options.idleTimeout,
 		MaxRequestBodySize: MaxBodySize,
-		Handler:            r.Handler,
+		Handler:            accessLog.middleware(r.Handler),
+		// keep-alive connections are closed after their current request on shutdown
+		CloseOnShutdown: true,
 		// Logger:             logrus.NewEntry(log).WithField("component", "fasthttp"),
 	}
 
+	ln, err := listen(ctx, address, options, log)
+	if err != nil {
+		return err
+	}
+	serveErr := make(chan error, 1)
 	go func() {
-		log.Info("Server listening", "address", address)
-		if err := server.ListenAndServe(address); err != http.ErrServerClosed {
-			stdlog.Fatalf("ListenAndServe(): %v", err)
-		}
+		log.Info("Server listening", "address", address, "tls", options.tlsCert != "", "mtls", options.tlsCert != "" && options.tlsClientCA != "")
+		serveErr <- server.Serve(ln)
 	}()
 	log.Info("Server started")
 
-	// wait cancel
-	<-ctx.Done()
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	return server.ShutdownWithContext(shutdownCtx)
+	type loaded struct {
+		rgeo   geocoder.Geocoder
+		caches []CacheInfo
+		err    error
+	}
+	loadDone := make(chan loaded, 1)
+	go func() {
+		rgeo, caches, err := load(ctx)
+		loadDone <- loaded{rgeo, caches, err}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("error serving: %w", err)
+	case <-ctx.Done():
+		// the geocoder is never served, release it once the loader returns
+		go func() {
+			if l := <-loadDone; l.err == nil {
+				closeGeocoder(l.rgeo, log)
+			}
+		}()
+		return s.shutdown(server, 0, options.shutdownTimeout, log)
+	case l := <-loadDone:
+		if l.err == nil && options.overlay != nil {
+			overlay, err := geocoder.NewOverlayGeocoder(l.rgeo, options.overlay)
+			if err != nil {
+				closeGeocoder(l.rgeo, log)
+				l.err = err
+			} else {
+				l.rgeo = overlay
+			}
+		}
+		if l.err != nil {
+			return errors.Join(l.err, s.shutdown(server, 0, options.shutdownTimeout, log))
+		}
+		s.setGeocoder(l.rgeo, l.caches)
+		s.ready.Store(true)
+		log.Info("Server ready")
+	}
+
+	select {
+	case err := <-serveErr:
+		// handlers may still be running, the geocoder is left to the process exit
+		return fmt.Errorf("error serving: %w", err)
+	case <-ctx.Done():
+		return s.shutdownAndClose(server, options.shutdownDelay, options.shutdownTimeout, log)
+	}
+}
+
+// shutdownAndClose shuts the server down and closes the served geocoder once
+// no request reads it.  When the shutdown times out handlers may still read
+// the cache, the geocoder is then left open to the process exit.
+func (s *server) shutdownAndClose(server *fasthttp.Server, delay, timeout time.Duration, log *slog.Logger) error {
+	if err := s.shutdown(server, delay, timeout, log); err != nil {
+		log.Warn("Requests still running after the shutdown timeout, the geocoder is left open")
+		return err
+	}
+	closeGeocoder(s.rgeo, log)
+	return nil
+}
+
+// closeGeocoder releases the caches of rgeo if it holds any.
+func closeGeocoder(rgeo geocoder.Geocoder, log *slog.Logger) {
+	closer, ok := rgeo.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		log.Error("Error closing geocoder", "error", err)
+	}
+}
+
+// shutdown fails readiness, waits delay for load balancers to notice and
+// then waits up to timeout for requests in flight to finish.
+func (s *server) shutdown(server *fasthttp.Server, delay, timeout time.Duration, log *slog.Logger) error {
+	s.draining.Store(true)
+	if delay > 0 {
+		log.Info("Server draining", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	log.Info("Server shutting down", "timeout", timeout)
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := server.ShutdownWithContext(ctx); err != nil {
+		return fmt.Errorf("error shutting down server: %w", err)
+	}
+	return nil
+}
+
+// router registers the handlers, every route must be documented in openapi.yml.
+func (s *server) router() *router.Router {
+	r := router.New()
+	r.SaveMatchedRoutePath = true
+	r.GET("/rgeocode/address/{lat}/{lon}", s.protected(s.RGeoCodeHandler))
+	r.GET("/rgeocode/multiaddress", s.protected(s.RGeoMultipleCodeHandler)) // DEPRECATED use post endpoint
+	r.POST("/rgeocode/multiaddress", s.protected(s.RGeoMultipleCodeHandler))
+	r.GET("/healthz", s.HealthzHandler)
+	r.GET("/readyz", s.ReadyzHandler)
+	r.GET("/info", s.InfoHandler)
+	r.GET("/openapi.json", s.OpenAPIHandler)
+	r.GET("/docs", s.DocsHandler)
+	r.GET("/docs/{asset}", s.DocsAssetHandler)
+	r.GET("/admin/overlay", s.admin(s.OverlayHandler))
+	r.PUT("/admin/overlay", s.admin(s.OverlayReplaceHandler))
+	r.POST("/admin/overlay/points", s.admin(s.OverlayPutHandler))
+	r.DELETE("/admin/overlay/points/{id}", s.admin(s.OverlayDeleteHandler))
+	r.Handle(http.MethodGet, "/metrics", fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler()))
+	return r
 }
 
 type server struct {
 	rgeo            geocoder.Geocoder
 	pointsPerThread int
+	// largest radius parameter in meters
+	maxRadius float64
+
+	// rgeo and caches are set once before ready is stored
+	ready     atomic.Bool
+	draining  atomic.Bool
+	caches    []CacheInfo
+	startedAt time.Time
+
+	// cache of answers, nil when disabled
+	cache *responseCache
+	// api keys and quotas, nil when authentication is disabled
+	auth *keyAuth
+	// overlay served over rgeo, nil when disabled
+	overlay *overlayAdmin
 
 	metricHttpAddressCallCount      metric.Int64Counter
 	metricHttpAddressMultiCallCount metric.Int64Counter
 	metricAddressesEncoded          metric.Int64Counter
 }
 
+// setGeocoder replaces the served geocoder, cached answers of the previous one are dropped.
+func (s *server) setGeocoder(rgeo geocoder.Geocoder, caches []CacheInfo) {
+	s.rgeo = rgeo
+	s.caches = caches
+	if s.cache != nil {
+		s.cache.purge()
+	}
+}
+
 var reqPointsPool = sync.Pool{
 	New: func() any {
 		return [][2]float64{}
@@ -96,9 +275,16 @@ var reqPointsPool = sync.Pool{
 }
 
 func (s *server) RGeoCodeHandler(ctx *fasthttp.RequestCtx) {
+	spanCtx, span := startRequestSpan(ctx, "GET /rgeocode/address")
+	defer endRequestSpan(ctx, span)
+
 	s.metricHttpAddressCallCount.Add(ctx, 1)
 	s.metricAddressesEncoded.Add(ctx, 1)
 
+	if !s.charge(ctx, 1) {
+		return
+	}
+
 	latS := ctx.UserValue("lat").(string)
 	lonS := ctx.UserValue("lon").(string)
 
@@ -112,17 +298,29 @@ func (s *server) RGeoCodeHandler(ctx *fasthttp.RequestCtx) {
 		ctx.Response.SetStatusCode(http.StatusBadRequest)
 		return
 	}
+	params, err := parseQueryParams(ctx.QueryArgs(), s.maxRadius)
+	if err != nil {
+		ctx.Response.SetStatusCode(http.StatusBadRequest)
+		ctx.Response.SetBodyString(err.Error())
+		return
+	}
 
-	i, ok := s.rgeo.Find(lat, lon)
+	i, ok := s.find(spanCtx, lat, lon, params.query)
+	if ok {
+		setResultCounts(ctx, 1, 1)
+	} else {
+		setResultCounts(ctx, 1, 0)
+	}
 	if !ok {
 		ctx.Response.SetStatusCode(http.StatusNoContent)
 		return
 	}
 
-	out, err := json.Marshal(i)
+	out, err := params.fields.marshalInfo(i.Info)
 	if err != nil {
 		ctx.Response.SetStatusCode(http.StatusInternalServerError)
 		ctx.Response.SetBodyString("failed to marshal response")
+		return
 	}
 
 	ctx.Response.SetStatusCode(http.StatusOK)
@@ -130,13 +328,23 @@ func (s *server) RGeoCodeHandler(ctx *fasthttp.RequestCtx) {
 }
 
 func (s *server) RGeoMultipleCodeHandler(ctx *fasthttp.RequestCtx) {
+	spanCtx, span := startRequestSpan(ctx, string(ctx.Method())+" /rgeocode/multiaddress")
+	defer endRequestSpan(ctx, span)
+
 	s.metricHttpAddressMultiCallCount.Add(ctx, 1)
 
+	params, err := parseQueryParams(ctx.QueryArgs(), s.maxRadius)
+	if err != nil {
+		ctx.Response.SetStatusCode(http.StatusBadRequest)
+		ctx.Response.SetBodyString(err.Error())
+		return
+	}
+
 	req := reqPointsPool.Get().([][2]float64) // lat, lon
 	req = req[:0]
 	defer reqPointsPool.Put(req)
 
-	err := json.Unmarshal(ctx.Request.Body(), &req)
+	err = json.Unmarshal(ctx.Request.Body(), &req)
 	if err != nil {
 		ctx.Response.SetStatusCode(http.StatusBadRequest)
 		ctx.Response.SetBodyString("failed to parse request: " + err.Error())
@@ -144,20 +352,40 @@ func (s *server) RGeoMultipleCodeHandler(ctx *fasthttp.RequestCtx) {
 	}
 
 	s.metricAddressesEncoded.Add(ctx, int64(len(req)))
+	span.SetAttributes(attribute.Int("batch.size", len(req)))
+
+	if !s.charge(ctx, len(req)) {
+		return
+	}
 
 	res := geomodel.InfoList{}
 
+	// spans of every point of a large batch would flood the exporter
+	findCtx := context.Context(spanCtx)
+	if len(req) > maxTracedBatch {
+		findCtx = context.Background()
+	}
+
 	if len(req) < s.pointsPerThread {
 		for _, p := range req {
-			info, _ := s.rgeo.Find(p[0], p[1])
+			info, _ := s.find(findCtx, p[0], p[1], params.query)
 			res = append(res, info.Info)
 		}
 	} else {
 		threads := min(max(2, len(req)/s.pointsPerThread), runtime.GOMAXPROCS(0)/2)
-		res = s.multithreadedFind(req, threads)
+		res = s.multithreadedFind(req, threads, params.query)
 	}
 
-	data, err := res.MarshalJSON()
+	found := 0
+	for _, info := range res {
+		if info != (geomodel.Info{}) {
+			found++
+		}
+	}
+	setResultCounts(ctx, len(req), found)
+	span.SetAttributes(attribute.Int("batch.found", found))
+
+	data, err := params.fields.marshalList(res)
 	if err != nil {
 		ctx.Response.SetStatusCode(http.StatusInternalServerError)
 		return
@@ -167,28 +395,15 @@ func (s *server) RGeoMultipleCodeHandler(ctx *fasthttp.RequestCtx) {
 	ctx.Response.SetBody(data)
 }
 
-func (s *server) multithreadedFind(points [][2]float64, threads int) []geomodel.Info {
-	var res = make([]geomodel.Info, len(points))
-	var taskChan = make(chan int, threads)
-
-	go func() {
-		for i := range points {
-			taskChan <- i
-		}
-		close(taskChan)
-	}()
-
-	var wg sync.WaitGroup
-	wg.Add(threads)
-	for range threads {
-		go func() {
-			for i := range taskChan {
-				info, _ := s.rgeo.Find(points[i][0], points[i][1])
-				res[i] = info.Info
-			}
-			wg.Done()
-		}()
+// multithreadedFind resolves a batch sorted along a Hilbert curve, so the
+// workers walk nearby parts of the cache, see [geocoder.ResolveBatch].
+func (s *server) multithreadedFind(points [][2]float64, threads int, q geocoder.Query) []geomodel.Info {
+	found := geocoder.ResolveBatch(points, threads, func(lat, lon float64) (geocoder.InfoModel, bool) {
+		return s.find(context.Background(), lat, lon, q)
+	})
+	res := make([]geomodel.Info, len(found))
+	for i, info := range found {
+		res[i] = info.Info
 	}
-	wg.Wait()
 	return res
 }
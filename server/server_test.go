@@ -139,7 +139,7 @@ func TestMultithreadedFind(t *testing.T) {
 	t.Run("empty input", func(t *testing.T) {
 		rgeo := buildTestGeoCoder(t, 0)
 		s := &server{rgeo: rgeo}
-		result := s.multithreadedFind(nil, 4)
+		result := s.multithreadedFind(nil, 4, geocoder.Query{})
 		if len(result) != 0 {
 			t.Errorf("expected 0 results, got %d", len(result))
 		}
@@ -149,7 +149,7 @@ func TestMultithreadedFind(t *testing.T) {
 		rgeo := buildTestGeoCoder(t, 1)
 		s := &server{rgeo: rgeo}
 		input := makeInput(t, 1)
-		result := s.multithreadedFind(input, 1)
+		result := s.multithreadedFind(input, 1, geocoder.Query{})
 		if len(result) != 1 {
 			t.Fatalf("expected 1 result, got %d", len(result))
 		}
@@ -166,7 +166,7 @@ func TestMultithreadedFind(t *testing.T) {
 		s := &server{rgeo: rgeo}
 		input := makeInput(t, numPoints)
 
-		result := s.multithreadedFind(input, numThreads)
+		result := s.multithreadedFind(input, numThreads, geocoder.Query{})
 
 		if len(result) != numPoints {
 			t.Fatalf("expected %d results, got %d", numPoints, len(result))
@@ -188,7 +188,7 @@ func TestMultithreadedFind(t *testing.T) {
 		s := &server{rgeo: rgeo}
 		input := makeInput(t, numPoints)
 
-		result := s.multithreadedFind(input, numThreads)
+		result := s.multithreadedFind(input, numThreads, geocoder.Query{})
 
 		if len(result) != numPoints {
 			t.Fatalf("expected %d results, got %d", numPoints, len(result))
@@ -210,7 +210,7 @@ func TestMultithreadedFind(t *testing.T) {
 		s := &server{rgeo: rgeo}
 		input := makeInput(t, numPoints)
 
-		result := s.multithreadedFind(input, numThreads)
+		result := s.multithreadedFind(input, numThreads, geocoder.Query{})
 
 		if len(result) != numPoints {
 			t.Fatalf("expected %d results, got %d", numPoints, len(result))
@@ -233,7 +233,7 @@ func TestMultithreadedFind(t *testing.T) {
 		s := &server{rgeo: rgeo}
 		input := makeInput(t, numPoints)
 
-		result := s.multithreadedFind(input, numThreads)
+		result := s.multithreadedFind(input, numThreads, geocoder.Query{})
 
 		if len(result) != numPoints {
 			t.Fatalf("expected %d results, got %d", numPoints, len(result))
@@ -253,7 +253,7 @@ func TestMultithreadedFind(t *testing.T) {
 		s := &server{rgeo: rgeo}
 		input := makeInput(t, numPoints)
 
-		result := s.multithreadedFind(input, 4)
+		result := s.multithreadedFind(input, 4, geocoder.Query{})
 
 		for i, r := range result {
 			expectedHN := strconv.Itoa(i)
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/royalcat/rgeocache/geocoder"
+	"github.com/valyala/fasthttp"
+)
+
+// Run returns listen errors instead of exiting from the serving goroutine.
+func TestListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	if _, err := listen(t.Context(), busy.Addr().String(), loadOptions(), slog.Default()); err == nil {
+		t.Error("expected a listen error for a busy address")
+	}
+}
+
+func TestShutdownDrain(t *testing.T) {
+	s := &server{startedAt: time.Now()}
+	s.ready.Store(true)
+
+	started := make(chan struct{})
+	srv := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			switch string(ctx.Path()) {
+			case "/readyz":
+				s.ReadyzHandler(ctx)
+			case "/slow":
+				close(started)
+				time.Sleep(300 * time.Millisecond)
+				ctx.Response.SetBodyString("done")
+			}
+		},
+		CloseOnShutdown: true,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	base := "http://" + ln.Addr().String()
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.shutdown(srv, 200*time.Millisecond, time.Second, slog.Default())
+	}()
+
+	// readiness fails while the listener is still open
+	time.Sleep(50 * time.Millisecond)
+	resp, err := http.Get(base + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("readyz while draining: status %d", resp.StatusCode)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Error(err)
+	}
+	if body := <-slow; body != "done" {
+		t.Errorf("request in flight was cut off: %s", body)
+	}
+}
+
+type closingGeocoder struct {
+	geocoder.Geocoder
+	closed atomic.Bool
+}
+
+func (g *closingGeocoder) Close() error {
+	g.closed.Store(true)
+	return nil
+}
+
+// The cache stays mapped while a handler outliving the shutdown timeout reads it.
+func TestShutdownTimeoutKeepsGeocoder(t *testing.T) {
+	rgeo := &closingGeocoder{}
+	s := &server{startedAt: time.Now(), rgeo: rgeo}
+	s.ready.Store(true)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := &fasthttp.Server{
+		Handler: func(ctx *fasthttp.RequestCtx) {
+			close(started)
+			<-release
+			if rgeo.closed.Load() {
+				ctx.Response.SetBodyString("closed")
+				return
+			}
+			ctx.Response.SetBodyString("done")
+		},
+		CloseOnShutdown: true,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-started
+
+	if err := s.shutdownAndClose(srv, 0, 50*time.Millisecond, slog.Default()); err == nil {
+		t.Error("expected a shutdown timeout")
+	}
+	close(release)
+	if body := <-slow; body != "done" {
+		t.Errorf("handler after the timeout: %s", body)
+	}
+	if rgeo.closed.Load() {
+		t.Error("geocoder closed while a handler was running")
+	}
+
+	// a clean shutdown closes it
+	s = &server{startedAt: time.Now(), rgeo: rgeo}
+	idle := &fasthttp.Server{Handler: func(*fasthttp.RequestCtx) {}}
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go idle.Serve(ln)
+	time.Sleep(10 * time.Millisecond)
+	if err := s.shutdownAndClose(idle, 0, time.Second, slog.Default()); err != nil {
+		t.Fatal(err)
+	}
+	if !rgeo.closed.Load() {
+		t.Error("geocoder not closed after a clean shutdown")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"go.opentelemetry.io/contrib/exporters/autoexport"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/propagation"
 	logsdk "go.opentelemetry.io/otel/sdk/log"
 	meticsdk "go.opentelemetry.io/otel/sdk/metric"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
@@ -49,6 +50,7 @@ func setupTelemetry(ctx context.Context) error {
 	}
 	traceProvider := tracesdk.NewTracerProvider(tracesdk.WithBatcher(spanExporter))
 	otel.SetTracerProvider(traceProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
 	logsExporter, err := autoexport.NewLogExporter(ctx)
 	if err != nil {
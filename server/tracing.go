@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/royalcat/rgeocache/server")
+
+// maxTracedBatch is the largest multiaddress batch traced point by point,
+// larger batches get only the request span.
+const maxTracedBatch = 16
+
+// startRequestSpan starts the span of a request, continuing the trace of the
+// client when the request carries a traceparent header.
+func startRequestSpan(ctx *fasthttp.RequestCtx, name string) (context.Context, trace.Span) {
+	parent := otel.GetTextMapPropagator().Extract(ctx, requestHeaderCarrier{&ctx.Request.Header})
+	return tracer.Start(parent, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", string(ctx.Method())),
+			attribute.String("url.path", string(ctx.Path())),
+		),
+	)
+}
+
+func endRequestSpan(ctx *fasthttp.RequestCtx, span trace.Span) {
+	status := ctx.Response.StatusCode()
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// requestHeaderCarrier adapts fasthttp request headers to the otel propagators.
+type requestHeaderCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+var _ propagation.TextMapCarrier = requestHeaderCarrier{}
+
+func (c requestHeaderCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c requestHeaderCarrier) Set(key, value string) {
+	c.header.Set(key, value)
+}
+
+func (c requestHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, c.header.Len())
+	for key := range c.header.All() {
+		keys = append(keys, string(key))
+	}
+	return keys
+}
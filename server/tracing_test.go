@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	s := &server{
+		rgeo:                            buildTestGeoCoder(t, 1),
+		pointsPerThread:                 1000,
+		metricHttpAddressCallCount:      must(meter.Int64Counter("http_address_call_total")),
+		metricHttpAddressMultiCallCount: must(meter.Int64Counter("http_address_multi_call_total")),
+		metricAddressesEncoded:          must(meter.Int64Counter("address_encoded_total")),
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.SetMethod("POST")
+	ctx.Request.SetRequestURI("/rgeocode/multiaddress")
+	ctx.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx.Request.SetBodyString("[[0,0],[0,0]]")
+	s.RGeoMultipleCodeHandler(ctx)
+
+	var request sdktrace.ReadOnlySpan
+	geocoderSpans := 0
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "POST /rgeocode/multiaddress":
+			request = span
+		case "RGeoCoder.Find":
+			geocoderSpans++
+		}
+	}
+	if request == nil {
+		t.Fatal("request span not recorded")
+	}
+	if got := request.Parent().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("request span trace %s, expected the trace of traceparent", got)
+	}
+	if geocoderSpans != 2 {
+		t.Errorf("expected a geocoder span per point of a small batch, got %d", geocoderSpans)
+	}
+}